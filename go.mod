@@ -0,0 +1,3 @@
+module github.com/nurysso/binrex
+
+go 1.24
@@ -0,0 +1,369 @@
+// Package fetch implements the HTTP downloads used for manifests and
+// release artifacts.
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+)
+
+// ErrNetwork matches, with errors.Is, every failure to reach or download
+// from a remote
+var ErrNetwork = errors.New("network error")
+
+// ErrTransient matches, with errors.Is, the network failures that may not
+// happen when tried again: unreachable hosts, timeouts, broken off
+// transfers and server errors, unlike a 404
+var ErrTransient = errors.New("transient network error")
+
+// ErrRateLimited matches, with errors.Is, downloads the host refused with
+// HTTP 429 or a rate limit 403, which another mirror may serve
+var ErrRateLimited = errors.New("rate limited")
+
+// networkError keeps the message of a failed download while matching
+// ErrNetwork, and ErrTransient when it is transient
+type networkError struct {
+	err         error
+	transient   bool
+	rateLimited bool
+}
+
+func (e networkError) Error() string { return e.err.Error() }
+func (e networkError) Unwrap() []error {
+	errs := []error{e.err, ErrNetwork}
+	if e.transient {
+		errs = append(errs, ErrTransient)
+	}
+	if e.rateLimited {
+		errs = append(errs, ErrRateLimited)
+	}
+	return errs
+}
+
+// NetworkError marks err as a failure to reach a remote
+func NetworkError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return networkError{err: err}
+}
+
+// TransientError marks err as a failure to reach a remote that is worth
+// retrying
+func TransientError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return networkError{err: err, transient: true}
+}
+
+// statusError returns the error for an unexpected HTTP status, transient
+// for server errors, timeouts and rate limiting
+func statusError(url string, resp *http.Response) error {
+	code := resp.StatusCode
+	err := fmt.Errorf("failed to download %s: HTTP %d", url, code)
+	if rateLimited(resp) {
+		return networkError{err: fmt.Errorf("%w, rate limited", err), transient: true, rateLimited: true}
+	}
+	if code == http.StatusUnauthorized || code == http.StatusForbidden {
+		err = fmt.Errorf("%w, add a login for it to ~/.netrc or a token to auth_tokens in the config", err)
+	}
+	if code >= 500 || code == http.StatusRequestTimeout {
+		return TransientError(err)
+	}
+	return NetworkError(err)
+}
+
+// rateLimited reports whether a response is a 429, or a 403 that says it
+// is a rate limit like GitHub's
+func rateLimited(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusForbidden:
+		return resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("RateLimit-Remaining") == "0" || resp.Header.Get("Retry-After") != ""
+	}
+	return false
+}
+
+// credentials returns the Authorization header for a request URL, set
+// with SetCredentials
+var credentials atomic.Pointer[func(*url.URL) string]
+
+// SetCredentials makes downloads send the Authorization header fn returns
+// for their URL, when it returns one. Requests that already have one, like
+// those of API, keep it.
+func SetCredentials(fn func(u *url.URL) string) {
+	credentials.Store(&fn)
+}
+
+// authorize adds the credentials for a request's URL
+func authorize(req *http.Request) {
+	fn := credentials.Load()
+	if fn == nil || req.Header.Get("Authorization") != "" {
+		return
+	}
+	if header := (*fn)(req.URL); header != "" {
+		req.Header.Set("Authorization", header)
+	}
+}
+
+// rateLimit caps the read speed of response bodies, 0 is unlimited
+var rateLimit atomic.Int64
+
+// SetRateLimit caps the speed of every download in bytes per second, 0
+// removes the cap
+func SetRateLimit(bytesPerSecond int64) {
+	rateLimit.Store(bytesPerSecond)
+}
+
+// throttledReader sleeps between reads to keep the average speed at rate
+type throttledReader struct {
+	r     io.Reader
+	rate  int64
+	start time.Time
+	read  int64
+}
+
+// limitBody throttles a response body when a rate limit is set
+func limitBody(body io.Reader) io.Reader {
+	rate := rateLimit.Load()
+	if rate <= 0 {
+		return body
+	}
+	return &throttledReader{r: body, rate: rate, start: time.Now()}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	// Small reads keep the pauses short and the speed even
+	if chunk := max(t.rate/8, 1); int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+
+	due := time.Duration(float64(t.read) / float64(t.rate) * float64(time.Second))
+	if wait := due - time.Since(t.start); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
+
+// Get downloads a URL into memory
+func Get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return do(req)
+}
+
+// PostJSON posts a JSON body to url and returns the response body
+func PostJSON(ctx context.Context, url string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return do(req)
+}
+
+// API sends a request to a JSON API authenticated with a bearer token and
+// returns the response body. Any 2xx status is a success, for others the
+// API's error message is part of the error.
+func API(ctx context.Context, method, url, token string, body []byte) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, NetworkError(fmt.Errorf("%s %s: %w", method, url, err))
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, NetworkError(fmt.Errorf("failed to read %s: %w", url, err))
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "" {
+			return nil, fmt.Errorf("%s %s: HTTP %d: %s", method, url, resp.StatusCode, apiErr.Message)
+		}
+		return nil, fmt.Errorf("%s %s: HTTP %d", method, url, resp.StatusCode)
+	}
+	return data, nil
+}
+
+// do sends a request and reads the whole response, non-200 is an error
+func do(req *http.Request) ([]byte, error) {
+	url := req.URL.String()
+	authorize(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, TransientError(fmt.Errorf("failed to download %s: %w", url, err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(url, resp)
+	}
+
+	data, err := io.ReadAll(limitBody(resp.Body))
+	if err != nil {
+		return nil, TransientError(fmt.Errorf("failed to read %s: %w", url, err))
+	}
+
+	return data, nil
+}
+
+// DownloadFile downloads url to dest. Data is written to dest.part first and
+// an interrupted download is resumed with an HTTP Range request on the next
+// attempt instead of starting over. Progress is printed to out.
+func DownloadFile(ctx context.Context, url, dest string, out io.Writer) error {
+	partPath := dest + ".part"
+
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	authorize(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return TransientError(fmt.Errorf("failed to download %s: %w", url, err))
+	}
+	defer resp.Body.Close()
+
+	// startOver drops a partial file that can't be resumed and downloads
+	// the whole body again
+	startOver := func() error {
+		fmt.Fprintf(out, "Partial download of %s doesn't match, starting over\n", url)
+		if err := os.Remove(partPath); err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return DownloadFile(ctx, url, dest, out)
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if contentRange := resp.Header.Get("Content-Range"); !strings.HasPrefix(contentRange, fmt.Sprintf("bytes %d-", offset)) {
+			if offset == 0 {
+				return fmt.Errorf("failed to download %s: unexpected Content-Range %q", url, contentRange)
+			}
+			return startOver()
+		}
+		fmt.Fprintf(out, "Resuming download at %s\n", fsutil.FormatBytes(offset))
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		// Server ignored the range (or there was nothing to resume)
+		offset = 0
+		flags |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file may already hold the whole body, only when its
+		// size is the total the server reports
+		if total, ok := rangeTotal(resp.Header.Get("Content-Range")); ok && total == offset {
+			return os.Rename(partPath, dest)
+		}
+		return startOver()
+	default:
+		return statusError(url, resp)
+	}
+
+	file, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return err
+	}
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	progress := &progressWriter{out: out, done: offset, total: total}
+
+	_, copyErr := io.Copy(file, io.TeeReader(limitBody(resp.Body), progress))
+	closeErr := file.Close()
+	fmt.Fprintln(out)
+
+	if copyErr != nil {
+		return TransientError(fmt.Errorf("download interrupted (run again to resume): %w", copyErr))
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	return os.Rename(partPath, dest)
+}
+
+// rangeTotal returns the complete length in a Content-Range header such
+// as "bytes */1234", false when it is missing or unknown
+func rangeTotal(contentRange string) (int64, bool) {
+	_, total, ok := strings.Cut(contentRange, "/")
+	if !ok || total == "*" {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(total), 10, 64)
+	return n, err == nil
+}
+
+// progressWriter prints download progress as bytes pass through it
+type progressWriter struct {
+	out       io.Writer
+	done      int64
+	total     int64
+	lastPrint time.Time
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+
+	if time.Since(p.lastPrint) > 200*time.Millisecond || p.done == p.total {
+		p.lastPrint = time.Now()
+		if p.total > 0 {
+			fmt.Fprintf(p.out, "\r  Downloading: %s / %s", fsutil.FormatBytes(p.done), fsutil.FormatBytes(p.total))
+		} else {
+			fmt.Fprintf(p.out, "\r  Downloading: %s", fsutil.FormatBytes(p.done))
+		}
+	}
+
+	return len(b), nil
+}
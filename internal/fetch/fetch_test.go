@@ -0,0 +1,96 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const body = "0123456789abcdefghij"
+
+func TestDownloadFileResume(t *testing.T) {
+	tests := []struct {
+		name   string
+		part   string
+		handle func(w http.ResponseWriter, r *http.Request)
+	}{
+		{
+			name: "206 at the offset",
+			part: body[:8],
+			handle: func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Range") != "bytes=8-" {
+					t.Errorf("Range = %q, want bytes=8-", r.Header.Get("Range"))
+				}
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes 8-%d/%d", len(body)-1, len(body)))
+				w.WriteHeader(http.StatusPartialContent)
+				io.WriteString(w, body[8:])
+			},
+		},
+		{
+			name: "206 at another offset",
+			part: "stale",
+			handle: func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Range") == "" {
+					io.WriteString(w, body)
+					return
+				}
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(body)-1, len(body)))
+				w.WriteHeader(http.StatusPartialContent)
+				io.WriteString(w, body)
+			},
+		},
+		{
+			name: "416 with the whole body",
+			part: body,
+			handle: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(body)))
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			},
+		},
+		{
+			name: "416 with a longer part",
+			part: body + "garbage",
+			handle: func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Range") == "" {
+					io.WriteString(w, body)
+					return
+				}
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(body)))
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(test.handle))
+			defer server.Close()
+
+			dest := filepath.Join(t.TempDir(), "file")
+			if err := os.WriteFile(dest+".part", []byte(test.part), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			var out strings.Builder
+			if err := DownloadFile(context.Background(), server.URL, dest, &out); err != nil {
+				t.Fatalf("DownloadFile: %v\n%s", err, out.String())
+			}
+			data, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != body {
+				t.Errorf("downloaded %q, want %q", data, body)
+			}
+			if _, err := os.Stat(dest + ".part"); !os.IsNotExist(err) {
+				t.Errorf("partial file left behind: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// NetrcMachine is the login of one machine in a .netrc file, the default
+// entry has an empty Name
+type NetrcMachine struct {
+	Name     string
+	Login    string
+	Password string
+}
+
+// ParseNetrc parses a .netrc file as curl and ftp read it. Macro
+// definitions are skipped.
+func ParseNetrc(data []byte) []NetrcMachine {
+	var machines []NetrcMachine
+	var current *NetrcMachine
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	inMacro := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		// A macro runs until the next empty line
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for n := 0; n < len(fields); n++ {
+			value := ""
+			if n+1 < len(fields) {
+				value = fields[n+1]
+			}
+			switch fields[n] {
+			case "machine":
+				machines = append(machines, NetrcMachine{Name: value})
+				current = &machines[len(machines)-1]
+				n++
+			case "default":
+				machines = append(machines, NetrcMachine{})
+				current = &machines[len(machines)-1]
+			case "login":
+				if current != nil {
+					current.Login = value
+				}
+				n++
+			case "password":
+				if current != nil {
+					current.Password = value
+				}
+				n++
+			case "account":
+				n++
+			case "macdef":
+				inMacro = true
+				n = len(fields)
+			}
+		}
+	}
+	return machines
+}
+
+// FindNetrc returns the login for host, falling back to the default
+// entry, nil when there is neither
+func FindNetrc(machines []NetrcMachine, host string) *NetrcMachine {
+	var fallback *NetrcMachine
+	for n := range machines {
+		switch machines[n].Name {
+		case host:
+			return &machines[n]
+		case "":
+			if fallback == nil {
+				fallback = &machines[n]
+			}
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,160 @@
+// Package i18n translates binrex's user-facing messages. Messages are
+// looked up by their English format string, so a message without a
+// translation prints as it always did.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//go:embed locales/*.json
+var builtin embed.FS
+
+// Catalog maps English format strings to their translations
+type Catalog map[string]string
+
+// current is the catalog T translates with, nil for English
+var current Catalog
+
+// plain makes T return untranslated ASCII messages, see SetPlain
+var plain bool
+
+// symbols are the non-ASCII marks messages use and what plain output
+// prints instead. A mark already followed by "Warning:" is dropped.
+var symbols = strings.NewReplacer("✓", "ok", "✗", "fail", "•", "-", "→", "->", "⚠ Warning:", "Warning:", "⚠", "warning:", "★", "*")
+
+// Detect returns the locale messages should use: language when set, e.g.
+// from the config, otherwise LC_ALL, LC_MESSAGES and LANG in that order
+func Detect(language string) string {
+	if language != "" {
+		return language
+	}
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// candidates returns the catalog names tried for a locale, most specific
+// first: "pt_BR.UTF-8" tries pt_BR, then pt
+func candidates(locale string) []string {
+	locale, _, _ = strings.Cut(locale, ".")
+	locale, _, _ = strings.Cut(locale, "@")
+	locale = strings.ReplaceAll(locale, "-", "_")
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return nil
+	}
+
+	names := []string{locale}
+	if lang, _, ok := strings.Cut(locale, "_"); ok {
+		names = append(names, lang)
+	}
+	return names
+}
+
+// SetLocale switches to the catalog of a locale. Catalogs in userDir,
+// named like the built-in ones (e.g. "de.json"), add to or replace their
+// messages, so translations can be written without rebuilding binrex.
+// Unknown locales fall back to English.
+func SetLocale(locale, userDir string) error {
+	current = nil
+	for _, name := range candidates(locale) {
+		catalog, err := loadCatalog(name, userDir)
+		if err != nil {
+			return err
+		}
+		if catalog != nil {
+			current = catalog
+			return nil
+		}
+	}
+	return nil
+}
+
+// loadCatalog merges the built-in and user catalogs of one locale, nil
+// when neither exists
+func loadCatalog(name, userDir string) (Catalog, error) {
+	var catalog Catalog
+	if data, err := builtin.ReadFile("locales/" + name + ".json"); err == nil {
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			return nil, fmt.Errorf("built-in catalog %s: %w", name, err)
+		}
+	}
+
+	if userDir == "" {
+		return catalog, nil
+	}
+	path := filepath.Join(userDir, name+".json")
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return catalog, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var user Catalog
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if catalog == nil {
+		catalog = make(Catalog)
+	}
+	for msg, translation := range user {
+		catalog[msg] = translation
+	}
+	return catalog, nil
+}
+
+// SetPlain turns plain output on or off. Plain messages are never
+// translated and use ASCII words for symbols such as ✓, so scripts and
+// screen readers get the same output in every locale and version.
+func SetPlain(on bool) {
+	plain = on
+}
+
+// ASCII replaces the symbols of s with their plain words
+func ASCII(s string) string {
+	return symbols.Replace(s)
+}
+
+// plainWriter applies ASCII to everything written through it
+type plainWriter struct {
+	w io.Writer
+}
+
+func (p plainWriter) Write(b []byte) (int, error) {
+	if _, err := io.WriteString(p.w, ASCII(string(b))); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// PlainWriter returns w with ASCII applied to the output
+func PlainWriter(w io.Writer) io.Writer {
+	return plainWriter{w}
+}
+
+// T translates a message and formats it with args like fmt.Sprintf
+func T(msg string, args ...any) string {
+	if plain {
+		if len(args) > 0 {
+			msg = fmt.Sprintf(msg, args...)
+		}
+		return ASCII(msg)
+	}
+	if translation, ok := current[msg]; ok && translation != "" {
+		msg = translation
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
@@ -3,964 +3,3324 @@
 package main
 
 import (
-	"encoding/json"
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/template"
 	"time"
-)
 
-// Constants
-const (
-	RepoURL = "https://github.com/nurysso/binrex"
+	"github.com/nurysso/binrex/internal/fsutil"
+	"github.com/nurysso/binrex/internal/i18n"
+	"github.com/nurysso/binrex/pkg/config"
+	"github.com/nurysso/binrex/pkg/daemon"
+	"github.com/nurysso/binrex/pkg/installer"
+	"github.com/nurysso/binrex/pkg/manifest"
+	"github.com/nurysso/binrex/pkg/state"
 )
 
-// Package represents a package in the manifest
-type Package struct {
-	Name          string   `json:"name"`
-	RepoURL       string   `json:"repo_url"`
-	SourceDir     string   `json:"source_dir"`   // Where to run build commands (where Cargo.toml/Makefile is)
-	BinPath       string   `json:"bin_path"`     // Optional: explicit path to binaries after build
-	BinaryNames   []string `json:"binary_names"` // List of binary names to install
-	Version       string   `json:"version"`
-	Description   string   `json:"description"`
-	Keywords      []string `json:"keywords"`
-	OSSupported   string   `json:"os_supported"`
-	RequiredTools string   `json:"required_tools"`
-	BuildCommands string   `json:"build_commands"`
-	InstallSize   string   `json:"install_size"`
-}
+// version is the binrex release
+const version = "0.1.6"
 
-// InstalledPackage represents an installed package
-type InstalledPackage struct {
-	Name          string   `json:"name"`
-	Version       string   `json:"version"`
-	BinaryPaths   []string `json:"binary_paths"`
-	RepoPath      string   `json:"repo_path"`
-	InstallDate   string   `json:"install_date"`
-	TotalBinaries int      `json:"total_binaries"`
-}
+// dryRun makes mutating commands print what they would do instead
+var dryRun bool
 
-// Manifest represents the manifest.json structure
-type Manifest struct {
-	Packages []Package `json:"packages"`
-}
+// assumeYes answers yes to every confirmation prompt
+var assumeYes bool
 
-// InstalledData represents installed.json structure
-type InstalledData struct {
-	Installed []InstalledPackage `json:"installed"`
-}
+// profile is the installation profile selected with --profile
+var profile string
 
-// Binary represents a found binary file
-type Binary struct {
-	Name string
-	Path string
-}
+// buildJobs is the --build-jobs override, 0 when not given
+var buildJobs int
 
-// Global paths
-var (
-	configDir     string
-	cacheDir      string
-	binDir        string
-	manifestPath  string
-	installedPath string
-)
+// limitRate is the --limit-rate override, e.g. "500k"
+var limitRate string
 
-// initPaths initializes all directory paths
-func initPaths() error {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("could not determine HOME directory: %w", err)
-	}
+// containerBuilds runs builds inside the packages' build images
+var containerBuilds bool
 
-	configDir = filepath.Join(home, ".config", "binrex")
-	cacheDir = filepath.Join(home, ".cache", "binrex", "repos")
-	binDir = filepath.Join(home, ".local", "bin")
-	manifestPath = filepath.Join(configDir, "manifest.json")
-	installedPath = filepath.Join(configDir, "installed.json")
+// remoteBuild is the --remote-build SSH host, empty when not given
+var remoteBuild string
 
-	return nil
-}
+// sandbox is the --sandbox tool, empty when not given
+var sandbox string
 
-// getOSName returns the current OS name
-func getOSName() string {
-	return strings.ToLower(runtime.GOOS)
-}
+// noNetworkBuild builds without network after fetching dependencies
+var noNetworkBuild bool
 
-// createDirectories creates necessary directories
-func createDirectories() error {
-	dirs := []string{configDir, cacheDir, binDir}
+// porcelain selects the stable ASCII output of --porcelain
+var porcelain bool
 
-	for _, dir := range dirs {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("error creating %s: %w", dir, err)
-		}
-	}
+// system installs for every user into /usr/local with --system
+var system bool
 
-	// Create empty installed.json if it doesn't exist
-	if !fileExists(installedPath) {
-		emptyData := InstalledData{Installed: []InstalledPackage{}}
-		data, _ := json.MarshalIndent(emptyData, "", "  ")
-		os.WriteFile(installedPath, data, 0644)
-	}
+// configPath, manifestPath and statePath are the --config, --manifest and
+// --state overrides, empty when not given
+var configPath, manifestPath, statePath string
 
-	return nil
-}
+// inst is the installer every command works through
+var inst *installer.Installer
 
-// fileExists checks if a file exists
-func fileExists(path string) bool {
-	_, err := os.Stat(path)
-	return err == nil
+// isInteractive reports whether stdin is attached to a terminal
+func isInteractive() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
 }
 
-// runCommand runs a shell command and prints output
-func runCommand(cmd string) error {
-	command := exec.Command("sh", "-c", cmd)
-	command.Stdout = os.Stdout
-	command.Stderr = os.Stderr
-	return command.Run()
-}
+// promptYesNo asks a yes/no question. When stdin is not a terminal the
+// default answer is returned without prompting.
+func promptYesNo(question string, defaultYes bool) bool {
+	if assumeYes {
+		return true
+	}
+	if !isInteractive() {
+		return defaultYes
+	}
+
+	hint := i18n.T("[y/N]")
+	if defaultYes {
+		hint = i18n.T("[Y/n]")
+	}
+	fmt.Printf("%s %s ", question, hint)
+
+	var answer string
+	fmt.Scanln(&answer)
+	answer = strings.ToLower(strings.TrimSpace(answer))
 
-// runCommandSilent runs a command silently
-func runCommandSilent(cmd string) error {
-	command := exec.Command("sh", "-c", cmd)
-	return command.Run()
+	if answer == "" {
+		return defaultYes
+	}
+	// English answers work whatever the language
+	return answer == "y" || answer == "yes" || answer == strings.ToLower(i18n.T("y")) || answer == strings.ToLower(i18n.T("yes"))
 }
 
-// checkToolExists checks if a tool is available
-func checkToolExists(tool string) bool {
-	cmd := fmt.Sprintf("which %s > /dev/null 2>&1", tool)
-	return runCommandSilent(cmd) == nil
+// printError prints an error the way every command reports one
+func printError(err error) {
+	fmt.Fprint(os.Stderr, i18n.T("Error: %v\n", err))
 }
 
-// checkRequiredTools checks if all required tools are available
-func checkRequiredTools(tools string) bool {
-	if tools == "" {
+// confirmAction asks before a destructive or large operation. Unlike
+// promptYesNo it defaults to no, and refuses outright when there is no
+// terminal to ask on unless --yes was given.
+func confirmAction(question string) bool {
+	if assumeYes || dryRun {
 		return true
 	}
+	if !isInteractive() {
+		fmt.Fprintln(os.Stderr, i18n.T("Error: Confirmation required, re-run with --yes to proceed non-interactively"))
+		return false
+	}
+	return promptYesNo(question, false)
+}
 
-	toolsList := strings.Split(tools, ",")
-	allFound := true
-
-	fmt.Println("Checking required tools...")
-	for _, tool := range toolsList {
-		tool = strings.TrimSpace(tool)
-		if tool == "" {
-			continue
+// parseSelection parses a selection like "1 3 5-7" into 0-based indexes,
+// checking them against n choices
+func parseSelection(input string, n int) ([]int, error) {
+	var picked []int
+	for _, field := range strings.FieldsFunc(input, func(r rune) bool { return r == ' ' || r == ',' }) {
+		from, to, isRange := strings.Cut(field, "-")
+		if !isRange {
+			to = from
 		}
-
-		if checkToolExists(tool) {
-			fmt.Printf("  ✓ %s found\n", tool)
-		} else {
-			fmt.Printf("  ✗ %s NOT FOUND\n", tool)
-			allFound = false
+		a, errA := strconv.Atoi(from)
+		b, errB := strconv.Atoi(to)
+		if errA != nil || errB != nil || a < 1 || b > n || a > b {
+			return nil, fmt.Errorf("invalid selection %q", field)
+		}
+		for i := a; i <= b; i++ {
+			picked = append(picked, i-1)
 		}
 	}
-
-	return allFound
+	return picked, nil
 }
 
-// getCurrentDate returns current date in YYYY-MM-DD format
-func getCurrentDate() string {
-	return time.Now().Format("2006-01-02")
-}
+// selectPackages shows a checkbox list of the manifest packages matching
+// query that can be installed here, and returns the ones the user picks
+func selectPackages(query string) ([]string, error) {
+	if !isInteractive() {
+		return nil, fmt.Errorf("--interactive needs a terminal")
+	}
 
-// loadManifest loads the manifest.json file
-func loadManifest() (*Manifest, error) {
-	data, err := os.ReadFile(manifestPath)
+	results, err := inst.Search(manifest.SearchOptions{Query: query, OS: installer.GetOSName()})
+	if err == installer.ErrManifestNotFound {
+		printManifestMissing()
+		return nil, err
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	var manifest Manifest
-	if err := json.Unmarshal(data, &manifest); err != nil {
-		return nil, err
+	var choices []manifest.Package
+	for _, pkg := range results {
+		if !inst.State.IsInstalled(pkg.Name) {
+			choices = append(choices, pkg)
+		}
+	}
+	if len(choices) == 0 {
+		fmt.Println(i18n.T("No packages to install."))
+		return nil, nil
 	}
 
-	return &manifest, nil
-}
+	selected := make([]bool, len(choices))
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Println()
+		for n, pkg := range choices {
+			mark := " "
+			if selected[n] {
+				mark = "x"
+			}
+			fmt.Printf("  %2d [%s] %-20s %s\n", n+1, mark, pkg.Name, pkg.Description)
+		}
+		fmt.Print(i18n.T("\nToggle packages (e.g. 1 3 5-7), a = all, Enter = install, q = quit: "))
 
-// loadInstalled loads the installed.json file
-func loadInstalled() (*InstalledData, error) {
-	data, err := os.ReadFile(installedPath)
-	if err != nil {
-		return &InstalledData{Installed: []InstalledPackage{}}, nil
-	}
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			return nil, installer.ErrAborted
+		}
 
-	var installed InstalledData
-	if err := json.Unmarshal(data, &installed); err != nil {
-		return &InstalledData{Installed: []InstalledPackage{}}, nil
+		switch input := strings.ToLower(strings.TrimSpace(line)); input {
+		case "":
+			var names []string
+			for n, pkg := range choices {
+				if selected[n] {
+					names = append(names, pkg.Name)
+				}
+			}
+			return names, nil
+		case "q":
+			return nil, installer.ErrAborted
+		case "a":
+			for n := range selected {
+				selected[n] = true
+			}
+		default:
+			picked, err := parseSelection(input, len(choices))
+			if err != nil {
+				printError(err)
+				continue
+			}
+			for _, n := range picked {
+				selected[n] = !selected[n]
+			}
+		}
 	}
-
-	return &installed, nil
 }
 
-// saveInstalled saves the installed.json file
-func saveInstalled(data *InstalledData) error {
-	jsonData, err := json.MarshalIndent(data, "", "  ")
-	if err != nil {
-		return err
+// confirm is the installer's Confirm callback
+func confirm(question string, defaultYes bool) bool {
+	if defaultYes {
+		return promptYesNo(question, true)
 	}
-
-	return os.WriteFile(installedPath, jsonData, 0644)
+	return confirmAction(question)
 }
 
-// findPackage finds a package in the manifest by name
-func findPackage(name string) (*Package, error) {
-	manifest, err := loadManifest()
-	if err != nil {
-		return nil, err
+// confirmRemoval shows what removing (or with purge, purging) a package
+// deletes and asks to proceed
+func confirmRemoval(name string, purge bool) bool {
+	pkg := inst.State.Get(name)
+	if pkg == nil {
+		// Remove reports the error
+		return true
 	}
 
-	for _, pkg := range manifest.Packages {
-		if pkg.Name == name {
-			return &pkg, nil
+	if !purge {
+		fmt.Print(i18n.T("Package %s (v%s) will be removed:\n", pkg.Name, pkg.Version))
+		for _, bp := range pkg.BinaryPaths {
+			fmt.Printf("  - %s\n", bp)
 		}
+		return confirmAction(i18n.T("Remove package?"))
 	}
 
-	return nil, fmt.Errorf("package '%s' not found", name)
+	fmt.Print(i18n.T("Package %s (v%s) will be purged:\n", pkg.Name, pkg.Version))
+	for _, path := range append(append([]string{}, pkg.BinaryPaths...), inst.PurgePaths(name)...) {
+		fmt.Printf("  - %s\n", path)
+	}
+	return confirmAction(i18n.T("Purge package?"))
 }
 
-// isPackageInstalled checks if a package is already installed
-func isPackageInstalled(name string) bool {
-	installedData, _ := loadInstalled()
-	for _, pkg := range installedData.Installed {
-		if pkg.Name == name {
-			return true
+// removalNames returns the packages remove and purge act on: every
+// installed package for --all, otherwise the names given with glob
+// patterns expanded
+func removalNames(args []string) ([]string, error) {
+	if len(args) == 1 && (args[0] == "--all" || args[0] == "-a") {
+		installedData, err := inst.State.Load()
+		if err != nil {
+			return nil, err
 		}
+		var names []string
+		for _, pkg := range installedData.Installed {
+			names = append(names, pkg.Name)
+		}
+		return names, nil
 	}
-	return false
-}
 
-// getRepoNameFromURL extracts repository name from GitHub URL
-func getRepoNameFromURL(url string) string {
-	url = strings.TrimRight(url, "/")
-	if strings.HasSuffix(url, ".git") {
-		url = url[:len(url)-4]
+	names, err := packageNames(args)
+	if err != nil {
+		return nil, err
 	}
-
-	parts := strings.Split(url, "/")
-	return parts[len(parts)-1]
-}
-
-// getRepoCachePath returns the cache directory path for a repository
-func getRepoCachePath(repoURL string) string {
-	repoName := getRepoNameFromURL(repoURL)
-	return filepath.Join(cacheDir, repoName)
+	return inst.MatchInstalled(names)
 }
 
-// cloneOrUpdateRepo clones or updates a repository
-func cloneOrUpdateRepo(repoURL string) (string, error) {
-	repoPath := getRepoCachePath(repoURL)
+// confirmBatchRemoval lists several packages about to be removed and asks
+// once for all of them
+func confirmBatchRemoval(names []string, purge bool) bool {
+	header, question := i18n.T("%d packages will be removed:\n", len(names)), i18n.T("Remove %d packages?", len(names))
+	if purge {
+		header, question = i18n.T("%d packages will be purged:\n", len(names)), i18n.T("Purge %d packages?", len(names))
+	}
 
-	if !fileExists(repoPath) {
-		fmt.Printf("\nCloning repository from %s...\n", repoURL)
-		cmd := fmt.Sprintf("git clone %s %s", repoURL, repoPath)
-		if err := runCommand(cmd); err != nil {
-			return "", fmt.Errorf("failed to clone repository: %w", err)
+	fmt.Print(header)
+	for _, name := range names {
+		if pkg := inst.State.Get(name); pkg != nil {
+			fmt.Printf("  - %s (v%s)\n", pkg.Name, pkg.Version)
+		} else {
+			fmt.Print(i18n.T("  - %s (not installed)\n", name))
 		}
-	} else {
-		fmt.Printf("\nUpdating repository at %s...\n", repoPath)
-		cmd := fmt.Sprintf("cd %s && git pull", repoPath)
-		runCommand(cmd)
 	}
-
-	return repoPath, nil
+	return confirmAction(question)
 }
 
-// findBinariesInPath finds all binary files in the specified path
-func findBinariesInPath(searchPath string, expectedNames []string) []Binary {
-	var binaries []Binary
-	foundMap := make(map[string]Binary)
+// printManifestMissing prints the hint shown when no manifest is synced
+func printManifestMissing() {
+	fmt.Fprintln(os.Stderr, i18n.T("Error: manifest.json not found"))
+	fmt.Fprintln(os.Stderr, i18n.T("Run 'binrex sync' first"))
+}
 
-	if !fileExists(searchPath) {
-		return binaries
+// showPackageInfo shows manifest details and install status of a package
+func showPackageInfo(name string) error {
+	pkg, err := inst.FindPackage(name)
+	if err == installer.ErrManifestNotFound {
+		printManifestMissing()
+		return err
 	}
-
-	entries, err := os.ReadDir(searchPath)
 	if err != nil {
-		return binaries
+		fmt.Fprint(os.Stderr, i18n.T("Error: Package '%s' not found in manifest\n", name))
+		return err
 	}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
+	pkg.PrintInfo(os.Stdout)
 
-		itemPath := filepath.Join(searchPath, entry.Name())
-		info, err := entry.Info()
-		if err != nil {
-			continue
+	if installed := inst.State.Get(name); installed != nil {
+		fmt.Print(i18n.T("Installed: v%s (%s)\n", installed.Version, installed.InstallDate))
+		if installed.Commit != "" {
+			fmt.Print(i18n.T("Commit: %s\n", installed.Commit))
 		}
-
-		isExecutable := info.Mode()&0111 != 0
-
-		if isExecutable {
-			// Skip common build artifacts
-			skipPatterns := []string{".d", ".rlib", ".so", ".a", ".o", ".dylib", ".dll"}
-			skip := false
-			for _, pattern := range skipPatterns {
-				if strings.HasSuffix(entry.Name(), pattern) {
-					skip = true
-					break
-				}
-			}
-			if skip {
-				continue
-			}
-
-			// Skip hidden files and build scripts
-			if strings.HasPrefix(entry.Name(), ".") {
-				continue
+		if p := installed.Provenance; p != nil {
+			fmt.Print(i18n.T("Built: on %s/%s in %.1fs with: %s\n", p.OS, p.Arch, p.BuildSeconds, p.BuildCommand))
+			if p.BuildImage != "" {
+				fmt.Print(i18n.T("Build image: %s\n", p.BuildImage))
 			}
-
-			// If expected names are specified, only include those
-			if len(expectedNames) > 0 {
-				if contains(expectedNames, entry.Name()) {
-					if _, exists := foundMap[entry.Name()]; !exists {
-						foundMap[entry.Name()] = Binary{
-							Name: entry.Name(),
-							Path: itemPath,
-						}
-					}
-				}
-			} else {
-				// No expected names, include all executables
-				if _, exists := foundMap[entry.Name()]; !exists {
-					foundMap[entry.Name()] = Binary{
-						Name: entry.Name(),
-						Path: itemPath,
-					}
-				}
+			if p.SignedBy != "" {
+				fmt.Print(i18n.T("Verified signature: %s\n", p.SignedBy))
 			}
 		}
+	} else {
+		fmt.Println(i18n.T("Installed: no"))
 	}
 
-	// Convert map to slice
-	for _, binary := range foundMap {
-		binaries = append(binaries, binary)
-	}
-
-	return binaries
+	return nil
 }
 
-// findBuiltBinaries finds binaries after build
-func findBuiltBinaries(repoPath string, pkg *Package) ([]Binary, error) {
-	var binaries []Binary
-
-	// If explicit bin_path is provided, search there
-	if pkg.BinPath != "" {
-		searchPath := filepath.Join(repoPath, pkg.BinPath)
-		fmt.Printf("Searching for binaries in: %s\n", searchPath)
-		binaries = findBinariesInPath(searchPath, pkg.BinaryNames)
-
-		if len(binaries) > 0 {
-			return binaries, nil
-		}
+// showTree prints the dependency trees of packages, or of everything
+// installed without names
+func showTree(names []string) error {
+	trees, err := inst.DependencyTree(names)
+	if err == installer.ErrManifestNotFound {
+		printManifestMissing()
+		return err
 	}
-
-	// Otherwise, search in common build output directories
-	buildDir := repoPath
-	if pkg.SourceDir != "" {
-		buildDir = filepath.Join(repoPath, pkg.SourceDir)
+	if err != nil {
+		printError(err)
+		return err
 	}
-
-	searchPaths := []string{
-		filepath.Join(buildDir, "target", "release"),
-		filepath.Join(buildDir, "target", "debug"),
-		filepath.Join(buildDir, "build"),
-		filepath.Join(buildDir, "build", "bin"),
-		filepath.Join(buildDir, "bin"),
-		filepath.Join(buildDir, "dist"),
-		buildDir,
+	if len(trees) == 0 {
+		fmt.Println(i18n.T("No packages installed"))
+		return nil
 	}
 
-	fmt.Println("Searching for built binaries...")
-	for _, searchPath := range searchPaths {
-		found := findBinariesInPath(searchPath, pkg.BinaryNames)
-		if len(found) > 0 {
-			fmt.Printf("Found binaries in: %s\n", searchPath)
-			binaries = append(binaries, found...)
-
-			// If we found all expected binaries, stop searching
-			if len(pkg.BinaryNames) > 0 && len(binaries) >= len(pkg.BinaryNames) {
-				break
-			}
+	var show func(node *installer.DepNode, depth int)
+	show = func(node *installer.DepNode, depth int) {
+		line := strings.Repeat("  ", depth) + node.Name
+		switch {
+		case node.Cycle:
+			line += i18n.T(" (cycle)")
+		case node.Orphan:
+			line += i18n.T(" (orphan, not in the manifest)")
+		case !node.Installed:
+			line += i18n.T(" (not installed)")
+		}
+		fmt.Println(line)
+		for _, dep := range node.Deps {
+			show(dep, depth+1)
 		}
 	}
-
-	if len(binaries) == 0 {
-		return nil, fmt.Errorf("no binaries found after build")
+	for _, tree := range trees {
+		show(tree, 0)
 	}
-
-	return binaries, nil
+	return nil
 }
 
-// contains checks if a slice contains a string
-func contains(slice []string, item string) bool {
-	for _, s := range slice {
-		if s == item {
-			return true
+// writeFormatted prints items one per line with a Go template, as CSV
+// with the given columns when format is "csv", or as tab-separated columns
+// without a header for "porcelain"
+func writeFormatted[T any](format string, items []T, header []string, row func(T) []string) error {
+	if format == "porcelain" {
+		writePorcelain(items, row)
+		return nil
+	}
+	if format == "csv" {
+		w := csv.NewWriter(os.Stdout)
+		w.Write(header)
+		for _, item := range items {
+			w.Write(row(item))
 		}
+		w.Flush()
+		return w.Error()
 	}
-	return false
-}
-
-// syncManifest syncs the manifest from GitHub
-func syncManifest() error {
-	fmt.Println("Syncing manifest from GitHub...")
 
-	manifestURL := fmt.Sprintf("%s/raw/main/manifest.json", RepoURL)
-
-	resp, err := http.Get(manifestURL)
+	tmpl, err := template.New("format").Funcs(template.FuncMap{"join": strings.Join}).Parse(format)
 	if err != nil {
-		return fmt.Errorf("failed to download manifest: %w", err)
+		return fmt.Errorf("invalid format: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download manifest: HTTP %d", resp.StatusCode)
+	for _, item := range items {
+		if err := tmpl.Execute(os.Stdout, item); err != nil {
+			return fmt.Errorf("invalid format: %w", err)
+		}
+		fmt.Println()
 	}
+	return nil
+}
 
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read manifest: %w", err)
+// writePorcelain prints the columns of each item separated by tabs, with
+// tabs and newlines inside values replaced by spaces. Columns are only
+// ever added at the end, so scripts can rely on their positions.
+func writePorcelain[T any](items []T, row func(T) []string) {
+	clean := strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+	for _, item := range items {
+		fields := row(item)
+		for n := range fields {
+			fields[n] = clean.Replace(fields[n])
+		}
+		fmt.Println(strings.Join(fields, "\t"))
 	}
+}
 
-	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to save manifest: %w", err)
+// formatFlag pulls --format out of args, returning it and the rest
+func formatFlag(args []string) (string, []string, error) {
+	var format string
+	var rest []string
+	for n := 0; n < len(args); n++ {
+		switch {
+		case args[n] == "--format":
+			if n+1 >= len(args) {
+				return "", nil, fmt.Errorf("--format requires a value")
+			}
+			format = args[n+1]
+			n++
+		case strings.HasPrefix(args[n], "--format="):
+			format = strings.TrimPrefix(args[n], "--format=")
+		default:
+			rest = append(rest, args[n])
+		}
 	}
-
-	fmt.Println("✓ Manifest synced successfully!")
-	return nil
+	return format, rest, nil
 }
 
-// installPackage installs a package
-func installPackage(name string) error {
-	fmt.Printf("Installing package: %s\n", name)
-
-	// Check if manifest exists
-	if !fileExists(manifestPath) {
-		fmt.Fprintf(os.Stderr, "Error: manifest.json not found at %s\n", manifestPath)
-		fmt.Fprintln(os.Stderr, "Run 'binrex sync' to download the manifest.")
-		return fmt.Errorf("manifest not found")
+// listPackages lists all installed packages, with a template or as CSV
+// when format is set
+func listPackages(format string) error {
+	if format == "" && porcelain {
+		format = "porcelain"
+	}
+	if format != "" {
+		installedData, err := inst.State.Load()
+		if err != nil {
+			return err
+		}
+		header := []string{"name", "version", "install_date", "binaries", "commit", "repo_path"}
+		return writeFormatted(format, installedData.Installed, header, func(p state.InstalledPackage) []string {
+			return []string{p.Name, p.Version, p.InstallDate, strings.Join(p.BinaryPaths, " "), p.Commit, p.RepoPath}
+		})
 	}
 
-	// Find package in manifest
-	pkg, err := findPackage(name)
+	installedData, err := inst.State.Load()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Package '%s' not found in manifest\n", name)
 		return err
 	}
 
-	// Display package info
-	fmt.Printf("\nPackage: %s\n", pkg.Name)
-	fmt.Printf("Version: %s\n", pkg.Version)
-	fmt.Printf("Description: %s\n", pkg.Description)
-	fmt.Printf("Repository: %s\n", pkg.RepoURL)
-	fmt.Printf("OS: %s\n", pkg.OSSupported)
-	if pkg.RequiredTools != "" {
-		fmt.Printf("Required tools: %s\n", pkg.RequiredTools)
-	}
-	if len(pkg.BinaryNames) > 0 {
-		fmt.Printf("Binaries: %s\n", strings.Join(pkg.BinaryNames, ", "))
-	}
-	if len(pkg.Keywords) > 0 {
-		fmt.Printf("Keywords: %s\n", strings.Join(pkg.Keywords, ", "))
-	}
-	fmt.Println()
+	fmt.Println(i18n.T("Installed packages:"))
+	fmt.Println(strings.Repeat("-", 60))
 
-	// Check OS compatibility
-	currentOS := getOSName()
-	if !strings.Contains(pkg.OSSupported, currentOS) && pkg.OSSupported != "all" {
-		fmt.Fprintf(os.Stderr, "Error: Package not supported on %s\n", currentOS)
-		fmt.Fprintf(os.Stderr, "Supported OS: %s\n", pkg.OSSupported)
-		return fmt.Errorf("unsupported OS")
-	}
+	if len(installedData.Installed) == 0 {
+		fmt.Println(i18n.T("  (none)"))
+	} else {
+		for _, pkg := range installedData.Installed {
+			fmt.Print(i18n.T("\n  • %s (v%s)\n", pkg.Name, pkg.Version))
+			fmt.Print(i18n.T("    Binaries: %d\n", pkg.TotalBinaries))
+			fmt.Print(i18n.T("    Installed: %s\n", pkg.InstallDate))
+			fmt.Print(i18n.T("    Repo: %s\n", pkg.RepoPath))
+			if pkg.DevPath != "" {
+				fmt.Print(i18n.T("    Linked to: %s (dev link)\n", pkg.DevPath))
+			}
 
-	// Check required tools
-	if pkg.RequiredTools != "" && !checkRequiredTools(pkg.RequiredTools) {
-		fmt.Fprintln(os.Stderr, "\nError: Missing required tools!")
-		fmt.Fprintln(os.Stderr, "Please install the required tools using your system package manager.")
-		return fmt.Errorf("missing required tools")
+			if len(pkg.BinaryPaths) > 0 {
+				fmt.Println(i18n.T("    Binary paths:"))
+				for _, bp := range pkg.BinaryPaths {
+					fmt.Printf("      - %s\n", bp)
+				}
+			}
+		}
 	}
 
-	// Check if already installed
-	if isPackageInstalled(name) {
-		fmt.Printf("Package '%s' is already installed. Use 'update' to update it.\n", name)
-		return nil
-	}
+	fmt.Print(i18n.T("\nTotal: %d package(s)\n", len(installedData.Installed)))
+	return nil
+}
 
-	// Clone or update the package's repository
-	repoPath, err := cloneOrUpdateRepo(pkg.RepoURL)
-	if err != nil {
-		return err
+// vendorPackages archives the sources of the given installed packages, or
+// of all of them, into outDir
+func vendorPackages(ctx context.Context, names []string, all bool, outDir string) error {
+	if all {
+		installedData, err := inst.State.Load()
+		if err != nil {
+			return err
+		}
+		names = nil
+		for _, pkg := range installedData.Installed {
+			names = append(names, pkg.Name)
+		}
 	}
-
-	// Determine where to run build commands
-	buildPath := repoPath
-	if pkg.SourceDir != "" {
-		buildPath = filepath.Join(repoPath, pkg.SourceDir)
+	if len(names) == 0 {
+		return fmt.Errorf("package name required")
 	}
 
-	if !fileExists(buildPath) {
-		return fmt.Errorf("source directory not found: %s", buildPath)
+	failed := 0
+	for _, name := range names {
+		archive, err := inst.Vendor(ctx, name, outDir)
+		if err != nil {
+			fmt.Fprint(os.Stderr, i18n.T("✗ %s: %v\n", name, err))
+			failed++
+			continue
+		}
+		if !dryRun {
+			fmt.Print(i18n.T("✓ %s -> %s\n", name, archive))
+		}
 	}
 
-	// Clean before building (if cargo project)
-	if strings.Contains(pkg.BuildCommands, "cargo") {
-		fmt.Println("Cleaning previous build...")
-		cleanCmd := fmt.Sprintf("cd %s && cargo clean", buildPath)
-		runCommandSilent(cleanCmd)
+	if failed > 0 {
+		return fmt.Errorf("%d package(s) could not be vendored", failed)
 	}
+	return nil
+}
 
-	// Build
-	fmt.Println("Building package...")
-	buildCmd := fmt.Sprintf("cd %s && %s", buildPath, pkg.BuildCommands)
-	if err := runCommand(buildCmd); err != nil {
-		fmt.Fprintln(os.Stderr, "Error: Build failed")
-		return err
+// verifyPackage checks that a package's binaries are in place, and with
+// rebuild that a clean build from the recorded commit reproduces them
+func verifyPackage(ctx context.Context, name string, rebuild bool) (bool, error) {
+	pkg := inst.State.Get(name)
+	if pkg == nil {
+		return false, fmt.Errorf("package '%s' is not installed", name)
 	}
 
-	// Find built binaries
-	binaries, err := findBuiltBinaries(repoPath, pkg)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		return err
+	if !rebuild {
+		ok := true
+		for _, bp := range pkg.BinaryPaths {
+			if _, err := os.Stat(bp); err != nil {
+				fmt.Print(i18n.T("  ✗ %s missing\n", bp))
+				ok = false
+				continue
+			}
+			if pkg.Provenance != nil {
+				if want := pkg.Provenance.SHA256[filepath.Base(bp)]; want != "" {
+					if got, _ := fsutil.SHA256File(installer.WrappedBinary(bp)); got != want {
+						fmt.Print(i18n.T("  ✗ %s modified since install\n", bp))
+						ok = false
+						continue
+					}
+				}
+			}
+			fmt.Print(i18n.T("  ✓ %s\n", bp))
+		}
+		return ok, nil
 	}
 
-	fmt.Printf("\nFound %d binary file(s):\n", len(binaries))
-	for _, binary := range binaries {
-		fmt.Printf("  - %s at %s\n", binary.Name, binary.Path)
+	checks, err := inst.VerifyRebuild(ctx, name)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Print(i18n.T("\nComparing %s with the installed binaries:\n", name))
+	ok := true
+	for _, check := range checks {
+		switch {
+		case check.Match():
+			fmt.Print(i18n.T("  ✓ %s %s\n", check.Name, check.InstalledSHA256))
+		case check.RebuiltSHA256 == "":
+			fmt.Print(i18n.T("  ✗ %s was not produced by the rebuild\n", check.Name))
+			ok = false
+		default:
+			fmt.Print(i18n.T("  ✗ %s MISMATCH\n", check.Name))
+			fmt.Print(i18n.T("      installed: %s\n", check.InstalledSHA256))
+			fmt.Print(i18n.T("      rebuilt:   %s\n", check.RebuiltSHA256))
+			ok = false
+		}
 	}
+	return ok, nil
+}
 
-	// Install binaries to ~/.local/bin
-	fmt.Printf("\nInstalling binaries to %s...\n", binDir)
-	var installedBinaries []string
-
-	for _, binary := range binaries {
-		src := binary.Path
-		dst := filepath.Join(binDir, binary.Name)
+// audit prints known vulnerabilities of installed packages and returns
+// the highest severity rank found
+func audit(ctx context.Context, names []string) (int, error) {
+	fmt.Println(i18n.T("Checking installed packages against OSV..."))
+	fmt.Println(strings.Repeat("-", 60))
 
-		if !fileExists(src) {
-			fmt.Fprintf(os.Stderr, "ERROR: Source file does not exist: %s\n", src)
-			continue
-		}
+	results, err := inst.Audit(ctx, names)
+	if err != nil {
+		return 0, err
+	}
 
-		// Copy file
-		if err := copyFile(src, dst); err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: Failed to install %s: %v\n", binary.Name, err)
+	highest, total, affected := -1, 0, 0
+	for _, result := range results {
+		if len(result.Vulnerabilities) == 0 {
+			fmt.Print(i18n.T("  ✓ %s (v%s): no known vulnerabilities\n", result.Package, result.Version))
 			continue
 		}
 
-		// Make executable
-		if err := os.Chmod(dst, 0755); err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: Failed to make %s executable: %v\n", binary.Name, err)
+		affected++
+		total += len(result.Vulnerabilities)
+		fmt.Print(i18n.T("  ✗ %s (v%s): %d known vulnerabilit(ies)\n", result.Package, result.Version, len(result.Vulnerabilities)))
+		for _, vuln := range result.Vulnerabilities {
+			severity := vuln.Severity
+			if vuln.Score > 0 {
+				severity = fmt.Sprintf("%s %.1f", vuln.Severity, vuln.Score)
+			}
+			fmt.Printf("      %s [%s] %s\n", vuln.ID, severity, vuln.Summary)
+			fmt.Printf("        %s\n", vuln.URL)
+			highest = max(highest, installer.SeverityRank(vuln.Severity))
 		}
-
-		installedBinaries = append(installedBinaries, dst)
-		fmt.Printf("  ✓ Installed: %s\n", dst)
 	}
 
-	if len(installedBinaries) == 0 {
-		return fmt.Errorf("no binaries were installed")
+	if total == 0 {
+		fmt.Print(i18n.T("\n✓ No known vulnerabilities in %d package(s)\n", len(results)))
+	} else {
+		fmt.Print(i18n.T("\nFound %d vulnerabilit(ies) in %d package(s)\n", total, affected))
 	}
+	return highest, nil
+}
 
-	// Update installed.json
-	installedData, _ := loadInstalled()
+// showLicenses prints the licenses of installed packages, as an SPDX
+// document when asJSON is set
+func showLicenses(asJSON bool) error {
+	infos, err := inst.Licenses()
+	if err != nil {
+		return err
+	}
 
-	newEntry := InstalledPackage{
-		Name:          name,
-		Version:       pkg.Version,
-		BinaryPaths:   installedBinaries,
-		RepoPath:      repoPath,
-		InstallDate:   getCurrentDate(),
-		TotalBinaries: len(installedBinaries),
+	if asJSON {
+		return installer.WriteSPDX(os.Stdout, infos, "binrex-"+version)
 	}
 
-	installedData.Installed = append(installedData.Installed, newEntry)
+	fmt.Println(i18n.T("Licenses of installed packages:"))
+	fmt.Println(strings.Repeat("-", 60))
 
-	if err := saveInstalled(installedData); err != nil {
-		fmt.Fprintln(os.Stderr, "Warning: Failed to update installed.json")
+	if len(infos) == 0 {
+		fmt.Println(i18n.T("  (none)"))
 	}
-
-	fmt.Printf("\n✓ Successfully installed %s!\n", name)
-	fmt.Printf("  Version: %s\n", pkg.Version)
-	fmt.Printf("  Binaries installed: %d\n", len(installedBinaries))
-	for _, binary := range installedBinaries {
-		fmt.Printf("    - %s\n", binary)
+	for _, info := range infos {
+		fmt.Print(i18n.T("\n  • %s (v%s): %s\n", info.Package, info.Version, info.License()))
+		if info.Declared != "" && info.Detected != "" && info.Declared != info.Detected {
+			fmt.Print(i18n.T("    ⚠ Manifest says %s, license file looks like %s\n", info.Declared, info.Detected))
+		}
+		if info.LicenseFile != "" {
+			fmt.Print(i18n.T("    License file: %s\n", info.LicenseFile))
+		}
+		if info.RepoURL != "" {
+			fmt.Print(i18n.T("    Source: %s\n", info.RepoURL))
+		}
 	}
 
+	fmt.Print(i18n.T("\nTotal: %d package(s)\n", len(infos)))
 	return nil
 }
 
-// installAll installs all packages from manifest
-func installAll() error {
-	fmt.Println("Installing all packages from manifest...")
-
-	if !fileExists(manifestPath) {
-		fmt.Fprintf(os.Stderr, "Error: manifest.json not found at %s\n", manifestPath)
-		fmt.Fprintln(os.Stderr, "Run 'binrex sync' to download the manifest.")
-		return fmt.Errorf("manifest not found")
-	}
+var (
+	mdImage  = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLink   = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`)
+	mdBold   = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	mdCode   = regexp.MustCompile("`([^`]+)`")
+	htmlLine = regexp.MustCompile(`^\s*</?[a-zA-Z][^>]*>\s*$`)
+)
 
-	manifest, err := loadManifest()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to load manifest: %v\n", err)
-		return err
+// renderMarkdown turns markdown into readable terminal text, with ANSI
+// styling when color is set
+func renderMarkdown(text string, color bool) string {
+	style := func(code, s string) string {
+		if !color {
+			return s
+		}
+		return "\x1b[" + code + "m" + s + "\x1b[0m"
 	}
 
-	// Filter packages to install
-	var toInstall []Package
-	currentOS := getOSName()
+	var out strings.Builder
+	inCode := false
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
 
-	for _, pkg := range manifest.Packages {
-		// Skip if already installed
-		if isPackageInstalled(pkg.Name) {
-			fmt.Printf("Skipping %s (already installed)\n", pkg.Name)
+		if strings.HasPrefix(trimmed, "```") {
+			inCode = !inCode
 			continue
 		}
-
-		// Skip if OS not supported
-		if !strings.Contains(pkg.OSSupported, currentOS) && pkg.OSSupported != "all" {
-			fmt.Printf("Skipping %s (not supported on %s)\n", pkg.Name, currentOS)
+		if inCode {
+			out.WriteString("    " + style("2", line) + "\n")
 			continue
 		}
-
-		// Check required tools
-		if pkg.RequiredTools != "" && !checkRequiredTools(pkg.RequiredTools) {
-			fmt.Printf("Skipping %s (missing required tools: %s)\n", pkg.Name, pkg.RequiredTools)
+		if htmlLine.MatchString(line) {
 			continue
 		}
 
-		toInstall = append(toInstall, pkg)
+		line = mdImage.ReplaceAllString(line, "[image: $1]")
+		line = mdLink.ReplaceAllString(line, "$1 ($2)")
+		line = mdBold.ReplaceAllString(line, style("1", "$1"))
+		line = mdCode.ReplaceAllString(line, style("36", "$1"))
+		// Headings and bullets keep their markers through the replacements
+		text := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "#"):
+			heading := strings.TrimSpace(strings.TrimLeft(text, "#"))
+			out.WriteString(style("1;4", heading) + "\n")
+		case strings.HasPrefix(trimmed, "- "), strings.HasPrefix(trimmed, "* "):
+			indent := line[:len(line)-len(strings.TrimLeft(line, " "))]
+			out.WriteString(indent + "  • " + strings.TrimSpace(text[2:]) + "\n")
+		default:
+			out.WriteString(line + "\n")
+		}
 	}
+	return out.String()
+}
 
-	if len(toInstall) == 0 {
-		fmt.Println("No packages to install.")
-		return nil
+// showReadme renders a package's README, through a pager on a terminal
+func showReadme(name string) error {
+	path, err := inst.ReadmePath(name)
+	if err != nil {
+		return err
 	}
-
-	fmt.Printf("\nFound %d package(s) to install:\n", len(toInstall))
-	for _, pkg := range toInstall {
-		fmt.Printf("  - %s (%s)\n", pkg.Name, pkg.Version)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
 	}
-	fmt.Println()
-
-	// Install each package
-	successCount := 0
-	failCount := 0
 
-	for i, pkg := range toInstall {
-		fmt.Printf("\n[%d/%d] Installing %s...\n", i+1, len(toInstall), pkg.Name)
-		fmt.Println(strings.Repeat("=", 60))
+	info, _ := os.Stdout.Stat()
+	tty := info != nil && info.Mode()&os.ModeCharDevice != 0 && !porcelain
 
-		if err := installPackage(pkg.Name); err != nil {
-			fmt.Fprintf(os.Stderr, "✗ Failed to install %s: %v\n", pkg.Name, err)
-			failCount++
-		} else {
-			successCount++
-		}
+	text := string(data)
+	if strings.EqualFold(filepath.Ext(path), ".md") && !porcelain {
+		text = renderMarkdown(text, tty)
 	}
+	page(text, tty)
+	return nil
+}
 
-	// Summary
-	fmt.Println("\n" + strings.Repeat("=", 60))
-	fmt.Println("Installation Summary:")
-	fmt.Printf("  ✓ Successfully installed: %d\n", successCount)
-	if failCount > 0 {
-		fmt.Printf("  ✗ Failed: %d\n", failCount)
+// showBuildLog shows the most recent build log of a package
+func showBuildLog(name string) error {
+	path, err := inst.LatestBuildLog(name)
+	if err != nil {
+		return err
 	}
-
-	if failCount > 0 {
-		return fmt.Errorf("some packages failed to install")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
 	}
 
+	info, _ := os.Stdout.Stat()
+	page(string(data), info != nil && info.Mode()&os.ModeCharDevice != 0)
 	return nil
 }
 
-// copyFile copies a file from src to dst
-func copyFile(src, dst string) error {
-	sourceFile, err := os.Open(src)
-	if err != nil {
-		return err
+// page shows text through $PAGER when stdout is a terminal
+func page(text string, tty bool) {
+	if !tty {
+		fmt.Print(text)
+		return
 	}
-	defer sourceFile.Close()
 
-	destFile, err := os.Create(dst)
-	if err != nil {
-		return err
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less -R"
 	}
-	defer destFile.Close()
+	command := exec.Command("sh", "-c", pager)
+	command.Stdin = strings.NewReader(text)
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+	if err := command.Run(); err != nil {
+		fmt.Print(text)
+	}
+}
 
-	if _, err := io.Copy(destFile, sourceFile); err != nil {
+// browse lists the manifest's categories, or the packages in one
+func browse(category string) error {
+	m, err := inst.LoadManifest()
+	if err == installer.ErrManifestNotFound {
+		printManifestMissing()
 		return err
 	}
-
-	// Copy permissions
-	srcInfo, err := os.Stat(src)
 	if err != nil {
 		return err
 	}
 
-	return os.Chmod(dst, srcInfo.Mode())
-}
-
-// removePackage removes an installed package
-func removePackage(name string) error {
-	fmt.Printf("Removing package: %s\n", name)
-
-	installedData, _ := loadInstalled()
-	var pkgToRemove *InstalledPackage
-	var remainingPackages []InstalledPackage
+	categories := m.Categories()
+	if category == "" {
+		names := make([]string, 0, len(categories))
+		for name := range categories {
+			names = append(names, name)
+		}
+		sort.Strings(names)
 
-	for i, pkg := range installedData.Installed {
-		if pkg.Name == name {
-			pkgToRemove = &installedData.Installed[i]
-		} else {
-			remainingPackages = append(remainingPackages, pkg)
+		fmt.Println(i18n.T("Categories:"))
+		fmt.Println(strings.Repeat("-", 60))
+		for _, name := range names {
+			fmt.Print(i18n.T("  %-30s %d package(s)\n", name, len(categories[name])))
 		}
+		fmt.Print(i18n.T("\nRun 'binrex browse <category>' to list its packages.\n"))
+		return nil
 	}
 
-	if pkgToRemove == nil {
-		fmt.Fprintf(os.Stderr, "Package '%s' is not installed\n", name)
-		return fmt.Errorf("package not installed")
+	packages, ok := categories[strings.ToLower(category)]
+	if !ok {
+		return fmt.Errorf("no packages in category '%s'", category)
 	}
 
-	// Remove all binaries
-	removedCount := 0
-	for _, binaryPath := range pkgToRemove.BinaryPaths {
-		if fileExists(binaryPath) {
-			if err := os.Remove(binaryPath); err != nil {
-				fmt.Fprintf(os.Stderr, "Error removing binary %s: %v\n", binaryPath, err)
-			} else {
-				fmt.Printf("  ✓ Removed binary: %s\n", binaryPath)
-				removedCount++
-			}
-		} else {
-			fmt.Printf("  Binary not found: %s\n", binaryPath)
+	fmt.Print(i18n.T("Packages in %s:\n", strings.ToLower(category)))
+	fmt.Println(strings.Repeat("-", 60))
+	for _, pkg := range packages {
+		fmt.Print(i18n.T("\n  • %s", pkg.Name))
+		if pkg.Description != "" {
+			fmt.Printf(" - %s", pkg.Description)
+		}
+		if pkg.Version != "" {
+			fmt.Printf(" (v%s)", pkg.Version)
 		}
+		fmt.Println()
 	}
+	fmt.Print(i18n.T("\nTotal: %d package(s)\n", len(packages)))
+	return nil
+}
 
-	// Update installed.json
-	installedData.Installed = remainingPackages
-	if err := saveInstalled(installedData); err != nil {
-		fmt.Fprintln(os.Stderr, "Warning: Failed to update installed.json")
+// searchPackages searches for packages in the manifest and prints them,
+// with long printing the full package details and format a template or
+// csv. installed keeps only installed ("yes") or not installed ("no")
+// packages when set.
+func searchPackages(opts manifest.SearchOptions, installed string, long bool, format string) error {
+	found, err := inst.Search(opts)
+	if err == installer.ErrManifestNotFound {
+		printManifestMissing()
+		return err
+	}
+	if err != nil {
+		fmt.Fprint(os.Stderr, i18n.T("Error loading manifest: %v\n", err))
+		return err
 	}
 
-	fmt.Printf("\n✓ Package '%s' removed successfully.\n", name)
-	fmt.Printf("  Binaries removed: %d/%d\n", removedCount, len(pkgToRemove.BinaryPaths))
+	var results []manifest.Package
+	for _, pkg := range found {
+		if installed == "" || inst.State.IsInstalled(pkg.Name) == (installed == "yes") {
+			results = append(results, pkg)
+		}
+	}
 
-	return nil
-}
+	if format == "" && porcelain {
+		format = "porcelain"
+	}
+	if format != "" {
+		header := []string{"name", "version", "description", "keywords", "license", "os_supported", "required_tools", "repo_url"}
+		err := writeFormatted(format, results, header, func(p manifest.Package) []string {
+			return []string{p.Name, p.Version, p.Description, strings.Join(p.Keywords, " "), p.License, p.OSSupported, p.RequiredTools, p.RepoURL}
+		})
+		if err != nil {
+			printError(err)
+		}
+		return err
+	}
 
-// listPackages lists all installed packages
-func listPackages() {
-	fmt.Println("Installed packages:")
+	fmt.Print(i18n.T("Searching for: %s\n", opts.Query))
+	if opts.License != "" {
+		fmt.Print(i18n.T("License: %s\n", opts.License))
+	}
 	fmt.Println(strings.Repeat("-", 60))
 
-	installedData, _ := loadInstalled()
+	for _, pkg := range results {
+		if long {
+			fmt.Println()
+			pkg.PrintInfo(os.Stdout)
+			continue
+		}
 
-	if len(installedData.Installed) == 0 {
-		fmt.Println("  (none)")
-	} else {
-		for _, pkg := range installedData.Installed {
-			fmt.Printf("\n  • %s (v%s)\n", pkg.Name, pkg.Version)
-			fmt.Printf("    Binaries: %d\n", pkg.TotalBinaries)
-			fmt.Printf("    Installed: %s\n", pkg.InstallDate)
-			fmt.Printf("    Repo: %s\n", pkg.RepoPath)
+		fmt.Print(i18n.T("\n  • %s", pkg.Name))
+		if pkg.Description != "" {
+			fmt.Printf(" - %s", pkg.Description)
+		}
+		if pkg.Version != "" {
+			fmt.Printf(" (v%s)", pkg.Version)
+		}
+		fmt.Println()
 
-			if len(pkg.BinaryPaths) > 0 {
-				fmt.Println("    Binary paths:")
-				for _, bp := range pkg.BinaryPaths {
-					fmt.Printf("      - %s\n", bp)
-				}
-			}
+		if len(pkg.Keywords) > 0 {
+			fmt.Print(i18n.T("    Keywords: %s\n", strings.Join(pkg.Keywords, ", ")))
 		}
 	}
 
-	fmt.Printf("\nTotal: %d package(s)\n", len(installedData.Installed))
+	if len(results) == 0 {
+		fmt.Println(i18n.T("  (none found)"))
+	}
+
+	fmt.Print(i18n.T("\nFound: %d package(s)\n", len(results)))
+	return nil
 }
 
-// updatePackage updates an installed package
-func updatePackage(name string) error {
-	fmt.Printf("Updating package: %s\n", name)
+// sendNotification shows a desktop notification using the platform tool
+func sendNotification(title, message string) error {
+	switch installer.GetOSName() {
+	case "darwin":
+		script := fmt.Sprintf("display notification %q with title %q", message, title)
+		return exec.Command("osascript", "-e", script).Run()
+	default:
+		if !installer.CheckToolExists("notify-send") {
+			return fmt.Errorf("notify-send not found")
+		}
+		return exec.Command("notify-send", "--app-name=binrex", title, message).Run()
+	}
+}
 
-	if !isPackageInstalled(name) {
-		fmt.Fprintf(os.Stderr, "Package '%s' is not installed. Installing new...\n", name)
-		return installPackage(name)
+// checkUpdates reports installed packages that have updates available.
+// With notify set the manifest is synced quietly first and the result is
+// sent as a desktop notification, which makes it suitable for cron/timers.
+func checkUpdates(ctx context.Context, notify bool) error {
+	if notify {
+		if err := inst.Sync(ctx, installer.SyncOptions{Quiet: true}); err != nil {
+			fmt.Fprint(os.Stderr, i18n.T("Warning: %v\n", err))
+		}
 	}
 
-	// Get package info from manifest
-	manifestPkg, err := findPackage(name)
+	outdated, err := inst.Outdated()
+	if err == installer.ErrManifestNotFound {
+		printManifestMissing()
+		return err
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Package '%s' not found in manifest\n", name)
+		fmt.Fprint(os.Stderr, i18n.T("Error loading manifest: %v\n", err))
 		return err
 	}
 
-	// Remove old version
-	fmt.Println("Removing old version...")
-	if err := removePackage(name); err != nil {
+	if len(outdated) == 0 {
+		if !notify {
+			fmt.Println(i18n.T("All packages are up to date."))
+		}
+		return nil
+	}
+
+	var lines []string
+	for _, pkg := range outdated {
+		lines = append(lines, fmt.Sprintf("%s %s → %s", pkg.Name, pkg.InstalledVersion, pkg.LatestVersion))
+	}
+
+	if notify {
+		title := fmt.Sprintf("binrex: %d update(s) available", len(outdated))
+		if err := sendNotification(title, strings.Join(lines, "\n")); err != nil {
+			fmt.Fprint(os.Stderr, i18n.T("Warning: Failed to send notification: %v\n", err))
+		}
+	}
+
+	fmt.Print(i18n.T("Updates available: %d\n", len(outdated)))
+	for _, line := range lines {
+		fmt.Print(i18n.T("  • %s\n", line))
+	}
+
+	return nil
+}
+
+// checkStatus prints installed vs available versions of every installed
+// package without changing anything, and reports whether any is outdated
+func checkStatus(ctx context.Context, commits, quiet bool) (bool, error) {
+	statuses, err := inst.Status(ctx, commits)
+	if err == installer.ErrManifestNotFound {
+		printManifestMissing()
+		return false, err
+	}
+	if err != nil {
+		printError(err)
+		return false, err
+	}
+
+	outdated := 0
+	for _, status := range statuses {
+		if status.Outdated {
+			outdated++
+		}
+	}
+	if quiet {
+		return outdated > 0, nil
+	}
+
+	if porcelain {
+		writePorcelain(statuses, func(s installer.PackageStatus) []string {
+			result := "ok"
+			if s.Outdated {
+				result = "outdated"
+			}
+			return []string{s.Name, result, s.InstalledVersion, s.AvailableVersion, s.InstalledCommit, s.AvailableCommit}
+		})
+		return outdated > 0, nil
+	}
+
+	if len(statuses) == 0 {
+		fmt.Println(i18n.T("No packages installed."))
+		return false, nil
+	}
+
+	for _, status := range statuses {
+		mark := i18n.T("✓")
+		if status.Outdated {
+			mark = i18n.T("✗")
+		}
+
+		available := status.AvailableVersion
+		if available == "" {
+			available = "-"
+		}
+		fmt.Printf("  %s %-20s %-12s %s\n", mark, status.Name, status.InstalledVersion, available)
+
+		if commits && status.InstalledCommit != status.AvailableCommit {
+			fmt.Print(i18n.T("      commit %s → %s\n", installer.ShortCommit(status.InstalledCommit), installer.ShortCommit(status.AvailableCommit)))
+		}
+	}
+
+	if outdated == 0 {
+		fmt.Println(i18n.T("\nAll packages are up to date."))
+	} else {
+		fmt.Print(i18n.T("\n%d of %d package(s) outdated\n", outdated, len(statuses)))
+	}
+	return outdated > 0, nil
+}
+
+// parseInterval parses a watch interval, accepting "d" for days on top of
+// Go durations
+func parseInterval(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid interval %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval %q", s)
+	}
+	return d, nil
+}
+
+// watchOnce runs one watch pass: sync, then notify about or upgrade the
+// outdated packages depending on watch_action
+func watchOnce(ctx context.Context) error {
+	unlock, err := inst.Lock()
+	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	// Update repository
-	repoPath := getRepoCachePath(manifestPkg.RepoURL)
-	if fileExists(repoPath) {
-		cmd := fmt.Sprintf("cd %s && git pull", repoPath)
-		fmt.Println("\nPulling latest changes...")
-		runCommand(cmd)
+	fmt.Print(i18n.T("[%s] Checking for updates...\n", time.Now().Format("2006-01-02 15:04:05")))
+	if inst.Config.GetWatchAction() != "upgrade" {
+		return checkUpdates(ctx, true)
 	}
 
-	// Install new version
-	fmt.Println("\nInstalling updated version...")
-	return installPackage(name)
+	if err := inst.Sync(ctx, installer.SyncOptions{Quiet: true}); err != nil {
+		fmt.Fprint(os.Stderr, i18n.T("Warning: %v\n", err))
+	}
+	return inst.Upgrade(ctx, nil)
 }
 
-// searchPackages searches for packages in the manifest
-func searchPackages(keyword string) {
-	fmt.Printf("Searching for: %s\n", keyword)
-	fmt.Println(strings.Repeat("-", 60))
+// watch runs watchOnce every interval until ctx is cancelled
+func watch(ctx context.Context, interval time.Duration) error {
+	fmt.Print(i18n.T("Watching for updates every %s (action: %s)\n", interval, inst.Config.GetWatchAction()))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	if !fileExists(manifestPath) {
-		fmt.Fprintln(os.Stderr, "Error: manifest.json not found")
-		fmt.Fprintln(os.Stderr, "Run 'binrex sync' first")
-		return
+	for {
+		if err := watchOnce(ctx); err != nil {
+			fmt.Fprint(os.Stderr, i18n.T("Warning: %v\n", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
 	}
+}
 
-	manifest, err := loadManifest()
+// installWatchTimer writes a systemd user service and timer that run
+// "binrex watch --once" every interval, then enables the timer
+func installWatchTimer(interval time.Duration) error {
+	exe, err := os.Executable()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading manifest: %v\n", err)
-		return
+		return fmt.Errorf("could not determine the binrex executable: %w", err)
 	}
 
-	keywordLower := strings.ToLower(keyword)
-	count := 0
+	args := ""
+	if profile != "" {
+		args = " --profile " + profile
+	}
+	service := fmt.Sprintf(`[Unit]
+Description=binrex update check
 
-	for _, pkg := range manifest.Packages {
-		searchText := strings.ToLower(fmt.Sprintf("%s %s %s",
-			pkg.Name, pkg.Description, strings.Join(pkg.Keywords, " ")))
+[Service]
+Type=oneshot
+ExecStart=%s%s watch --once
+`, exe, args)
+	timer := fmt.Sprintf(`[Unit]
+Description=Run binrex update check every %s
 
-		if strings.Contains(searchText, keywordLower) {
-			fmt.Printf("\n  • %s", pkg.Name)
-			if pkg.Description != "" {
-				fmt.Printf(" - %s", pkg.Description)
-			}
-			if pkg.Version != "" {
-				fmt.Printf(" (v%s)", pkg.Version)
-			}
-			fmt.Println()
+[Timer]
+OnBootSec=5min
+OnUnitActiveSec=%ds
+Persistent=true
 
-			if len(pkg.Keywords) > 0 {
-				fmt.Printf("    Keywords: %s\n", strings.Join(pkg.Keywords, ", "))
-			}
-			count++
+[Install]
+WantedBy=timers.target
+`, interval, int(interval.Seconds()))
+
+	dir := inst.Paths.SystemdUserDir
+	files := map[string]string{
+		filepath.Join(dir, "binrex-watch.service"): service,
+		filepath.Join(dir, "binrex-watch.timer"):   timer,
+	}
+
+	if dryRun {
+		fmt.Println(i18n.T("[dry-run] Planned actions:"))
+		for path := range files {
+			fmt.Print(i18n.T("  Would write: %s\n", path))
 		}
+		fmt.Println(i18n.T("  Would run: systemctl --user enable --now binrex-watch.timer"))
+		return nil
 	}
 
-	if count == 0 {
-		fmt.Println("  (none found)")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating %s: %w", dir, err)
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		fmt.Print(i18n.T("✓ Wrote %s\n", path))
 	}
 
-	fmt.Printf("\nFound: %d package(s)\n", count)
+	if !installer.CheckToolExists("systemctl") {
+		fmt.Println(i18n.T("systemctl not found, enable binrex-watch.timer with your service manager"))
+		return nil
+	}
+	for _, args := range [][]string{{"--user", "daemon-reload"}, {"--user", "enable", "--now", "binrex-watch.timer"}} {
+		command := exec.Command("systemctl", args...)
+		command.Stdout = os.Stdout
+		command.Stderr = os.Stderr
+		if err := command.Run(); err != nil {
+			return fmt.Errorf("systemctl %s failed: %w", strings.Join(args, " "), err)
+		}
+	}
+	fmt.Println(i18n.T("✓ Enabled binrex-watch.timer"))
+	return nil
 }
 
-// printUsage prints usage information
-func printUsage(prog string) {
-	fmt.Println("Binrex - Simple Binary Package Manager\n")
-	fmt.Printf("Usage: %s <command> [arguments]\n\n", prog)
-	fmt.Println("Commands:")
-	fmt.Println("  sync              - Sync manifest from GitHub")
-	fmt.Println("  install <name>    - Install a package")
-	fmt.Println("  install --all     - Install all packages in manifest")
-	fmt.Println("  remove <name>     - Remove a package")
-	fmt.Println("  list              - List installed packages")
-	fmt.Println("  update <name>     - Update a package")
-	fmt.Println("  search <query>    - Search for packages")
-	fmt.Println("  version           - Show version")
-	fmt.Println("  help              - Show this help")
+// showOwner prints which installed package owns a binary
+func showOwner(binary string) error {
+	pkg, path := inst.Owner(binary)
+	if pkg == nil {
+		fmt.Fprint(os.Stderr, i18n.T("%s is not owned by any installed package\n", path))
+		if _, err := os.Stat(path); err != nil {
+			fmt.Fprintln(os.Stderr, i18n.T("(file does not exist)"))
+		}
+		return fmt.Errorf("no owner found")
+	}
+
+	fmt.Print(i18n.T("%s is owned by %s (v%s)\n", path, pkg.Name, pkg.Version))
+	if pkg.Unmanaged {
+		fmt.Print(i18n.T("  Source: %s (unmanaged)\n", pkg.RepoURL))
+	}
+	fmt.Print(i18n.T("  Installed: %s\n", pkg.InstallDate))
+	return nil
 }
 
-func main() {
-	exitCode := run()
-	os.Exit(exitCode)
+// adoptBinary records a binary installed by hand as a package
+func adoptBinary(ctx context.Context, args []string) error {
+	var path string
+	var opts installer.AdoptOptions
+	for n := 0; n < len(args); n++ {
+		switch arg := args[n]; arg {
+		case "--name", "--version", "--repo", "--build-cmd", "--build-dir":
+			if n+1 >= len(args) {
+				return fmt.Errorf("%s requires a value", arg)
+			}
+			n++
+			switch arg {
+			case "--name":
+				opts.Name = args[n]
+			case "--version":
+				opts.Version = args[n]
+			case "--repo":
+				opts.RepoURL = args[n]
+			case "--build-cmd":
+				opts.BuildCommand = args[n]
+			case "--build-dir":
+				opts.BuildDir = args[n]
+			}
+		default:
+			if strings.HasPrefix(arg, "-") || path != "" {
+				return fmt.Errorf("unexpected argument: %s", arg)
+			}
+			path = arg
+		}
+	}
+	if path == "" {
+		return fmt.Errorf("path of the binary required")
+	}
+	// A bare name means the binary on PATH
+	if !strings.ContainsRune(path, filepath.Separator) {
+		if found, err := exec.LookPath(path); err == nil {
+			path = found
+		}
+	}
+
+	pkg, err := inst.Adopt(ctx, path, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Print(i18n.T("✓ Adopted %s as %s %s\n", pkg.BinaryPaths[0], pkg.Name, pkg.Version))
+	if pkg.RepoURL != "" {
+		fmt.Print(i18n.T("  Run 'binrex update %s' to rebuild it from %s\n", pkg.Name, pkg.RepoURL))
+	}
+	return nil
 }
 
-func run() int {
-	if len(os.Args) < 2 {
-		printUsage(os.Args[0])
-		return 1
+// fetchRepos clones or updates the repos of the named packages, or of all
+// with --all, without building them
+func fetchRepos(ctx context.Context, args []string) error {
+	jobs := 4
+	all := false
+	var names []string
+	for n := 0; n < len(args); n++ {
+		switch arg := args[n]; {
+		case arg == "--all":
+			all = true
+		case arg == "--jobs" && n+1 < len(args):
+			j, err := strconv.Atoi(args[n+1])
+			if err != nil || j < 1 {
+				return fmt.Errorf("--jobs must be a positive number")
+			}
+			jobs = j
+			n++
+		case strings.HasPrefix(arg, "-"):
+			return fmt.Errorf("unknown option: %s", arg)
+		default:
+			names = append(names, arg)
+		}
+	}
+	if all == (len(names) > 0) {
+		return fmt.Errorf("package names or --all required")
 	}
 
-	if err := initPaths(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		return 1
+	results, err := inst.Fetch(ctx, names, jobs)
+	if len(results) > 0 {
+		failed := 0
+		for _, result := range results {
+			if result.Err != nil {
+				failed++
+			}
+		}
+		fmt.Print(i18n.T("\nFetched %d of %d repositories into %s\n", len(results)-failed, len(results), inst.Paths.CacheDir))
 	}
+	return err
+}
 
-	if err := createDirectories(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		return 1
+// discover lists the GitHub repos with a topic and drafts manifest entries
+// for the ones the manifest lacks, writing them to manifest.d or printing
+// them
+func discover(ctx context.Context, args []string) error {
+	limit := 30
+	write, printJSON := false, false
+	var topic string
+	for n := 0; n < len(args); n++ {
+		switch arg := args[n]; {
+		case arg == "--limit" && n+1 < len(args):
+			l, err := strconv.Atoi(args[n+1])
+			if err != nil || l < 1 || l > 100 {
+				return fmt.Errorf("--limit must be between 1 and 100")
+			}
+			limit = l
+			n++
+		case arg == "--write":
+			write = true
+		case arg == "--print":
+			printJSON = true
+		case strings.HasPrefix(arg, "-"):
+			return fmt.Errorf("unknown option: %s", arg)
+		case topic == "":
+			topic = arg
+		default:
+			return fmt.Errorf("discover takes one topic")
+		}
+	}
+	if topic == "" {
+		return fmt.Errorf("topic required")
 	}
 
-	cmd := os.Args[1]
+	repos, err := inst.Discover(ctx, topic, limit)
+	if err != nil {
+		return err
+	}
 
-	switch cmd {
-	case "sync":
-		if err := syncManifest(); err != nil {
-			return 1
+	var fresh []installer.DiscoveredRepo
+	for _, repo := range repos {
+		if repo.Package == "" {
+			fresh = append(fresh, repo)
 		}
-		return 0
-	case "version":
-		fmt.Println("0.1.6")
-	case "install":
-		if len(os.Args) < 3 {
-			fmt.Fprintln(os.Stderr, "Error: package name required")
-			return 1
+	}
+
+	if printJSON {
+		var entries []manifest.Package
+		for _, repo := range fresh {
+			entries = append(entries, inst.CandidateEntry(ctx, repo))
 		}
-		if os.Args[2] == "-a" {
-			installAll()
+		data, err := installer.CandidateManifest(entries)
+		if err != nil {
+			return err
 		}
-		if err := installPackage(os.Args[2]); err != nil {
-			return 1
+		os.Stdout.Write(data)
+		return nil
+	}
+
+	if porcelain {
+		writePorcelain(repos, func(r installer.DiscoveredRepo) []string {
+			return []string{r.FullName, r.Package, strconv.Itoa(r.Stars), r.Language, r.URL, r.Description}
+		})
+	} else {
+		fmt.Print(i18n.T("Repositories with topic %s:\n", topic))
+		for _, repo := range repos {
+			status := i18n.T("new")
+			if repo.Package != "" {
+				status = i18n.T("in manifest as %s", repo.Package)
+			}
+			fmt.Print(i18n.T("  • %-35s ★ %-6d %s\n", repo.FullName, repo.Stars, status))
+			if repo.Description != "" {
+				fmt.Printf("      %s\n", repo.Description)
+			}
 		}
-		return 0
-	case "remove":
-		if len(os.Args) < 3 {
-			fmt.Fprintln(os.Stderr, "Error: package name required")
-			return 1
+		if len(repos) == 0 {
+			fmt.Println(i18n.T("  (none found)"))
 		}
-		if err := removePackage(os.Args[2]); err != nil {
-			return 1
+	}
+	if len(fresh) == 0 || (!write && (porcelain || !isInteractive())) {
+		return nil
+	}
+
+	if !write {
+		fmt.Println()
+		if !promptYesNo(i18n.T("Draft manifest entries for the %d new repo(s)?", len(fresh)), false) {
+			return nil
 		}
-		return 0
-	case "list":
-		listPackages()
-		return 0
-	case "update":
-		if len(os.Args) < 3 {
-			fmt.Fprintln(os.Stderr, "Error: package name required")
-			return 1
+	}
+
+	var entries []manifest.Package
+	for _, repo := range fresh {
+		entries = append(entries, inst.CandidateEntry(ctx, repo))
+	}
+	path, err := inst.WriteCandidates(topic, entries)
+	if err != nil {
+		return err
+	}
+	if !dryRun {
+		fmt.Print(i18n.T("✓ Wrote %d draft entries to %s\n", len(entries), path))
+		fmt.Println(i18n.T("  Review their build commands and binary names before installing them."))
+	}
+	return nil
+}
+
+// runOrphans lists the bin dir entries no package owns, then deletes them
+// with --clean or records them as packages with --adopt
+func runOrphans(args []string) error {
+	clean, adopt := false, false
+	for _, arg := range args {
+		switch arg {
+		case "--clean":
+			clean = true
+		case "--adopt":
+			adopt = true
+		default:
+			return fmt.Errorf("unknown option: %s", arg)
 		}
-		if err := updatePackage(os.Args[2]); err != nil {
-			return 1
+	}
+	if clean && adopt {
+		return fmt.Errorf("--clean and --adopt can't be combined")
+	}
+
+	orphans, err := inst.Orphans()
+	if err != nil {
+		return err
+	}
+	if len(orphans) == 0 {
+		fmt.Print(i18n.T("No orphaned executables in %s\n", inst.Paths.BinDir))
+		return nil
+	}
+
+	fmt.Print(i18n.T("%d executable(s) in %s not owned by any package:\n", len(orphans), inst.Paths.BinDir))
+	for _, orphan := range orphans {
+		switch {
+		case orphan.Broken:
+			fmt.Print(i18n.T("  %s (broken link to %s)\n", orphan.Path, orphan.Target))
+		case orphan.Target != "":
+			fmt.Printf("  %s -> %s\n", orphan.Path, orphan.Target)
+		default:
+			fmt.Printf("  %s\n", orphan.Path)
 		}
-		return 0
-	case "search":
-		if len(os.Args) < 3 {
-			fmt.Fprintln(os.Stderr, "Error: search keyword required")
+	}
+
+	switch {
+	case clean:
+		return inst.CleanOrphans(orphans)
+	case adopt:
+		var failed int
+		for _, orphan := range orphans {
+			if orphan.Broken {
+				continue
+			}
+			pkg, err := inst.Adopt(context.Background(), orphan.Path, installer.AdoptOptions{})
+			if err != nil {
+				fmt.Fprint(os.Stderr, i18n.T("✗ Failed to adopt %s: %v\n", orphan.Path, err))
+				failed++
+				continue
+			}
+			fmt.Print(i18n.T("  ✓ Adopted %s as %s\n", orphan.Path, pkg.Name))
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to adopt %d executable(s)", failed)
+		}
+	default:
+		fmt.Println(i18n.T("\nRun 'binrex orphans --clean' to delete them or 'binrex orphans --adopt' to manage them."))
+	}
+	return nil
+}
+
+// showHistory prints the history log, optionally for a single package
+func showHistory(pkgName string) error {
+	entries, err := state.ReadHistory(inst.Paths.HistoryPath, pkgName)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		fmt.Println(i18n.T("No matching history entries."))
+		return nil
+	}
+
+	for _, entry := range entries {
+		mark := i18n.T("✓")
+		if entry.Status != "ok" {
+			mark = i18n.T("✗")
+		}
+
+		fmt.Printf("%s %s %-8s", entry.Time, mark, entry.Action)
+		if entry.Package != "" {
+			fmt.Printf(" %s", entry.Package)
+		}
+		if entry.Version != "" {
+			fmt.Printf(" (v%s)", entry.Version)
+		}
+		if entry.Error != "" {
+			fmt.Printf(" - %s", entry.Error)
+		}
+		fmt.Println()
+	}
+
+	return nil
+}
+
+// showFiles prints the file list of an installed package, or only the
+// files changed since install, and reports whether none changed
+func showFiles(name string, changedOnly bool) (bool, error) {
+	files, err := inst.Files(name)
+	if err != nil {
+		if errors.Is(err, installer.ErrNotInstalled) {
+			return false, fmt.Errorf("package '%s' is not installed", name)
+		}
+		return false, err
+	}
+
+	ok := true
+	for _, file := range files {
+		switch file.Status {
+		case installer.FileMissing:
+			fmt.Print(i18n.T("  ✗ %s missing\n", file.Path))
+			ok = false
+		case installer.FileModified:
+			fmt.Print(i18n.T("  ✗ %s modified since install\n", file.Path))
+			ok = false
+		default:
+			if changedOnly {
+				continue
+			}
+			if file.Link != "" {
+				fmt.Printf("  %-8s %s -> %s\n", file.Kind, file.Path, file.Link)
+			} else {
+				fmt.Printf("  %-8s %s\n", file.Kind, file.Path)
+			}
+		}
+	}
+	if changedOnly && ok {
+		fmt.Print(i18n.T("✓ No files of %s changed since install\n", name))
+	}
+	return ok, nil
+}
+
+// showFileLog prints the file log, optionally for a single package
+func showFileLog(name string) error {
+	changes, err := inst.FileLog(name)
+	if err != nil {
+		return err
+	}
+
+	if len(changes) == 0 {
+		fmt.Println(i18n.T("No matching file changes."))
+		return nil
+	}
+	for _, change := range changes {
+		fmt.Printf("%s %-8s %-8s %s %s\n", change.Time, change.Action, change.Change, change.Package, change.Path)
+	}
+	return nil
+}
+
+// restoreState restores installed.json from a backup
+func restoreState(n int) error {
+	backup, data, err := inst.State.Restore(n)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	fmt.Print(i18n.T("✓ Restored %s from %s\n", inst.Paths.InstalledPath, backup))
+	fmt.Print(i18n.T("  Packages: %d\n", len(data.Installed)))
+	return nil
+}
+
+// prune runs Prune and reports the space reclaimed
+func prune(ctx context.Context) error {
+	fmt.Println(i18n.T("Pruning repo cache..."))
+	result, err := inst.Prune(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(result.Removed) == 0 {
+		fmt.Println(i18n.T("Nothing to prune."))
+		return nil
+	}
+	if dryRun {
+		fmt.Print(i18n.T("\n✓ Would reclaim %s\n", fsutil.FormatBytes(result.Reclaimed)))
+	} else {
+		fmt.Print(i18n.T("\n✓ Reclaimed %s\n", fsutil.FormatBytes(result.Reclaimed)))
+	}
+	return nil
+}
+
+// gc deletes the store entries nothing uses any more
+func gc(ctx context.Context) error {
+	fmt.Println(i18n.T("Collecting unused store entries..."))
+	result, err := inst.GC(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(result.Removed) == 0 {
+		fmt.Println(i18n.T("Nothing to collect."))
+		return nil
+	}
+	if dryRun {
+		fmt.Print(i18n.T("\n✓ Would reclaim %s\n", fsutil.FormatBytes(result.Reclaimed)))
+	} else {
+		fmt.Print(i18n.T("\n✓ Reclaimed %s\n", fsutil.FormatBytes(result.Reclaimed)))
+	}
+	return nil
+}
+
+// showVersions lists the versions of a package kept in the store
+func showVersions(name string) error {
+	versions, err := inst.InstalledVersions(name)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		fmt.Print(i18n.T("No stored versions of %s\n", name))
+		return nil
+	}
+
+	active := ""
+	if pkg := inst.State.Get(name); pkg != nil {
+		active = pkg.Version
+	}
+
+	fmt.Print(i18n.T("Versions of %s:\n", name))
+	for _, version := range versions {
+		marker := " "
+		if version == active {
+			marker = "*"
+		}
+		fmt.Printf("  %s %s\n", marker, version)
+	}
+	return nil
+}
+
+// showAlternatives lists the shared command names and their providers,
+// marking the active one
+func showAlternatives(name string) error {
+	alternatives, err := inst.Alternatives()
+	if err != nil {
+		return err
+	}
+
+	shown := 0
+	for _, alt := range alternatives {
+		if name != "" && alt.Name != name {
+			continue
+		}
+		fmt.Printf("%s:\n", alt.Name)
+		for _, provider := range alt.Providers {
+			marker := " "
+			if provider == alt.Active {
+				marker = "*"
+			}
+			fmt.Printf("  %s %s\n", marker, provider)
+		}
+		shown++
+	}
+	if shown == 0 {
+		if name != "" {
+			return fmt.Errorf("no installed package provides %s", name)
+		}
+		fmt.Println(i18n.T("No installed package provides a shared command"))
+	}
+	return nil
+}
+
+// showProfiles lists the configured profiles and marks the active one
+func showProfiles(base config.Paths) error {
+	for _, name := range inst.Config.ProfileNames() {
+		paths, err := inst.Config.ProfilePaths(base, name)
+		if err != nil {
+			return err
+		}
+
+		marker := " "
+		if name == inst.Paths.Profile {
+			marker = "*"
+		}
+		fmt.Printf("%s %-15s %s\n", marker, name, paths.BinDir)
+	}
+	return nil
+}
+
+// runPackage runs a package's binary without installing it, building or
+// downloading it into the run cache first when needed, and returns the
+// binary's exit code
+func runPackage(ctx context.Context, args []string) int {
+	var name, binary string
+	var binArgs []string
+	for n := 0; n < len(args); n++ {
+		switch {
+		case args[n] == "--":
+			binArgs = args[n+1:]
+			n = len(args)
+		case args[n] == "--bin" && n+1 < len(args):
+			binary = args[n+1]
+			n++
+		case name == "":
+			name = args[n]
+		default:
+			binArgs = args[n:]
+			n = len(args)
+		}
+	}
+	if name == "" {
+		fmt.Fprintln(os.Stderr, i18n.T("Error: package name required"))
+		return 1
+	}
+
+	// Only hold the lock while building, the tool may run for long
+	unlock, err := inst.Lock()
+	if err != nil {
+		printError(err)
+		return 1
+	}
+	path, err := inst.PrepareRun(ctx, name, binary)
+	unlock()
+	if err != nil {
+		if err != installer.ErrManifestNotFound {
+			printError(err)
+		}
+		return exitCode(err)
+	}
+	if dryRun {
+		return 0
+	}
+
+	cmd := exec.CommandContext(ctx, path, binArgs...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		printError(err)
+		return 1
+	}
+	return 0
+}
+
+// packageShell starts a subshell with the binaries of packages first on
+// PATH, without installing them, and returns the shell's exit code
+func packageShell(ctx context.Context, names []string) int {
+	names, err := packageNames(names)
+	if err != nil {
+		printError(err)
+		return 1
+	}
+
+	unlock, err := inst.Lock()
+	if err != nil {
+		printError(err)
+		return 1
+	}
+	dir, err := inst.PrepareShell(ctx, names)
+	unlock()
+	if err != nil {
+		if err != installer.ErrManifestNotFound {
+			printError(err)
+		}
+		return exitCode(err)
+	}
+	if dryRun {
+		return 0
+	}
+	defer os.RemoveAll(dir)
+
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "sh"
+	}
+	fmt.Fprint(os.Stderr, i18n.T("Starting %s with %s on PATH, exit to leave\n", filepath.Base(shell), strings.Join(names, ", ")))
+
+	cmd := exec.CommandContext(ctx, shell)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(),
+		"PATH="+dir+string(os.PathListSeparator)+os.Getenv("PATH"),
+		"BINREX_SHELL="+strings.Join(names, " "))
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		printError(err)
+		return 1
+	}
+	return 0
+}
+
+// showPins lists the pinned packages
+func showPins() error {
+	pins, err := inst.Pins()
+	if err != nil {
+		return err
+	}
+	if len(pins) == 0 {
+		fmt.Println(i18n.T("No packages pinned"))
+		return nil
+	}
+
+	names := make([]string, 0, len(pins))
+	for name := range pins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %s @ %s\n", name, pins[name])
+	}
+	return nil
+}
+
+// runDev links an installed package to a working copy, or back to its
+// install
+func runDev(ctx context.Context, args []string) error {
+	switch {
+	case len(args) == 3 && args[0] == "link":
+		return inst.DevLink(ctx, args[1], args[2])
+	case len(args) == 2 && args[0] == "unlink":
+		return inst.DevUnlink(ctx, args[1])
+	case len(args) > 0 && args[0] != "link" && args[0] != "unlink":
+		return fmt.Errorf("unknown dev command: %s", args[0])
+	}
+	return fmt.Errorf("usage: dev link <name> <path> | dev unlink <name>")
+}
+
+// Commands whose arguments completions offer package names for, from the
+// manifest or of the installed packages
+var (
+	availableCommands = []string{"install", "info", "run", "shell", "fetch", "readme", "tree"}
+	installedCommands = []string{"remove", "purge", "update", "use", "rollback", "pin", "unpin", "verify", "diff", "logs", "history", "files", "watch-build", "audit"}
+)
+
+// completionCommands are the commands completions offer
+var completionCommands = []string{
+	"sync", "install", "remove", "purge", "list", "update", "upgrade", "search", "info", "tree", "check",
+	"watch", "owns", "adopt", "orphans", "vendor", "verify", "audit", "readme", "diff", "logs", "submit",
+	"fetch", "discover", "browse", "licenses", "prune", "gc", "rollback", "use", "alternatives",
+	"pin", "unpin", "snapshot", "dev", "watch-build", "run", "shell", "override", "source",
+	"init-shell", "env", "completion", "profiles", "history", "files", "verify-state", "restore-state",
+	"daemon", "web", "version", "help",
+}
+
+// completePackages prints the names of the packages in the manifest, or
+// of the installed ones, each with its one-line description after a tab,
+// for the completion scripts
+func completePackages(which string) error {
+	descriptions := make(map[string]string)
+	var names []string
+	if m, err := inst.LoadManifest(); err == nil {
+		for _, pkg := range m.Packages {
+			line, _, _ := strings.Cut(strings.TrimSpace(pkg.Description), "\n")
+			descriptions[pkg.Name] = line
+			if which == "available" {
+				names = append(names, pkg.Name)
+			}
+		}
+	}
+	if which == "installed" {
+		installedData, err := inst.State.Load()
+		if err != nil {
+			return err
+		}
+		for _, pkg := range installedData.Installed {
+			names = append(names, pkg.Name)
+		}
+	}
+
+	for _, name := range names {
+		if descriptions[name] == "" {
+			fmt.Println(name)
+		} else {
+			fmt.Printf("%s\t%s\n", name, descriptions[name])
+		}
+	}
+	return nil
+}
+
+// completionScript returns the completion script for a shell. Package
+// names are looked up when completing, so zsh and fish show their
+// descriptions from the synced manifest next to them.
+func completionScript(shell string) (string, error) {
+	commands := strings.Join(completionCommands, " ")
+	switch shell {
+	case "bash":
+		return fmt.Sprintf(`_binrex() {
+    local cur=${COMP_WORDS[COMP_CWORD]}
+    if [ "$COMP_CWORD" -eq 1 ]; then
+        COMPREPLY=($(compgen -W "%s" -- "$cur"))
+        return
+    fi
+    case ${COMP_WORDS[1]} in
+        %s) COMPREPLY=($(compgen -W "$(binrex __complete available 2>/dev/null | cut -f1)" -- "$cur")) ;;
+        %s) COMPREPLY=($(compgen -W "$(binrex __complete installed 2>/dev/null | cut -f1)" -- "$cur")) ;;
+    esac
+}
+complete -F _binrex binrex
+`, commands, strings.Join(availableCommands, "|"), strings.Join(installedCommands, "|")), nil
+	case "zsh":
+		return fmt.Sprintf(`#compdef binrex
+_binrex() {
+    local -a packages
+    if (( CURRENT == 2 )); then
+        compadd -- %s
+        return
+    fi
+    case $words[2] in
+        (%s) packages=(${(f)"$(binrex __complete available 2>/dev/null)"}) ;;
+        (%s) packages=(${(f)"$(binrex __complete installed 2>/dev/null)"}) ;;
+        (*) return 1 ;;
+    esac
+    packages=(${${packages//:/\\:}//$'\t'/:})
+    _describe 'package' packages
+}
+compdef _binrex binrex
+`, commands, strings.Join(availableCommands, "|"), strings.Join(installedCommands, "|")), nil
+	case "fish":
+		return fmt.Sprintf(`complete -c binrex -f
+complete -c binrex -n __fish_use_subcommand -a '%s'
+complete -c binrex -n '__fish_seen_subcommand_from %s' -a '(binrex __complete available 2>/dev/null)'
+complete -c binrex -n '__fish_seen_subcommand_from %s' -a '(binrex __complete installed 2>/dev/null)'
+`, commands, strings.Join(availableCommands, " "), strings.Join(installedCommands, " ")), nil
+	}
+	return "", fmt.Errorf("no completions for %s, use bash, zsh or fish", shell)
+}
+
+// runSnapshot lists, creates, restores or deletes snapshots of the
+// installed set
+func runSnapshot(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		snapshots, err := inst.Snapshots()
+		if err != nil {
+			return err
+		}
+		if len(snapshots) == 0 {
+			fmt.Println(i18n.T("No snapshots"))
+			return nil
+		}
+		for _, snapshot := range snapshots {
+			fmt.Print(i18n.T("  %-20s %s  %d package(s)\n", snapshot.Name, snapshot.Created, len(snapshot.Packages)))
+		}
+		return nil
+	}
+
+	if len(args) != 2 {
+		return fmt.Errorf("usage: snapshot %s <name>", args[0])
+	}
+	switch args[0] {
+	case "create":
+		snapshot, err := inst.CreateSnapshot(args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Print(i18n.T("✓ Snapshot %s records %d package(s)\n", snapshot.Name, len(snapshot.Packages)))
+	case "restore":
+		return inst.RestoreSnapshot(ctx, args[1])
+	case "delete":
+		if err := inst.DeleteSnapshot(args[1]); err != nil {
+			return err
+		}
+		fmt.Print(i18n.T("✓ Deleted snapshot %s\n", args[1]))
+	default:
+		return fmt.Errorf("unknown snapshot command: %s", args[0])
+	}
+	return nil
+}
+
+// runOverride lists, sets or removes local manifest field overrides
+func runOverride(args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		overrides, err := inst.LoadOverrides()
+		if err != nil {
+			return err
+		}
+		if len(overrides) == 0 {
+			fmt.Println(i18n.T("No overrides set"))
+			return nil
+		}
+
+		names := make([]string, 0, len(overrides))
+		for name := range overrides {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if len(args) > 1 && args[1] != name {
+				continue
+			}
+			fields := make([]string, 0, len(overrides[name]))
+			for field := range overrides[name] {
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+
+			fmt.Printf("%s:\n", name)
+			for _, field := range fields {
+				fmt.Printf("  %s = %s\n", field, overrides[name][field])
+			}
+		}
+		return nil
+	}
+
+	switch args[0] {
+	case "set":
+		if len(args) != 4 {
+			return fmt.Errorf("usage: override set <name> <field> <value>")
+		}
+		if err := inst.SetOverride(args[1], args[2], args[3]); err != nil {
+			return err
+		}
+		fmt.Print(i18n.T("✓ %s %s overridden\n", args[1], args[2]))
+	case "unset":
+		if len(args) != 2 && len(args) != 3 {
+			return fmt.Errorf("usage: override unset <name> [field]")
+		}
+		field := ""
+		if len(args) == 3 {
+			field = args[2]
+		}
+		if err := inst.UnsetOverride(args[1], field); err != nil {
+			return err
+		}
+		fmt.Print(i18n.T("✓ Removed the override of %s\n", strings.TrimSpace(args[1]+" "+field)))
+	default:
+		return fmt.Errorf("unknown override command: %s", args[0])
+	}
+	return nil
+}
+
+// runSource lists manifest sources or manages their signing keys
+func runSource(args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		for _, source := range inst.Sources() {
+			if source.KeyPath == "" {
+				fmt.Print(i18n.T("  %s (unsigned)\n", source.URL))
+				continue
+			}
+			fmt.Printf("  %s (%s: %s)\n", source.URL, source.KeyType, source.KeyPath)
+		}
+		return nil
+	}
+
+	switch args[0] {
+	case "trust":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: source trust <url> <keyfile>")
+		}
+		source, err := inst.TrustSource(args[1], args[2])
+		if err != nil {
+			return err
+		}
+		fmt.Print(i18n.T("✓ %s must now be signed with %s key %s\n", source.URL, source.KeyType, args[2]))
+	case "untrust":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: source untrust <url>")
+		}
+		if err := inst.UntrustSource(args[1]); err != nil {
+			return err
+		}
+		fmt.Print(i18n.T("✓ Removed the key of %s\n", args[1]))
+	default:
+		return fmt.Errorf("unknown source command: %s", args[0])
+	}
+	return nil
+}
+
+// printUsage prints usage information
+func printUsage(prog string) {
+	fmt.Println("Binrex - Simple Binary Package Manager")
+	fmt.Println()
+	fmt.Printf("Usage: %s <command> [arguments]\n\n", prog)
+	fmt.Println("Commands:")
+	fmt.Println("  sync                  - Sync manifest (falls back to mirrors)")
+	fmt.Println("    --diff              - Show package changes before replacing the manifest")
+	fmt.Println("  install <name>...     - Install packages")
+	fmt.Println("  install <name>@<ver>  - Install the newest tag matching a constraint, e.g. tool@^1.2")
+	fmt.Println("  install -a, --all     - Install all packages in manifest, resuming an unfinished run")
+	fmt.Println("    --retry-failed      - Only retry the packages that failed last time")
+	fmt.Println("  install -i [query]    - Pick packages to install from a checklist")
+	fmt.Println("  install --git <url>   - Install directly from a git repository")
+	fmt.Println("  install --path <dir>  - Build and install a local checkout as it is, without cloning")
+	fmt.Println("  run <name> [-- args]  - Run a package's binary without installing it")
+	fmt.Println("    --bin <binary>      - Binary to run when the package has several")
+	fmt.Println("  shell <name>...       - Start a shell with packages on PATH without installing them")
+	fmt.Println("  remove <name>...      - Remove packages, names may be globs like 'rust-*'")
+	fmt.Println("  remove -a, --all      - Remove every installed package")
+	fmt.Println("  purge <name>...       - Remove packages with their cached repos and build logs")
+	fmt.Println("  purge -a, --all       - Purge every installed package")
+	fmt.Println("  list                  - List installed packages")
+	fmt.Println("    --format <fmt>      - Print with a Go template, e.g. '{{.Name}} {{.Version}}', or csv")
+	fmt.Println("  update <name>...      - Update packages")
+	fmt.Println("  use <name>@<version>  - Switch to another installed version")
+	fmt.Println("  use <name>            - List installed versions of a package")
+	fmt.Println("  rollback <name>       - Switch back to the version used before the current one")
+	fmt.Println("  alternatives [cmd]    - List packages providing shared commands")
+	fmt.Println("    <cmd> <name>        - Make a package the active provider of cmd")
+	fmt.Println("  pin [name] [ref]      - Build a package at a commit or tag until unpinned, or list pins")
+	fmt.Println("  unpin <name>          - Let a pinned package follow the manifest again")
+	fmt.Println("  adopt <path>          - Manage a binary installed by hand as a package")
+	fmt.Println("    --name <name>       - Package name (default: the binary's, or the repo's)")
+	fmt.Println("    --version <ver>     - Version to record (default: from --version)")
+	fmt.Println("    --repo <url>        - Source repo that update rebuilds it from")
+	fmt.Println("    --build-cmd, --build-dir - Build settings for updates (default: detected)")
+	fmt.Println("  orphans               - List executables in the bin dir no package owns")
+	fmt.Println("    --clean             - Delete them")
+	fmt.Println("    --adopt             - Record them as unmanaged packages")
+	fmt.Println("  dev link <name> <path> - Run a package's commands from the builds in a working copy")
+	fmt.Println("  dev unlink <name>     - Point a package's commands back at its install")
+	fmt.Println("  watch-build <name>    - Rebuild a local or dev linked package whenever its sources change")
+	fmt.Println("  snapshot [list]       - List snapshots of the installed packages")
+	fmt.Println("  snapshot create <name> - Record the installed packages with their commits and hashes")
+	fmt.Println("  snapshot restore <name> - Return to a snapshot, rebuilding what the store lacks")
+	fmt.Println("  snapshot delete <name> - Delete a snapshot")
+	fmt.Println("  upgrade --all         - Update all outdated packages")
+	fmt.Println("  upgrade <name>...     - Update the given packages if outdated")
+	fmt.Println("  fetch <name>...       - Clone or update the repos of packages without building, for later offline builds")
+	fmt.Println("    --all               - Fetch the repos of every package for this OS")
+	fmt.Println("    --jobs <n>          - Repos to fetch at once (default 4)")
+	fmt.Println("  search <query>        - Search for packages")
+	fmt.Println("    --long              - Show full package details")
+	fmt.Println("    --license <id>      - Only show packages with this license")
+	fmt.Println("    --keyword <word>    - Only show packages with this keyword")
+	fmt.Println("    --os <os>           - Only show packages supporting this OS")
+	fmt.Println("    --required-tool <t> - Only show packages that need this tool")
+	fmt.Println("    --installed         - Only show installed packages (--not-installed for the rest)")
+	fmt.Println("    --format <fmt>      - Print with a Go template, e.g. '{{.Name}} {{.Version}}', or csv")
+	fmt.Println("  readme <name>         - Show a package's README")
+	fmt.Println("  diff <name>...        - Show the commits and diffstat between the installed build and upstream HEAD")
+	fmt.Println("  tree [name]...        - Show the dependency tree of packages, or of everything installed")
+	fmt.Println("  logs <name>           - Show a package's last build log")
+	fmt.Println("  browse [category]     - List package categories, or the packages in one")
+	fmt.Println("  discover <topic>      - Find GitHub repos with a topic and draft manifest entries for new ones")
+	fmt.Println("    --limit <n>         - Number of repos to show (default 30)")
+	fmt.Println("    --write             - Add the drafts to manifest.d without asking")
+	fmt.Println("    --print             - Print the drafts as manifest JSON instead")
+	fmt.Println("  submit <name>         - Validate, test-build and propose a manifest.d package upstream as a pull request")
+	fmt.Println("    --no-build          - Skip the test build")
+	fmt.Println("  info <name>           - Show package details")
+	fmt.Println("  check                 - Compare installed packages with the manifest, exits 1 if any is outdated")
+	fmt.Println("    --commits           - Also compare build commits with the remote HEAD")
+	fmt.Println("    -q, --quiet         - Print nothing, only set the exit code")
+	fmt.Println("    --notify            - Sync first and send a desktop notification")
+	fmt.Println("  restore-state [n]     - Restore installed.json from a backup")
+	fmt.Println("  verify-state          - Check installed.json and the manifest weren't changed outside binrex")
+	fmt.Println("    --accept            - Trust their current contents")
+	fmt.Println("  history [name]        - Show install/remove/update/sync history")
+	fmt.Println("  files <name>          - List the files binrex wrote for a package, marking changed ones")
+	fmt.Println("    --changed           - Only list files changed or deleted since install, exits 1 if any")
+	fmt.Println("    --log               - Show the log of files created, modified and deleted instead")
+	fmt.Println("  vendor <name>...      - Archive the sources installed packages were built from")
+	fmt.Println("    --all               - Archive every installed package")
+	fmt.Println("    -o, --output <dir>  - Write the tarballs here (default: .)")
+	fmt.Println("  verify <name>         - Check that a package's binaries are in place")
+	fmt.Println("    --rebuild           - Rebuild from the recorded commit and compare hashes")
+	fmt.Println("  audit [name]...       - Check installed packages for known vulnerabilities (OSV)")
+	fmt.Println("    --fail-on <sev>     - Exit non-zero for findings of at least this severity")
+	fmt.Println("  licenses [--json]     - Show licenses of installed packages (SPDX JSON)")
+	fmt.Println("  prune                 - Delete unused cached repos and build artifacts")
+	fmt.Println("  gc                    - Delete store entries no installed package or snapshot uses")
+	fmt.Println("  watch                 - Periodically sync and notify about or upgrade packages")
+	fmt.Println("    --interval <d>      - Time between checks, e.g. 24h or 7d (default 24h)")
+	fmt.Println("    --once              - Run a single check and exit")
+	fmt.Println("    --install-timer     - Install a systemd user timer running the check")
+	fmt.Println("  owns <binary>         - Show which package installed a binary")
+	fmt.Println("  profiles              - List installation profiles")
+	fmt.Println("  override list [name]  - Show local overrides of manifest fields")
+	fmt.Println("  override set <n> <f> <v> - Override field f of package n, e.g. build_commands")
+	fmt.Println("  override unset <n> [f] - Go back to the manifest's value of f (default: all fields)")
+	fmt.Println("  source [list]         - List manifest sources and their signing keys")
+	fmt.Println("  source trust <u> <k>  - Require the manifest at URL u to be signed by key file k")
+	fmt.Println("  source untrust <u>    - Stop checking the signature of URL u")
+	fmt.Println("  init-shell [shell]    - Add the bin dir to PATH in your shell rc file")
+	fmt.Println("  env [shell]           - Print PATH, MANPATH and completion setup, for eval \"$(binrex env)\"")
+	fmt.Println("  completion [shell]    - Print bash, zsh or fish completions, with package descriptions")
+	fmt.Println("    --print             - Only print the line to add")
+	fmt.Println("  daemon [--addr a]     - Serve the local HTTP API (default 127.0.0.1:7878)")
+	fmt.Println("  web [--addr a]        - Serve the API plus a web UI for managing packages")
+	fmt.Println("  version               - Show version")
+	fmt.Println("  help                  - Show this help")
+	fmt.Println()
+	fmt.Println("Global flags:")
+	fmt.Println("  --dry-run             - Show what install/remove/update/upgrade would do")
+	fmt.Println("  -y, --yes             - Don't ask for confirmation")
+	fmt.Println("  --porcelain           - Stable, untranslated ASCII output for scripts and screen readers")
+	fmt.Println("  --system              - Install for every user into /usr/local, with state in /var/lib/binrex (needs root)")
+	fmt.Println("                          binrex refuses to run as root otherwise, unless BINREX_ALLOW_ROOT=1 is set")
+	fmt.Println("  --container           - Build inside the package's build_image (podman/docker)")
+	fmt.Println("  --sandbox[=tool]      - Build under bwrap or firejail, writing only to the repo")
+	fmt.Println("  --no-network-build    - Fetch dependencies first, then build without network")
+	fmt.Println("  --remote-build <host> - Build on this SSH host and copy back only the binaries")
+	fmt.Println("  --build-jobs <n>      - Parallel build jobs (default: build_jobs or CPU count)")
+	fmt.Println("  --limit-rate <rate>   - Cap download and clone speed, e.g. 500k or 2M per second")
+	fmt.Println("  --profile <name>      - Use a profile from config.json (own bin dir and state)")
+	fmt.Println("  --config <file>       - Use this config.json instead of $XDG_CONFIG_HOME/binrex/config.json")
+	fmt.Println("  --manifest <file>     - Use this manifest.json instead of the synced one")
+	fmt.Println("  --state <file>        - Use this installed.json, with its lock and history beside it")
+	fmt.Println()
+	fmt.Println("Install/update flags:")
+	fmt.Println("  --build-cmd <cmd>     - Build with this command instead of the manifest's")
+	fmt.Println("  --build-dir <dir>     - Build in this directory of the repo instead")
+	fmt.Println("  --install-dir <dir>   - Link binaries here instead of the bin dir (or a bin_dirs name)")
+	fmt.Println("  --as <name>           - Install the binary under another name, binary=name for one of several")
+	fmt.Println("  --force               - Rebuild on update even if upstream hasn't changed")
+	fmt.Println("  --enable-services     - Enable and start the package's systemd user services")
+	fmt.Println("  --install-missing-tools - Bootstrap missing toolchains (rustup, go, build-essential)")
+	fmt.Println("  --no-keep-source      - Delete the cached repo once the binaries are installed")
+	fmt.Println("  --from-source         - Build packages that have a release_asset instead of downloading it")
+	fmt.Println()
+	fmt.Println("Exit codes:")
+	fmt.Println("  0                     - Success")
+	fmt.Println("  1                     - Any other error, or failures with different causes")
+	fmt.Printf("  %-21d - No manifest synced yet\n", exitManifestMissing)
+	fmt.Printf("  %-21d - Package not in the manifest or not installed\n", exitPackageNotFound)
+	fmt.Printf("  %-21d - Package not supported on this OS\n", exitUnsupportedOS)
+	fmt.Printf("  %-21d - Required tools missing\n", exitMissingTools)
+	fmt.Printf("  %-21d - Build failed\n", exitBuildFailed)
+	fmt.Printf("  %-21d - Network error (download, clone or sync failed)\n", exitNetwork)
+}
+
+// parseBuildFlags pulls the install/update flags out of args and returns
+// the remaining arguments. Flags may appear anywhere, other flags than the
+// command's own extra ones are rejected.
+func parseBuildFlags(args []string, extra ...string) (installer.InstallOptions, []string, error) {
+	var opts installer.InstallOptions
+	var rest []string
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--force":
+			opts.Force = true
+		case "--enable-services":
+			opts.EnableServices = true
+		case "--install-missing-tools":
+			opts.InstallMissingTools = true
+		case "--no-keep-source":
+			opts.NoKeepSource = true
+		case "--from-source":
+			opts.FromSource = true
+		case "--as":
+			if i+1 >= len(args) {
+				return opts, nil, fmt.Errorf("%s requires a value", args[i])
+			}
+			if opts.Aliases == nil {
+				opts.Aliases = make(map[string]string)
+			}
+			// "alias" renames the only binary, "binary=alias" a specific one
+			binary, alias, ok := strings.Cut(args[i+1], "=")
+			if !ok {
+				binary, alias = "", binary
+			}
+			opts.Aliases[binary] = alias
+			i++
+		case "--build-cmd", "--build-dir", "--install-dir":
+			if i+1 >= len(args) {
+				return opts, nil, fmt.Errorf("%s requires a value", args[i])
+			}
+			switch args[i] {
+			case "--build-cmd":
+				opts.BuildCommand = args[i+1]
+			case "--build-dir":
+				opts.BuildDir = args[i+1]
+			default:
+				opts.InstallDir = args[i+1]
+			}
+			i++
+		default:
+			if isFlag(args[i]) && !slices.Contains(extra, args[i]) {
+				return opts, nil, fmt.Errorf("unknown flag %s", args[i])
+			}
+			rest = append(rest, args[i])
+		}
+	}
+
+	return opts, rest, nil
+}
+
+// isFlag reports whether an argument looks like a flag rather than a name
+func isFlag(arg string) bool {
+	return len(arg) > 1 && strings.HasPrefix(arg, "-")
+}
+
+// packageNames returns the package names of a command that takes no flags
+func packageNames(args []string) ([]string, error) {
+	for _, arg := range args {
+		if isFlag(arg) {
+			return nil, fmt.Errorf("unknown flag %s", arg)
+		}
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("package name required")
+	}
+	return args, nil
+}
+
+// Exit codes for classes of failure, so scripts can tell them apart
+const (
+	exitManifestMissing = 3
+	exitPackageNotFound = 4
+	exitUnsupportedOS   = 5
+	exitMissingTools    = 6
+	exitBuildFailed     = 7
+	exitNetwork         = 8
+)
+
+// exitCode returns the exit code for err: 0 for nil, the code of its class
+// when every failure in it shares one, and 1 otherwise
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	classes := []struct {
+		err  error
+		code int
+	}{
+		{installer.ErrManifestNotFound, exitManifestMissing},
+		{installer.ErrPackageNotFound, exitPackageNotFound},
+		{installer.ErrNotInstalled, exitPackageNotFound},
+		{installer.ErrUnsupportedOS, exitUnsupportedOS},
+		{installer.ErrMissingTools, exitMissingTools},
+		{installer.ErrBuildFailed, exitBuildFailed},
+		{installer.ErrNetwork, exitNetwork},
+	}
+	code := 1
+	for _, class := range classes {
+		if !errors.Is(err, class.err) || code == class.code {
+			continue
+		}
+		if code != 1 {
+			return 1
+		}
+		code = class.code
+	}
+	return code
+}
+
+// forEachPackage runs fn for every name, carrying on past failures, and
+// returns their errors joined. With several names a summary is printed.
+func forEachPackage(names []string, verb string, fn func(name string) error) error {
+	var failed []string
+	var errs []error
+	for n, name := range names {
+		if len(names) > 1 {
+			if n > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("==> [%d/%d] %s\n", n+1, len(names), name)
+		}
+		if err := fn(name); err != nil {
+			failed = append(failed, name)
+			errs = append(errs, err)
+		}
+	}
+
+	if len(names) > 1 {
+		fmt.Print(i18n.T("\n%d of %d package(s) processed", len(names)-len(failed), len(names)))
+		if len(failed) > 0 {
+			fmt.Print(i18n.T(", failed to %s: %s", verb, strings.Join(failed, ", ")))
+		}
+		fmt.Println()
+	}
+	return errors.Join(errs...)
+}
+
+// parseGlobalFlags removes flags that apply to every command from os.Args.
+// It stops at "--", and for run and shell at the package name, leaving the
+// arguments after it to the binary as they are.
+func parseGlobalFlags() error {
+	args := os.Args[:1]
+	cmd := ""
+	var err error
+	for i := 1; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		if arg == "--" || (cmd == "run" || cmd == "shell") && !strings.HasPrefix(arg, "-") {
+			args = append(args, os.Args[i:]...)
+			break
+		}
+		switch {
+		case arg == "--dry-run":
+			dryRun = true
+		case arg == "--container":
+			containerBuilds = true
+		case arg == "--sandbox":
+			sandbox = "auto"
+		case strings.HasPrefix(arg, "--sandbox="):
+			sandbox = strings.TrimPrefix(arg, "--sandbox=")
+		case arg == "--no-network-build":
+			noNetworkBuild = true
+		case arg == "--porcelain":
+			porcelain = true
+		case arg == "--system":
+			system = true
+		case arg == "--remote-build" && i+1 < len(os.Args):
+			remoteBuild = os.Args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--remote-build="):
+			remoteBuild = strings.TrimPrefix(arg, "--remote-build=")
+		case arg == "-y" || arg == "--yes":
+			assumeYes = true
+		case arg == "--profile" && i+1 < len(os.Args):
+			profile = os.Args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--profile="):
+			profile = strings.TrimPrefix(arg, "--profile=")
+		case arg == "--build-jobs" && i+1 < len(os.Args):
+			if buildJobs, err = parseBuildJobs(os.Args[i+1]); err != nil {
+				return err
+			}
+			i++
+		case strings.HasPrefix(arg, "--build-jobs="):
+			if buildJobs, err = parseBuildJobs(strings.TrimPrefix(arg, "--build-jobs=")); err != nil {
+				return err
+			}
+		case arg == "--limit-rate" && i+1 < len(os.Args):
+			limitRate = os.Args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--limit-rate="):
+			limitRate = strings.TrimPrefix(arg, "--limit-rate=")
+		case arg == "--config" && i+1 < len(os.Args):
+			configPath = os.Args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--config="):
+			configPath = strings.TrimPrefix(arg, "--config=")
+		case arg == "--manifest" && i+1 < len(os.Args):
+			manifestPath = os.Args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--manifest="):
+			manifestPath = strings.TrimPrefix(arg, "--manifest=")
+		case arg == "--state" && i+1 < len(os.Args):
+			statePath = os.Args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--state="):
+			statePath = strings.TrimPrefix(arg, "--state=")
+		default:
+			if cmd == "" && !strings.HasPrefix(arg, "-") {
+				cmd = arg
+			}
+			args = append(args, arg)
+		}
+	}
+	os.Args = args
+	return nil
+}
+
+// parseBuildJobs parses the --build-jobs value, 0 uses the default
+func parseBuildJobs(value string) (int, error) {
+	jobs, err := strconv.Atoi(value)
+	if err != nil || jobs < 0 {
+		return 0, fmt.Errorf("--build-jobs must be a number of jobs, got %q", value)
+	}
+	return jobs, nil
+}
+
+func main() {
+	os.Exit(run())
+}
+
+// checkFlags parses the flags of check, which may come in any order
+func checkFlags(args []string) (notify, commits, quiet bool) {
+	for _, arg := range args {
+		switch arg {
+		case "--notify":
+			notify = true
+		case "--commits":
+			commits = true
+		case "-q", "--quiet":
+			quiet = true
+		}
+	}
+	return notify, commits, quiet
+}
+
+// writesState reports whether a command changes installed.json, the
+// manifest, the store or the repo cache
+func writesState(cmd string) bool {
+	switch cmd {
+	case "sync", "install", "remove", "purge", "update", "upgrade", "use", "alternatives", "pin", "unpin", "snapshot", "dev", "orphans", "adopt", "submit", "fetch", "gc", "rollback", "restore-state", "verify-state", "prune", "diff":
+		return true
+	}
+	return false
+}
+
+// checkUser refuses to run as root without --system, where the per-user
+// layout would install into root's home, or as sudo keeps HOME into the
+// user's home with files they can't change, unless BINREX_ALLOW_ROOT is
+// set. It refuses --system commands that write to the system dirs without
+// root.
+func checkUser(cmd string) error {
+	if cmd == "help" || cmd == "version" || runtime.GOOS == "windows" {
+		return nil
+	}
+	root := os.Geteuid() == 0
+	switch {
+	// Containers often have no other user to run as
+	case root && !system && os.Getenv("BINREX_ALLOW_ROOT") == "":
+		return fmt.Errorf("binrex installs for your user and won't run as root, run it without sudo, or with --system to install for every user into /usr/local")
+	case system && profile != "":
+		return fmt.Errorf("--system can't be combined with --profile, profiles are per user")
+	case system && !root && !dryRun && writesState(cmd):
+		return fmt.Errorf("--system %s needs root, run it with sudo", cmd)
+	}
+	return nil
+}
+
+func run() int {
+	flagErr := parseGlobalFlags()
+	// Until the config is loaded only the environment picks the language
+	i18n.SetLocale(i18n.Detect(""), "")
+	i18n.SetPlain(porcelain)
+	if flagErr != nil {
+		printError(flagErr)
+		return 1
+	}
+
+	if len(os.Args) < 2 {
+		printUsage(os.Args[0])
+		return 1
+	}
+
+	if err := checkUser(os.Args[1]); err != nil {
+		printError(err)
+		return 1
+	}
+
+	var paths config.Paths
+	var err error
+	if system {
+		paths = config.SystemPaths()
+	} else {
+		if paths, err = config.DefaultPaths(); err != nil {
+			printError(err)
+			return 1
+		}
+		moved, err := config.MigrateLegacy(paths)
+		for _, m := range moved {
+			fmt.Fprint(os.Stderr, i18n.T("Moved %s to %s\n", m.From, m.To))
+		}
+		if err != nil {
+			fmt.Fprint(os.Stderr, i18n.T("Warning: %v\n", err))
+		}
+	}
+
+	if configPath != "" {
+		paths.ConfigPath, _ = filepath.Abs(configPath)
+	}
+
+	cfg, err := config.Load(paths.ConfigPath)
+	if err != nil {
+		printError(err)
+		return 1
+	}
+	if err := i18n.SetLocale(i18n.Detect(cfg.Language), filepath.Join(paths.ConfigDir, "locales")); err != nil {
+		fmt.Fprint(os.Stderr, i18n.T("Warning: %v\n", err))
+	}
+
+	basePaths := paths
+	paths, err = cfg.ProfilePaths(paths, cfg.ActiveProfile(profile))
+	if err != nil {
+		printError(err)
+		return 1
+	}
+
+	if manifestPath != "" {
+		paths.ManifestPath, _ = filepath.Abs(manifestPath)
+	}
+	if statePath != "" {
+		// The lock and history belong with the state they protect
+		paths.InstalledPath, _ = filepath.Abs(statePath)
+		paths.LockPath = filepath.Join(filepath.Dir(paths.InstalledPath), "binrex.lock")
+		paths.HistoryPath = filepath.Join(filepath.Dir(paths.InstalledPath), "history.jsonl")
+	}
+
+	inst = installer.New(paths, cfg)
+	inst.DryRun = dryRun
+	inst.BuildJobs = buildJobs
+	inst.ContainerBuilds = containerBuilds
+	inst.RemoteBuildHost = remoteBuild
+	inst.Sandbox = sandbox
+	inst.NoNetworkBuild = noNetworkBuild
+	if porcelain {
+		inst.Stdout = i18n.PlainWriter(os.Stdout)
+		inst.Stderr = i18n.PlainWriter(os.Stderr)
+		inst.State.Warn = inst.Stderr
+	}
+	inst.LimitRate = limitRate
+	inst.Confirm = confirm
+
+	if err := inst.Init(); err != nil {
+		printError(err)
+		return 1
+	}
+
+	ctx := context.Background()
+	cmd := os.Args[1]
+
+	// Commands that touch installed.json, the manifest or the repo cache
+	// must not run concurrently
+	locked := writesState(cmd)
+	if cmd == "check" {
+		// --notify records what it notified about, --commits fetches into
+		// the repo cache
+		notify, commits, _ := checkFlags(os.Args[2:])
+		locked = notify || commits
+	}
+	if locked {
+		unlock, err := inst.Lock()
+		if err != nil {
+			printError(err)
+			return 1
+		}
+		defer unlock()
+	}
+
+	// Auto-prune once the configured interval has passed, after the
+	// command itself and before the lock is released
+	switch cmd {
+	case "install", "remove", "purge", "update", "upgrade":
+		if !dryRun && inst.PruneDue() {
+			defer func() {
+				fmt.Println()
+				if err := prune(ctx); err != nil {
+					fmt.Fprint(os.Stderr, i18n.T("Warning: Auto-prune failed: %v\n", err))
+				}
+			}()
+		}
+	}
+
+	switch cmd {
+	case "sync":
+		opts := installer.SyncOptions{Diff: len(os.Args) > 2 && os.Args[2] == "--diff"}
+		return exitCode(inst.Sync(ctx, opts))
+	case "version":
+		fmt.Println(version)
+	case "install":
+		opts, args, err := parseBuildFlags(os.Args[2:], "-a", "--all", "--retry-failed", "--git", "--path", "-i", "--interactive")
+		if err != nil {
+			printError(err)
+			return 1
+		}
+
+		var names, gitURLs, localDirs []string
+		all, interactive := false, false
+		for n := 0; n < len(args); n++ {
+			switch args[n] {
+			case "-a", "--all":
+				all = true
+			case "--retry-failed":
+				all = true
+				opts.RetryFailed = true
+			case "-i", "--interactive":
+				interactive = true
+			case "--git":
+				if n+1 >= len(args) {
+					fmt.Fprintln(os.Stderr, i18n.T("Error: repository URL required"))
+					return 1
+				}
+				gitURLs = append(gitURLs, args[n+1])
+				n++
+			case "--path":
+				if n+1 >= len(args) {
+					fmt.Fprintln(os.Stderr, i18n.T("Error: directory required"))
+					return 1
+				}
+				localDirs = append(localDirs, args[n+1])
+				n++
+			default:
+				names = append(names, args[n])
+			}
+		}
+
+		if interactive {
+			if all || len(gitURLs) > 0 || len(names) > 1 {
+				fmt.Fprintln(os.Stderr, i18n.T("Error: --interactive takes at most one search query"))
+				return 1
+			}
+			selected, err := selectPackages(strings.Join(names, ""))
+			if err == installer.ErrAborted {
+				fmt.Println(i18n.T("Installation aborted."))
+				return 1
+			}
+			if err != nil {
+				printError(err)
+				return exitCode(err)
+			}
+			if len(selected) == 0 {
+				return 0
+			}
+			names = selected
+		}
+
+		switch {
+		case all && (len(names) > 0 || len(gitURLs) > 0 || len(localDirs) > 0):
+			fmt.Fprintln(os.Stderr, i18n.T("Error: --all can't be combined with package names"))
+			return 1
+		case all && len(opts.Aliases) > 0:
+			fmt.Fprintln(os.Stderr, i18n.T("Error: --as can't be used with --all"))
+			return 1
+		case all:
+			return exitCode(inst.InstallAll(ctx, opts))
+		case len(names)+len(gitURLs)+len(localDirs) == 0:
+			fmt.Fprintln(os.Stderr, i18n.T("Error: package name required"))
+			return 1
+		case len(names)+len(gitURLs)+len(localDirs) > 1 && len(opts.Aliases) > 0:
+			fmt.Fprintln(os.Stderr, i18n.T("Error: --as can only be used when installing a single package"))
+			return 1
+		}
+
+		err = forEachPackage(names, "install", func(arg string) error {
+			// name@constraint builds the newest matching tag, e.g. tool@^1.2
+			name, constraint, _ := strings.Cut(arg, "@")
+			o := opts
+			o.Constraint = constraint
+			return inst.Install(ctx, name, o)
+		})
+		gitErr := forEachPackage(gitURLs, "install", func(url string) error {
+			return inst.InstallGit(ctx, url, opts)
+		})
+		localErr := forEachPackage(localDirs, "install", func(dir string) error {
+			return inst.InstallLocal(ctx, dir, opts)
+		})
+		return exitCode(errors.Join(err, gitErr, localErr))
+	case "remove", "purge":
+		names, err := removalNames(os.Args[2:])
+		if err != nil {
+			printError(err)
+			return exitCode(err)
+		}
+		if len(names) == 0 {
+			fmt.Println(i18n.T("No packages installed"))
+			return 0
+		}
+		if len(names) == 1 {
+			if !confirmRemoval(names[0], cmd == "purge") {
+				fmt.Println(i18n.T("Removal aborted."))
+				return 1
+			}
+		} else if !confirmBatchRemoval(names, cmd == "purge") {
+			fmt.Println(i18n.T("Removal aborted."))
+			return 1
+		}
+
+		failed, err := inst.RemovePackages(ctx, names, cmd == "purge")
+		if len(names) > 1 {
+			fmt.Print(i18n.T("\n%d of %d package(s) processed", len(names)-len(failed), len(names)))
+			if len(failed) > 0 {
+				fmt.Print(i18n.T(", failed to %s: %s", cmd, strings.Join(failed, ", ")))
+			}
+			fmt.Println()
+		}
+		return exitCode(err)
+	case "list":
+		format, args, err := formatFlag(os.Args[2:])
+		if err == nil && len(args) > 0 {
+			err = fmt.Errorf("unexpected argument %s", args[0])
+		}
+		if err == nil {
+			err = listPackages(format)
+		}
+		if err != nil {
+			printError(err)
+			return 1
+		}
+		return 0
+	case "update":
+		opts, args, err := parseBuildFlags(os.Args[2:])
+		if err != nil {
+			printError(err)
+			return 1
+		}
+		if len(args) < 1 {
+			fmt.Fprintln(os.Stderr, i18n.T("Error: package name required"))
+			return 1
+		}
+		if len(args) > 1 && len(opts.Aliases) > 0 {
+			fmt.Fprintln(os.Stderr, i18n.T("Error: --as can only be used when updating a single package"))
+			return 1
+		}
+		return exitCode(forEachPackage(args, "update", func(name string) error {
+			return inst.Update(ctx, name, opts)
+		}))
+	case "upgrade":
+		all := false
+		var names []string
+		for _, arg := range os.Args[2:] {
+			switch {
+			case arg == "--all":
+				all = true
+			case strings.HasPrefix(arg, "-"):
+				printError(fmt.Errorf("unknown option: %s", arg))
+				return 1
+			default:
+				names = append(names, arg)
+			}
+		}
+		if all == (len(names) > 0) {
+			fmt.Fprintln(os.Stderr, i18n.T("Error: package name or --all required"))
+			return 1
+		}
+		return exitCode(inst.Upgrade(ctx, names))
+	case "search":
+		var opts manifest.SearchOptions
+		long, filtered := false, false
+		installed := ""
+		format, args, err := formatFlag(os.Args[2:])
+		if err != nil {
+			printError(err)
+			return 1
+		}
+		for i := 0; i < len(args); i++ {
+			switch args[i] {
+			case "--long", "-l":
+				long = true
+			case "--installed":
+				installed, filtered = "yes", true
+			case "--not-installed":
+				installed, filtered = "no", true
+			case "--license", "--keyword", "--os", "--required-tool":
+				if i+1 >= len(args) {
+					fmt.Fprint(os.Stderr, i18n.T("Error: %s requires a value\n", args[i]))
+					return 1
+				}
+				switch args[i] {
+				case "--license":
+					opts.License = args[i+1]
+				case "--keyword":
+					opts.Keyword = args[i+1]
+				case "--os":
+					opts.OS = args[i+1]
+				default:
+					opts.RequiredTool = args[i+1]
+				}
+				filtered = true
+				i++
+			default:
+				if isFlag(args[i]) {
+					fmt.Fprint(os.Stderr, i18n.T("Error: unknown flag %s\n", args[i]))
+					return 1
+				}
+				opts.Query = args[i]
+			}
+		}
+		if opts.Query == "" && !filtered && format == "" {
+			fmt.Fprintln(os.Stderr, i18n.T("Error: search keyword required"))
+			return 1
+		}
+		return exitCode(searchPackages(opts, installed, long, format))
+	case "check":
+		// Exit codes: 0 up to date, 1 outdated, 2 the check failed
+		notify, commits, quiet := checkFlags(os.Args[2:])
+		if notify {
+			if err := checkUpdates(ctx, true); err != nil {
+				return 2
+			}
+			return 0
+		}
+		outdated, err := checkStatus(ctx, commits, quiet)
+		if err != nil {
+			return 2
+		}
+		if outdated {
+			return 1
+		}
+		return 0
+	case "watch":
+		interval := inst.Config.GetWatchInterval()
+		once, timer := false, false
+		for n := 2; n < len(os.Args); n++ {
+			switch os.Args[n] {
+			case "--once":
+				once = true
+			case "--install-timer":
+				timer = true
+			case "--interval":
+				if n+1 < len(os.Args) {
+					interval = os.Args[n+1]
+					n++
+				}
+			}
+		}
+		d, err := parseInterval(interval)
+		if err != nil {
+			printError(err)
+			return 1
+		}
+		// Nobody is there to answer prompts
+		inst.Confirm = nil
+
+		switch {
+		case timer:
+			err = installWatchTimer(d)
+		case once:
+			err = watchOnce(ctx)
+		default:
+			ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+			defer stop()
+			err = watch(ctx, d)
+		}
+		if err != nil {
+			printError(err)
+			return 1
+		}
+		return 0
+	case "owns":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, i18n.T("Error: binary name or path required"))
+			return 1
+		}
+		if err := showOwner(os.Args[2]); err != nil {
+			return 1
+		}
+		return 0
+	case "adopt":
+		if err := adoptBinary(ctx, os.Args[2:]); err != nil {
+			printError(err)
+			return 1
+		}
+		return 0
+	case "orphans":
+		if err := runOrphans(os.Args[2:]); err != nil {
+			if err != installer.ErrAborted {
+				printError(err)
+			}
+			return 1
+		}
+		return 0
+	case "vendor":
+		all := false
+		outDir := "."
+		var names []string
+		for n := 2; n < len(os.Args); n++ {
+			switch os.Args[n] {
+			case "--all":
+				all = true
+			case "-o", "--output":
+				if n+1 < len(os.Args) {
+					outDir = os.Args[n+1]
+					n++
+				}
+			default:
+				names = append(names, os.Args[n])
+			}
+		}
+		if err := vendorPackages(ctx, names, all, outDir); err != nil {
+			printError(err)
+			return 1
+		}
+		return 0
+	case "verify":
+		rebuild := false
+		var names []string
+		for _, arg := range os.Args[2:] {
+			if arg == "--rebuild" {
+				rebuild = true
+			} else {
+				names = append(names, arg)
+			}
+		}
+		if len(names) == 0 {
+			fmt.Fprintln(os.Stderr, i18n.T("Error: package name required"))
+			return 1
+		}
+		ok, err := verifyPackage(ctx, names[0], rebuild)
+		if err != nil {
+			printError(err)
+			return 1
+		}
+		if !ok {
+			fmt.Println(i18n.T("\n✗ Verification failed"))
+			return 1
+		}
+		fmt.Println(i18n.T("\n✓ Verified"))
+		return 0
+	case "audit":
+		failOn := -1
+		var names []string
+		for n := 2; n < len(os.Args); n++ {
+			arg := os.Args[n]
+			switch {
+			case arg == "--fail-on" || strings.HasPrefix(arg, "--fail-on="):
+				severity, ok := strings.CutPrefix(arg, "--fail-on=")
+				if !ok {
+					if n+1 >= len(os.Args) {
+						fmt.Fprint(os.Stderr, i18n.T("Error: %s requires a value\n", arg))
+						return 1
+					}
+					severity = os.Args[n+1]
+					n++
+				}
+				if failOn = installer.SeverityRank(severity); failOn < 0 {
+					fmt.Fprint(os.Stderr, i18n.T("Error: unknown severity '%s' (low, medium, high, critical)\n", severity))
+					return 1
+				}
+			case strings.HasPrefix(arg, "-"):
+				printError(fmt.Errorf("unknown option: %s", arg))
+				return 1
+			default:
+				names = append(names, arg)
+			}
+		}
+		highest, err := audit(ctx, names)
+		if err != nil {
+			printError(err)
+			return exitCode(err)
+		}
+		if failOn >= 0 && highest >= failOn {
+			return 1
+		}
+		return 0
+	case "readme":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, i18n.T("Error: package name required"))
+			return 1
+		}
+		if err := showReadme(os.Args[2]); err != nil {
+			printError(err)
+			return 1
+		}
+		return 0
+	case "diff":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, i18n.T("Error: package name required"))
+			return 1
+		}
+		return exitCode(forEachPackage(os.Args[2:], "diff", func(name string) error {
+			return inst.Diff(ctx, name)
+		}))
+	case "logs":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, i18n.T("Error: package name required"))
+			return 1
+		}
+		if err := showBuildLog(os.Args[2]); err != nil {
+			printError(err)
+			return 1
+		}
+		return 0
+	case "submit":
+		var name string
+		var opts installer.SubmitOptions
+		for _, arg := range os.Args[2:] {
+			switch {
+			case arg == "--no-build":
+				opts.SkipBuild = true
+			case strings.HasPrefix(arg, "-") || name != "":
+				fmt.Fprint(os.Stderr, i18n.T("Error: unknown flag %s\n", arg))
+				return 1
+			default:
+				name = arg
+			}
+		}
+		if name == "" {
+			fmt.Fprintln(os.Stderr, i18n.T("Error: package name required"))
+			return 1
+		}
+		url, err := inst.Submit(ctx, name, opts)
+		if err != nil {
+			printError(err)
+			return exitCode(err)
+		}
+		if url != "" {
+			fmt.Print(i18n.T("✓ Opened %s\n", url))
+		}
+		return 0
+	case "fetch":
+		if err := fetchRepos(ctx, os.Args[2:]); err != nil {
+			printError(err)
+			return exitCode(err)
+		}
+		return 0
+	case "discover":
+		if err := discover(ctx, os.Args[2:]); err != nil {
+			if err != installer.ErrAborted {
+				printError(err)
+			}
+			return exitCode(err)
+		}
+		return 0
+	case "browse":
+		category := ""
+		if len(os.Args) > 2 {
+			category = strings.Join(os.Args[2:], " ")
+		}
+		if err := browse(category); err != nil {
+			if err != installer.ErrManifestNotFound {
+				printError(err)
+			}
+			return exitCode(err)
+		}
+		return 0
+	case "licenses":
+		asJSON := len(os.Args) > 2 && os.Args[2] == "--json"
+		if err := showLicenses(asJSON); err != nil {
+			printError(err)
+			return 1
+		}
+		return 0
+	case "prune":
+		if err := prune(ctx); err != nil {
+			printError(err)
+			return 1
+		}
+		return 0
+	case "gc":
+		if err := gc(ctx); err != nil {
+			printError(err)
+			return 1
+		}
+		return 0
+	case "rollback":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, i18n.T("Error: package name required"))
+			return 1
+		}
+		err := inst.Rollback(ctx, os.Args[2])
+		if err != nil && err != installer.ErrNotInstalled {
+			printError(err)
+		}
+		return exitCode(err)
+	case "use":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, i18n.T("Error: package name required"))
+			return 1
+		}
+		name, version, found := strings.Cut(os.Args[2], "@")
+		if !found {
+			if err := showVersions(name); err != nil {
+				printError(err)
+				return 1
+			}
+			return 0
+		}
+		return exitCode(inst.Use(ctx, name, version))
+	case "alternatives":
+		if len(os.Args) < 4 {
+			name := ""
+			if len(os.Args) == 3 {
+				name = os.Args[2]
+			}
+			if err := showAlternatives(name); err != nil {
+				printError(err)
+				return 1
+			}
+			return 0
+		}
+		if err := inst.SetAlternative(os.Args[2], os.Args[3]); err != nil {
+			printError(err)
+			return 1
+		}
+		fmt.Print(i18n.T("✓ %s now provided by %s\n", os.Args[2], os.Args[3]))
+		return 0
+	case "pin":
+		if len(os.Args) < 4 {
+			if err := showPins(); err != nil {
+				printError(err)
+				return 1
+			}
+			return 0
+		}
+		if err := inst.Pin(ctx, os.Args[2], os.Args[3]); err != nil {
+			printError(err)
+			return exitCode(err)
+		}
+		fmt.Print(i18n.T("✓ %s pinned to %s, run 'binrex update %s' to build it\n", os.Args[2], os.Args[3], os.Args[2]))
+		return 0
+	case "unpin":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, i18n.T("Error: package name required"))
+			return 1
+		}
+		if err := inst.Unpin(os.Args[2]); err != nil {
+			printError(err)
+			return 1
+		}
+		fmt.Print(i18n.T("✓ %s follows the manifest again\n", os.Args[2]))
+		return 0
+	case "snapshot":
+		if err := runSnapshot(ctx, os.Args[2:]); err != nil {
+			if err != installer.ErrAborted {
+				printError(err)
+			}
+			return exitCode(err)
+		}
+		return 0
+	case "watch-build":
+		if len(os.Args) != 3 {
+			fmt.Fprintln(os.Stderr, i18n.T("Error: usage: watch-build <name>"))
+			return 1
+		}
+		if err := inst.WatchBuild(ctx, os.Args[2]); err != nil {
+			printError(err)
+			return exitCode(err)
+		}
+		return 0
+	case "dev":
+		if err := runDev(ctx, os.Args[2:]); err != nil {
+			printError(err)
+			return exitCode(err)
+		}
+		return 0
+	case "run":
+		return runPackage(ctx, os.Args[2:])
+	case "shell":
+		return packageShell(ctx, os.Args[2:])
+	case "override":
+		if err := runOverride(os.Args[2:]); err != nil {
+			printError(err)
+			return 1
+		}
+		return 0
+	case "source":
+		if err := runSource(os.Args[2:]); err != nil {
+			printError(err)
+			return 1
+		}
+		return 0
+	case "init-shell":
+		shell := installer.DetectShell()
+		printOnly := false
+		for _, arg := range os.Args[2:] {
+			if arg == "--print" {
+				printOnly = true
+			} else {
+				shell = arg
+			}
+		}
+		if printOnly {
+			fmt.Println(inst.ShellPathLine(shell))
+			return 0
+		}
+		if err := inst.InitShell(shell); err != nil {
+			printError(err)
+			return 1
+		}
+		return 0
+	case "env":
+		shell := installer.DetectShell()
+		if len(os.Args) > 2 {
+			shell = os.Args[2]
+		}
+		fmt.Print(inst.ShellEnv(shell))
+		return 0
+	case "completion":
+		shell := installer.DetectShell()
+		if len(os.Args) > 2 {
+			shell = os.Args[2]
+		}
+		script, err := completionScript(shell)
+		if err != nil {
+			printError(err)
+			return 1
+		}
+		fmt.Print(script)
+		return 0
+	case "__complete":
+		if len(os.Args) != 3 || (os.Args[2] != "available" && os.Args[2] != "installed") {
+			return 1
+		}
+		return exitCode(completePackages(os.Args[2]))
+	case "profiles":
+		if err := showProfiles(basePaths); err != nil {
+			printError(err)
+			return 1
+		}
+		return 0
+	case "history":
+		pkgName := ""
+		if len(os.Args) > 2 {
+			pkgName = os.Args[2]
+		}
+		if err := showHistory(pkgName); err != nil {
+			printError(err)
+			return 1
+		}
+		return 0
+	case "files":
+		changedOnly, showLog := false, false
+		var names []string
+		for _, arg := range os.Args[2:] {
+			switch arg {
+			case "--changed":
+				changedOnly = true
+			case "--log":
+				showLog = true
+			default:
+				names = append(names, arg)
+			}
+		}
+		if showLog {
+			name := ""
+			if len(names) > 0 {
+				name = names[0]
+			}
+			return exitCode(showFileLog(name))
+		}
+		if len(names) == 0 {
+			fmt.Fprintln(os.Stderr, i18n.T("Error: package name required"))
+			return 1
+		}
+		ok, err := showFiles(names[0], changedOnly)
+		if err != nil {
+			printError(err)
+			return 1
+		}
+		if !ok {
+			return 1
+		}
+		return 0
+	case "verify-state":
+		accept := len(os.Args) > 2 && os.Args[2] == "--accept"
+		if err := inst.VerifyState(accept); err != nil {
+			printError(err)
+			return 1
+		}
+		return 0
+	case "restore-state":
+		n := 0
+		if len(os.Args) > 2 {
+			var err error
+			n, err = strconv.Atoi(os.Args[2])
+			if err != nil || n < 1 || n > state.Backups {
+				fmt.Fprint(os.Stderr, i18n.T("Error: backup number must be between 1 and %d\n", state.Backups))
+				return 1
+			}
+		}
+		if err := restoreState(n); err != nil {
+			return 1
+		}
+		return 0
+	case "tree":
+		return exitCode(showTree(os.Args[2:]))
+	case "info":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, i18n.T("Error: package name required"))
+			return 1
+		}
+		return exitCode(showPackageInfo(os.Args[2]))
+	case "daemon", "web":
+		addr := daemon.DefaultAddr
+		if len(os.Args) > 3 && os.Args[2] == "--addr" {
+			addr = os.Args[3]
+		}
+		// API clients can't answer prompts
+		inst.Confirm = nil
+
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		server := daemon.New(inst)
+		server.UI = cmd == "web"
+		if server.UI {
+			fmt.Print(i18n.T("binrex web UI at http://%s\n", addr))
+		} else {
+			fmt.Print(i18n.T("binrex daemon listening on http://%s\n", addr))
+			fmt.Print(i18n.T("Send the token in %s as \"Authorization: Bearer <token>\"\n", server.TokenPath()))
+		}
+		if err := server.ListenAndServe(ctx, addr); err != nil {
+			printError(err)
 			return 1
 		}
-		searchPackages(os.Args[2])
 		return 0
 	case "help":
 		printUsage(os.Args[0])
 		return 0
 	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", cmd)
+		fmt.Fprint(os.Stderr, i18n.T("Unknown command: %s\n", cmd))
 		printUsage(os.Args[0])
 		return 1
 	}
@@ -0,0 +1,448 @@
+// Package config holds binrex's filesystem layout and user configuration.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultProfile is the profile used when none is selected
+const DefaultProfile = "default"
+
+// Constants
+const (
+	RepoURL            = "https://github.com/nurysso/binrex"
+	DefaultManifestURL = RepoURL + "/raw/main/manifest.json"
+	DefaultOSVURL      = "https://api.osv.dev"
+	DefaultGitHubAPI   = "https://api.github.com"
+	DefaultKeyserver   = "https://keys.openpgp.org"
+)
+
+// Paths are the directories and files binrex works with
+type Paths struct {
+	Profile   string
+	ConfigDir string
+	// StateDir holds installed.json, its backups, the history and the lock
+	StateDir      string
+	CacheDir      string
+	BinDir        string
+	ManifestPath  string
+	InstalledPath string
+	LockPath      string
+	ConfigPath    string
+	HistoryPath   string
+	// StoreDir keeps every built version of a package in an entry named
+	// after its content hash, the bin dir entries link into it
+	StoreDir string
+	// ApplicationsDir and IconsDir receive desktop entries and icons of
+	// GUI packages
+	ApplicationsDir string
+	IconsDir        string
+	// SystemdUserDir receives systemd user units of daemon packages
+	SystemdUserDir string
+	// LogDir keeps the output of recent builds
+	LogDir string
+}
+
+// DefaultPaths returns the standard per-user layout, following the XDG
+// base directory variables with the usual fallbacks under HOME
+func DefaultPaths() (Paths, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return Paths{}, fmt.Errorf("could not determine HOME directory: %w", err)
+	}
+
+	configHome := xdgHome("XDG_CONFIG_HOME", home, ".config")
+	configDir := filepath.Join(configHome, "binrex")
+	dataDir := filepath.Join(xdgHome("XDG_DATA_HOME", home, ".local", "share"), "binrex")
+	stateDir := filepath.Join(xdgHome("XDG_STATE_HOME", home, ".local", "state"), "binrex")
+	return Paths{
+		Profile:         DefaultProfile,
+		ConfigDir:       configDir,
+		StateDir:        stateDir,
+		CacheDir:        filepath.Join(xdgHome("XDG_CACHE_HOME", home, ".cache"), "binrex", "repos"),
+		BinDir:          filepath.Join(home, ".local", "bin"),
+		ManifestPath:    filepath.Join(configDir, "manifest.json"),
+		InstalledPath:   filepath.Join(stateDir, "installed.json"),
+		LockPath:        filepath.Join(stateDir, "binrex.lock"),
+		ConfigPath:      filepath.Join(configDir, "config.json"),
+		HistoryPath:     filepath.Join(stateDir, "history.jsonl"),
+		StoreDir:        filepath.Join(dataDir, "store"),
+		ApplicationsDir: filepath.Join(filepath.Dir(dataDir), "applications"),
+		IconsDir:        filepath.Join(filepath.Dir(dataDir), "icons"),
+		SystemdUserDir:  filepath.Join(configHome, "systemd", "user"),
+		LogDir:          filepath.Join(stateDir, "logs"),
+	}, nil
+}
+
+// SystemPaths returns the layout of --system installs for every user:
+// binaries in /usr/local, config in /etc and state of its own in /var, so
+// per-user installs never see them
+func SystemPaths() Paths {
+	configDir := filepath.Join("/etc", "binrex")
+	stateDir := filepath.Join("/var", "lib", "binrex")
+	return Paths{
+		Profile:         DefaultProfile,
+		ConfigDir:       configDir,
+		StateDir:        stateDir,
+		CacheDir:        filepath.Join("/var", "cache", "binrex", "repos"),
+		BinDir:          filepath.Join("/usr", "local", "bin"),
+		ManifestPath:    filepath.Join(configDir, "manifest.json"),
+		InstalledPath:   filepath.Join(stateDir, "installed.json"),
+		LockPath:        filepath.Join(stateDir, "binrex.lock"),
+		ConfigPath:      filepath.Join(configDir, "config.json"),
+		HistoryPath:     filepath.Join(stateDir, "history.jsonl"),
+		StoreDir:        filepath.Join("/usr", "local", "lib", "binrex", "store"),
+		ApplicationsDir: filepath.Join("/usr", "local", "share", "applications"),
+		IconsDir:        filepath.Join("/usr", "local", "share", "icons"),
+		SystemdUserDir:  filepath.Join("/etc", "systemd", "user"),
+		LogDir:          filepath.Join("/var", "log", "binrex"),
+	}
+}
+
+// CreateDirectories creates the directories binrex writes into
+func (p Paths) CreateDirectories() error {
+	dirs := []string{p.ConfigDir, p.StateDir, p.CacheDir, p.BinDir, p.StoreDir, filepath.Dir(p.InstalledPath)}
+
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("error creating %s: %w", dir, err)
+		}
+	}
+
+	return nil
+}
+
+// Profile is a named installation with its own bin dir and installed.json
+type Profile struct {
+	// BinDir defaults to $XDG_DATA_HOME/binrex/profiles/<name>/bin
+	BinDir string `json:"bin_dir"`
+}
+
+// Config represents the user's config.json
+type Config struct {
+	// ManifestURLs are tried in order when syncing the manifest
+	ManifestURLs []string `json:"manifest_urls"`
+	// SourceMirrors maps a repository or download URL prefix to alternative
+	// prefixes, e.g. "https://github.com/" -> ["https://ghproxy.example.com/github.com/"]
+	SourceMirrors map[string][]string `json:"source_mirrors"`
+	// Profile is the profile to use when --profile isn't given
+	Profile string `json:"profile"`
+	// Profiles are the named profiles besides "default"
+	Profiles map[string]Profile `json:"profiles"`
+	// AutoPruneDays runs prune after install/update/remove once this many
+	// days have passed since the last prune, 0 disables it
+	AutoPruneDays int `json:"auto_prune_days"`
+	// Language of binrex's messages, e.g. "de". When empty LC_ALL,
+	// LC_MESSAGES and LANG decide.
+	Language string `json:"language"`
+	// BuildJobs is the number of parallel build jobs, 0 means one per CPU
+	BuildJobs int `json:"build_jobs"`
+	// CompilerCache is the compiler cache builds run through, "sccache" or
+	// "ccache". When empty whichever is installed is used, "none" turns
+	// it off.
+	CompilerCache string `json:"compiler_cache"`
+	// RemoteBuildHost is an SSH host, e.g. "user@buildbox", that clones and
+	// builds source packages, only the binaries are copied back
+	RemoteBuildHost string `json:"remote_build_host"`
+	// ContainerBuilds runs build commands inside each package's build_image
+	ContainerBuilds bool `json:"container_builds"`
+	// Sandbox runs local builds under "bwrap" or "firejail", which only
+	// let them write to the package's repo and hide the home directory.
+	// "auto" uses whichever is installed, empty builds unsandboxed.
+	Sandbox string `json:"sandbox"`
+	// SandboxPaths are more paths in the home directory sandboxed builds
+	// can read, on top of the directories on PATH, e.g. "~/.config/git"
+	SandboxPaths []string `json:"sandbox_paths"`
+	// NoNetworkBuilds fetches the dependencies of local builds with
+	// cargo fetch or go mod download and then runs the build without
+	// network, so builds downloading anything else fail
+	NoNetworkBuilds bool `json:"no_network_builds"`
+	// ContainerRuntime is "podman" or "docker", detected when empty
+	ContainerRuntime string `json:"container_runtime"`
+	// DefaultBuildImage is used for packages that declare no build_image
+	DefaultBuildImage string `json:"default_build_image"`
+	// EnableServices enables and starts systemd user units on install
+	EnableServices bool `json:"enable_services"`
+	// WatchInterval is how often watch checks for updates, e.g. "24h"
+	WatchInterval string `json:"watch_interval"`
+	// WatchAction is what watch does with outdated packages: "notify"
+	// (default) or "upgrade"
+	WatchAction string `json:"watch_action"`
+	// AllowedToolInstallers are the toolchain installers
+	// --install-missing-tools may run: "rustup", "go", "build-essential".
+	// Defaults to rustup and go.
+	AllowedToolInstallers []string `json:"allowed_tool_installers"`
+	// OSVURL is the OSV API used by audit
+	OSVURL string `json:"osv_url"`
+	// GitHubAPIURL is the GitHub API used to look up release assets
+	GitHubAPIURL string `json:"github_api_url"`
+	// GitHubToken authenticates the GitHub API calls of submit. GITHUB_TOKEN
+	// and GH_TOKEN are used when empty.
+	GitHubToken string `json:"github_token"`
+	// AuthTokens maps a host or URL prefix, e.g.
+	// "https://pkgs.example.com/binrex/", to a bearer token sent with
+	// manifest syncs and downloads from it. A token starting with $ is
+	// read from that environment variable.
+	AuthTokens map[string]string `json:"auth_tokens"`
+	// GitCredentials asks git's credential helpers for the login of
+	// download hosts that have no token or ~/.netrc entry
+	GitCredentials bool `json:"git_credentials"`
+	// SubmitRepo is the "owner/repo" whose manifest.json submit proposes
+	// packages to, binrex's own by default
+	SubmitRepo string `json:"submit_repo"`
+	// BinDirs are additional bin directories by name, e.g.
+	// "cargo": "~/.cargo/bin", which install_dir settings can refer to
+	BinDirs map[string]string `json:"bin_dirs"`
+	// Codesign ad-hoc signs built binaries on macOS so Gatekeeper doesn't
+	// block them
+	Codesign bool `json:"codesign"`
+	// InstallDirs maps a package name to the directory its binaries are
+	// linked into instead of the bin dir, a bin_dirs name or a path
+	InstallDirs map[string]string `json:"install_dirs"`
+	// SourceKeys maps a manifest URL to the public key file (GPG or
+	// minisign) its signature must verify with, on top of the keys added
+	// with 'binrex source trust'
+	SourceKeys map[string]string `json:"source_keys"`
+	// Keyserver is where the signing_keys of packages are fetched from
+	// when they aren't in the user's keyring, keys.openpgp.org by default
+	Keyserver string `json:"keyserver"`
+	// DeleteSources deletes a package's cached repository once its
+	// binaries are installed, like --no-keep-source
+	DeleteSources bool `json:"delete_sources"`
+	// LimitRate caps the download speed of syncs, downloads and clones in
+	// bytes per second, e.g. "500k" or "2M", like --limit-rate
+	LimitRate string `json:"limit_rate"`
+	// IntegrityKey is a file with a secret key, e.g.
+	// "~/.config/binrex/integrity.key", that installed.json and the
+	// manifest are sealed with by an HMAC instead of a plain checksum, so
+	// other programs can't change them unnoticed
+	IntegrityKey string `json:"integrity_key"`
+	// NetworkRetries is how often a clone, pull or download failing with
+	// a transient network error is tried again, waiting 2s, 4s, 8s and so
+	// on in between. 0 retries 3 times, -1 not at all.
+	NetworkRetries int `json:"network_retries"`
+}
+
+// Load loads config.json, a missing file means defaults
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Config{}, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return &cfg, nil
+}
+
+// GetManifestURLs returns the manifest URLs to try, primary first
+func (c *Config) GetManifestURLs() []string {
+	if len(c.ManifestURLs) > 0 {
+		return c.ManifestURLs
+	}
+	return []string{DefaultManifestURL}
+}
+
+// GetWatchInterval returns the configured watch interval, 24h by default
+func (c *Config) GetWatchInterval() string {
+	if c.WatchInterval != "" {
+		return c.WatchInterval
+	}
+	return "24h"
+}
+
+// GetWatchAction returns the configured watch action, notify by default
+func (c *Config) GetWatchAction() string {
+	if c.WatchAction != "" {
+		return c.WatchAction
+	}
+	return "notify"
+}
+
+// GetOSVURL returns the OSV API base URL
+func (c *Config) GetOSVURL() string {
+	if c.OSVURL != "" {
+		return strings.TrimRight(c.OSVURL, "/")
+	}
+	return DefaultOSVURL
+}
+
+// GetGitHubToken returns the GitHub token from the config or the
+// environment, "" when there is none
+func (c *Config) GetGitHubToken() string {
+	if c.GitHubToken != "" {
+		return c.GitHubToken
+	}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		return token
+	}
+	return os.Getenv("GH_TOKEN")
+}
+
+// GetSubmitRepo returns the repository submit opens pull requests against
+func (c *Config) GetSubmitRepo() string {
+	if c.SubmitRepo != "" {
+		return c.SubmitRepo
+	}
+	return strings.TrimPrefix(RepoURL, "https://github.com/")
+}
+
+// GetGitHubAPIURL returns the GitHub API base URL
+func (c *Config) GetGitHubAPIURL() string {
+	if c.GitHubAPIURL != "" {
+		return strings.TrimRight(c.GitHubAPIURL, "/")
+	}
+	return DefaultGitHubAPI
+}
+
+// GetKeyserver returns the keyserver base URL
+func (c *Config) GetKeyserver() string {
+	if c.Keyserver != "" {
+		return strings.TrimRight(c.Keyserver, "/")
+	}
+	return DefaultKeyserver
+}
+
+// ParseRate parses a transfer rate in bytes per second with an optional
+// k, M or G suffix (powers of 1024), e.g. "500k". An empty rate is 0,
+// no limit.
+func ParseRate(s string) (int64, error) {
+	rate := strings.TrimSuffix(strings.TrimSpace(s), "/s")
+	rate = strings.TrimRight(rate, "bB")
+	if rate == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	switch rate[len(rate)-1] {
+	case 'k', 'K':
+		multiplier = 1 << 10
+	case 'm', 'M':
+		multiplier = 1 << 20
+	case 'g', 'G':
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		rate = rate[:len(rate)-1]
+	}
+
+	n, err := strconv.ParseFloat(rate, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid rate %q, expected e.g. 500k or 2M", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// ResolveBinDir turns an install_dir setting into an absolute directory:
+// a bin_dirs name, a path starting with ~/ or a path relative to the
+// working directory
+func (c *Config) ResolveBinDir(dir string) (string, error) {
+	if named, ok := c.BinDirs[dir]; ok {
+		dir = named
+	}
+	if rest, ok := strings.CutPrefix(dir, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("could not determine HOME directory: %w", err)
+		}
+		dir = filepath.Join(home, rest)
+	}
+	return filepath.Abs(dir)
+}
+
+// GetRepoURLs returns the clone URLs to try for a repository: the primary
+// URL, the package's own mirrors, then any configured prefix mirrors.
+// Release and url downloads are tried at the prefix mirrors the same way.
+func (c *Config) GetRepoURLs(repoURL string, mirrors []string) []string {
+	urls := []string{repoURL}
+	urls = append(urls, mirrors...)
+
+	prefixes := make([]string, 0, len(c.SourceMirrors))
+	for prefix := range c.SourceMirrors {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	for _, prefix := range prefixes {
+		if !strings.HasPrefix(repoURL, prefix) {
+			continue
+		}
+		for _, alt := range c.SourceMirrors[prefix] {
+			urls = append(urls, alt+strings.TrimPrefix(repoURL, prefix))
+		}
+	}
+
+	return urls
+}
+
+// ActiveProfile returns the profile to use: name if set, otherwise the
+// configured one, otherwise "default"
+func (c *Config) ActiveProfile(name string) string {
+	if name != "" {
+		return name
+	}
+	if c.Profile != "" {
+		return c.Profile
+	}
+	return DefaultProfile
+}
+
+// ProfilePaths returns p adjusted for the named profile. Every profile
+// except "default" keeps its installed.json, history, repo cache and
+// version store under its own directory, the manifest and config are shared
+func (c *Config) ProfilePaths(p Paths, name string) (Paths, error) {
+	prof, ok := c.Profiles[name]
+
+	if name == DefaultProfile {
+		if prof.BinDir != "" {
+			p.BinDir = prof.BinDir
+		}
+		return p, nil
+	}
+
+	if !ok {
+		return Paths{}, fmt.Errorf("profile %q is not defined in %s", name, p.ConfigPath)
+	}
+	if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return Paths{}, fmt.Errorf("invalid profile name %q", name)
+	}
+
+	profileDir := filepath.Join(p.StateDir, "profiles", name)
+	p.Profile = name
+	p.InstalledPath = filepath.Join(profileDir, "installed.json")
+	p.HistoryPath = filepath.Join(profileDir, "history.jsonl")
+	p.CacheDir = filepath.Join(filepath.Dir(p.CacheDir), "profiles", name, "repos")
+	p.StoreDir = filepath.Join(filepath.Dir(p.StoreDir), "profiles", name, "store")
+	p.LogDir = filepath.Join(filepath.Dir(p.LogDir), "profiles", name, "logs")
+
+	p.BinDir = prof.BinDir
+	if p.BinDir == "" {
+		p.BinDir = filepath.Join(filepath.Dir(p.StoreDir), "bin")
+	}
+
+	return p, nil
+}
+
+// ProfileNames returns the defined profile names, "default" first
+func (c *Config) ProfileNames() []string {
+	names := []string{DefaultProfile}
+	for name := range c.Profiles {
+		if name != DefaultProfile {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nurysso/binrex/pkg/state"
+)
+
+// xdgHome returns an XDG base directory from its environment variable,
+// falling back to the default under home. Relative values are ignored as
+// the spec requires.
+func xdgHome(env, home string, fallback ...string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(append([]string{home}, fallback...)...)
+}
+
+// Migration is one file or directory moved out of a legacy location
+type Migration struct {
+	From string
+	To   string
+}
+
+// MigrateLegacy moves files from the locations used before binrex followed
+// the XDG base directories: state out of ~/.config/binrex, and config and
+// store when the XDG variables point elsewhere. The repo cache stays where
+// it is since installed.json records its paths. Nothing is overwritten, a
+// file already at the new location wins. Moving the store relinks the bin
+// dir and rewrites the store paths installed.json records.
+func MigrateLegacy(p Paths) ([]Migration, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("could not determine HOME directory: %w", err)
+	}
+
+	legacyConfig := filepath.Join(home, ".config", "binrex")
+	legacyStore := filepath.Join(home, ".local", "share", "binrex", "store")
+
+	moves := []Migration{
+		{filepath.Join(legacyConfig, "config.json"), p.ConfigPath},
+		{filepath.Join(legacyConfig, "manifest.json"), p.ManifestPath},
+		{filepath.Join(legacyConfig, "installed.json"), p.InstalledPath},
+		{filepath.Join(legacyConfig, "history.jsonl"), p.HistoryPath},
+		{filepath.Join(legacyConfig, "last-prune"), filepath.Join(p.StateDir, "last-prune")},
+		{filepath.Join(legacyConfig, "profiles"), filepath.Join(p.StateDir, "profiles")},
+		{legacyStore, p.StoreDir},
+	}
+	backups, _ := filepath.Glob(filepath.Join(legacyConfig, "installed.json.*"))
+	for _, backup := range backups {
+		moves = append(moves, Migration{backup, p.InstalledPath + filepath.Ext(backup)})
+	}
+
+	var done []Migration
+	for _, m := range moves {
+		if m.From == m.To {
+			continue
+		}
+		if _, err := os.Lstat(m.From); err != nil {
+			continue
+		}
+		if _, err := os.Lstat(m.To); err == nil {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(m.To), 0755); err != nil {
+			return done, fmt.Errorf("error creating %s: %w", filepath.Dir(m.To), err)
+		}
+		if err := os.Rename(m.From, m.To); err != nil {
+			return done, fmt.Errorf("failed to move %s to %s: %w", m.From, m.To, err)
+		}
+		done = append(done, m)
+
+		if m.From == legacyStore {
+			if err := relinkStore(p.BinDir, legacyStore, p.StoreDir); err != nil {
+				return done, err
+			}
+			if err := moveStorePaths(p.InstalledPath, legacyStore, p.StoreDir); err != nil {
+				return done, err
+			}
+		}
+	}
+
+	return done, nil
+}
+
+// relinkStore points the bin dir symlinks into a moved store at its new
+// location
+func relinkStore(binDir, from, to string) error {
+	entries, err := os.ReadDir(binDir)
+	if err != nil {
+		return nil
+	}
+
+	for _, entry := range entries {
+		link := filepath.Join(binDir, entry.Name())
+		target, err := os.Readlink(link)
+		if err != nil || !strings.HasPrefix(target, from+string(filepath.Separator)) {
+			continue
+		}
+		if err := os.Remove(link); err != nil {
+			return err
+		}
+		if err := os.Symlink(to+strings.TrimPrefix(target, from), link); err != nil {
+			return fmt.Errorf("failed to relink %s: %w", link, err)
+		}
+	}
+	return nil
+}
+
+// moveStorePaths points the store entries and links recorded in the
+// installed.json at path into a moved store
+func moveStorePaths(path, from, to string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var installed state.InstalledData
+	if err := json.Unmarshal(data, &installed); err != nil {
+		return fmt.Errorf("failed to rewrite the store paths in %s: %w", path, err)
+	}
+
+	move := func(p string) string {
+		if strings.HasPrefix(p, from+string(filepath.Separator)) {
+			return to + strings.TrimPrefix(p, from)
+		}
+		return p
+	}
+	for n := range installed.Installed {
+		pkg := &installed.Installed[n]
+		pkg.StorePath = move(pkg.StorePath)
+		for r := range pkg.FileList {
+			pkg.FileList[r].Path = move(pkg.FileList[r].Path)
+			pkg.FileList[r].Link = move(pkg.FileList[r].Link)
+		}
+	}
+	// Sealed without the integrity key, which isn't loaded yet: a state
+	// file sealed with it is reported until verify-state accepts it
+	return state.NewStore(path, nil).Save(&installed)
+}
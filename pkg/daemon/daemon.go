@@ -0,0 +1,375 @@
+// Package daemon serves a localhost HTTP API over the installer so desktop
+// frontends and scripts can drive binrex without parsing CLI output.
+//
+// Read-only endpoints return JSON. Operations stream their progress as
+// server-sent events: one "log" event per output line followed by a single
+// "done" event carrying the error, if any.
+//
+//	GET  /api/packages?q=&license=   manifest packages matching a search
+//	GET  /api/installed              installed.json entries
+//	GET  /api/outdated               installed packages with newer versions
+//	POST /api/sync                   sync the manifest
+//	POST /api/install  {"name"} or {"git"}
+//	POST /api/update   {"name"}
+//	POST /api/remove   {"name"}
+//
+// Outdated packages are objects with name, installed_version and
+// latest_version fields. Before the web UI they were spelled Name,
+// InstalledVersion and LatestVersion.
+//
+// Every API request must carry the token the daemon generates when it starts,
+// as "Authorization: Bearer <token>". It is written to daemon.token in the
+// state dir, readable only by the user. Requests for another Host than the
+// listen address, from another Origin, or POSTs whose Content-Type isn't
+// application/json are rejected, so web pages can't drive the API.
+//
+// With UI enabled a small embedded web interface is served at /. The page
+// is checked for Host and Origin like the API and carries the token its
+// calls send.
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nurysso/binrex/pkg/installer"
+	"github.com/nurysso/binrex/pkg/manifest"
+	"github.com/nurysso/binrex/pkg/state"
+)
+
+// DefaultAddr is where the daemon listens unless told otherwise
+const DefaultAddr = "127.0.0.1:7878"
+
+//go:embed web
+var webFiles embed.FS
+
+// Server exposes an Installer over HTTP
+type Server struct {
+	Installer *installer.Installer
+
+	// UI serves the embedded web interface next to the API
+	UI bool
+
+	// Token authenticates requests, generated by ListenAndServe
+	Token string
+
+	// addr is the listen address requests must be made to
+	addr string
+
+	// mu serializes operations inside this process, the installer lock
+	// guards against other binrex processes
+	mu sync.Mutex
+}
+
+// New returns a Server for inst
+func New(inst *installer.Installer) *Server {
+	return &Server{Installer: inst}
+}
+
+// Handler returns the API routes
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/packages", s.handlePackages)
+	mux.HandleFunc("GET /api/installed", s.handleInstalled)
+	mux.HandleFunc("GET /api/outdated", s.handleOutdated)
+	mux.HandleFunc("POST /api/sync", s.handleOperation(func(ctx context.Context, inst *installer.Installer, req operationRequest) error {
+		return inst.Sync(ctx, installer.SyncOptions{})
+	}))
+	mux.HandleFunc("POST /api/install", s.handleOperation(func(ctx context.Context, inst *installer.Installer, req operationRequest) error {
+		if req.Git != "" {
+			return inst.InstallGit(ctx, req.Git, installer.InstallOptions{})
+		}
+		return inst.Install(ctx, req.Name, installer.InstallOptions{})
+	}))
+	mux.HandleFunc("POST /api/update", s.handleOperation(func(ctx context.Context, inst *installer.Installer, req operationRequest) error {
+		return inst.Update(ctx, req.Name, installer.InstallOptions{})
+	}))
+	mux.HandleFunc("POST /api/remove", s.handleOperation(func(ctx context.Context, inst *installer.Installer, req operationRequest) error {
+		return inst.Remove(ctx, req.Name)
+	}))
+
+	if s.UI {
+		mux.HandleFunc("GET /{$}", s.handleIndex)
+	}
+
+	return s.guard(mux)
+}
+
+// TokenPath returns the file the daemon's token is written to
+func (s *Server) TokenPath() string {
+	return filepath.Join(s.Installer.Paths.StateDir, "daemon.token")
+}
+
+// guard rejects requests that don't come from a client of this daemon:
+// another Host (DNS rebinding), a cross-site Origin, a POST that isn't
+// JSON or an API call without the token. The web UI page carries the
+// token itself.
+func (s *Server) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != s.addr {
+			http.Error(w, "invalid host", http.StatusForbidden)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" && origin != "http://"+s.addr {
+			http.Error(w, "cross-origin requests are not allowed", http.StatusForbidden)
+			return
+		}
+		if r.Method == http.MethodPost {
+			if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+				http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+				return
+			}
+		}
+		if !s.UI || strings.HasPrefix(r.URL.Path, "/api/") {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || s.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+				http.Error(w, "missing or invalid token", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newToken returns a random token
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ListenAndServe serves the API on addr until ctx is cancelled. Only
+// loopback addresses are accepted since the API can run arbitrary builds.
+// A new token is generated and written to TokenPath for the time the
+// daemon runs.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %s: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("refusing to listen on non-loopback address %s", addr)
+	}
+
+	s.addr = addr
+	if s.Token, err = newToken(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.TokenPath()), 0755); err != nil {
+		return err
+	}
+	// Removed first, an existing file would keep its permissions
+	os.Remove(s.TokenPath())
+	if err := os.WriteFile(s.TokenPath(), []byte(s.Token+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", s.TokenPath(), err)
+	}
+	defer os.Remove(s.TokenPath())
+
+	srv := &http.Server{Addr: addr, Handler: s.Handler()}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// handleIndex serves the web UI with the token its API calls send
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	page, err := webFiles.ReadFile("web/index.html")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Write(bytes.ReplaceAll(page, []byte("{{token}}"), []byte(s.Token)))
+}
+
+func (s *Server) handlePackages(w http.ResponseWriter, r *http.Request) {
+	results, err := s.Installer.Search(manifest.SearchOptions{
+		Query:   r.URL.Query().Get("q"),
+		License: r.URL.Query().Get("license"),
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, results)
+}
+
+func (s *Server) handleInstalled(w http.ResponseWriter, r *http.Request) {
+	data, err := s.Installer.State.Load()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if data.Installed == nil {
+		data.Installed = []state.InstalledPackage{}
+	}
+	writeJSON(w, data.Installed)
+}
+
+func (s *Server) handleOutdated(w http.ResponseWriter, r *http.Request) {
+	outdated, err := s.Installer.Outdated()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, outdated)
+}
+
+// operationRequest is the JSON body of a POST operation
+type operationRequest struct {
+	Name string `json:"name"`
+	Git  string `json:"git"`
+}
+
+// operation runs against an installer whose output is streamed
+type operation func(ctx context.Context, inst *installer.Installer, req operationRequest) error
+
+// handleOperation runs op under the lock and streams its output as
+// server-sent events
+func (s *Server) handleOperation(op operation) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req operationRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		unlock, err := s.Installer.Lock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		defer unlock()
+
+		stream := newEventStream(w)
+		inst := s.Installer.WithOutput(stream.writer("stdout"), stream.writer("stderr"))
+
+		err = op(r.Context(), inst, req)
+		stream.flushPartial()
+
+		done := map[string]string{}
+		if err != nil {
+			done["error"] = err.Error()
+		}
+		stream.send("done", done)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, installer.ErrManifestNotFound) {
+		status = http.StatusNotFound
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// eventStream writes server-sent events, one per output line
+type eventStream struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+	partial map[string]*bytes.Buffer
+}
+
+func newEventStream(w http.ResponseWriter) *eventStream {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	return &eventStream{w: w, flusher: flusher, partial: map[string]*bytes.Buffer{}}
+}
+
+// send writes one event with a JSON payload
+func (e *eventStream) send(event string, payload any) {
+	data, _ := json.Marshal(payload)
+	fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", event, data)
+	if e.flusher != nil {
+		e.flusher.Flush()
+	}
+}
+
+// writer returns an io.Writer emitting a "log" event per complete line
+func (e *eventStream) writer(name string) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		buf := e.partial[name]
+		if buf == nil {
+			buf = &bytes.Buffer{}
+			e.partial[name] = buf
+		}
+		buf.Write(p)
+
+		for {
+			line, err := buf.ReadString('\n')
+			if err != nil {
+				// Keep the incomplete line for the next write
+				buf.WriteString(line)
+				break
+			}
+			e.send("log", map[string]string{"stream": name, "line": line[:len(line)-1]})
+		}
+		return len(p), nil
+	})
+}
+
+// flushPartial emits any trailing output that didn't end in a newline
+func (e *eventStream) flushPartial() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for name, buf := range e.partial {
+		if buf.Len() > 0 {
+			e.send("log", map[string]string{"stream": name, "line": buf.String()})
+			buf.Reset()
+		}
+	}
+}
+
+// writerFunc adapts a function to io.Writer
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
@@ -0,0 +1,162 @@
+package daemon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nurysso/binrex/pkg/config"
+	"github.com/nurysso/binrex/pkg/installer"
+)
+
+const testAddr = "127.0.0.1:7878"
+
+// newTestServer returns a Server over an installer in a temp HOME, as
+// ListenAndServe would set it up on testAddr
+func newTestServer(t *testing.T, ui bool) *Server {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	for _, env := range []string{"XDG_CONFIG_HOME", "XDG_CACHE_HOME", "XDG_DATA_HOME", "XDG_STATE_HOME"} {
+		t.Setenv(env, "")
+	}
+	paths, err := config.DefaultPaths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst := installer.New(paths, &config.Config{})
+	if err := inst.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(inst)
+	s.UI = ui
+	s.addr = testAddr
+	s.Token = "secret"
+	return s
+}
+
+// serve runs one request through the server's handler
+func serve(s *Server, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, r)
+	return w
+}
+
+func TestGuard(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		host   string
+		header map[string]string
+		want   int
+	}{
+		{"token", "GET", testAddr, map[string]string{"Authorization": "Bearer secret"}, http.StatusOK},
+		{"no token", "GET", testAddr, nil, http.StatusUnauthorized},
+		{"wrong token", "GET", testAddr, map[string]string{"Authorization": "Bearer guess"}, http.StatusUnauthorized},
+		{"not bearer", "GET", testAddr, map[string]string{"Authorization": "secret"}, http.StatusUnauthorized},
+		{"other host", "GET", "evil.example:7878", map[string]string{"Authorization": "Bearer secret"}, http.StatusForbidden},
+		{"same origin", "GET", testAddr, map[string]string{"Authorization": "Bearer secret", "Origin": "http://" + testAddr}, http.StatusOK},
+		{"other origin", "GET", testAddr, map[string]string{"Authorization": "Bearer secret", "Origin": "http://evil.example"}, http.StatusForbidden},
+		{"form post", "POST", testAddr, map[string]string{"Authorization": "Bearer secret", "Content-Type": "application/x-www-form-urlencoded"}, http.StatusUnsupportedMediaType},
+		{"text post", "POST", testAddr, map[string]string{"Authorization": "Bearer secret", "Content-Type": "text/plain"}, http.StatusUnsupportedMediaType},
+		{"json post without token", "POST", testAddr, map[string]string{"Content-Type": "application/json"}, http.StatusUnauthorized},
+	}
+
+	s := newTestServer(t, false)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := "/api/installed"
+			if test.method == "POST" {
+				path = "/api/remove"
+			}
+			r := httptest.NewRequest(test.method, path, strings.NewReader(`{"name":"x"}`))
+			r.Host = test.host
+			for key, value := range test.header {
+				r.Header.Set(key, value)
+			}
+			if w := serve(s, r); w.Code != test.want {
+				t.Errorf("status %d, want %d: %s", w.Code, test.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestTokenFile(t *testing.T) {
+	s := newTestServer(t, false)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.ListenAndServe(ctx, "127.0.0.1:0") }()
+
+	var info os.FileInfo
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		var err error
+		if info, err = os.Stat(s.TokenPath()); err == nil {
+			break
+		}
+	}
+	if info == nil {
+		cancel()
+		t.Fatalf("%s was not written", s.TokenPath())
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("%s has mode %v, want 0600", s.TokenPath(), info.Mode().Perm())
+	}
+	data, _ := os.ReadFile(s.TokenPath())
+	if token := strings.TrimSpace(string(data)); len(token) != 64 || token == "secret" {
+		t.Errorf("token file holds %q, want a new random token", token)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.TokenPath()); !os.IsNotExist(err) {
+		t.Errorf("%s left behind after shutdown: %v", s.TokenPath(), err)
+	}
+}
+
+func TestWebUI(t *testing.T) {
+	s := newTestServer(t, true)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Host = testAddr
+	w := serve(s, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET / status %d, want 200", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `content="secret"`) {
+		t.Error("the page doesn't carry the token")
+	}
+	if strings.Contains(w.Body.String(), "{{token}}") {
+		t.Error("the token placeholder was left in the page")
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Host = "evil.example:7878"
+	if w := serve(s, r); w.Code != http.StatusForbidden || strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("GET / for another Host: status %d, want 403 without the token", w.Code)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Host = testAddr
+	r.Header.Set("Origin", "http://evil.example")
+	if w := serve(s, r); w.Code != http.StatusForbidden {
+		t.Errorf("GET / from another Origin: status %d, want 403", w.Code)
+	}
+
+	// The UI serves the page without a token, never the API
+	r = httptest.NewRequest("GET", "/api/installed", nil)
+	r.Host = testAddr
+	if w := serve(s, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("API without a token next to the UI: status %d, want 401", w.Code)
+	}
+	r = httptest.NewRequest("GET", "/other", nil)
+	r.Host = testAddr
+	if w := serve(s, r); w.Code != http.StatusNotFound {
+		t.Errorf("GET /other: status %d, want 404", w.Code)
+	}
+}
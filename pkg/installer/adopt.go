@@ -0,0 +1,127 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+	"github.com/nurysso/binrex/pkg/state"
+)
+
+// AdoptOptions describe a binary installed by hand for Adopt
+type AdoptOptions struct {
+	// Name of the package, by default the binary's name or, with a
+	// RepoURL, the repo's
+	Name string
+	// Version to record, by default read from the binary's --version
+	Version string
+	// RepoURL is the source the binary was built from. Updates rebuild
+	// from it like a package installed with install --git.
+	RepoURL string
+	// BuildCommand and BuildDir are recorded for updates, the build
+	// system is detected when BuildCommand is empty
+	BuildCommand string
+	BuildDir     string
+}
+
+// detectVersion asks a binary for its version, "unknown" when it has none
+// to tell
+func detectVersion(ctx context.Context, path string) string {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	out, _ := exec.CommandContext(ctx, path, "--version").CombinedOutput()
+	line, _, _ := strings.Cut(string(out), "\n")
+	if version := versionPattern.FindString(line); version != "" {
+		return version
+	}
+	return "unknown"
+}
+
+// Adopt records an executable installed by hand as an unmanaged package so
+// that binrex lists, verifies and removes it. The binary stays where it
+// is. With a source repo, update rebuilds it from there.
+func (i *Installer) Adopt(ctx context.Context, path string, opts AdoptOptions) (*state.InstalledPackage, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() || info.Mode().Perm()&0111 == 0 {
+		return nil, fmt.Errorf("%s is not an executable", abs)
+	}
+
+	name := opts.Name
+	if opts.RepoURL != "" {
+		// Updates reinstall it the way install --git does, under the
+		// repo's name
+		repoName := RepoNameFromURL(opts.RepoURL)
+		if name != "" && name != repoName {
+			return nil, fmt.Errorf("packages built from a git URL are named after the repo, %s", repoName)
+		}
+		name = repoName
+	}
+	if name == "" {
+		name = filepath.Base(abs)
+	}
+
+	installedData, err := i.State.Load()
+	if err != nil {
+		return nil, err
+	}
+	if installedData.Find(name) != nil {
+		return nil, fmt.Errorf("a package named %s is already installed", name)
+	}
+	if owner, _ := i.Owner(abs); owner != nil {
+		return nil, fmt.Errorf("%s is already owned by %s", abs, owner.Name)
+	}
+
+	sum, err := fsutil.SHA256File(WrappedBinary(abs))
+	if err != nil {
+		return nil, err
+	}
+	version := opts.Version
+	if version == "" {
+		version = detectVersion(ctx, abs)
+	}
+	entry := state.InstalledPackage{
+		Name:          name,
+		Version:       version,
+		BinaryPaths:   []string{abs},
+		InstallDate:   getCurrentDate(),
+		TotalBinaries: 1,
+		Unmanaged:     true,
+		RepoURL:       opts.RepoURL,
+		BuildCommands: opts.BuildCommand,
+		BuildDir:      opts.BuildDir,
+		Provenance:    &state.Provenance{SHA256: map[string]string{filepath.Base(abs): sum}},
+	}
+	if opts.RepoURL != "" {
+		entry.RepoPath = i.RepoCachePath(opts.RepoURL)
+	}
+	// Rebuilds go back next to the adopted binary
+	if dir := filepath.Dir(abs); dir != filepath.Clean(i.Paths.BinDir) {
+		entry.InstallDir = dir
+	}
+
+	if i.DryRun {
+		i.printf("  Would record %s as %s %s in %s\n", abs, name, version, i.Paths.InstalledPath)
+		return &entry, nil
+	}
+	// Adopting changes nothing on disk, the binary is only listed
+	entry.FileList = fileList(&entry)
+	installedData.Installed = append(installedData.Installed, entry)
+	if err := i.State.Save(installedData); err != nil {
+		return nil, fmt.Errorf("failed to update installed.json: %w", err)
+	}
+	i.recordHistory("adopt", name, version, nil)
+	return &entry, nil
+}
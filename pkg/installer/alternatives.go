@@ -0,0 +1,179 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nurysso/binrex/pkg/state"
+)
+
+// Alternative is a command name several packages can provide
+type Alternative struct {
+	Name      string   `json:"name"`
+	Active    string   `json:"active"`
+	Providers []string `json:"providers"`
+}
+
+// providedTarget returns the command name of a provides entry and the
+// installed binary it links to. "name:binary" picks one of several
+// binaries, plain "name" uses the package's first binary.
+func providedTarget(pkg *state.InstalledPackage, entry string) (string, string) {
+	name, binary, _ := strings.Cut(entry, ":")
+	for _, bp := range pkg.BinaryPaths {
+		if binary == "" || filepath.Base(bp) == binary {
+			return name, bp
+		}
+	}
+	return name, ""
+}
+
+// linkAlternative points the shared command name at a provider's binary
+func (i *Installer) linkAlternative(data *state.InstalledData, pkg *state.InstalledPackage, entry string) error {
+	name, target := providedTarget(pkg, entry)
+	if target == "" {
+		return fmt.Errorf("%s provides %s but has no matching binary", pkg.Name, entry)
+	}
+
+	link := filepath.Join(i.Paths.BinDir, name)
+	for _, other := range data.Installed {
+		for _, bp := range other.BinaryPaths {
+			if filepath.Clean(bp) == link {
+				return fmt.Errorf("%s is a binary of %s, not a shared name", link, other.Name)
+			}
+		}
+	}
+
+	if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Symlink(target, link); err != nil {
+		return fmt.Errorf("failed to link %s: %w", link, err)
+	}
+	if data.Alternatives == nil {
+		data.Alternatives = make(map[string]string)
+	}
+	data.Alternatives[name] = pkg.Name
+	return nil
+}
+
+// registerProvides makes a freshly installed package the active provider
+// of the names nobody else provides yet, and points out the conflicts
+func (i *Installer) registerProvides(name string) {
+	data, err := i.State.Load()
+	if err != nil {
+		return
+	}
+	pkg := data.Find(name)
+	if pkg == nil || len(pkg.Provides) == 0 {
+		return
+	}
+
+	for _, entry := range pkg.Provides {
+		provided, _ := providedTarget(pkg, entry)
+		active := data.Alternatives[provided]
+		if active != "" && active != name && data.Find(active) != nil {
+			i.printf("\n%s is also provided by %s, which stays active.\n", provided, active)
+			i.printf("  Run 'binrex alternatives %s %s' to switch.\n", provided, name)
+			continue
+		}
+
+		if err := i.linkAlternative(data, pkg, entry); err != nil {
+			i.eprintf("Warning: %v\n", err)
+			continue
+		}
+		i.printf("  ✓ %s -> %s\n", filepath.Join(i.Paths.BinDir, provided), name)
+	}
+
+	if err := i.State.Save(data); err != nil {
+		i.eprintf("Warning: Failed to update installed.json: %v\n", err)
+	}
+}
+
+// dropProvider hands the names a removed package provided over to another
+// installed provider, or removes their links. data must no longer list
+// the removed package.
+func (i *Installer) dropProvider(data *state.InstalledData, removed string) {
+	for provided, active := range data.Alternatives {
+		if active != removed {
+			continue
+		}
+		delete(data.Alternatives, provided)
+
+		switched := false
+		for n := range data.Installed {
+			pkg := &data.Installed[n]
+			for _, entry := range pkg.Provides {
+				if name, _ := providedTarget(pkg, entry); name == provided && !switched {
+					if err := i.linkAlternative(data, pkg, entry); err == nil {
+						i.printf("  ✓ %s now provided by %s\n", provided, pkg.Name)
+						switched = true
+					}
+				}
+			}
+		}
+
+		if !switched {
+			link := filepath.Join(i.Paths.BinDir, provided)
+			if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+				i.eprintf("Error removing %s: %v\n", link, err)
+			}
+		}
+	}
+}
+
+// Alternatives lists the provided command names with their providers
+func (i *Installer) Alternatives() ([]Alternative, error) {
+	data, err := i.State.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*Alternative)
+	for n := range data.Installed {
+		pkg := &data.Installed[n]
+		for _, entry := range pkg.Provides {
+			name, _ := providedTarget(pkg, entry)
+			if byName[name] == nil {
+				byName[name] = &Alternative{Name: name, Active: data.Alternatives[name]}
+			}
+			byName[name].Providers = append(byName[name].Providers, pkg.Name)
+		}
+	}
+
+	var alternatives []Alternative
+	for _, alt := range byName {
+		alternatives = append(alternatives, *alt)
+	}
+	sort.Slice(alternatives, func(a, b int) bool { return alternatives[a].Name < alternatives[b].Name })
+	return alternatives, nil
+}
+
+// SetAlternative makes pkgName the active provider of a command name
+func (i *Installer) SetAlternative(name, pkgName string) error {
+	data, err := i.State.Load()
+	if err != nil {
+		return err
+	}
+	pkg := data.Find(pkgName)
+	if pkg == nil {
+		return fmt.Errorf("package '%s' is not installed", pkgName)
+	}
+
+	for _, entry := range pkg.Provides {
+		if provided, _ := providedTarget(pkg, entry); provided != name {
+			continue
+		}
+		if i.DryRun {
+			i.printf("  Would link: %s -> %s\n", filepath.Join(i.Paths.BinDir, name), pkgName)
+			return nil
+		}
+		if err := i.linkAlternative(data, pkg, entry); err != nil {
+			return err
+		}
+		return i.State.Save(data)
+	}
+	return fmt.Errorf("%s does not provide %s", pkgName, name)
+}
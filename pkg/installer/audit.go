@@ -0,0 +1,221 @@
+package installer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nurysso/binrex/internal/fetch"
+)
+
+// severityRanks orders severities for comparisons, MODERATE is GitHub's
+// name for MEDIUM
+var severityRanks = map[string]int{
+	"UNKNOWN":  0,
+	"NONE":     0,
+	"LOW":      1,
+	"MEDIUM":   2,
+	"MODERATE": 2,
+	"HIGH":     3,
+	"CRITICAL": 4,
+}
+
+// SeverityRank returns the rank of a severity name, -1 if it's unknown
+func SeverityRank(severity string) int {
+	rank, ok := severityRanks[strings.ToUpper(severity)]
+	if !ok {
+		return -1
+	}
+	return rank
+}
+
+// Vulnerability is a known vulnerability reported by OSV
+type Vulnerability struct {
+	ID       string   `json:"id"`
+	Summary  string   `json:"summary"`
+	Aliases  []string `json:"aliases,omitempty"`
+	Severity string   `json:"severity"`        // LOW, MEDIUM, HIGH, CRITICAL or UNKNOWN
+	Score    float64  `json:"score,omitempty"` // CVSS v3 base score when available
+	URL      string   `json:"url"`
+}
+
+// AuditResult lists the vulnerabilities affecting one installed package
+type AuditResult struct {
+	Package         string          `json:"package"`
+	Version         string          `json:"version"`
+	Commit          string          `json:"commit,omitempty"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+}
+
+// osvQuery is one query of an OSV querybatch request
+type osvQuery struct {
+	Commit  string      `json:"commit,omitempty"`
+	Version string      `json:"version,omitempty"`
+	Package *osvPackage `json:"package,omitempty"`
+}
+
+type osvPackage struct {
+	Name      string `json:"name"`
+	Ecosystem string `json:"ecosystem"`
+}
+
+// osvVuln is the part of an OSV vulnerability record binrex uses
+type osvVuln struct {
+	ID       string   `json:"id"`
+	Summary  string   `json:"summary"`
+	Details  string   `json:"details"`
+	Aliases  []string `json:"aliases"`
+	Severity []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+}
+
+// toVulnerability summarises an OSV record, preferring a computed CVSS v3
+// score over the database's own severity label
+func (v *osvVuln) toVulnerability() Vulnerability {
+	vuln := Vulnerability{
+		ID:       v.ID,
+		Summary:  v.Summary,
+		Aliases:  v.Aliases,
+		Severity: "UNKNOWN",
+		URL:      "https://osv.dev/vulnerability/" + v.ID,
+	}
+	if vuln.Summary == "" {
+		vuln.Summary, _, _ = strings.Cut(v.Details, "\n")
+	}
+
+	for _, s := range v.Severity {
+		if score, ok := cvss3Score(s.Score); ok {
+			vuln.Score = score
+			vuln.Severity = cvssRating(score)
+			return vuln
+		}
+	}
+	if label := strings.ToUpper(v.DatabaseSpecific.Severity); SeverityRank(label) >= 0 {
+		if label == "MODERATE" {
+			label = "MEDIUM"
+		}
+		vuln.Severity = label
+	}
+	return vuln
+}
+
+// Audit queries OSV for known vulnerabilities in the installed packages,
+// or only the named ones, by source commit and by repository URL and
+// version
+func (i *Installer) Audit(ctx context.Context, names []string) ([]AuditResult, error) {
+	installedData, err := i.State.Load()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if installedData.Find(name) == nil {
+			return nil, fmt.Errorf("%s: %w", name, ErrNotInstalled)
+		}
+	}
+	m, _ := i.LoadManifest()
+
+	var results []AuditResult
+	var queries []osvQuery
+	var owners []int // index into results for every query
+
+	for _, pkg := range installedData.Installed {
+		if len(names) > 0 && !contains(names, pkg.Name) {
+			continue
+		}
+		repoURL := pkg.RepoURL
+		if m != nil && !pkg.Unmanaged {
+			if mp, err := m.Find(pkg.Name); err == nil {
+				repoURL = mp.RepoURL
+			}
+		}
+
+		results = append(results, AuditResult{Package: pkg.Name, Version: pkg.Version, Commit: pkg.Commit})
+		if pkg.Commit != "" {
+			queries = append(queries, osvQuery{Commit: pkg.Commit})
+			owners = append(owners, len(results)-1)
+		}
+		if repoURL != "" && pkg.Version != "" {
+			queries = append(queries, osvQuery{
+				Version: pkg.Version,
+				Package: &osvPackage{Name: repoURL, Ecosystem: "GIT"},
+			})
+			owners = append(owners, len(results)-1)
+		}
+	}
+
+	if len(queries) == 0 {
+		return results, nil
+	}
+
+	body, err := json.Marshal(map[string]any{"queries": queries})
+	if err != nil {
+		return nil, err
+	}
+	data, err := fetch.PostJSON(ctx, i.Config.GetOSVURL()+"/v1/querybatch", body)
+	if err != nil {
+		return nil, err
+	}
+
+	var batch struct {
+		Results []struct {
+			Vulns []struct {
+				ID string `json:"id"`
+			} `json:"vulns"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return nil, fmt.Errorf("failed to parse OSV response: %w", err)
+	}
+
+	// The batch endpoint only returns IDs, fetch each record once
+	details := make(map[string]Vulnerability)
+	seen := make(map[int]map[string]bool)
+	for n, result := range batch.Results {
+		if n >= len(owners) {
+			break
+		}
+		owner := owners[n]
+		if seen[owner] == nil {
+			seen[owner] = make(map[string]bool)
+		}
+
+		for _, v := range result.Vulns {
+			if seen[owner][v.ID] {
+				continue
+			}
+			seen[owner][v.ID] = true
+
+			vuln, ok := details[v.ID]
+			if !ok {
+				vuln, err = i.fetchVulnerability(ctx, v.ID)
+				if err != nil {
+					return nil, err
+				}
+				details[v.ID] = vuln
+			}
+			results[owner].Vulnerabilities = append(results[owner].Vulnerabilities, vuln)
+		}
+	}
+
+	return results, nil
+}
+
+// fetchVulnerability downloads one OSV record
+func (i *Installer) fetchVulnerability(ctx context.Context, id string) (Vulnerability, error) {
+	data, err := fetch.Get(ctx, i.Config.GetOSVURL()+"/v1/vulns/"+id)
+	if err != nil {
+		return Vulnerability{}, err
+	}
+
+	var v osvVuln
+	if err := json.Unmarshal(data, &v); err != nil {
+		return Vulnerability{}, fmt.Errorf("failed to parse OSV record %s: %w", id, err)
+	}
+	return v.toVulnerability(), nil
+}
@@ -0,0 +1,151 @@
+package installer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nurysso/binrex/internal/fetch"
+)
+
+// downloadLogins are the logins of download hosts, read from ~/.netrc
+// once and asked of git once per host
+type downloadLogins struct {
+	mu    sync.Mutex
+	netrc []fetch.NetrcMachine
+	git   map[string]string
+}
+
+// credentials returns the Authorization header downloads from u send: the
+// bearer token of auth_tokens, else the ~/.netrc login, else what git's
+// credential helpers have with git_credentials. Nothing is sent over
+// plain http except to this machine.
+func (i *Installer) credentials(u *url.URL) string {
+	if u.Scheme != "https" && !isLoopback(u.Hostname()) {
+		return ""
+	}
+	if token := i.authToken(u); token != "" {
+		return "Bearer " + token
+	}
+
+	logins := i.logins
+	logins.mu.Lock()
+	defer logins.mu.Unlock()
+	if logins.netrc == nil {
+		logins.netrc = loadNetrc()
+	}
+	if m := fetch.FindNetrc(logins.netrc, u.Hostname()); m != nil && m.Login != "" {
+		return basicAuth(m.Login, m.Password)
+	}
+	if !i.Config.GitCredentials {
+		return ""
+	}
+	header, asked := logins.git[u.Host]
+	if !asked {
+		header = gitCredential(u)
+		logins.git[u.Host] = header
+	}
+	return header
+}
+
+// authToken returns the auth_tokens token for u, from the longest URL
+// prefix or the host it is configured for
+func (i *Installer) authToken(u *url.URL) string {
+	best, token := -1, ""
+	for key, value := range i.Config.AuthTokens {
+		matches := key == u.Host || key == u.Hostname()
+		if strings.Contains(key, "://") {
+			matches = urlPrefixMatches(key, u)
+		}
+		if matches && len(key) > best {
+			best, token = len(key), value
+		}
+	}
+	if name, ok := strings.CutPrefix(token, "$"); ok {
+		return os.Getenv(name)
+	}
+	return token
+}
+
+// urlPrefixMatches reports whether a URL prefix key covers u: the same
+// scheme and host, and a path under the key's path on a / boundary, so
+// "https://host/org" doesn't match "https://host/org-evil"
+func urlPrefixMatches(key string, u *url.URL) bool {
+	prefix, err := url.Parse(key)
+	if err != nil || !strings.EqualFold(prefix.Scheme, u.Scheme) || !strings.EqualFold(prefix.Host, u.Host) {
+		return false
+	}
+	dir := strings.TrimSuffix(prefix.Path, "/")
+	return u.Path == dir || strings.HasPrefix(u.Path, dir+"/")
+}
+
+// loadNetrc reads the machines of $NETRC or ~/.netrc, none when there is
+// no such file
+func loadNetrc() []fetch.NetrcMachine {
+	path := os.Getenv("NETRC")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return []fetch.NetrcMachine{}
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []fetch.NetrcMachine{}
+	}
+	return fetch.ParseNetrc(data)
+}
+
+// gitCredential asks git's credential helpers for the login of u's host
+// without letting git prompt for one
+func gitCredential(u *url.URL) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	input := "protocol=" + u.Scheme + "\nhost=" + u.Host + "\npath=" + strings.TrimPrefix(u.Path, "/") + "\n\n"
+	cmd := exec.CommandContext(ctx, "git", "credential", "fill")
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+
+	var user, password string
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		key, value, _ := strings.Cut(string(line), "=")
+		switch key {
+		case "username":
+			user = value
+		case "password":
+			password = value
+		}
+	}
+	if user == "" && password == "" {
+		return ""
+	}
+	return basicAuth(user, password)
+}
+
+// basicAuth returns a Basic Authorization header
+func basicAuth(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+// isLoopback reports whether host is this machine
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,60 @@
+package installer
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/nurysso/binrex/pkg/config"
+)
+
+func TestAuthToken(t *testing.T) {
+	tests := []struct {
+		key  string
+		url  string
+		want bool
+	}{
+		{"https://host/org", "https://host/org/tool.tar.gz", true},
+		{"https://host/org", "https://host/org", true},
+		{"https://host/org", "https://host/org-evil/tool.tar.gz", false},
+		{"https://host/org/", "https://host/org/tool.tar.gz", true},
+		{"https://host/org/", "https://host/org-evil/tool.tar.gz", false},
+		{"https://host/org", "http://host/org/tool.tar.gz", false},
+		{"https://host/org", "https://evil-host/org/tool.tar.gz", false},
+		{"https://host/org", "https://host.evil/org/tool.tar.gz", false},
+		{"https://host", "https://host/any/tool.tar.gz", true},
+		{"host", "https://host/any/tool.tar.gz", true},
+		{"host", "https://host:8443/tool.tar.gz", true},
+		{"host:8443", "https://host/tool.tar.gz", false},
+		{"host", "https://other/tool.tar.gz", false},
+	}
+
+	for _, test := range tests {
+		u, err := url.Parse(test.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		i := &Installer{Config: &config.Config{AuthTokens: map[string]string{test.key: "secret"}}}
+		if got := i.authToken(u) == "secret"; got != test.want {
+			t.Errorf("auth_tokens key %q sends its token to %s: %v, want %v", test.key, test.url, got, test.want)
+		}
+	}
+}
+
+func TestAuthTokenLongestPrefix(t *testing.T) {
+	i := &Installer{Config: &config.Config{AuthTokens: map[string]string{
+		"host":                 "host",
+		"https://host/org":     "org",
+		"https://host/org/sub": "sub",
+	}}}
+	for rawURL, want := range map[string]string{
+		"https://host/other/file":   "host",
+		"https://host/org/file":     "org",
+		"https://host/org/sub/file": "sub",
+		"https://host/org/subway":   "org",
+	} {
+		u, _ := url.Parse(rawURL)
+		if got := i.authToken(u); got != want {
+			t.Errorf("authToken(%s) = %q, want %q", rawURL, got, want)
+		}
+	}
+}
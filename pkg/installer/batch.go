@@ -0,0 +1,80 @@
+package installer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+)
+
+// BatchProgress is how far an install -a got. It is saved after every
+// package, so a batch cut short by a crash or Ctrl-C picks up where it
+// stopped, and kept while packages of it failed.
+type BatchProgress struct {
+	Started string `json:"started"`
+	// Packages are the packages the batch set out to install, in order
+	Packages []string `json:"packages"`
+	Done     []string `json:"done"`
+	// Failed maps the packages that failed to their error
+	Failed map[string]string `json:"failed"`
+}
+
+// batchProgressPath returns where the progress of an unfinished install -a
+// is kept, next to installed.json
+func (i *Installer) batchProgressPath() string {
+	return filepath.Join(filepath.Dir(i.Paths.InstalledPath), "install-batch.json")
+}
+
+// loadBatchProgress returns the progress of the unfinished install -a, nil
+// when there is none
+func (i *Installer) loadBatchProgress() (*BatchProgress, error) {
+	data, err := os.ReadFile(i.batchProgressPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var progress BatchProgress
+	if err := json.Unmarshal(data, &progress); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", i.batchProgressPath(), err)
+	}
+	if progress.Failed == nil {
+		progress.Failed = make(map[string]string)
+	}
+	return &progress, nil
+}
+
+// saveBatchProgress writes the progress of install -a
+func (i *Installer) saveBatchProgress(progress *BatchProgress) error {
+	data, err := json.MarshalIndent(progress, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(i.batchProgressPath(), append(data, '\n'), 0644)
+}
+
+// finish records the outcome of one package of the batch
+func (p *BatchProgress) finish(name string, err error) {
+	if err != nil {
+		p.Failed[name] = err.Error()
+		return
+	}
+	delete(p.Failed, name)
+	if !contains(p.Done, name) {
+		p.Done = append(p.Done, name)
+	}
+}
+
+// left returns the packages of the batch that neither finished nor failed
+func (p *BatchProgress) left() []string {
+	var left []string
+	for _, name := range p.Packages {
+		if _, failed := p.Failed[name]; !failed && !contains(p.Done, name) {
+			left = append(left, name)
+		}
+	}
+	return left
+}
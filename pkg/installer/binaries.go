@@ -0,0 +1,287 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nurysso/binrex/pkg/manifest"
+)
+
+// Binary represents a found binary file
+type Binary struct {
+	Name string
+	Path string
+}
+
+// maxBinaryDepth is how many directories below the source dir binaries
+// are looked for when the manifest doesn't say where they are
+const maxBinaryDepth = 4
+
+// outputDirs are the usual build output directories, relative to the
+// source dir, in the order their binaries are preferred
+var outputDirs = []string{"target/release", "target/debug", "build", "build/bin", "bin", "dist", "."}
+
+// unsearchedDirs hold version control data, dependencies and the
+// intermediate files of builds, whose executables aren't what a build
+// produces for installing
+var unsearchedDirs = []string{"node_modules", "vendor", "CMakeFiles", "_deps"}
+
+// cargoInternalDirs are the dirs under target/<profile> where cargo keeps
+// build scripts, dependencies and test binaries
+var cargoInternalDirs = []string{"build", "deps", "incremental", "examples"}
+
+// isBinaryCandidate reports whether a file looks like a built binary
+// rather than a library or build artifact
+func isBinaryCandidate(name string, mode os.FileMode) bool {
+	if !mode.IsRegular() || mode&0111 == 0 {
+		return false
+	}
+	// Skip hidden files and build scripts
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	// Skip common build artifacts
+	for _, pattern := range []string{".d", ".rlib", ".so", ".a", ".o", ".dylib", ".dll"} {
+		if strings.HasSuffix(name, pattern) {
+			return false
+		}
+	}
+	return true
+}
+
+// findBinariesInPath finds all binary files in the specified path
+func findBinariesInPath(searchPath string, expectedNames []string) []Binary {
+	var binaries []Binary
+
+	entries, err := os.ReadDir(searchPath)
+	if err != nil {
+		return binaries
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !isBinaryCandidate(entry.Name(), info.Mode()) {
+			continue
+		}
+		// If expected names are specified, only include those
+		if len(expectedNames) > 0 && !matchesBinaryNames(expectedNames, entry.Name()) {
+			continue
+		}
+		binaries = append(binaries, Binary{
+			Name: entry.Name(),
+			Path: filepath.Join(searchPath, entry.Name()),
+		})
+	}
+	return binaries
+}
+
+// matchesBinaryNames reports whether a file name matches any of a
+// package's binary_names, which may be globs or regular expressions
+func matchesBinaryNames(entries []string, name string) bool {
+	for _, entry := range entries {
+		if manifest.MatchBinaryName(entry, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipSearchDir reports whether a directory, relative to the source dir,
+// is left out of the search for binaries
+func skipSearchDir(rel string) bool {
+	name := filepath.Base(rel)
+	if strings.HasPrefix(name, ".") || contains(unsearchedDirs, name) {
+		return true
+	}
+	parent := filepath.Dir(rel)
+	return filepath.Base(filepath.Dir(parent)) == "target" && contains(cargoInternalDirs, name)
+}
+
+// outputDirRank orders directories relative to the source dir by how
+// likely their executables are the build's binaries: the usual output
+// directories first, then the others, shallow before deep
+func outputDirRank(rel string) int {
+	for n, dir := range outputDirs {
+		if filepath.ToSlash(rel) == dir {
+			return n
+		}
+	}
+	return len(outputDirs) + strings.Count(filepath.ToSlash(rel), "/")
+}
+
+// searchBinaries walks the source dir up to maxBinaryDepth directories
+// deep for executables, ordered by outputDirRank
+func searchBinaries(buildDir string, expectedNames []string) []Binary {
+	type candidate struct {
+		Binary
+		rank int
+	}
+	var candidates []candidate
+	filepath.WalkDir(buildDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(buildDir, path)
+		if entry.IsDir() {
+			if rel != "." && (skipSearchDir(rel) || strings.Count(filepath.ToSlash(rel), "/") >= maxBinaryDepth) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil || !isBinaryCandidate(entry.Name(), info.Mode()) {
+			return nil
+		}
+		if len(expectedNames) > 0 && !matchesBinaryNames(expectedNames, entry.Name()) {
+			return nil
+		}
+		candidates = append(candidates, candidate{Binary{entry.Name(), path}, outputDirRank(filepath.Dir(rel))})
+		return nil
+	})
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return candidates[a].rank < candidates[b].rank
+	})
+
+	// Without names to look for, a build's binaries are those of the usual
+	// output directories, or else of the best directory that has any
+	var binaries []Binary
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		if len(expectedNames) == 0 && c.rank >= len(outputDirs) && c.rank != candidates[0].rank {
+			break
+		}
+		if !seen[c.Name] {
+			seen[c.Name] = true
+			binaries = append(binaries, c.Binary)
+		}
+	}
+	return binaries
+}
+
+// globBinaries finds the binaries matching a package's binary_paths
+// globs, relative to the source dir
+func globBinaries(buildDir string, patterns, expectedNames []string) []Binary {
+	var binaries []Binary
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(filepath.Join(buildDir, pattern))
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			name := filepath.Base(match)
+			if err != nil || seen[name] || !isBinaryCandidate(name, info.Mode()) {
+				continue
+			}
+			if len(expectedNames) > 0 && !matchesBinaryNames(expectedNames, name) {
+				continue
+			}
+			seen[name] = true
+			binaries = append(binaries, Binary{Name: name, Path: match})
+		}
+	}
+	return binaries
+}
+
+// findBuiltBinaries finds binaries after build: in bin_path or the
+// binary_paths globs when the manifest has them, else anywhere in the
+// source dir
+func (i *Installer) findBuiltBinaries(repoPath string, pkg *manifest.Package) ([]Binary, error) {
+	// If explicit bin_path is provided, search there
+	if pkg.BinPath != "" {
+		searchPath := filepath.Join(repoPath, pkg.BinPath)
+		i.printf("Searching for binaries in: %s\n", searchPath)
+		if binaries := findBinariesInPath(searchPath, pkg.BinaryNames); len(binaries) > 0 {
+			return binaries, nil
+		}
+	}
+
+	buildDir := repoPath
+	if pkg.SourceDir != "" {
+		buildDir = filepath.Join(repoPath, pkg.SourceDir)
+	}
+
+	if len(pkg.BinaryPaths) > 0 {
+		i.printf("Searching for binaries matching: %s\n", strings.Join(pkg.BinaryPaths, ", "))
+		if binaries := globBinaries(buildDir, pkg.BinaryPaths, pkg.BinaryNames); len(binaries) > 0 {
+			return binaries, nil
+		}
+	}
+
+	i.println("Searching for built binaries...")
+	binaries := searchBinaries(buildDir, pkg.BinaryNames)
+	if len(binaries) == 0 {
+		return nil, fmt.Errorf("no binaries found after build")
+	}
+	dirs := make(map[string]bool)
+	for _, binary := range binaries {
+		if dir := filepath.Dir(binary.Path); !dirs[dir] {
+			dirs[dir] = true
+			i.printf("Found binaries in: %s\n", dir)
+		}
+	}
+	return binaries, nil
+}
+
+// contains checks if a slice contains a string
+func contains(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
+
+// applyAliases renames found binaries to their aliases. An alias under the
+// "" key renames the only binary and is rewritten to its real name in
+// aliases, so it can be recorded, as are aliases under a binary name
+// pattern like "tool-*".
+func applyAliases(binaries []Binary, aliases map[string]string) ([]Binary, error) {
+	if alias, ok := aliases[""]; ok {
+		if len(binaries) != 1 {
+			return nil, fmt.Errorf("--as needs binary=alias when a package has %d binaries", len(binaries))
+		}
+		delete(aliases, "")
+		aliases[binaries[0].Name] = alias
+	}
+
+	// Aliases of binary name patterns apply to the binaries they match and
+	// are recorded under the names they resolved to
+	for pattern, alias := range aliases {
+		if !manifest.IsBinaryPattern(pattern) {
+			continue
+		}
+		var matched []string
+		for _, binary := range binaries {
+			if manifest.MatchBinaryName(pattern, binary.Name) {
+				matched = append(matched, binary.Name)
+			}
+		}
+		if len(matched) > 1 {
+			return nil, fmt.Errorf("alias %q of %s matches %d binaries: %s", alias, pattern, len(matched), strings.Join(matched, ", "))
+		}
+		delete(aliases, pattern)
+		if len(matched) == 0 || aliases[matched[0]] != "" {
+			continue
+		}
+		// Drop what the pattern resolved to for the previous version
+		for binary, a := range aliases {
+			if a == alias {
+				delete(aliases, binary)
+			}
+		}
+		aliases[matched[0]] = alias
+	}
+
+	for n, binary := range binaries {
+		if alias := aliases[binary.Name]; alias != "" {
+			if strings.ContainsRune(alias, filepath.Separator) {
+				return nil, fmt.Errorf("invalid alias %q for %s", alias, binary.Name)
+			}
+			binaries[n].Name = alias
+		}
+	}
+	return binaries, nil
+}
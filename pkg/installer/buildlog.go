@@ -0,0 +1,73 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// buildLogsKept is the number of build logs kept per package
+const buildLogsKept = 5
+
+// buildLogTail is the number of log lines shown when a build fails
+const buildLogTail = 20
+
+// buildLogs returns a package's build logs, oldest first
+func (i *Installer) buildLogs(name string) []string {
+	logs, _ := filepath.Glob(filepath.Join(i.Paths.LogDir, name+"-????????-??????.log"))
+	// Names end in a sortable timestamp
+	sort.Strings(logs)
+	return logs
+}
+
+// createBuildLog creates a new timestamped build log for a package and
+// drops the oldest ones past buildLogsKept
+func (i *Installer) createBuildLog(name string) (*os.File, string, error) {
+	if err := os.MkdirAll(i.Paths.LogDir, 0755); err != nil {
+		return nil, "", fmt.Errorf("error creating %s: %w", i.Paths.LogDir, err)
+	}
+
+	path := filepath.Join(i.Paths.LogDir, fmt.Sprintf("%s-%s.log", name, time.Now().Format("20060102-150405")))
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create build log: %w", err)
+	}
+
+	if logs := i.buildLogs(name); len(logs) > buildLogsKept {
+		for _, old := range logs[:len(logs)-buildLogsKept] {
+			os.Remove(old)
+		}
+	}
+	return f, path, nil
+}
+
+// printBuildLogTail prints the last lines of a failed build's log
+func (i *Installer) printBuildLogTail(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > buildLogTail {
+		lines = lines[len(lines)-buildLogTail:]
+	}
+
+	i.eprintf("\nLast %d line(s) of the build log:\n", len(lines))
+	for _, line := range lines {
+		i.eprintf("  %s\n", line)
+	}
+	i.eprintf("Full log: %s\n", path)
+}
+
+// LatestBuildLog returns the path of a package's most recent build log
+func (i *Installer) LatestBuildLog(name string) (string, error) {
+	logs := i.buildLogs(name)
+	if len(logs) == 0 {
+		return "", fmt.Errorf("no build logs for %s in %s", name, i.Paths.LogDir)
+	}
+	return logs[len(logs)-1], nil
+}
@@ -0,0 +1,67 @@
+package installer
+
+import (
+	"context"
+)
+
+// PackageStatus compares an installed package with what's available
+type PackageStatus struct {
+	Name             string `json:"name"`
+	InstalledVersion string `json:"installed_version"`
+	AvailableVersion string `json:"available_version,omitempty"`
+	InstalledCommit  string `json:"installed_commit,omitempty"`
+	AvailableCommit  string `json:"available_commit,omitempty"`
+	Outdated         bool   `json:"outdated"`
+}
+
+// Status reports every installed package against the manifest without
+// changing anything. With commits set, the remote HEAD of each repo is
+// queried too so packages built from an older commit show as outdated.
+func (i *Installer) Status(ctx context.Context, commits bool) ([]PackageStatus, error) {
+	m, err := i.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	installedData, err := i.State.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []PackageStatus
+	for _, pkg := range installedData.Installed {
+		status := PackageStatus{
+			Name:             pkg.Name,
+			InstalledVersion: pkg.Version,
+			InstalledCommit:  pkg.Commit,
+		}
+
+		repoURL := pkg.RepoURL
+		if !pkg.Unmanaged {
+			if mp, err := m.Find(pkg.Name); err == nil {
+				repoURL = mp.RepoURL
+				status.AvailableVersion = mp.Version
+				if mp.Version != "" && mp.Version != pkg.Version &&
+					(pkg.Constraint == "" || constraintAllows(pkg.Constraint, pkg.Version, mp.Version)) {
+					status.Outdated = true
+				}
+			}
+		}
+
+		if _, local := localPath(repoURL); commits && repoURL != "" && !local {
+			if pkg.Constraint != "" {
+				// The newest matching tag rather than the default branch
+				_, status.AvailableCommit, _ = i.resolveConstraint(ctx, "", repoURL, pkg.Constraint)
+			} else {
+				status.AvailableCommit = remoteHead(ctx, repoURL)
+			}
+			if status.AvailableCommit != "" && pkg.Commit != "" && status.AvailableCommit != pkg.Commit {
+				status.Outdated = true
+			}
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
@@ -0,0 +1,163 @@
+package installer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/nurysso/binrex/pkg/manifest"
+)
+
+// checksumAssets are the names releases commonly publish their checksums
+// under, tried when the manifest names none. {asset} is the downloaded
+// asset's name.
+var checksumAssets = []string{"SHA256SUMS", "SHA256SUMS.txt", "sha256sums.txt", "checksums.txt", "{asset}.sha256"}
+
+// signatureSuffixes are tried for a signature next to a checksums file
+var signatureSuffixes = []string{".asc", ".sig", ".gpg"}
+
+// releaseChecksums finds the checksums file and its signature among a
+// release's assets, by the manifest's names or the usual ones
+func releaseChecksums(pkg *manifest.Package, release *githubRelease, assetName string) (string, string) {
+	find := func(name string) string {
+		if strings.Contains(name, "://") {
+			return name
+		}
+		name = strings.ReplaceAll(expandRelease(name, pkg, release.TagName), "{asset}", assetName)
+		for _, asset := range release.Assets {
+			if strings.EqualFold(asset.Name, name) {
+				return asset.URL
+			}
+		}
+		return ""
+	}
+
+	var sumsURL, sumsName string
+	if pkg.Checksums != "" {
+		sumsName = pkg.Checksums
+		sumsURL = find(sumsName)
+	} else {
+		for _, name := range checksumAssets {
+			if sumsURL = find(name); sumsURL != "" {
+				sumsName = name
+				break
+			}
+		}
+	}
+	if sumsURL == "" {
+		return "", ""
+	}
+
+	if pkg.ChecksumsSig != "" {
+		return sumsURL, find(pkg.ChecksumsSig)
+	}
+	for _, suffix := range signatureSuffixes {
+		if sigURL := find(sumsName + suffix); sigURL != "" {
+			return sumsURL, sigURL
+		}
+	}
+	return sumsURL, ""
+}
+
+// verifyArtifact checks a download's SHA256 against the manifest's hash
+// and the checksums file, after verifying the file's signature
+func (i *Installer) verifyArtifact(ctx context.Context, a artifact, fileName, sum, tmpDir string) error {
+	if a.SHA256 != "" {
+		if !strings.EqualFold(sum, a.SHA256) {
+			i.eprintf("Error: %s has SHA256 %s, expected %s\n", fileName, sum, a.SHA256)
+			return fmt.Errorf("checksum mismatch for %s", fileName)
+		}
+		i.printf("  ✓ SHA256 matches the manifest: %s\n", sum)
+	}
+
+	if a.SumsURL == "" {
+		if a.SHA256 == "" {
+			i.eprintf("Warning: No checksum to verify %s against\n", fileName)
+		}
+		return nil
+	}
+
+	sums, err := i.getMirrored(ctx, a.SumsURL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch checksums: %w", err)
+	}
+	sumsName := path.Base(strings.SplitN(a.SumsURL, "?", 2)[0])
+
+	if a.SigURL != "" {
+		if err := i.verifySignature(ctx, sums, a.SigURL, filepath.Join(tmpDir, sumsName)); err != nil {
+			return err
+		}
+	}
+
+	expected := parseChecksums(sums, fileName)
+	if expected == "" {
+		return fmt.Errorf("%s lists no SHA256 for %s", sumsName, fileName)
+	}
+	if !strings.EqualFold(sum, expected) {
+		i.eprintf("Error: %s has SHA256 %s, %s lists %s\n", fileName, sum, sumsName, expected)
+		return fmt.Errorf("checksum mismatch for %s", fileName)
+	}
+	i.printf("  ✓ SHA256 matches %s: %s\n", sumsName, sum)
+	return nil
+}
+
+// parseChecksums returns the hash a sha256sum style file lists for
+// fileName. A file holding a single bare hash is taken to be for it.
+func parseChecksums(data []byte, fileName string) string {
+	var lines [][]string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+			lines = append(lines, fields)
+		}
+	}
+
+	for _, fields := range lines {
+		if len(fields) < 2 {
+			continue
+		}
+		// "hash  name", "hash *name" for binary mode, maybe with a directory
+		name := strings.TrimPrefix(fields[len(fields)-1], "*")
+		if path.Base(name) == fileName {
+			return fields[0]
+		}
+	}
+	if len(lines) == 1 && len(lines[0]) == 1 {
+		return lines[0][0]
+	}
+	return ""
+}
+
+// verifySignature checks a detached GPG signature of data with the keys in
+// the user's keyring. data is written to dataPath for gpg to read.
+func (i *Installer) verifySignature(ctx context.Context, data []byte, sigURL, dataPath string) error {
+	if !CheckToolExists("gpg") {
+		i.eprintf("Warning: gpg not found, can't verify %s\n", sigURL)
+		return nil
+	}
+
+	sig, err := i.getMirrored(ctx, sigURL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch signature: %w", err)
+	}
+	if err := os.WriteFile(dataPath, data, 0644); err != nil {
+		return err
+	}
+	sigPath := dataPath + ".sig"
+	if err := os.WriteFile(sigPath, sig, 0644); err != nil {
+		return err
+	}
+
+	if out, err := exec.CommandContext(ctx, "gpg", "--verify", sigPath, dataPath).CombinedOutput(); err != nil {
+		i.eprintf("Error: Bad or unknown signature on %s\n%s", filepath.Base(dataPath), out)
+		return fmt.Errorf("signature verification failed")
+	}
+	i.printf("  ✓ Signature on %s verified\n", filepath.Base(dataPath))
+	return nil
+}
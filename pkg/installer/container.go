@@ -0,0 +1,80 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/nurysso/binrex/pkg/manifest"
+)
+
+// containerBuilds reports whether builds run inside containers
+func (i *Installer) containerBuilds() bool {
+	return i.ContainerBuilds || i.Config.ContainerBuilds
+}
+
+// containerRuntime returns the configured container runtime, otherwise
+// podman or docker, whichever is installed
+func (i *Installer) containerRuntime() (string, error) {
+	if i.Config.ContainerRuntime != "" {
+		return i.Config.ContainerRuntime, nil
+	}
+	for _, runtime := range []string{"podman", "docker"} {
+		if CheckToolExists(runtime) {
+			return runtime, nil
+		}
+	}
+	return "", fmt.Errorf("container builds need podman or docker")
+}
+
+// buildImage returns the image a package is built in
+func (i *Installer) buildImage(pkg *manifest.Package) string {
+	if pkg.BuildImage != "" {
+		return pkg.BuildImage
+	}
+	return i.Config.DefaultBuildImage
+}
+
+// runContainerBuild runs a package's build commands inside its build
+// image. Only the cached repo is mounted, so the build script can't touch
+// the rest of the host; the binaries are picked up from the repo after.
+func (i *Installer) runContainerBuild(ctx context.Context, pkg *manifest.Package, repoPath string, out io.Writer) error {
+	image := i.buildImage(pkg)
+	if image == "" {
+		return fmt.Errorf("%s declares no build_image and no default_build_image is configured", pkg.Name)
+	}
+
+	runtime, err := i.containerRuntime()
+	if err != nil {
+		return err
+	}
+
+	args := []string{"run", "--rm",
+		"-v", repoPath + ":/src",
+		"-w", path.Join("/src", filepath.ToSlash(pkg.SourceDir)),
+		"-e", "HOME=/tmp",
+	}
+	// Keep files written into the mounted repo owned by the user
+	if filepath.Base(runtime) == "podman" {
+		args = append(args, "--userns=keep-id")
+	} else {
+		args = append(args, "--user", strconv.Itoa(os.Getuid())+":"+strconv.Itoa(os.Getgid()))
+	}
+
+	jobs := strconv.Itoa(i.buildJobs())
+	for _, env := range []string{"MAKEFLAGS=-j" + jobs, "CARGO_BUILD_JOBS=" + jobs, "CMAKE_BUILD_PARALLEL_LEVEL=" + jobs, "BINREX_BUILD_JOBS=" + jobs} {
+		args = append(args, "-e", env)
+	}
+	args = append(args, image, "sh", "-c", pkg.BuildCommands)
+
+	i.printf("Building in %s container %s...\n", runtime, image)
+	command := exec.CommandContext(ctx, runtime, args...)
+	command.Stdout = out
+	command.Stderr = out
+	return command.Run()
+}
@@ -0,0 +1,97 @@
+package installer
+
+import (
+	"math"
+	"strings"
+)
+
+// cvss3Weights are the CVSS v3.x base metric weights
+var cvss3Weights = map[string]map[string]float64{
+	"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+	"AC": {"L": 0.77, "H": 0.44},
+	"UI": {"N": 0.85, "R": 0.62},
+	"C":  {"H": 0.56, "L": 0.22, "N": 0},
+	"I":  {"H": 0.56, "L": 0.22, "N": 0},
+	"A":  {"H": 0.56, "L": 0.22, "N": 0},
+}
+
+// cvss3Roundup rounds up to one decimal the way the CVSS v3.1 spec does
+func cvss3Roundup(x float64) float64 {
+	n := math.Round(x * 100000)
+	if math.Mod(n, 10000) == 0 {
+		return n / 100000
+	}
+	return (math.Floor(n/10000) + 1) / 10
+}
+
+// cvss3Score computes the base score of a CVSS v3.x vector such as
+// "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H"
+func cvss3Score(vector string) (float64, bool) {
+	if !strings.HasPrefix(vector, "CVSS:3.") {
+		return 0, false
+	}
+
+	metrics := make(map[string]string)
+	for _, part := range strings.Split(vector, "/")[1:] {
+		if key, value, ok := strings.Cut(part, ":"); ok {
+			metrics[key] = value
+		}
+	}
+
+	values := make(map[string]float64)
+	for metric, weights := range cvss3Weights {
+		w, ok := weights[metrics[metric]]
+		if !ok {
+			return 0, false
+		}
+		values[metric] = w
+	}
+
+	changed := metrics["S"] == "C"
+	switch metrics["PR"] {
+	case "N":
+		values["PR"] = 0.85
+	case "L":
+		values["PR"] = 0.62
+		if changed {
+			values["PR"] = 0.68
+		}
+	case "H":
+		values["PR"] = 0.27
+		if changed {
+			values["PR"] = 0.5
+		}
+	default:
+		return 0, false
+	}
+
+	iss := 1 - (1-values["C"])*(1-values["I"])*(1-values["A"])
+	impact := 6.42 * iss
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	if impact <= 0 {
+		return 0, true
+	}
+
+	exploitability := 8.22 * values["AV"] * values["AC"] * values["PR"] * values["UI"]
+	if changed {
+		return cvss3Roundup(math.Min(1.08*(impact+exploitability), 10)), true
+	}
+	return cvss3Roundup(math.Min(impact+exploitability, 10)), true
+}
+
+// cvssRating maps a CVSS score to its qualitative severity
+func cvssRating(score float64) string {
+	switch {
+	case score >= 9:
+		return "CRITICAL"
+	case score >= 7:
+		return "HIGH"
+	case score >= 4:
+		return "MEDIUM"
+	case score > 0:
+		return "LOW"
+	}
+	return "NONE"
+}
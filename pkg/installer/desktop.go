@@ -0,0 +1,98 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+	"github.com/nurysso/binrex/pkg/manifest"
+)
+
+// iconTarget splits a manifest icon entry into its source path and the
+// file name to install it under
+func iconTarget(entry string) (src, name string) {
+	src, name, found := strings.Cut(entry, ":")
+	if !found || name == "" {
+		name = filepath.Base(src)
+	}
+	return src, name
+}
+
+// installDesktopFiles copies a package's .desktop entries and icons from
+// its build dir, returning the installed paths. Missing files are warned
+// about but don't fail the install, the binaries are already in place.
+func (i *Installer) installDesktopFiles(ctx context.Context, pkg *manifest.Package, buildPath string) (desktopFiles, iconPaths []string) {
+	if len(pkg.DesktopFiles) == 0 && len(pkg.Icons) == 0 {
+		return nil, nil
+	}
+
+	copyInto := func(src, dir, name string) string {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			i.eprintf("Warning: Failed to create %s: %v\n", dir, err)
+			return ""
+		}
+		dst := filepath.Join(dir, name)
+		if err := fsutil.CopyFile(filepath.Join(buildPath, src), dst); err != nil {
+			i.eprintf("Warning: Failed to install %s: %v\n", src, err)
+			return ""
+		}
+		if err := os.Chmod(dst, 0644); err != nil {
+			i.eprintf("Warning: Failed to set permissions on %s: %v\n", dst, err)
+		}
+		i.printf("  ✓ Installed: %s\n", dst)
+		return dst
+	}
+
+	i.println("\nInstalling desktop entries and icons...")
+	for _, src := range pkg.DesktopFiles {
+		if dst := copyInto(src, i.Paths.ApplicationsDir, filepath.Base(src)); dst != "" {
+			desktopFiles = append(desktopFiles, dst)
+		}
+	}
+	for _, entry := range pkg.Icons {
+		src, name := iconTarget(entry)
+		if dst := copyInto(src, i.Paths.IconsDir, name); dst != "" {
+			iconPaths = append(iconPaths, dst)
+		}
+	}
+
+	i.refreshDesktopDatabase(ctx, len(desktopFiles) > 0)
+	return desktopFiles, iconPaths
+}
+
+// printDesktopPlan prints the desktop entries and icons an install would
+// add, for dry runs
+func (i *Installer) printDesktopPlan(pkg *manifest.Package) {
+	for _, src := range pkg.DesktopFiles {
+		i.printf("  Would copy: %s -> %s\n", src, filepath.Join(i.Paths.ApplicationsDir, filepath.Base(src)))
+	}
+	for _, entry := range pkg.Icons {
+		src, name := iconTarget(entry)
+		i.printf("  Would copy: %s -> %s\n", src, filepath.Join(i.Paths.IconsDir, name))
+	}
+}
+
+// removeDesktopFiles deletes installed desktop entries and icons
+func (i *Installer) removeDesktopFiles(ctx context.Context, desktopFiles, iconPaths []string) {
+	for _, path := range append(append([]string{}, desktopFiles...), iconPaths...) {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			i.eprintf("Error removing %s: %v\n", path, err)
+			continue
+		}
+		i.printf("  ✓ Removed: %s\n", path)
+	}
+
+	i.refreshDesktopDatabase(ctx, len(desktopFiles) > 0)
+}
+
+// refreshDesktopDatabase asks the desktop to re-read the applications
+// dir when update-desktop-database is available
+func (i *Installer) refreshDesktopDatabase(ctx context.Context, changed bool) {
+	if !changed || !CheckToolExists("update-desktop-database") {
+		return
+	}
+	runCommandSilent(ctx, fmt.Sprintf("update-desktop-database %q", i.Paths.ApplicationsDir))
+}
@@ -0,0 +1,159 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nurysso/binrex/pkg/manifest"
+	"github.com/nurysso/binrex/pkg/state"
+)
+
+// DevLink points an installed package's bin dir entries at the build
+// outputs of a working copy with symlinks instead of copies, so rebuilding
+// there updates the installed commands at once
+func (i *Installer) DevLink(ctx context.Context, name, dir string) error {
+	err := i.devLink(name, dir)
+	i.recordHistory("dev-link", name, i.installedVersion(name), err)
+	return err
+}
+
+func (i *Installer) devLink(name, dir string) error {
+	installedData, err := i.State.Load()
+	if err != nil {
+		return err
+	}
+	installed := installedData.Find(name)
+	if installed == nil {
+		i.eprintf("Package '%s' is not installed\n", name)
+		return ErrNotInstalled
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		i.eprintf("Error: %s is not a directory\n", dir)
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	// Look for the binaries under their real names, where the manifest
+	// or the install said the build puts them
+	pkg := i.buildRecipe(installed)
+	realNames := make(map[string]string)
+	for _, binaryPath := range installed.BinaryPaths {
+		realNames[filepath.Base(binaryPath)] = filepath.Base(binaryPath)
+	}
+	for binary, alias := range installed.BinaryAliases {
+		realNames[alias] = binary
+	}
+	expected := *pkg
+	expected.BinaryNames = nil
+	for _, binary := range realNames {
+		expected.BinaryNames = append(expected.BinaryNames, binary)
+	}
+
+	binaries, err := i.findBuiltBinaries(abs, &expected)
+	if err != nil {
+		i.eprintf("Error: No binaries of %s found in %s, build it there first\n", name, abs)
+		return err
+	}
+	targets := make(map[string]string)
+	for _, binary := range binaries {
+		targets[binary.Name] = binary.Path
+	}
+
+	if i.DryRun {
+		i.println("[dry-run] Planned actions:")
+		for _, binaryPath := range installed.BinaryPaths {
+			if target := targets[realNames[filepath.Base(binaryPath)]]; target != "" {
+				i.printf("  Would link: %s -> %s\n", binaryPath, target)
+			}
+		}
+		i.printf("  Would record %s as linked to %s in %s\n", name, abs, i.Paths.InstalledPath)
+		return nil
+	}
+
+	linked := 0
+	for _, binaryPath := range installed.BinaryPaths {
+		target := targets[realNames[filepath.Base(binaryPath)]]
+		if target == "" {
+			i.eprintf("Warning: %s has no %s, keeping %s\n", abs, realNames[filepath.Base(binaryPath)], binaryPath)
+			continue
+		}
+		// A copy would go stale with the next rebuild, so only a symlink
+		// will do
+		if err := replaceEntry(binaryPath, func(tmp string) error {
+			return os.Symlink(target, tmp)
+		}); err != nil {
+			i.eprintf("Error: Failed to link %s: %v\n", binaryPath, err)
+			return err
+		}
+		linked++
+		i.printf("  ✓ Linked: %s -> %s\n", binaryPath, target)
+	}
+	if linked == 0 {
+		return fmt.Errorf("no binaries of %s were linked", name)
+	}
+
+	installed.DevPath = abs
+	i.trackFiles("dev link", installed)
+	if err := i.State.Save(installedData); err != nil {
+		return fmt.Errorf("failed to update installed.json: %w", err)
+	}
+	i.printf("\n✓ %s now runs the builds in %s, 'binrex dev unlink %s' restores the install\n", name, abs, name)
+	return nil
+}
+
+// buildRecipe returns how an installed package is built: its manifest
+// entry, or what was recorded for packages installed without one
+func (i *Installer) buildRecipe(installed *state.InstalledPackage) *manifest.Package {
+	if m, err := i.LoadManifest(); err == nil {
+		if pkg, err := m.Find(installed.Name); err == nil {
+			return pkg
+		}
+	}
+	return &manifest.Package{
+		Name:          installed.Name,
+		RepoURL:       installed.RepoURL,
+		BuildCommands: installed.BuildCommands,
+		SourceDir:     installed.BuildDir,
+	}
+}
+
+// DevUnlink points the bin dir entries of a package linked by DevLink back
+// at its store entry
+func (i *Installer) DevUnlink(ctx context.Context, name string) error {
+	err := i.devUnlink(name)
+	i.recordHistory("dev-unlink", name, i.installedVersion(name), err)
+	return err
+}
+
+func (i *Installer) devUnlink(name string) error {
+	installed := i.State.Get(name)
+	if installed == nil {
+		i.eprintf("Package '%s' is not installed\n", name)
+		return ErrNotInstalled
+	}
+	if installed.DevPath == "" {
+		i.printf("%s is not linked to a working copy\n", name)
+		return nil
+	}
+
+	entries, err := i.StoreEntries(name)
+	if err != nil {
+		return err
+	}
+	for n := range entries {
+		if entries[n].Path == installed.StorePath {
+			return i.useEntry(&entries[n])
+		}
+	}
+	if entry := i.storeEntry(name, installed.Version); entry != nil {
+		return i.useEntry(entry)
+	}
+	i.eprintf("Error: The store has no build of %s %s, reinstall it with 'binrex install --force %s'\n", name, installed.Version, name)
+	return fmt.Errorf("no store entry of %s to restore", name)
+}
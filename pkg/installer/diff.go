@@ -0,0 +1,88 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+)
+
+// Diff fetches the cached repo of an installed package and prints the
+// commits and diffstat between the commit it was built from and upstream
+// HEAD, so an update can be judged before rebuilding. Local packages are
+// compared with their working copy's HEAD instead.
+func (i *Installer) Diff(ctx context.Context, name string) error {
+	installed := i.State.Get(name)
+	if installed == nil {
+		i.eprintf("Package '%s' is not installed\n", name)
+		return ErrNotInstalled
+	}
+	if installed.Commit == "" {
+		i.eprintf("Error: %s wasn't built from a known commit, there is nothing to compare\n", name)
+		return fmt.Errorf("no installed commit of %s", name)
+	}
+	if !fsutil.FileExists(installed.RepoPath) {
+		i.eprintf("Error: The source of %s was deleted, 'binrex update %s' clones it again\n", name, name)
+		return fmt.Errorf("no cached repo of %s", name)
+	}
+
+	repoPath := installed.RepoPath
+	git := func(args ...string) (string, error) {
+		out, err := exec.CommandContext(ctx, "git", append([]string{"-C", repoPath}, args...)...).Output()
+		return strings.TrimRight(string(out), "\n"), err
+	}
+
+	upstream, label := "", "upstream"
+	if _, local := localPath(installed.RepoURL); local {
+		upstream, label = getRepoCommit(repoPath), "working copy"
+	} else if upstream = i.fetchUpstream(ctx, repoPath); upstream == "" {
+		// Pinned checkouts are detached, compare with the default branch
+		upstream, _ = git("rev-parse", "origin/HEAD")
+	}
+	if upstream == "" {
+		i.eprintf("Error: Can't tell the upstream HEAD of %s\n", name)
+		return fmt.Errorf("no upstream HEAD for %s", name)
+	}
+	if _, err := git("cat-file", "-e", installed.Commit+"^{commit}"); err != nil {
+		i.eprintf("Error: The installed commit %s is no longer in the history of %s\n", ShortCommit(installed.Commit), name)
+		return fmt.Errorf("installed commit of %s not found", name)
+	}
+
+	if upstream == installed.Commit {
+		i.printf("✓ %s is built from %s %s, there are no changes.\n", name, label, ShortCommit(upstream))
+		return nil
+	}
+
+	log, err := git("log", "--oneline", "--no-decorate", installed.Commit+".."+upstream)
+	if err != nil {
+		return fmt.Errorf("failed to list the commits of %s: %w", name, err)
+	}
+	stat, err := git("diff", "--stat", installed.Commit, upstream)
+	if err != nil {
+		return fmt.Errorf("failed to diff %s: %w", name, err)
+	}
+
+	commits := 0
+	if log != "" {
+		commits = len(strings.Split(log, "\n"))
+	}
+	i.printf("%s: %d commit(s) from %s (installed v%s) to %s (%s)\n",
+		name, commits, ShortCommit(installed.Commit), installed.Version, ShortCommit(upstream), label)
+	if commits == 0 {
+		i.println("  The installed commit is ahead of upstream or on another branch.")
+	}
+	for _, line := range strings.Split(log, "\n") {
+		if line != "" {
+			i.printf("  %s\n", line)
+		}
+	}
+	if stat != "" {
+		i.println()
+		for _, line := range strings.Split(stat, "\n") {
+			i.printf("%s\n", line)
+		}
+	}
+	return nil
+}
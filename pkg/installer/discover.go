@@ -0,0 +1,173 @@
+package installer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/nurysso/binrex/internal/fetch"
+	"github.com/nurysso/binrex/internal/fsutil"
+	"github.com/nurysso/binrex/pkg/manifest"
+)
+
+// DiscoveredRepo is a GitHub repository found by Discover
+type DiscoveredRepo struct {
+	Name        string   `json:"name"`
+	FullName    string   `json:"full_name"`
+	URL         string   `json:"html_url"`
+	Description string   `json:"description"`
+	Homepage    string   `json:"homepage"`
+	Language    string   `json:"language"`
+	Stars       int      `json:"stargazers_count"`
+	Topics      []string `json:"topics"`
+	License     *struct {
+		SPDX string `json:"spdx_id"`
+	} `json:"license"`
+	// Package is the manifest package built from the repo, "" when the
+	// manifest has none
+	Package string `json:"-"`
+}
+
+// topicPattern matches the GitHub topic names
+var topicPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,49}$`)
+
+// languageBuilds are the build settings candidate entries get from a
+// repo's main language
+var languageBuilds = map[string]struct {
+	tools, command, binPath string
+}{
+	"Rust": {"cargo", "cargo build --release", ""},
+	"Go":   {"go", "go build -o bin/ ./...", ""},
+	"C":    {"make", "make", ""},
+	"C++":  {"cmake", "cmake -B build -DCMAKE_BUILD_TYPE=Release && cmake --build build", ""},
+	"Zig":  {"zig", "zig build -Doptimize=ReleaseSafe", "zig-out/bin"},
+	"Nim":  {"nimble", "nimble build -d:release", ""},
+}
+
+// Discover searches GitHub for repositories tagged with a topic, most
+// starred first, and marks the ones the manifest already builds
+func (i *Installer) Discover(ctx context.Context, topic string, limit int) ([]DiscoveredRepo, error) {
+	if !topicPattern.MatchString(topic) {
+		return nil, fmt.Errorf("invalid topic %q, topics are lowercase letters, digits and hyphens", topic)
+	}
+	query := url.Values{
+		"q":        {"topic:" + topic},
+		"sort":     {"stars"},
+		"per_page": {fmt.Sprint(limit)},
+	}
+	data, err := fetch.Get(ctx, i.Config.GetGitHubAPIURL()+"/search/repositories?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Items []DiscoveredRepo `json:"items"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("invalid search results: %w", err)
+	}
+
+	known := make(map[string]string)
+	if m, err := i.LoadManifest(); err == nil {
+		for _, pkg := range m.Packages {
+			if repo, ok := githubRepo(pkg.RepoURL); ok {
+				known[strings.ToLower(repo)] = pkg.Name
+			}
+		}
+	} else if err != ErrManifestNotFound {
+		return nil, err
+	}
+	for n := range result.Items {
+		result.Items[n].Package = known[strings.ToLower(result.Items[n].FullName)]
+	}
+	return result.Items, nil
+}
+
+// CandidateEntry drafts a manifest entry for a discovered repo. The
+// version is its latest release, the build settings are guessed from its
+// language, so entries need a review before they are relied on.
+func (i *Installer) CandidateEntry(ctx context.Context, repo DiscoveredRepo) manifest.Package {
+	pkg := manifest.Package{
+		Name:        strings.ToLower(repo.Name),
+		RepoURL:     repo.URL,
+		Version:     "0.0.0",
+		Description: repo.Description,
+		Keywords:    repo.Topics,
+		Homepage:    repo.Homepage,
+		BinaryNames: []string{repo.Name},
+		OSSupported: "linux,mac",
+	}
+	if repo.License != nil && repo.License.SPDX != "NOASSERTION" {
+		pkg.License = repo.License.SPDX
+	}
+	if build, ok := languageBuilds[repo.Language]; ok {
+		pkg.RequiredTools = build.tools
+		pkg.BuildCommands = build.command
+		pkg.BinPath = build.binPath
+	}
+
+	data, err := fetch.Get(ctx, fmt.Sprintf("%s/repos/%s/releases/latest", i.Config.GetGitHubAPIURL(), repo.FullName))
+	var release githubRelease
+	if err == nil && json.Unmarshal(data, &release) == nil && release.TagName != "" {
+		pkg.Version = tagVersion(release.TagName)
+		if release.TagName != "v"+pkg.Version {
+			pkg.ReleaseTag = release.TagName
+		}
+	}
+	return pkg
+}
+
+// discoverPath is the manifest.d file the entries of a topic go in
+func (i *Installer) discoverPath(topic string) string {
+	return filepath.Join(i.localManifestDir(), "discover-"+topic+".json")
+}
+
+// CandidateManifest returns the JSON of a manifest holding entries, with
+// empty fields left out
+func CandidateManifest(entries []manifest.Package) ([]byte, error) {
+	var packages []json.RawMessage
+	for n := range entries {
+		entry, err := entries[n].CompactJSON()
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, entry)
+	}
+	data, err := json.MarshalIndent(map[string]any{"packages": packages}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// WriteCandidates adds entries to the local manifest, in a manifest.d
+// file of their own per topic, and returns its path. Packages already in
+// the file stay.
+func (i *Installer) WriteCandidates(topic string, entries []manifest.Package) (string, error) {
+	path := i.discoverPath(topic)
+	if fsutil.FileExists(path) {
+		existing, err := manifest.Load(path)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", path, err)
+		}
+		existing.Merge(&manifest.Manifest{Packages: entries})
+		entries = existing.Packages
+	}
+
+	data, err := CandidateManifest(entries)
+	if err != nil {
+		return "", err
+	}
+	if i.DryRun {
+		i.printf("  Would write %d manifest entries to %s\n", len(entries), path)
+		return path, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	return path, fsutil.WriteFileAtomic(path, data, 0644)
+}
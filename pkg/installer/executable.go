@@ -0,0 +1,130 @@
+package installer
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"os"
+	"runtime"
+	"unicode/utf8"
+)
+
+// elfMachines, machoCPUs and peMachines map GOARCH to the machine types a
+// native binary for it carries
+var elfMachines = map[string]elf.Machine{
+	"amd64":   elf.EM_X86_64,
+	"386":     elf.EM_386,
+	"arm64":   elf.EM_AARCH64,
+	"arm":     elf.EM_ARM,
+	"riscv64": elf.EM_RISCV,
+	"ppc64le": elf.EM_PPC64,
+	"ppc64":   elf.EM_PPC64,
+	"s390x":   elf.EM_S390,
+}
+
+var machoCPUs = map[string]macho.Cpu{
+	"amd64": macho.CpuAmd64,
+	"arm64": macho.CpuArm64,
+}
+
+var peMachines = map[string]uint16{
+	"amd64": pe.IMAGE_FILE_MACHINE_AMD64,
+	"386":   pe.IMAGE_FILE_MACHINE_I386,
+	"arm64": pe.IMAGE_FILE_MACHINE_ARM64,
+}
+
+// checkExecutable inspects a file's magic bytes and describes why it won't
+// run on this host: a binary for another OS or architecture, or a text
+// file without a #! line. It returns "" for files that look fine.
+func checkExecutable(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return err.Error()
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, _ := f.Read(head)
+	head = head[:n]
+
+	switch {
+	case n == 0:
+		return "is empty"
+	case bytes.HasPrefix(head, []byte("#!")):
+		return ""
+	case bytes.HasPrefix(head, []byte("\x7fELF")):
+		file, err := elf.NewFile(f)
+		if err != nil {
+			return fmt.Sprintf("is a damaged ELF file: %v", err)
+		}
+		if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+			return fmt.Sprintf("is a Linux/BSD binary (%s), not for %s", file.Machine, runtime.GOOS)
+		}
+		if want, ok := elfMachines[runtime.GOARCH]; ok && file.Machine != want {
+			return fmt.Sprintf("is built for %s, not %s", file.Machine, runtime.GOARCH)
+		}
+		if file.Type != elf.ET_EXEC && file.Type != elf.ET_DYN {
+			return fmt.Sprintf("is not an executable (%s)", file.Type)
+		}
+	case bytes.HasPrefix(head, []byte{0xca, 0xfe, 0xba, 0xbe}):
+		// Universal binary, runs if one of its slices matches
+		file, err := macho.NewFatFile(f)
+		if err != nil {
+			return fmt.Sprintf("is a damaged Mach-O file: %v", err)
+		}
+		if runtime.GOOS != "darwin" {
+			return fmt.Sprintf("is a macOS binary, not for %s", runtime.GOOS)
+		}
+		for _, arch := range file.Arches {
+			if arch.Cpu == machoCPUs[runtime.GOARCH] {
+				return ""
+			}
+		}
+		return fmt.Sprintf("has no slice for %s", runtime.GOARCH)
+	case isMachO(head):
+		file, err := macho.NewFile(f)
+		if err != nil {
+			return fmt.Sprintf("is a damaged Mach-O file: %v", err)
+		}
+		if runtime.GOOS != "darwin" {
+			return fmt.Sprintf("is a macOS binary, not for %s", runtime.GOOS)
+		}
+		if want, ok := machoCPUs[runtime.GOARCH]; ok && file.Cpu != want {
+			return fmt.Sprintf("is built for %s, not %s", file.Cpu, runtime.GOARCH)
+		}
+		if file.Type != macho.TypeExec {
+			return fmt.Sprintf("is not an executable (Mach-O type %d)", file.Type)
+		}
+	case bytes.HasPrefix(head, []byte("MZ")):
+		file, err := pe.NewFile(f)
+		if err != nil {
+			return fmt.Sprintf("is a damaged PE file: %v", err)
+		}
+		if runtime.GOOS != "windows" {
+			return fmt.Sprintf("is a Windows binary, not for %s", runtime.GOOS)
+		}
+		if want, ok := peMachines[runtime.GOARCH]; ok && file.Machine != want {
+			return fmt.Sprintf("is built for machine 0x%x, not %s", file.Machine, runtime.GOARCH)
+		}
+	case utf8.Valid(head) && !bytes.Contains(head, []byte{0}):
+		return "is a text file without a #! line"
+	default:
+		return "is not a recognised executable format"
+	}
+	return ""
+}
+
+// isMachO reports whether head starts with a thin Mach-O magic number
+func isMachO(head []byte) bool {
+	for _, magic := range [][]byte{
+		{0xfe, 0xed, 0xfa, 0xce}, {0xce, 0xfa, 0xed, 0xfe},
+		{0xfe, 0xed, 0xfa, 0xcf}, {0xcf, 0xfa, 0xed, 0xfe},
+	} {
+		if bytes.HasPrefix(head, magic) {
+			return true
+		}
+	}
+	return false
+}
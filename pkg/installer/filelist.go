@@ -0,0 +1,204 @@
+package installer
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+	"github.com/nurysso/binrex/pkg/state"
+)
+
+// Kinds of the files in a package's file list
+const (
+	fileBinary  = "binary"
+	fileStore   = "store"
+	fileCopied  = "file"
+	fileDesktop = "desktop"
+	fileIcon    = "icon"
+	fileService = "service"
+)
+
+// File statuses reported by Files
+const (
+	FileUnchanged = "unchanged"
+	FileModified  = "modified"
+	FileMissing   = "missing"
+)
+
+// PackageFile is a file of an installed package and whether it still is
+// as binrex wrote it
+type PackageFile struct {
+	state.FileRecord
+	Status string
+}
+
+// fileLogPath returns the log of the files binrex changed, kept next to
+// the history
+func (i *Installer) fileLogPath() string {
+	return filepath.Join(filepath.Dir(i.Paths.HistoryPath), "files.jsonl")
+}
+
+// fileList records the files an installed package has now: its bin dir
+// entries, store entry, copied files, desktop files, icons and services.
+// Directories are listed by the files in them.
+func fileList(pkg *state.InstalledPackage) []state.FileRecord {
+	var records []state.FileRecord
+	seen := make(map[string]bool)
+	add := func(kind string, paths ...string) {
+		for _, path := range paths {
+			for _, record := range recordFiles(path, kind) {
+				if !seen[record.Path] {
+					seen[record.Path] = true
+					records = append(records, record)
+				}
+			}
+		}
+	}
+
+	add(fileBinary, pkg.BinaryPaths...)
+	if pkg.StorePath != "" {
+		add(fileStore, pkg.StorePath)
+	}
+	add(fileCopied, pkg.Files...)
+	add(fileDesktop, pkg.DesktopFiles...)
+	add(fileIcon, pkg.IconPaths...)
+	add(fileService, pkg.ServiceUnits...)
+
+	sort.Slice(records, func(a, b int) bool { return records[a].Path < records[b].Path })
+	return records
+}
+
+// recordFiles records a file, symlink or the files under a directory,
+// nothing when it doesn't exist. Store entry metadata is left out, it
+// changes whenever the entry is used.
+func recordFiles(root, kind string) []state.FileRecord {
+	var records []state.FileRecord
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() == storeEntryFile {
+			return nil
+		}
+		if record, ok := recordFile(path, kind); ok {
+			records = append(records, record)
+		}
+		return nil
+	})
+	return records
+}
+
+// recordFile records a single file or symlink as it is now
+func recordFile(path, kind string) (state.FileRecord, bool) {
+	record := state.FileRecord{Path: path, Kind: kind}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return record, false
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		record.Link, err = os.Readlink(path)
+	} else if info.Mode().IsRegular() {
+		record.SHA256, err = fsutil.SHA256File(path)
+	}
+	return record, err == nil
+}
+
+// fileStatus reports whether a recorded file is still as it was recorded
+func fileStatus(record state.FileRecord) string {
+	current, ok := recordFile(record.Path, record.Kind)
+	switch {
+	case !ok:
+		return FileMissing
+	case !current.Same(record):
+		return FileModified
+	default:
+		return FileUnchanged
+	}
+}
+
+// trackFiles takes the file list of an installed package anew, logging
+// what the operation changed since the list was last taken
+func (i *Installer) trackFiles(action string, pkg *state.InstalledPackage) {
+	records := fileList(pkg)
+	i.logFileChanges(action, pkg.Name, pkg.FileList, records)
+	pkg.FileList = records
+}
+
+// logFileChanges appends the difference of two file lists to the file log
+func (i *Installer) logFileChanges(action, name string, before, after []state.FileRecord) {
+	changes := state.DiffFiles(before, after, func(path string) bool {
+		_, err := os.Lstat(path)
+		return err == nil
+	})
+	if err := state.AppendFileChanges(i.fileLogPath(), action, name, changes); err != nil {
+		i.eprintf("Warning: Failed to write the file log: %v\n", err)
+	}
+}
+
+// removeLeftovers deletes the files of an old file list that keep doesn't
+// have and the earlier cleanup missed, unless another package owns them
+// or they changed since binrex wrote them. Store files are left to the
+// store.
+func (i *Installer) removeLeftovers(old, keep []state.FileRecord, owned map[string]bool) {
+	kept := make(map[string]bool, len(keep))
+	for _, record := range keep {
+		kept[record.Path] = true
+	}
+
+	for _, record := range old {
+		if record.Kind == fileStore || kept[record.Path] || owned[record.Path] {
+			continue
+		}
+		switch fileStatus(record) {
+		case FileMissing:
+			continue
+		case FileModified:
+			i.eprintf("Warning: Keeping %s, it changed since it was installed\n", record.Path)
+			continue
+		}
+		if err := os.Remove(record.Path); err != nil {
+			i.eprintf("Error removing %s: %v\n", record.Path, err)
+			continue
+		}
+		i.printf("  ✓ Removed: %s\n", record.Path)
+	}
+}
+
+// ownedFiles returns the paths in the file lists of the installed packages
+// other than name
+func ownedFiles(installedData *state.InstalledData, name string) map[string]bool {
+	owned := make(map[string]bool)
+	for _, pkg := range installedData.Installed {
+		if pkg.Name == name {
+			continue
+		}
+		for _, record := range pkg.FileList {
+			owned[record.Path] = true
+		}
+	}
+	return owned
+}
+
+// Files returns the file list of an installed package, each file with
+// whether it changed since binrex wrote it. Packages installed before file
+// lists were kept are listed as they are now.
+func (i *Installer) Files(name string) ([]PackageFile, error) {
+	pkg := i.State.Get(name)
+	if pkg == nil {
+		return nil, ErrNotInstalled
+	}
+
+	records := pkg.FileList
+	if records == nil {
+		records = fileList(pkg)
+	}
+	files := make([]PackageFile, 0, len(records))
+	for _, record := range records {
+		files = append(files, PackageFile{FileRecord: record, Status: fileStatus(record)})
+	}
+	return files, nil
+}
+
+// FileLog returns the file log, optionally for a single package
+func (i *Installer) FileLog(name string) ([]state.FileChange, error) {
+	return state.ReadFileChanges(i.fileLogPath(), name)
+}
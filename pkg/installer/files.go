@@ -0,0 +1,195 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+	"github.com/nurysso/binrex/pkg/manifest"
+	"github.com/nurysso/binrex/pkg/state"
+)
+
+// isFilesPackage reports whether a package copies declared files instead
+// of building binaries
+func isFilesPackage(pkg *manifest.Package) bool {
+	return pkg.Type == manifest.TypeScript || pkg.Type == manifest.TypeAssets
+}
+
+// checkPackageType rejects package types binrex doesn't know and files
+// packages that declare nothing to copy
+func checkPackageType(pkg *manifest.Package) error {
+	switch pkg.Type {
+	case "":
+		return nil
+	case manifest.TypeScript, manifest.TypeAssets:
+		if len(pkg.Files) == 0 {
+			return fmt.Errorf("%s package %s declares no files", pkg.Type, pkg.Name)
+		}
+		if pkg.RepoURL == "" {
+			return fmt.Errorf("%s package %s needs a repo_url to copy its files from", pkg.Type, pkg.Name)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown package type %q", pkg.Type)
+	}
+}
+
+// fileTarget resolves the directory a declared file is copied into.
+// Scripts without a target go to the package's bin dir.
+func (i *Installer) fileTarget(pkg *manifest.Package, target string) (string, error) {
+	if target == "" {
+		if pkg.Type != manifest.TypeScript {
+			return "", fmt.Errorf("no target directory for an %s file", pkg.Type)
+		}
+		return i.binDir(pkg), nil
+	}
+	return i.Config.ResolveBinDir(target)
+}
+
+// sortedFiles returns the declared file patterns in order
+func sortedFiles(files map[string]string) []string {
+	patterns := make([]string, 0, len(files))
+	for pattern := range files {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	return patterns
+}
+
+// installFiles copies the declared files of a script or assets package
+// from srcDir to their target directories. Copies landing in the bin dir
+// are returned as binaries, the rest as files. On failure the copies made
+// so far are deleted again.
+func (i *Installer) installFiles(pkg *manifest.Package, srcDir string) (binaries, files []string, err error) {
+	defer func() {
+		if err != nil {
+			for _, path := range append(binaries, files...) {
+				os.RemoveAll(path)
+			}
+			binaries, files = nil, nil
+		}
+	}()
+
+	for _, pattern := range sortedFiles(pkg.Files) {
+		if !filepath.IsLocal(pattern) {
+			return binaries, files, fmt.Errorf("file %s is outside the package", pattern)
+		}
+		target, err := i.fileTarget(pkg, pkg.Files[pattern])
+		if err != nil {
+			return binaries, files, err
+		}
+		matches, err := filepath.Glob(filepath.Join(srcDir, pattern))
+		if err != nil {
+			return binaries, files, err
+		}
+		if len(matches) == 0 {
+			return binaries, files, fmt.Errorf("no file matches %s", pattern)
+		}
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return binaries, files, fmt.Errorf("error creating %s: %w", target, err)
+		}
+
+		for _, src := range matches {
+			dst := filepath.Join(target, filepath.Base(src))
+			if fsutil.FileExists(dst) {
+				return binaries, files, fmt.Errorf("%s already exists, not overwriting it", dst)
+			}
+
+			info, err := os.Stat(src)
+			if err != nil {
+				return binaries, files, err
+			}
+			if info.IsDir() {
+				err = copyTree(src, dst)
+			} else if err = fsutil.CopyFile(src, dst); err == nil && pkg.Type == manifest.TypeScript {
+				err = os.Chmod(dst, 0755)
+			}
+			if err != nil {
+				os.RemoveAll(dst)
+				return binaries, files, fmt.Errorf("failed to copy %s: %w", src, err)
+			}
+
+			if filepath.Clean(target) == filepath.Clean(i.binDir(pkg)) {
+				binaries = append(binaries, dst)
+			} else {
+				files = append(files, dst)
+			}
+			i.printf("  ✓ Installed: %s\n", dst)
+		}
+	}
+	return binaries, files, nil
+}
+
+// printFilesPlan prints what installing a script or assets package would
+// copy, for dry runs
+func (i *Installer) printFilesPlan(pkg *manifest.Package) {
+	repoPath := i.RepoCachePath(pkg.RepoURL)
+
+	i.println("[dry-run] Planned actions:")
+	if fsutil.FileExists(repoPath) {
+		i.printf("  Would update repository: cd %s && git pull\n", repoPath)
+	} else {
+		i.printf("  Would clone: git clone %s %s\n", pkg.RepoURL, repoPath)
+	}
+	i.printSigningPlan(pkg)
+	for _, pattern := range sortedFiles(pkg.Files) {
+		target, err := i.fileTarget(pkg, pkg.Files[pattern])
+		if err != nil {
+			i.printf("  Can't copy %s: %v\n", pattern, err)
+			continue
+		}
+		i.printf("  Would copy: %s -> %s\n", pattern, target)
+	}
+	i.printf("  Would record %s in %s\n", pkg.Name, i.Paths.InstalledPath)
+}
+
+// installFilesPackage copies the files of a script or assets package out
+// of its checked out repo and records them, without building anything
+func (i *Installer) installFilesPackage(ctx context.Context, pkg *manifest.Package, repoPath string, opts InstallOptions) error {
+	if _, err := i.verifySigned(ctx, pkg, repoPath); err != nil {
+		i.eprintf("Error: %v\n", err)
+		return err
+	}
+
+	i.printf("\nCopying files of %s...\n", pkg.Name)
+	binaries, files, err := i.installFiles(pkg, buildPathFor(pkg, repoPath))
+	if err != nil {
+		i.eprintf("Error: %v\n", err)
+		return err
+	}
+
+	i.recordInstall(ctx, state.InstalledPackage{
+		Name:          pkg.Name,
+		Version:       pkg.Version,
+		BinaryPaths:   binaries,
+		RepoPath:      repoPath,
+		InstallDate:   getCurrentDate(),
+		TotalBinaries: len(binaries),
+		Commit:        getRepoCommit(repoPath),
+		InstallDir:    pkg.InstallDir,
+		Constraint:    opts.Constraint,
+		Type:          pkg.Type,
+		Files:         files,
+	})
+	if opts.NoKeepSource || i.Config.DeleteSources {
+		i.deleteSource(pkg.Name)
+	}
+
+	i.printf("\n✓ Successfully installed %s!\n", pkg.Name)
+	i.printf("  Version: %s\n", pkg.Version)
+	i.printf("  Files installed: %d\n", len(binaries)+len(files))
+	for _, path := range append(binaries, files...) {
+		i.printf("    - %s\n", path)
+	}
+	if len(binaries) > 0 {
+		i.warnIfNotOnPath(i.binDir(pkg))
+	}
+	if pkg.PostInstall != "" {
+		i.printf("\n%s\n", strings.TrimRight(pkg.PostInstall, "\n"))
+	}
+	return nil
+}
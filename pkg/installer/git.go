@@ -0,0 +1,266 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/nurysso/binrex/internal/fetch"
+	"github.com/nurysso/binrex/internal/fsutil"
+)
+
+// LocalOrigin prefixes the repo URL recorded for packages installed from a
+// local directory with install --path
+const LocalOrigin = "local:"
+
+// localPath returns the directory of a local: repo URL
+func localPath(repoURL string) (string, bool) {
+	return strings.CutPrefix(repoURL, LocalOrigin)
+}
+
+// localVersion returns the version of a local package directory: the
+// commit it has checked out, marked -dirty when it has uncommitted
+// changes, or "local" outside git
+func localVersion(ctx context.Context, dir string) string {
+	commit := getRepoCommit(dir)
+	if commit == "" {
+		return "local"
+	}
+	out, err := exec.CommandContext(ctx, "git", "-C", dir, "status", "--porcelain").Output()
+	if err == nil && len(strings.TrimSpace(string(out))) > 0 {
+		return ShortCommit(commit) + "-dirty"
+	}
+	return ShortCommit(commit)
+}
+
+// RepoNameFromURL extracts repository name from GitHub URL
+func RepoNameFromURL(url string) string {
+	url = strings.TrimRight(url, "/")
+	if strings.HasSuffix(url, ".git") {
+		url = url[:len(url)-4]
+	}
+
+	parts := strings.Split(url, "/")
+	return parts[len(parts)-1]
+}
+
+// RepoCachePath returns the cache directory path for a repository
+func (i *Installer) RepoCachePath(repoURL string) string {
+	repoName := RepoNameFromURL(repoURL)
+	return filepath.Join(i.Paths.CacheDir, repoName)
+}
+
+// cloneOrUpdateRepo clones or updates a repository, failing over to
+// mirrors when the primary URL is unreachable
+func (i *Installer) cloneOrUpdateRepo(ctx context.Context, repoURL string, mirrors []string) (string, error) {
+	repoPath := i.RepoCachePath(repoURL)
+	urls := i.Config.GetRepoURLs(repoURL, mirrors)
+
+	if !fsutil.FileExists(repoPath) {
+		err := i.retry(ctx, "Cloning "+repoURL, func() error {
+			var lastErr error
+			for n, url := range urls {
+				if n > 0 {
+					i.printf("Trying mirror %s...\n", url)
+				}
+				i.printf("\nCloning repository from %s...\n", url)
+				cmd := fmt.Sprintf("%s clone %s %s", i.gitCommand(), url, repoPath)
+				if lastErr = i.runGit(ctx, cmd); lastErr == nil {
+					return nil
+				}
+				// Don't leave a half-cloned directory for the next attempt
+				os.RemoveAll(repoPath)
+			}
+			return fetch.NetworkError(fmt.Errorf("failed to clone repository: %w", lastErr))
+		})
+		if err != nil {
+			return "", err
+		}
+		return repoPath, nil
+	}
+
+	i.printf("\nUpdating repository at %s...\n", repoPath)
+	// A previous install may have left a tag checked out
+	if err := runCommandSilent(ctx, fmt.Sprintf("cd %s && git symbolic-ref -q HEAD", repoPath)); err != nil {
+		out, _ := exec.CommandContext(ctx, "git", "-C", repoPath, "rev-parse", "--abbrev-ref", "origin/HEAD").Output()
+		if branch := strings.TrimPrefix(strings.TrimSpace(string(out)), "origin/"); branch != "" {
+			runCommandSilent(ctx, fmt.Sprintf("cd %s && git checkout --quiet %s", repoPath, branch))
+		}
+	}
+	// A pull that keeps failing leaves the cached checkout to build from
+	i.retry(ctx, "Updating "+repoPath, func() error {
+		err := i.runGit(ctx, fmt.Sprintf("cd %s && %s pull", repoPath, i.gitCommand()))
+		if err == nil {
+			return nil
+		}
+		for _, url := range urls[1:] {
+			i.printf("Trying mirror %s...\n", url)
+			if i.runGit(ctx, fmt.Sprintf("cd %s && %s pull %s HEAD", repoPath, i.gitCommand(), url)) == nil {
+				return nil
+			}
+		}
+		return err
+	})
+
+	return repoPath, nil
+}
+
+// gitCommand returns the git command for clones and pulls. Git has no
+// rate limit of its own, so with one set it runs under trickle when that
+// is installed.
+func (i *Installer) gitCommand() string {
+	rate, _ := i.rateLimit()
+	if rate <= 0 {
+		return "git"
+	}
+	if !CheckToolExists("trickle") {
+		if !i.warnedRate {
+			i.eprintln("Warning: Install trickle to rate limit git clones, only downloads are limited")
+			i.warnedRate = true
+		}
+		return "git"
+	}
+	return fmt.Sprintf("trickle -s -d %d git", max(rate/1024, 1))
+}
+
+// updateSubmodules checks out the submodules a repository's HEAD refers
+// to, recursively
+func (i *Installer) updateSubmodules(ctx context.Context, repoPath string) error {
+	i.println("Updating submodules...")
+	cmd := fmt.Sprintf("cd %s && git submodule sync --recursive && %s submodule update --init --recursive", repoPath, i.gitCommand())
+	if err := i.runCommand(ctx, cmd); err != nil {
+		return fmt.Errorf("failed to update submodules: %w", err)
+	}
+	return nil
+}
+
+// hasSubmodules reports whether a checked out repository uses submodules
+func hasSubmodules(repoPath string) bool {
+	return fsutil.FileExists(filepath.Join(repoPath, ".gitmodules"))
+}
+
+// DetectBuildCommand guesses the build command for a repository by
+// looking for well-known build system files
+func DetectBuildCommand(repoPath string) string {
+	buildSystems := []struct {
+		file    string
+		command string
+	}{
+		{"Cargo.toml", "cargo build --release"},
+		{"go.mod", "go build -o bin/ ./..."},
+		{"CMakeLists.txt", "cmake -B build -DCMAKE_BUILD_TYPE=Release && cmake --build build"},
+		{"meson.build", "meson setup build && meson compile -C build"},
+		{"Makefile", "make"},
+		{"install.sh", "./install.sh"},
+	}
+
+	for _, bs := range buildSystems {
+		if fsutil.FileExists(filepath.Join(repoPath, bs.file)) {
+			return bs.command
+		}
+	}
+
+	return ""
+}
+
+// getRepoCommit returns the commit hash of a repository's HEAD
+func getRepoCommit(repoPath string) string {
+	out, err := exec.Command("git", "-C", repoPath, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// ShortCommit abbreviates a commit hash for display
+func ShortCommit(commit string) string {
+	if commit == "" {
+		return "unknown"
+	}
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
+
+// fetchUpstream fetches a cached repo and returns the upstream HEAD
+// commit, or "" when the repo is missing or the fetch fails
+func (i *Installer) fetchUpstream(ctx context.Context, repoPath string) string {
+	if !fsutil.FileExists(repoPath) {
+		return ""
+	}
+
+	i.println("\nFetching upstream changes...")
+	if err := runCommandSilent(ctx, fmt.Sprintf("cd %s && git fetch --quiet", repoPath)); err != nil {
+		i.eprintln("Warning: Failed to fetch upstream changes")
+		return ""
+	}
+
+	out, err := exec.CommandContext(ctx, "git", "-C", repoPath, "rev-parse", "@{upstream}").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// showUpstreamChanges prints the commits between the installed build and
+// the fetched upstream, falling back to the top of the changelog when
+// there is no usable git range
+func (i *Installer) showUpstreamChanges(ctx context.Context, repoPath, commit string) {
+	from := commit
+	if from == "" {
+		from = "HEAD"
+	}
+
+	out, err := exec.CommandContext(ctx, "git", "-C", repoPath, "log", "--oneline", "--no-decorate",
+		from+"..@{upstream}").Output()
+	if err != nil {
+		i.showChangelogExcerpt(repoPath)
+		return
+	}
+
+	log := strings.TrimSpace(string(out))
+	if log == "" {
+		i.println("No new upstream commits.")
+		return
+	}
+
+	i.printf("\nUpstream changes since %s:\n", ShortCommit(commit))
+	for _, line := range strings.Split(log, "\n") {
+		i.printf("  %s\n", line)
+	}
+}
+
+// showChangelogExcerpt prints the top of a repository's changelog
+func (i *Installer) showChangelogExcerpt(repoPath string) {
+	for _, name := range []string{"CHANGELOG.md", "CHANGELOG", "CHANGES.md", "NEWS.md"} {
+		data, err := os.ReadFile(filepath.Join(repoPath, name))
+		if err != nil {
+			continue
+		}
+
+		lines := strings.Split(string(data), "\n")
+		if len(lines) > 20 {
+			lines = lines[:20]
+		}
+
+		i.printf("\n%s:\n", name)
+		for _, line := range lines {
+			i.printf("  %s\n", line)
+		}
+		return
+	}
+}
+
+// remoteHead asks a remote for its HEAD commit without touching the cache
+func remoteHead(ctx context.Context, repoURL string) string {
+	out, err := exec.CommandContext(ctx, "git", "ls-remote", repoURL, "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	commit, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\t")
+	return commit
+}
@@ -0,0 +1,911 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+	"github.com/nurysso/binrex/pkg/manifest"
+	"github.com/nurysso/binrex/pkg/state"
+)
+
+// InstallOptions control Install, InstallGit, InstallAll and Update
+type InstallOptions struct {
+	// BuildCommand overrides the manifest's build_commands, or the
+	// auto-detected build command of a git install
+	BuildCommand string
+	// BuildDir overrides the manifest's source_dir, relative to the repo
+	BuildDir string
+	// Force makes Update rebuild even when upstream hasn't changed
+	Force bool
+	// EnableServices enables and starts the package's systemd user units,
+	// as does the config's enable_services
+	EnableServices bool
+	// InstallMissingTools bootstraps missing required tools with the
+	// toolchain installers allowed in the config
+	InstallMissingTools bool
+	// InstallDir links the binaries into this directory instead of the
+	// bin dir, taking precedence over install_dirs and the manifest
+	InstallDir string
+	// Aliases install binaries under other names on top of the manifest's
+	// binary_aliases. The "" key renames a package's only binary.
+	Aliases map[string]string
+	// Constraint builds the newest tag satisfying a version constraint
+	// like ^1.2 instead of the default branch, recorded for updates
+	Constraint string
+	// FromSource builds packages that have a release_asset instead of
+	// downloading the release
+	FromSource bool
+	// NoKeepSource deletes the cached repository once the binaries are
+	// installed, as does the config's delete_sources
+	NoKeepSource bool
+	// Commit builds exactly this commit, ahead of pins and constraints,
+	// recorded as Version when that is set
+	Commit  string
+	Version string
+	// RetryFailed makes InstallAll install only the packages that failed
+	// in the unfinished batch
+	RetryFailed bool
+
+	// confirmed skips asking before an update, the caller asked already
+	confirmed bool
+}
+
+// forcesRebuild reports whether the options change what a build produces
+func (o InstallOptions) forcesRebuild() bool {
+	return o.Force || o.BuildCommand != "" || o.BuildDir != ""
+}
+
+// apply returns a copy of pkg with the option overrides applied
+func (o InstallOptions) apply(pkg *manifest.Package) *manifest.Package {
+	p := *pkg
+	if o.BuildCommand != "" {
+		p.BuildCommands = o.BuildCommand
+	}
+	if o.BuildDir != "" {
+		p.SourceDir = o.BuildDir
+	}
+	if len(o.Aliases) > 0 {
+		p.BinaryAliases = make(map[string]string)
+		for binary, alias := range pkg.BinaryAliases {
+			p.BinaryAliases[binary] = alias
+		}
+		for binary, alias := range o.Aliases {
+			p.BinaryAliases[binary] = alias
+		}
+	}
+	return &p
+}
+
+// withInstallDir resolves where a package's binaries are linked: the
+// override, the config's install_dirs, the manifest's install_dir, and
+// the bin dir otherwise. pkg must be a copy, as apply returns.
+func (i *Installer) withInstallDir(pkg *manifest.Package, override string) (*manifest.Package, error) {
+	dir := pkg.InstallDir
+	if d := i.Config.InstallDirs[pkg.Name]; d != "" {
+		dir = d
+	}
+	if override != "" {
+		dir = override
+	}
+
+	pkg.InstallDir = ""
+	if dir != "" {
+		resolved, err := i.Config.ResolveBinDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		if resolved != filepath.Clean(i.Paths.BinDir) {
+			pkg.InstallDir = resolved
+		}
+	}
+	return pkg, nil
+}
+
+// binDir returns the directory a package's binaries are linked into
+func (i *Installer) binDir(pkg *manifest.Package) string {
+	if pkg.InstallDir != "" {
+		return pkg.InstallDir
+	}
+	return i.Paths.BinDir
+}
+
+// Install installs a package from the manifest
+func (i *Installer) Install(ctx context.Context, name string, opts InstallOptions) error {
+	err := i.install(ctx, name, opts)
+	i.recordHistory("install", name, i.installedVersion(name), err)
+	return err
+}
+
+// InstallGit installs a package straight from a git URL, without a
+// manifest entry. The package is recorded as unmanaged in installed.json.
+func (i *Installer) InstallGit(ctx context.Context, repoURL string, opts InstallOptions) error {
+	name := RepoNameFromURL(repoURL)
+	err := i.installGit(ctx, repoURL, opts)
+	i.recordHistory("install", name, i.installedVersion(name), err)
+	return err
+}
+
+// InstallLocal installs a package from a local directory, such as the
+// checkout of a tool being developed, like InstallGit but building the
+// directory as it is, without cloning or pulling. It is recorded with a
+// local: origin, so updates rebuild it from there.
+func (i *Installer) InstallLocal(ctx context.Context, dir string, opts InstallOptions) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		i.eprintf("Error: %s is not a directory\n", dir)
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return i.InstallGit(ctx, LocalOrigin+abs, opts)
+}
+
+// install installs a package
+func (i *Installer) install(ctx context.Context, name string, opts InstallOptions) error {
+	i.printf("Installing package: %s\n", name)
+
+	// Check if manifest exists
+	if err := i.requireManifest(); err != nil {
+		return err
+	}
+
+	// Find package in manifest
+	pkg, err := i.FindPackage(name)
+	if err != nil {
+		i.eprintf("Error: Package '%s' not found in manifest\n", name)
+		return err
+	}
+	if pkg, err = i.withInstallDir(opts.apply(pkg), opts.InstallDir); err != nil {
+		return err
+	}
+
+	// Display package info
+	i.println()
+	pkg.PrintInfo(i.Stdout)
+	i.println()
+
+	// Check OS compatibility
+	currentOS := GetOSName()
+	if !pkg.SupportsOS(currentOS) {
+		i.eprintf("Error: Package not supported on %s\n", currentOS)
+		i.eprintf("Supported OS: %s\n", pkg.OSSupported)
+		return ErrUnsupportedOS
+	}
+
+	// Check required tools, container builds bring their own
+	if pkg.RequiredTools != "" && i.buildsLocally() && !i.ensureRequiredTools(ctx, pkg.RequiredTools, opts.InstallMissingTools) {
+		i.eprintln("\nError: Missing required tools!")
+		i.eprintln("Please install the required tools using your system package manager.")
+		if !opts.InstallMissingTools {
+			i.eprintln("Or re-run with --install-missing-tools to bootstrap known toolchains.")
+		}
+		return ErrMissingTools
+	}
+
+	// Check if already installed
+	if i.State.IsInstalled(name) && !i.replaces(name) {
+		i.printf("Package '%s' is already installed. Use 'update' to update it.\n", name)
+		return nil
+	}
+
+	if err := checkPackageType(pkg); err != nil {
+		i.eprintf("Error: %v\n", err)
+		return err
+	}
+
+	// Packages without a repo are downloaded as they are
+	if pkg.URL != "" && !isFilesPackage(pkg) {
+		return i.installURL(ctx, pkg)
+	}
+
+	// Prefer the prebuilt release when the manifest names an asset, unless
+	// a specific source ref is wanted
+	pin := i.pinnedRef(name)
+	if pkg.ReleaseAsset != "" && !opts.FromSource && opts.Constraint == "" && pin == "" && !isFilesPackage(pkg) {
+		err := i.installRelease(ctx, pkg)
+		if err == nil {
+			return nil
+		}
+		i.eprintf("Warning: Can't install from the release: %v\n", err)
+		i.println("Building from source instead...")
+	}
+
+	if i.DryRun {
+		if opts.Commit != "" {
+			i.printf("[dry-run] Would build commit %s\n", ShortCommit(opts.Commit))
+		} else if pin != "" {
+			i.printf("[dry-run] %s is pinned to %s\n", name, pin)
+		} else if err := i.planConstraint(ctx, pkg, opts.Constraint); err != nil {
+			return err
+		}
+		if isFilesPackage(pkg) {
+			i.printFilesPlan(pkg)
+			return nil
+		}
+		i.printInstallPlan(pkg)
+		return nil
+	}
+
+	// Clone or update the package's repository
+	repoPath, err := i.cloneOrUpdateRepo(ctx, pkg.RepoURL, pkg.Mirrors)
+	if err != nil {
+		return err
+	}
+	if opts.Commit != "" {
+		if _, err := i.checkoutRef(ctx, repoPath, opts.Commit); err != nil {
+			i.eprintf("Error: %v\n", err)
+			return err
+		}
+		if opts.Version != "" {
+			pkg.Version = opts.Version
+		}
+	} else if pin != "" {
+		if pkg.Version, err = i.checkoutPin(ctx, repoPath, pin); err != nil {
+			i.eprintf("Error: %v\n", err)
+			return err
+		}
+	} else if opts.Constraint != "" {
+		tag, err := i.checkoutConstraint(ctx, repoPath, opts.Constraint)
+		if err != nil {
+			i.eprintf("Error: %v\n", err)
+			return err
+		}
+		pkg.Version = tagVersion(tag)
+	}
+	if pkg.Submodules {
+		if err := i.updateSubmodules(ctx, repoPath); err != nil {
+			return err
+		}
+	}
+
+	// Script and assets packages are copied as they are
+	if isFilesPackage(pkg) {
+		return i.installFilesPackage(ctx, pkg, repoPath, opts)
+	}
+
+	installedBinaries, provenance, err := i.buildAndInstall(ctx, pkg, repoPath)
+	if err != nil {
+		return err
+	}
+
+	desktopFiles, iconPaths := i.installDesktopFiles(ctx, pkg, buildPathFor(pkg, repoPath))
+	serviceUnits := i.installServices(ctx, pkg, buildPathFor(pkg, repoPath), opts.EnableServices || i.Config.EnableServices)
+
+	// Update installed.json
+	i.recordInstall(ctx, state.InstalledPackage{
+		Name:          name,
+		Version:       pkg.Version,
+		BinaryPaths:   installedBinaries,
+		RepoPath:      repoPath,
+		InstallDate:   getCurrentDate(),
+		TotalBinaries: len(installedBinaries),
+		Commit:        getRepoCommit(repoPath),
+		DesktopFiles:  desktopFiles,
+		IconPaths:     iconPaths,
+		ServiceUnits:  serviceUnits,
+		Provenance:    provenance,
+		InstallDir:    pkg.InstallDir,
+		BinaryAliases: pkg.BinaryAliases,
+		Provides:      pkg.Provides,
+		Constraint:    opts.Constraint,
+	})
+	i.registerProvides(name)
+	if opts.NoKeepSource || i.Config.DeleteSources {
+		i.deleteSource(name)
+	}
+
+	i.printInstallSummary(pkg, installedBinaries)
+	if pkg.PostInstall != "" {
+		i.printf("\n%s\n", strings.TrimRight(pkg.PostInstall, "\n"))
+	}
+	return nil
+}
+
+// deleteSource deletes the cached repository an installed package was
+// built from, unless other installed packages are built from it too. The
+// next update clones it again.
+func (i *Installer) deleteSource(name string) {
+	installedData, err := i.State.Load()
+	if err != nil {
+		return
+	}
+	repoPath := i.unsharedRepoPath(installedData, name)
+	if repoPath == "" {
+		return
+	}
+
+	if err := os.RemoveAll(repoPath); err != nil {
+		i.eprintf("Warning: Failed to delete %s: %v\n", repoPath, err)
+		return
+	}
+	i.printf("  ✓ Deleted source: %s\n", repoPath)
+}
+
+// buildPathFor returns where a package's build commands run
+func buildPathFor(pkg *manifest.Package, repoPath string) string {
+	if pkg.SourceDir != "" {
+		return filepath.Join(repoPath, pkg.SourceDir)
+	}
+	return repoPath
+}
+
+// build runs a package's build commands on the host, in a sandbox when
+// one is configured and without network when asked, on the remote build
+// host or inside its build image when container builds are enabled. The
+// output goes to a build log, of which only the tail is shown when the
+// build fails.
+func (i *Installer) build(ctx context.Context, pkg *manifest.Package, repoPath string) error {
+	log, logPath, err := i.createBuildLog(pkg.Name)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+	i.printf("Build log: %s\n", logPath)
+	var out io.Writer = log
+	if i.streamBuild {
+		out = io.MultiWriter(log, i.Stdout)
+	}
+
+	sandbox, err := i.sandboxTool()
+	if err == nil && i.buildsLocally() && i.noNetworkBuild() && sandbox == "" {
+		err = checkNetworkIsolation(ctx)
+	}
+	if err != nil && i.buildsLocally() {
+		i.eprintf("Error: %v\n", err)
+		return err
+	}
+	switch {
+	case i.remoteBuildHost() != "":
+		err = i.runRemoteBuild(ctx, pkg, repoPath, out)
+	case i.containerBuilds():
+		err = i.runContainerBuild(ctx, pkg, repoPath, out)
+	default:
+		err = i.runLocalBuild(ctx, sandbox, pkg, repoPath, out)
+	}
+	if err != nil {
+		i.printBuildLogTail(logPath)
+	}
+	return err
+}
+
+// buildAndInstall builds a package inside its cloned repo and copies the
+// resulting binaries into the bin dir, returning the installed paths and
+// the provenance of the build
+func (i *Installer) buildAndInstall(ctx context.Context, pkg *manifest.Package, repoPath string) ([]string, *state.Provenance, error) {
+	// Determine where to run build commands
+	buildPath := buildPathFor(pkg, repoPath)
+
+	if !fsutil.FileExists(buildPath) {
+		return nil, nil, fmt.Errorf("source directory not found: %s", buildPath)
+	}
+
+	signer, err := i.verifySigned(ctx, pkg, repoPath)
+	if err != nil {
+		i.eprintf("Error: %v\n", err)
+		return nil, nil, err
+	}
+
+	// Clean before building (if cargo project), except in a developer's
+	// own checkout
+	_, local := localPath(pkg.RepoURL)
+	if strings.Contains(pkg.BuildCommands, "cargo") && i.buildsLocally() && !local {
+		i.println("Cleaning previous build...")
+		cleanCmd := fmt.Sprintf("cd %s && cargo clean", buildPath)
+		runCommandSilent(ctx, cleanCmd)
+	}
+
+	// Build
+	if cache := i.compilerCache(); cache != "" && i.buildsLocally() {
+		i.printf("Building package (jobs: %d, cache: %s)...\n", i.buildJobs(), cache)
+	} else {
+		i.printf("Building package (jobs: %d)...\n", i.buildJobs())
+	}
+	start := time.Now()
+	if err := i.build(ctx, pkg, repoPath); err != nil {
+		i.eprintln("Error: Build failed")
+		return nil, nil, fmt.Errorf("%w: %v", ErrBuildFailed, err)
+	}
+
+	provenance := &state.Provenance{
+		BuildCommand: pkg.BuildCommands,
+		BuildSeconds: math.Round(time.Since(start).Seconds()*10) / 10,
+		OS:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		SHA256:       make(map[string]string),
+	}
+	if host := i.remoteBuildHost(); host != "" {
+		provenance.BuildHost = host
+	} else if i.containerBuilds() {
+		provenance.BuildImage = i.buildImage(pkg)
+	} else {
+		provenance.Sandbox, _ = i.sandboxTool()
+		provenance.NoNetwork = i.noNetworkBuild()
+	}
+	provenance.SignedBy = signer
+
+	// Find built binaries
+	binaries, err := i.findBuiltBinaries(repoPath, pkg)
+	if err != nil {
+		i.eprintf("Error: %v\n", err)
+		return nil, nil, err
+	}
+
+	i.printf("\nFound %d binary file(s):\n", len(binaries))
+	for _, binary := range binaries {
+		i.printf("  - %s at %s\n", binary.Name, binary.Path)
+	}
+
+	if binaries, err = applyAliases(binaries, pkg.BinaryAliases); err != nil {
+		i.eprintf("Error: %v\n", err)
+		return nil, nil, err
+	}
+
+	installedBinaries, err := i.installBinaries(pkg, buildPath, binaries, provenance)
+	if err != nil {
+		return nil, nil, err
+	}
+	return installedBinaries, provenance, nil
+}
+
+// installBinaries keeps a package's binaries in a new store entry, links
+// them into its bin dir and records their hashes in provenance. Packages
+// with a runtime environment get wrapper scripts instead of links, with
+// their lib_paths copied from srcDir.
+func (i *Installer) installBinaries(pkg *manifest.Package, srcDir string, binaries []Binary, provenance *state.Provenance) ([]string, error) {
+	staging, err := i.stageStoreEntry()
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+	if err := storeLibs(pkg, srcDir, staging); err != nil {
+		return nil, err
+	}
+
+	var stored []Binary
+	for _, binary := range binaries {
+		if !fsutil.FileExists(binary.Path) {
+			i.eprintf("ERROR: Source file does not exist: %s\n", binary.Path)
+			continue
+		}
+
+		if owner, _ := i.Owner(filepath.Join(i.binDir(pkg), binary.Name)); owner != nil && owner.Name != pkg.Name {
+			i.eprintf("Error: %s is already installed by %s, use --as to install it under another name\n", binary.Name, owner.Name)
+			continue
+		}
+
+		if err := i.stageBinary(binary.Path, staging, binary.Name); err != nil {
+			i.eprintf("Warning: Failed to install %s: %v\n", binary.Name, err)
+			continue
+		}
+		stored = append(stored, binary)
+	}
+	if len(stored) == 0 {
+		return nil, fmt.Errorf("no binaries were installed")
+	}
+
+	entryDir, err := i.commitStoreEntry(staging, pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	i.printf("\nInstalling binaries to %s...\n", i.binDir(pkg))
+	var installedBinaries []string
+
+	for _, binary := range stored {
+		if needsWrapper(pkg) {
+			if err := writeWrapper(pkg, entryDir, binary.Name); err != nil {
+				i.eprintf("Warning: Failed to write the wrapper of %s: %v\n", binary.Name, err)
+				continue
+			}
+		}
+
+		dst, err := linkStored(entryDir, i.binDir(pkg), binary.Name)
+		if err != nil {
+			i.eprintf("Warning: Failed to install %s: %v\n", binary.Name, err)
+			continue
+		}
+
+		sum, err := fsutil.SHA256File(filepath.Join(entryDir, binary.Name))
+		if err != nil {
+			i.eprintf("Warning: Failed to hash %s: %v\n", binary.Name, err)
+		} else {
+			provenance.SHA256[binary.Name] = sum
+		}
+
+		installedBinaries = append(installedBinaries, dst)
+		i.printf("  ✓ Installed: %s\n", dst)
+	}
+
+	if len(installedBinaries) == 0 {
+		return nil, fmt.Errorf("no binaries were installed")
+	}
+
+	return installedBinaries, nil
+}
+
+// printInstallPlan prints what installing a package would do, for dry runs
+func (i *Installer) printInstallPlan(pkg *manifest.Package) {
+	repoPath := i.RepoCachePath(pkg.RepoURL)
+	dir, local := localPath(pkg.RepoURL)
+	if local {
+		repoPath = dir
+	}
+	buildPath := buildPathFor(pkg, repoPath)
+
+	i.println("[dry-run] Planned actions:")
+	switch {
+	case local:
+		i.printf("  Would build %s as it is\n", repoPath)
+	case fsutil.FileExists(repoPath):
+		i.printf("  Would update repository: cd %s && git pull\n", repoPath)
+	default:
+		i.printf("  Would clone: git clone %s %s\n", pkg.RepoURL, repoPath)
+	}
+	if pkg.Submodules {
+		i.printf("  Would run: cd %s && git submodule update --init --recursive\n", repoPath)
+	}
+	i.printSigningPlan(pkg)
+	if strings.Contains(pkg.BuildCommands, "cargo") && i.buildsLocally() && !local {
+		i.printf("  Would run: cd %s && cargo clean\n", buildPath)
+	}
+	if host := i.remoteBuildHost(); host != "" {
+		i.printf("  Would run on %s: %s\n", host, pkg.BuildCommands)
+		i.printf("  Would copy the built binaries back from %s\n", host)
+	} else if i.containerBuilds() {
+		i.printf("  Would run in container %s: cd %s && %s\n", i.buildImage(pkg), buildPath, pkg.BuildCommands)
+	} else if sandbox, err := i.sandboxTool(); err != nil {
+		i.printf("  Can't sandbox the build: %v\n", err)
+	} else {
+		where := ""
+		if sandbox != "" {
+			where = fmt.Sprintf(" in a %s sandbox", sandbox)
+		}
+		if i.noNetworkBuild() {
+			fetches, _ := dependencyFetchesFor(buildPath)
+			for _, fetch := range fetches {
+				i.printf("  Would run%s: cd %s && %s\n", where, buildPath, fetch)
+			}
+			where += " without network"
+		}
+		i.printf("  Would run%s: cd %s && %s\n", where, buildPath, pkg.BuildCommands)
+	}
+
+	versionDir := i.storeEntryDir(pkg.Name, pkg.Version, "")
+	if len(pkg.BinaryNames) > 0 {
+		for _, name := range pkg.BinaryNames {
+			if manifest.IsBinaryPattern(name) {
+				i.printf("  Would copy: binaries matching %s -> %s\n", name, versionDir)
+				continue
+			}
+			alias := name
+			if a := pkg.BinaryAliases[name]; a != "" {
+				alias = a
+			}
+			i.printf("  Would copy: %s -> %s\n", name, filepath.Join(versionDir, alias))
+			if needsWrapper(pkg) {
+				i.printf("  Would write wrapper: %s -> %s\n", filepath.Join(i.binDir(pkg), alias), filepath.Join(versionDir, alias))
+			} else {
+				i.printf("  Would link: %s -> %s\n", filepath.Join(i.binDir(pkg), alias), filepath.Join(versionDir, alias))
+			}
+		}
+	} else {
+		i.printf("  Would copy: binaries found after build -> %s\n", versionDir)
+		if needsWrapper(pkg) {
+			i.printf("  Would write wrappers for them into %s\n", i.binDir(pkg))
+		} else {
+			i.printf("  Would link: them into %s\n", i.binDir(pkg))
+		}
+	}
+	for _, lib := range pkg.LibPaths {
+		i.printf("  Would copy: %s -> %s\n", lib, filepath.Join(versionDir, "lib", lib))
+	}
+	i.printDesktopPlan(pkg)
+	for _, src := range pkg.Services {
+		i.printf("  Would copy: %s -> %s\n", src, filepath.Join(i.Paths.SystemdUserDir, filepath.Base(src)))
+	}
+	i.printf("  Would record %s in %s\n", pkg.Name, i.Paths.InstalledPath)
+}
+
+// recordInstall records an entry in installed.json. When it replaces the
+// version an update is swapping out, what only that version installed is
+// deleted first.
+func (i *Installer) recordInstall(ctx context.Context, entry state.InstalledPackage) {
+	entry.StorePath = i.storeEntryOf(entry.BinaryPaths)
+	action := "install"
+	if old := i.State.Get(entry.Name); old != nil {
+		action, entry.FileList = "update", old.FileList
+		if entry.FileList == nil {
+			entry.FileList = fileList(old)
+		}
+	}
+	previous := entry.FileList
+	if i.replaces(entry.Name) {
+		i.retire(ctx, i.replacing, &entry)
+	}
+	i.trackFiles(action, &entry)
+	if installedData, err := i.State.Load(); err == nil {
+		i.removeLeftovers(previous, entry.FileList, ownedFiles(installedData, entry.Name))
+	}
+	if err := i.State.Add(entry); err != nil {
+		i.eprintf("Warning: Failed to update installed.json: %v\n", err)
+	}
+}
+
+// printInstallSummary prints the result of a successful install
+func (i *Installer) printInstallSummary(pkg *manifest.Package, installedBinaries []string) {
+	i.printf("\n✓ Successfully installed %s!\n", pkg.Name)
+	i.printf("  Version: %s\n", pkg.Version)
+	i.printf("  Binaries installed: %d\n", len(installedBinaries))
+	for _, binary := range installedBinaries {
+		i.printf("    - %s\n", binary)
+	}
+	i.warnIfNotOnPath(i.binDir(pkg))
+}
+
+// installGit installs a package from a git URL. Without a BuildCommand
+// option the build system is auto-detected.
+func (i *Installer) installGit(ctx context.Context, repoURL string, opts InstallOptions) error {
+	name := RepoNameFromURL(repoURL)
+	i.printf("Installing %s from %s\n", name, repoURL)
+
+	if i.State.IsInstalled(name) && !i.replaces(name) {
+		i.printf("Package '%s' is already installed. Use 'update' to update it.\n", name)
+		return nil
+	}
+
+	dir, local := localPath(repoURL)
+	buildCmd := opts.BuildCommand
+	if i.DryRun {
+		src := i.RepoCachePath(repoURL)
+		if local {
+			src = dir
+		}
+		if buildCmd == "" {
+			buildCmd = DetectBuildCommand(filepath.Join(src, opts.BuildDir))
+		}
+		if buildCmd == "" {
+			buildCmd = "<auto-detected after clone>"
+		}
+		pkg, err := i.withInstallDir(&manifest.Package{Name: name, RepoURL: repoURL, SourceDir: opts.BuildDir, BuildCommands: buildCmd}, opts.InstallDir)
+		if err != nil {
+			return err
+		}
+		i.printInstallPlan(pkg)
+		return nil
+	}
+
+	var repoPath, version string
+	var err error
+	if local {
+		// The directory is the developer's own checkout, built as it is
+		if i.remoteBuildHost() != "" {
+			i.eprintf("Error: %s can't be built on %s, it only exists here\n", dir, i.remoteBuildHost())
+			return fmt.Errorf("can't build local package %s remotely", name)
+		}
+		if opts.Commit != "" || i.pinnedRef(name) != "" {
+			i.eprintf("Error: %s is built from %s as it is, it can't be pinned or built at a commit\n", name, dir)
+			return fmt.Errorf("can't check out a commit of local package %s", name)
+		}
+		repoPath, version = dir, localVersion(ctx, dir)
+	} else if repoPath, version, err = i.checkoutGit(ctx, name, repoURL, opts); err != nil {
+		return err
+	}
+
+	if buildCmd == "" {
+		buildCmd = DetectBuildCommand(filepath.Join(repoPath, opts.BuildDir))
+	}
+	if buildCmd == "" {
+		i.eprintln("Error: Could not detect a build system (Cargo.toml, go.mod, CMakeLists.txt, meson.build, Makefile, install.sh)")
+		return fmt.Errorf("unknown build system")
+	}
+	i.printf("Detected build command: %s\n", buildCmd)
+
+	pkg, err := i.withInstallDir(opts.apply(&manifest.Package{
+		Name:          name,
+		RepoURL:       repoURL,
+		Version:       version,
+		BuildCommands: buildCmd,
+	}), opts.InstallDir)
+	if err != nil {
+		return err
+	}
+
+	installedBinaries, provenance, err := i.buildAndInstall(ctx, pkg, repoPath)
+	if err != nil {
+		return err
+	}
+
+	i.recordInstall(ctx, state.InstalledPackage{
+		Name:          name,
+		Version:       pkg.Version,
+		BinaryPaths:   installedBinaries,
+		RepoPath:      repoPath,
+		InstallDate:   getCurrentDate(),
+		TotalBinaries: len(installedBinaries),
+		Unmanaged:     true,
+		RepoURL:       repoURL,
+		BuildCommands: buildCmd,
+		BuildDir:      opts.BuildDir,
+		Commit:        getRepoCommit(repoPath),
+		Provenance:    provenance,
+		InstallDir:    pkg.InstallDir,
+		BinaryAliases: pkg.BinaryAliases,
+		Provides:      pkg.Provides,
+	})
+	i.registerProvides(name)
+	if opts.NoKeepSource || i.Config.DeleteSources {
+		i.deleteSource(name)
+	}
+
+	i.printInstallSummary(pkg, installedBinaries)
+	return nil
+}
+
+// checkoutGit clones or updates the repo of a git install and checks out
+// the commit to build, returning the repo and the version it builds
+func (i *Installer) checkoutGit(ctx context.Context, name, repoURL string, opts InstallOptions) (string, string, error) {
+	repoPath, err := i.cloneOrUpdateRepo(ctx, repoURL, nil)
+	if err != nil {
+		return "", "", err
+	}
+	version := ShortCommit(getRepoCommit(repoPath))
+	if opts.Commit != "" {
+		commit, err := i.checkoutRef(ctx, repoPath, opts.Commit)
+		if err != nil {
+			i.eprintf("Error: %v\n", err)
+			return "", "", err
+		}
+		version = ShortCommit(commit)
+		if opts.Version != "" {
+			version = opts.Version
+		}
+	} else if pin := i.pinnedRef(name); pin != "" {
+		if version, err = i.checkoutPin(ctx, repoPath, pin); err != nil {
+			i.eprintf("Error: %v\n", err)
+			return "", "", err
+		}
+	}
+	// There's no manifest to flag it, so check out whatever the repo uses
+	if hasSubmodules(repoPath) {
+		if err := i.updateSubmodules(ctx, repoPath); err != nil {
+			return "", "", err
+		}
+	}
+	return repoPath, version, nil
+}
+
+// InstallAll installs all packages from the manifest that are not
+// installed yet and can be built on this machine. A batch that was cut
+// short or had failures is resumed, installing only the packages of it
+// that are left, or with opts.RetryFailed only those that failed.
+func (i *Installer) InstallAll(ctx context.Context, opts InstallOptions) error {
+	i.println("Installing all packages from manifest...")
+
+	if err := i.requireManifest(); err != nil {
+		return err
+	}
+
+	m, err := i.LoadManifest()
+	if err != nil {
+		i.eprintf("Error: Failed to load manifest: %v\n", err)
+		return err
+	}
+
+	progress, err := i.loadBatchProgress()
+	if err != nil {
+		i.eprintf("Warning: %v, starting a new batch\n", err)
+	}
+	if progress != nil {
+		i.printf("Resuming the batch started %s: %d done, %d failed, %d left\n",
+			progress.Started, len(progress.Done), len(progress.Failed), len(progress.left()))
+	}
+	if opts.RetryFailed && (progress == nil || len(progress.Failed) == 0) {
+		i.println("No failed packages to retry.")
+		return nil
+	}
+
+	// Filter packages to install
+	var toInstall []manifest.Package
+	currentOS := GetOSName()
+
+	for _, pkg := range m.Packages {
+		if progress != nil {
+			_, failed := progress.Failed[pkg.Name]
+			if !contains(progress.Packages, pkg.Name) || (opts.RetryFailed && !failed) {
+				continue
+			}
+		}
+
+		// Skip if already installed
+		if i.State.IsInstalled(pkg.Name) {
+			i.printf("Skipping %s (already installed)\n", pkg.Name)
+			continue
+		}
+
+		// Skip if OS not supported
+		if !pkg.SupportsOS(currentOS) {
+			i.printf("Skipping %s (not supported on %s)\n", pkg.Name, currentOS)
+			continue
+		}
+
+		// Check required tools
+		if pkg.RequiredTools != "" && !i.ensureRequiredTools(ctx, pkg.RequiredTools, opts.InstallMissingTools) {
+			i.printf("Skipping %s (missing required tools: %s)\n", pkg.Name, pkg.RequiredTools)
+			continue
+		}
+
+		toInstall = append(toInstall, pkg)
+	}
+
+	if len(toInstall) == 0 {
+		i.println("No packages to install.")
+		if progress != nil && !i.DryRun {
+			os.Remove(i.batchProgressPath())
+		}
+		return nil
+	}
+
+	i.printf("\nFound %d package(s) to install:\n", len(toInstall))
+	for _, pkg := range toInstall {
+		i.printf("  - %s (%s)\n", pkg.Name, pkg.Version)
+	}
+	i.println()
+
+	if !i.confirm("Install these packages?", false) {
+		i.println("Installation aborted.")
+		return ErrAborted
+	}
+
+	if progress == nil {
+		progress = &BatchProgress{Started: time.Now().Format("2006-01-02 15:04:05"), Failed: make(map[string]string)}
+		for _, pkg := range toInstall {
+			progress.Packages = append(progress.Packages, pkg.Name)
+		}
+	}
+
+	// Install each package
+	start := time.Now()
+	var results []BatchResult
+	var errs []error
+
+	for n, pkg := range toInstall {
+		i.printf("\n[%d/%d] Installing %s...\n", n+1, len(toInstall), pkg.Name)
+		i.println(strings.Repeat("=", 60))
+
+		pkgStart := time.Now()
+		err := i.install(ctx, pkg.Name, opts)
+		i.recordHistory("install", pkg.Name, i.installedVersion(pkg.Name), err)
+		if err != nil {
+			i.eprintf("✗ Failed to install %s: %v\n", pkg.Name, err)
+			errs = append(errs, err)
+		}
+		results = append(results, i.batchResult(pkg.Name, "", pkg.Version, pkgStart, err))
+
+		if !i.DryRun {
+			progress.finish(pkg.Name, err)
+			if err := i.saveBatchProgress(progress); err != nil {
+				i.eprintf("Warning: failed to save the batch progress: %v\n", err)
+			}
+		}
+	}
+
+	i.printBatchSummary("Installation Summary", "install", start, results)
+	if !i.DryRun && len(progress.Failed) == 0 {
+		os.Remove(i.batchProgressPath())
+	}
+	if len(errs) > 0 {
+		i.println("  Run 'binrex install -a --retry-failed' to retry only the failed packages.")
+		return &batchError{"some packages failed to install", errs}
+	}
+
+	return nil
+}
@@ -0,0 +1,635 @@
+// Package installer implements the binrex package pipeline: syncing the
+// manifest, cloning and building packages, installing their binaries and
+// keeping installed.json up to date. The binrex CLI is a thin wrapper
+// around it, other tools can embed it the same way.
+package installer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nurysso/binrex/internal/fetch"
+	"github.com/nurysso/binrex/internal/fsutil"
+	"github.com/nurysso/binrex/pkg/config"
+	"github.com/nurysso/binrex/pkg/manifest"
+	"github.com/nurysso/binrex/pkg/state"
+)
+
+var (
+	// ErrManifestNotFound is returned when no manifest has been synced yet
+	ErrManifestNotFound = errors.New("manifest not found")
+	// ErrAborted is returned when the user declines a confirmation
+	ErrAborted = errors.New("aborted")
+	// ErrPackageNotFound is returned for packages missing from the manifest
+	ErrPackageNotFound = manifest.ErrNotFound
+	// ErrNotInstalled is returned for operations on packages that aren't
+	// installed
+	ErrNotInstalled = errors.New("package not installed")
+	// ErrUnsupportedOS is returned for packages not built for this OS
+	ErrUnsupportedOS = errors.New("unsupported OS")
+	// ErrMissingTools is returned when a package's required tools are
+	// missing
+	ErrMissingTools = errors.New("missing required tools")
+	// ErrBuildFailed is returned when a package's build commands fail
+	ErrBuildFailed = errors.New("build failed")
+	// ErrNetwork matches failed downloads, clones and manifest syncs
+	ErrNetwork = fetch.ErrNetwork
+)
+
+// batchError reports that some packages of a batch failed, keeping their
+// errors for errors.Is
+type batchError struct {
+	msg  string
+	errs []error
+}
+
+func (e *batchError) Error() string   { return e.msg }
+func (e *batchError) Unwrap() []error { return e.errs }
+
+// Installer installs, updates and removes packages
+type Installer struct {
+	Paths  config.Paths
+	Config *config.Config
+	State  *state.Store
+
+	// Stdout and Stderr receive progress output and build logs
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// DryRun makes mutating operations print what they would do instead
+	DryRun bool
+
+	// BuildJobs is the parallelism passed to build systems, 0 uses the
+	// config's build_jobs, then the number of CPUs
+	BuildJobs int
+
+	// ContainerBuilds runs build commands inside the package's build image,
+	// as does the config's container_builds
+	ContainerBuilds bool
+
+	// RemoteBuildHost builds on this SSH host instead, as does the config's
+	// remote_build_host
+	RemoteBuildHost string
+
+	// Sandbox runs local builds under "bwrap", "firejail" or, with
+	// "auto", whichever is installed, as does the config's sandbox
+	Sandbox string
+
+	// NoNetworkBuild fetches the dependencies of local builds first and
+	// runs the build itself without network, as does the config's
+	// no_network_builds
+	NoNetworkBuild bool
+
+	// LimitRate caps the download speed, e.g. "500k". The config's
+	// limit_rate applies when empty. Init applies it.
+	LimitRate string
+	// warnedRate is set once the user was told git can't be rate limited
+	warnedRate bool
+	// warnedCache is set once the user was told the configured compiler
+	// cache is missing
+	warnedCache bool
+	// warnedManifest is set once the user was told the manifest changed
+	// outside binrex
+	warnedManifest bool
+	// logins are the download logins Init sets up
+	logins *downloadLogins
+	// streamBuild shows build output as it runs, besides writing it to
+	// the build log, for watch-build
+	streamBuild bool
+	// ephemeral marks the installer run uses, whose bin dir isn't meant to
+	// be on PATH
+	ephemeral bool
+	// replacing is the installed entry an update swaps out once its new
+	// version is built and linked
+	replacing *state.InstalledPackage
+
+	// Confirm is asked before large or destructive steps. defaultYes is
+	// the answer the question suggests. A nil Confirm answers yes.
+	Confirm func(question string, defaultYes bool) bool
+}
+
+// New returns an Installer writing to os.Stdout/os.Stderr
+func New(paths config.Paths, cfg *config.Config) *Installer {
+	return &Installer{
+		Paths:  paths,
+		Config: cfg,
+		State:  state.NewStore(paths.InstalledPath, os.Stderr),
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+}
+
+// Init creates binrex's directories and an empty installed.json, applies
+// the download rate limit, logins and integrity key and moves a store of
+// the old layout into place
+func (i *Installer) Init() error {
+	rate, err := i.rateLimit()
+	if err != nil {
+		return err
+	}
+	fetch.SetRateLimit(rate)
+	i.logins = &downloadLogins{git: make(map[string]string)}
+	fetch.SetCredentials(i.credentials)
+	if err := i.loadIntegrityKey(); err != nil {
+		return err
+	}
+
+	if err := i.Paths.CreateDirectories(); err != nil {
+		return err
+	}
+	if err := i.State.Init(); err != nil {
+		return err
+	}
+	return i.migrateStore()
+}
+
+// rateLimit returns the download rate limit in bytes per second, 0 for
+// none
+func (i *Installer) rateLimit() (int64, error) {
+	if i.LimitRate != "" {
+		return config.ParseRate(i.LimitRate)
+	}
+	rate, err := config.ParseRate(i.Config.LimitRate)
+	if err != nil {
+		return 0, fmt.Errorf("limit_rate: %w", err)
+	}
+	return rate, nil
+}
+
+// Lock takes the binrex lock, see state.AcquireLock
+func (i *Installer) Lock() (func(), error) {
+	return state.AcquireLock(i.Paths.LockPath)
+}
+
+func (i *Installer) printf(format string, args ...any) {
+	fmt.Fprintf(i.Stdout, format, args...)
+}
+
+func (i *Installer) println(args ...any) {
+	fmt.Fprintln(i.Stdout, args...)
+}
+
+func (i *Installer) eprintf(format string, args ...any) {
+	fmt.Fprintf(i.Stderr, format, args...)
+}
+
+func (i *Installer) eprintln(args ...any) {
+	fmt.Fprintln(i.Stderr, args...)
+}
+
+// confirm asks i.Confirm, treating a nil callback as yes
+func (i *Installer) confirm(question string, defaultYes bool) bool {
+	if i.Confirm == nil || i.DryRun {
+		return true
+	}
+	return i.Confirm(question, defaultYes)
+}
+
+// recordHistory appends an operation to the history log
+func (i *Installer) recordHistory(action, pkg, version string, opErr error) {
+	if i.DryRun {
+		return
+	}
+
+	if err := state.AppendHistory(i.Paths.HistoryPath, action, pkg, version, opErr); err != nil {
+		i.eprintf("Warning: Failed to write history: %v\n", err)
+	}
+}
+
+// installedVersion returns the installed version of a package, or ""
+func (i *Installer) installedVersion(name string) string {
+	if pkg := i.State.Get(name); pkg != nil {
+		return pkg.Version
+	}
+	return ""
+}
+
+// runCommand runs a shell command and prints output
+func (i *Installer) runCommand(ctx context.Context, cmd string) error {
+	command := exec.CommandContext(ctx, "sh", "-c", cmd)
+	command.Stdout = i.Stdout
+	command.Stderr = i.Stderr
+	return command.Run()
+}
+
+// buildJobs returns the number of parallel build jobs to use
+func (i *Installer) buildJobs() int {
+	if i.BuildJobs > 0 {
+		return i.BuildJobs
+	}
+	if i.Config.BuildJobs > 0 {
+		return i.Config.BuildJobs
+	}
+	return runtime.NumCPU()
+}
+
+// compilerCache returns the compiler cache to build with: the config's
+// compiler_cache, or sccache or ccache when installed, "" for none
+func (i *Installer) compilerCache() string {
+	switch tool := i.Config.CompilerCache; tool {
+	case "none":
+		return ""
+	case "":
+		for _, tool := range []string{"sccache", "ccache"} {
+			if CheckToolExists(tool) {
+				return tool
+			}
+		}
+		return ""
+	default:
+		if !CheckToolExists(tool) {
+			if !i.warnedCache {
+				i.eprintf("Warning: compiler_cache %s is not installed, building without it\n", tool)
+				i.warnedCache = true
+			}
+			return ""
+		}
+		return tool
+	}
+}
+
+// buildEnv returns the environment for build commands: the current one
+// plus the job settings make, cargo, cmake and go understand, unless the
+// user already set them, and the compiler cache wrappers
+func (i *Installer) buildEnv() []string {
+	jobs := strconv.Itoa(i.buildJobs())
+	env := os.Environ()
+
+	defaults := []struct{ key, value string }{
+		{"MAKEFLAGS", "-j" + jobs},
+		{"CARGO_BUILD_JOBS", jobs},
+		{"CMAKE_BUILD_PARALLEL_LEVEL", jobs},
+		{"GOFLAGS", "-p=" + jobs},
+	}
+	for _, d := range defaults {
+		if _, ok := os.LookupEnv(d.key); !ok {
+			env = append(env, d.key+"="+d.value)
+		}
+	}
+
+	// A wrapper in CC is understood by make, cmake, meson and the cc
+	// crate, so the user's own compiler choice is wrapped too. rustc only
+	// goes through sccache.
+	if cache := i.compilerCache(); cache != "" {
+		for _, c := range []struct{ key, compiler string }{{"CC", "cc"}, {"CXX", "c++"}} {
+			compiler := os.Getenv(c.key)
+			if compiler == "" {
+				compiler = c.compiler
+			}
+			if !strings.HasPrefix(compiler, cache+" ") {
+				env = append(env, c.key+"="+cache+" "+compiler)
+			}
+		}
+		if _, ok := os.LookupEnv("RUSTC_WRAPPER"); !ok && cache == "sccache" {
+			env = append(env, "RUSTC_WRAPPER=sccache")
+		}
+	}
+	return append(env, "BINREX_BUILD_JOBS="+jobs)
+}
+
+// runCommandSilent runs a command silently
+func runCommandSilent(ctx context.Context, cmd string) error {
+	command := exec.CommandContext(ctx, "sh", "-c", cmd)
+	return command.Run()
+}
+
+// GetOSName returns the current OS name
+func GetOSName() string {
+	return strings.ToLower(runtime.GOOS)
+}
+
+// CheckToolExists checks if a tool is available
+func CheckToolExists(tool string) bool {
+	_, err := exec.LookPath(tool)
+	return err == nil
+}
+
+// checkRequiredTools checks if all required tools are available
+func (i *Installer) checkRequiredTools(tools string) bool {
+	return len(i.missingTools(tools)) == 0
+}
+
+// missingTools prints the availability of each required tool and returns
+// the ones that aren't installed or don't meet their version constraint
+func (i *Installer) missingTools(tools string) []string {
+	if tools == "" {
+		return nil
+	}
+
+	toolsList := strings.Split(tools, ",")
+	var missing []string
+
+	i.println("Checking required tools...")
+	for _, entry := range toolsList {
+		req := parseToolRequirement(entry)
+		if req.Name == "" {
+			continue
+		}
+
+		if !CheckToolExists(req.Name) {
+			i.printf("  ✗ %s NOT FOUND\n", req.Name)
+			missing = append(missing, req.Name)
+			continue
+		}
+		if req.Op == "" {
+			i.printf("  ✓ %s found\n", req.Name)
+			continue
+		}
+
+		version := toolVersion(req.Name)
+		switch {
+		case version == "":
+			i.printf("  ✗ %s found, but its version could not be determined (need %s%s)\n", req.Name, req.Op, req.Version)
+			missing = append(missing, req.Name)
+		case !req.satisfiedBy(version):
+			i.printf("  ✗ %s %s does not satisfy %s%s\n", req.Name, version, req.Op, req.Version)
+			missing = append(missing, req.Name)
+		default:
+			i.printf("  ✓ %s %s found\n", req.Name, version)
+		}
+	}
+
+	return missing
+}
+
+// getCurrentDate returns current date in YYYY-MM-DD format
+func getCurrentDate() string {
+	return time.Now().Format("2006-01-02")
+}
+
+// LoadManifest loads the synced manifest with the local additions in
+// manifest.d merged on top and the field overrides applied
+func (i *Installer) LoadManifest() (*manifest.Manifest, error) {
+	local, _ := filepath.Glob(filepath.Join(i.localManifestDir(), "*.json"))
+	synced := fsutil.FileExists(i.Paths.ManifestPath)
+	if !synced && len(local) == 0 {
+		return nil, ErrManifestNotFound
+	}
+
+	m := &manifest.Manifest{}
+	if synced {
+		i.checkManifestSeal()
+		var err error
+		if m, err = manifest.Load(i.Paths.ManifestPath); err != nil {
+			return nil, err
+		}
+	}
+
+	// Glob sorts, so 50-extra.json overrides 10-base.json
+	for _, path := range local {
+		part, err := manifest.Load(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		m.Merge(part)
+	}
+	if err := i.applyOverrides(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// localManifestDir holds the user's own manifest files, which add to and
+// override the synced manifest's packages
+func (i *Installer) localManifestDir() string {
+	return filepath.Join(i.Paths.ConfigDir, "manifest.d")
+}
+
+// FindPackage finds a package in the manifest by name
+func (i *Installer) FindPackage(name string) (*manifest.Package, error) {
+	m, err := i.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+	return m.Find(name)
+}
+
+// requireManifest prints the usual hint when the manifest is missing
+func (i *Installer) requireManifest() error {
+	local, _ := filepath.Glob(filepath.Join(i.localManifestDir(), "*.json"))
+	if !fsutil.FileExists(i.Paths.ManifestPath) && len(local) == 0 {
+		i.eprintf("Error: manifest.json not found at %s\n", i.Paths.ManifestPath)
+		i.eprintln("Run 'binrex sync' to download the manifest.")
+		return ErrManifestNotFound
+	}
+	return nil
+}
+
+// SyncOptions control Sync
+type SyncOptions struct {
+	// Quiet suppresses progress output, errors are still returned
+	Quiet bool
+	// Diff prints the packages added, removed and changed by the new
+	// manifest and asks before replacing the stored one
+	Diff bool
+}
+
+// Sync downloads the manifest from the configured URLs
+func (i *Installer) Sync(ctx context.Context, opts SyncOptions) error {
+	err := i.sync(ctx, opts)
+	i.recordHistory("sync", "", "", err)
+	return err
+}
+
+func (i *Installer) sync(ctx context.Context, opts SyncOptions) error {
+	if !opts.Quiet {
+		i.println("Syncing manifest...")
+	}
+
+	source := ""
+	var warnings []string
+	data, err := manifest.DownloadVerified(ctx, i.Config.GetManifestURLs(), i.Stderr, func(url string, data []byte) error {
+		source = url
+		if err := i.verifySource(ctx, url, url, data, opts.Quiet); err != nil {
+			return err
+		}
+		// A broken manifest falls back to the next mirror like a failed
+		// download
+		var err error
+		warnings, err = manifest.ValidateSchema(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", url, err)
+		}
+		return nil
+	})
+	if err != nil {
+		if !opts.Quiet {
+			i.eprintf("Error: %v\n", err)
+		}
+		return err
+	}
+
+	newManifest, err := manifest.Parse(data)
+	if err != nil {
+		i.eprintf("Error: Downloaded manifest is invalid: %v\n", err)
+		return err
+	}
+	if !opts.Quiet {
+		i.printManifestWarnings(source, warnings)
+	}
+	if len(newManifest.Include) > 0 {
+		if data, err = i.fetchIncludes(ctx, source, newManifest, opts.Quiet); err != nil {
+			if !opts.Quiet {
+				i.eprintf("Error: %v\n", err)
+			}
+			return err
+		}
+	}
+
+	if opts.Diff {
+		var oldManifest *manifest.Manifest
+		if fsutil.FileExists(i.Paths.ManifestPath) {
+			oldManifest, _ = manifest.Load(i.Paths.ManifestPath)
+		}
+
+		diff := manifest.Compare(oldManifest, newManifest)
+		i.printManifestDiff(diff)
+		if diff.Empty() || i.DryRun {
+			return nil
+		}
+		if !i.confirm("\nApply the new manifest?", true) {
+			i.println("Sync aborted.")
+			return ErrAborted
+		}
+	}
+
+	if err := fsutil.WriteFileAtomic(i.Paths.ManifestPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+	if err := state.Seal(i.Paths.ManifestPath, data, i.State.Key); err != nil {
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+	i.warnedManifest = false
+
+	if !opts.Quiet {
+		i.println("✓ Manifest synced successfully!")
+	}
+	return nil
+}
+
+// printManifestWarnings reports the problems of single packages found in
+// a manifest file
+func (i *Installer) printManifestWarnings(url string, warnings []string) {
+	if len(warnings) == 0 {
+		return
+	}
+	i.eprintf("Warning: %s has %d problem(s), the affected packages may fail to install:\n", url, len(warnings))
+	for _, warning := range warnings {
+		i.eprintf("  - %s\n", warning)
+	}
+}
+
+// fetchIncludes downloads the files an upstream manifest includes, relative
+// to the URL it came from, merges them into m and returns the merged
+// manifest to store. Each file must pass the source's signature check.
+func (i *Installer) fetchIncludes(ctx context.Context, source string, m *manifest.Manifest, quiet bool) ([]byte, error) {
+	for _, include := range m.Include {
+		url := manifest.ResolveURL(source, include)
+		data, err := fetch.Get(ctx, url)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download %s: %w", url, err)
+		}
+		if err := i.verifySource(ctx, source, url, data, quiet); err != nil {
+			return nil, err
+		}
+		partWarnings, err := manifest.ValidateSchema(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", url, err)
+		}
+		if !quiet {
+			i.printManifestWarnings(url, partWarnings)
+		}
+		part, err := manifest.Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s is invalid: %w", url, err)
+		}
+		m.Merge(part)
+	}
+	m.Include = nil
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// printManifestDiff prints what a new manifest changes
+func (i *Installer) printManifestDiff(diff *manifest.Diff) {
+	if diff.Empty() {
+		i.println("No package changes in the manifest.")
+		return
+	}
+
+	i.println("\nManifest changes:")
+	for _, pkg := range diff.Added {
+		i.printf("  + %s (%s)\n", pkg.Name, pkg.Version)
+	}
+	for _, pkg := range diff.Removed {
+		i.printf("  - %s (%s)\n", pkg.Name, pkg.Version)
+	}
+	for _, change := range diff.Changed {
+		i.printf("  ~ %s (%s → %s)\n", change.Name, change.From, change.To)
+	}
+}
+
+// Search searches the manifest
+func (i *Installer) Search(opts manifest.SearchOptions) ([]manifest.Package, error) {
+	m, err := i.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+	return m.Search(opts), nil
+}
+
+// Owner returns the installed package that owns a binary, given either its
+// name in the bin dir or a path to it, along with the resolved path
+func (i *Installer) Owner(binary string) (*state.InstalledPackage, string) {
+	target := filepath.Join(i.Paths.BinDir, binary)
+	if strings.ContainsRune(binary, filepath.Separator) {
+		if abs, err := filepath.Abs(binary); err == nil {
+			target = abs
+		}
+	}
+
+	installedData, _ := i.State.Load()
+	for n, pkg := range installedData.Installed {
+		for _, bp := range pkg.BinaryPaths {
+			if filepath.Clean(bp) == target {
+				return &installedData.Installed[n], bp
+			}
+		}
+	}
+
+	// A bare name may belong to a package with its own install_dir
+	if !strings.ContainsRune(binary, filepath.Separator) {
+		for n, pkg := range installedData.Installed {
+			for _, bp := range pkg.BinaryPaths {
+				if filepath.Base(bp) == binary {
+					return &installedData.Installed[n], bp
+				}
+			}
+		}
+	}
+
+	return nil, target
+}
+
+// WithOutput returns a copy of the installer writing its output to stdout
+// and stderr, e.g. to stream one operation to a frontend
+func (i *Installer) WithOutput(stdout, stderr io.Writer) *Installer {
+	clone := *i
+	clone.Stdout = stdout
+	clone.Stderr = stderr
+	return &clone
+}
@@ -0,0 +1,248 @@
+package installer_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nurysso/binrex/pkg/config"
+	"github.com/nurysso/binrex/pkg/installer"
+	"github.com/nurysso/binrex/pkg/manifest"
+)
+
+// fixture is a temp HOME with local bare git repositories and an HTTP
+// server handing out the manifest, so the install pipeline runs end to end
+// without touching the network or the real environment
+type fixture struct {
+	t    *testing.T
+	root string
+	inst *installer.Installer
+	out  bytes.Buffer
+
+	mu       sync.Mutex
+	packages []manifest.Package
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	for _, tool := range []string{"git", "sh", "make"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not available", tool)
+		}
+	}
+
+	f := &fixture{t: t, root: t.TempDir()}
+	home := filepath.Join(f.root, "home")
+
+	t.Setenv("HOME", home)
+	for _, env := range []string{"XDG_CONFIG_HOME", "XDG_CACHE_HOME", "XDG_DATA_HOME", "XDG_STATE_HOME"} {
+		t.Setenv(env, "")
+	}
+	t.Setenv("GIT_AUTHOR_NAME", "binrex")
+	t.Setenv("GIT_AUTHOR_EMAIL", "binrex@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "binrex")
+	t.Setenv("GIT_COMMITTER_EMAIL", "binrex@example.com")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		json.NewEncoder(w).Encode(manifest.Manifest{Packages: f.packages})
+	}))
+	t.Cleanup(server.Close)
+
+	paths, err := config.DefaultPaths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.inst = installer.New(paths, &config.Config{ManifestURLs: []string{server.URL + "/manifest.json"}})
+	f.inst.Stdout = &f.out
+	f.inst.Stderr = &f.out
+	if err := f.inst.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+// git runs git in dir
+func (f *fixture) git(dir string, args ...string) {
+	f.t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		f.t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+// addRepo creates a bare repository for a package whose Makefile builds
+// bin/<name>, a script printing output, and publishes it in the manifest
+func (f *fixture) addRepo(name, version, output string) string {
+	f.t.Helper()
+	bare := filepath.Join(f.root, "repos", name+".git")
+	work := filepath.Join(f.root, "work", name)
+
+	f.git(f.root, "init", "--quiet", "--bare", bare)
+	f.git(f.root, "clone", "--quiet", bare, work)
+	f.commit(name, output)
+
+	f.mu.Lock()
+	f.packages = append(f.packages, manifest.Package{
+		Name:          name,
+		RepoURL:       bare,
+		BinPath:       "bin",
+		BinaryNames:   []string{name},
+		Version:       version,
+		OSSupported:   "linux,mac",
+		BuildCommands: "make",
+	})
+	f.mu.Unlock()
+	return bare
+}
+
+// commit pushes a new revision of a package's source
+func (f *fixture) commit(name, output string) {
+	f.t.Helper()
+	work := filepath.Join(f.root, "work", name)
+	makefile := "all:\n\tmkdir -p bin\n\tprintf '#!/bin/sh\\necho " + output + "\\n' > bin/" + name + "\n\tchmod +x bin/" + name + "\n"
+	if err := os.WriteFile(filepath.Join(work, "Makefile"), []byte(makefile), 0644); err != nil {
+		f.t.Fatal(err)
+	}
+	f.git(work, "add", "-A")
+	f.git(work, "commit", "--quiet", "-m", output)
+	f.git(work, "push", "--quiet", "origin", "HEAD")
+}
+
+// setVersion changes a package's version in the served manifest
+func (f *fixture) setVersion(name, version string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for n := range f.packages {
+		if f.packages[n].Name == name {
+			f.packages[n].Version = version
+		}
+	}
+}
+
+// run runs an installed binary and returns its trimmed output
+func (f *fixture) run(name string) string {
+	f.t.Helper()
+	out, err := exec.Command(filepath.Join(f.inst.Paths.BinDir, name)).Output()
+	if err != nil {
+		f.t.Fatalf("running %s: %v\n%s", name, err, f.out.String())
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// must fails the test with the installer output when err is set
+func (f *fixture) must(err error) {
+	f.t.Helper()
+	if err != nil {
+		f.t.Fatalf("%v\n%s", err, f.out.String())
+	}
+}
+
+func TestInstallUpdateRemove(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	f.addRepo("hello", "1.0", "one")
+
+	f.must(f.inst.Sync(ctx, installer.SyncOptions{Quiet: true}))
+	f.must(f.inst.Install(ctx, "hello", installer.InstallOptions{}))
+
+	if got := f.run("hello"); got != "one" {
+		t.Fatalf("hello printed %q, want %q", got, "one")
+	}
+	pkg := f.inst.State.Get("hello")
+	if pkg == nil || pkg.Version != "1.0" || pkg.Commit == "" {
+		t.Fatalf("installed.json entry = %+v", pkg)
+	}
+	if pkg.Provenance == nil || pkg.Provenance.SHA256["hello"] == "" {
+		t.Fatalf("no provenance recorded: %+v", pkg.Provenance)
+	}
+
+	// Nothing changed upstream, update has nothing to rebuild
+	f.must(f.inst.Update(ctx, "hello", installer.InstallOptions{}))
+	if !strings.Contains(f.out.String(), "nothing to rebuild") {
+		t.Fatalf("update rebuilt an unchanged package:\n%s", f.out.String())
+	}
+
+	f.commit("hello", "two")
+	f.setVersion("hello", "2.0")
+	f.must(f.inst.Sync(ctx, installer.SyncOptions{Quiet: true}))
+
+	outdated, err := f.inst.Outdated()
+	f.must(err)
+	if len(outdated) != 1 || outdated[0].LatestVersion != "2.0" {
+		t.Fatalf("Outdated() = %+v", outdated)
+	}
+
+	f.must(f.inst.Update(ctx, "hello", installer.InstallOptions{}))
+	if got := f.run("hello"); got != "two" {
+		t.Fatalf("hello printed %q after update, want %q", got, "two")
+	}
+	if v := f.inst.State.Get("hello").Version; v != "2.0" {
+		t.Fatalf("installed version = %s, want 2.0", v)
+	}
+
+	f.must(f.inst.Remove(ctx, "hello"))
+	if f.inst.State.IsInstalled("hello") {
+		t.Fatal("hello still recorded after remove")
+	}
+	if _, err := os.Lstat(filepath.Join(f.inst.Paths.BinDir, "hello")); !os.IsNotExist(err) {
+		t.Fatalf("binary left behind after remove: %v", err)
+	}
+}
+
+func TestInstallGit(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	bare := f.addRepo("tool", "1.0", "unmanaged")
+
+	f.must(f.inst.InstallGit(ctx, bare, installer.InstallOptions{}))
+	if got := f.run("tool"); got != "unmanaged" {
+		t.Fatalf("tool printed %q, want %q", got, "unmanaged")
+	}
+	if pkg := f.inst.State.Get("tool"); pkg == nil || !pkg.Unmanaged || pkg.BuildCommands != "make" {
+		t.Fatalf("installed.json entry = %+v", pkg)
+	}
+}
+
+func TestInstallAlias(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	f.addRepo("hello", "1.0", "first")
+	bare := f.addRepo("other", "1.0", "second")
+
+	// other also ships a binary called other, rename it in the repo so
+	// both packages provide "hello"
+	work := filepath.Join(f.root, "work", "other")
+	makefile := "all:\n\tmkdir -p bin\n\tprintf '#!/bin/sh\\necho second\\n' > bin/hello\n\tchmod +x bin/hello\n"
+	if err := os.WriteFile(filepath.Join(work, "Makefile"), []byte(makefile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f.git(work, "commit", "--quiet", "-am", "ship hello")
+	f.git(work, "push", "--quiet", "origin", "HEAD")
+
+	f.must(f.inst.Sync(ctx, installer.SyncOptions{Quiet: true}))
+	f.must(f.inst.Install(ctx, "hello", installer.InstallOptions{}))
+
+	if err := f.inst.InstallGit(ctx, bare, installer.InstallOptions{}); err == nil {
+		t.Fatal("installing a second package owning hello succeeded")
+	}
+	f.must(f.inst.InstallGit(ctx, bare, installer.InstallOptions{Aliases: map[string]string{"": "hello2"}}))
+
+	if got := f.run("hello"); got != "first" {
+		t.Fatalf("hello printed %q, want %q", got, "first")
+	}
+	if got := f.run("hello2"); got != "second" {
+		t.Fatalf("hello2 printed %q, want %q", got, "second")
+	}
+}
@@ -0,0 +1,88 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/nurysso/binrex/pkg/state"
+)
+
+// loadIntegrityKey reads the config's integrity_key, with which
+// installed.json and the manifest are sealed by an HMAC
+func (i *Installer) loadIntegrityKey() error {
+	if i.Config.IntegrityKey == "" {
+		return nil
+	}
+	path, err := i.Config.ResolveBinDir(i.Config.IntegrityKey)
+	if err != nil {
+		return err
+	}
+	key, err := state.ReadKey(path)
+	if err != nil {
+		return err
+	}
+	i.State.Key = key
+	return nil
+}
+
+// checkManifestSeal warns once when the synced manifest changed since
+// sync wrote it
+func (i *Installer) checkManifestSeal() {
+	if i.warnedManifest {
+		return
+	}
+	data, err := os.ReadFile(i.Paths.ManifestPath)
+	if err != nil {
+		return
+	}
+	if err := state.CheckSeal(i.Paths.ManifestPath, data, i.State.Key); err != nil {
+		i.eprintf("⚠ Warning: %v\n", err)
+		i.eprintln("  Run 'binrex sync' to download it again, or check it and run 'binrex verify-state --accept' to trust it.")
+		i.warnedManifest = true
+	}
+}
+
+// VerifyState checks that installed.json and the synced manifest are what
+// binrex last wrote. With accept their current contents are sealed
+// instead, after the user checked a change made outside binrex.
+func (i *Installer) VerifyState(accept bool) error {
+	var errs []error
+	for _, path := range []string{i.Paths.InstalledPath, i.Paths.ManifestPath} {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if accept {
+			if i.DryRun {
+				i.printf("[dry-run] Would seal %s as it is\n", path)
+				continue
+			}
+			if err := state.Seal(path, data, i.State.Key); err != nil {
+				return fmt.Errorf("failed to seal %s: %w", path, err)
+			}
+			i.printf("✓ Sealed %s\n", path)
+			continue
+		}
+
+		if _, err := os.Stat(state.SealPath(path)); os.IsNotExist(err) {
+			i.printf("? %s has no checksum yet, binrex adds one the next time it writes it\n", path)
+			continue
+		}
+		if err := state.CheckSeal(path, data, i.State.Key); err != nil {
+			i.eprintf("✗ %v\n", err)
+			errs = append(errs, err)
+			continue
+		}
+		i.printf("✓ %s is unchanged\n", path)
+	}
+
+	if len(errs) > 0 {
+		i.eprintln("\nCheck the files, then run 'binrex verify-state --accept' to trust them.")
+		return &batchError{msg: "state files were modified outside binrex", errs: errs}
+	}
+	return nil
+}
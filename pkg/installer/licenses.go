@@ -0,0 +1,206 @@
+package installer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// licenseFileNames are the files checked for license text, in order
+var licenseFileNames = []string{
+	"LICENSE", "LICENSE.md", "LICENSE.txt", "LICENCE", "LICENCE.md",
+	"COPYING", "COPYING.md", "COPYING.txt",
+}
+
+// licensePatterns map recognisable license text to SPDX identifiers. More
+// specific patterns come first.
+var licensePatterns = []struct {
+	id       string
+	contains []string
+}{
+	{"AGPL-3.0", []string{"GNU AFFERO GENERAL PUBLIC LICENSE", "Version 3"}},
+	{"LGPL-3.0", []string{"GNU LESSER GENERAL PUBLIC LICENSE", "Version 3"}},
+	{"LGPL-2.1", []string{"GNU LESSER GENERAL PUBLIC LICENSE", "Version 2.1"}},
+	{"GPL-3.0", []string{"GNU GENERAL PUBLIC LICENSE", "Version 3"}},
+	{"GPL-2.0", []string{"GNU GENERAL PUBLIC LICENSE", "Version 2"}},
+	{"Apache-2.0", []string{"Apache License", "Version 2.0"}},
+	{"MPL-2.0", []string{"Mozilla Public License", "2.0"}},
+	{"MIT", []string{"Permission is hereby granted, free of charge"}},
+	{"ISC", []string{"Permission to use, copy, modify, and/or distribute this software"}},
+	{"BSD-3-Clause", []string{"Redistribution and use in source and binary forms", "Neither the name"}},
+	{"BSD-2-Clause", []string{"Redistribution and use in source and binary forms"}},
+	{"Unlicense", []string{"This is free and unencumbered software"}},
+}
+
+// LicenseInfo is the license information found for an installed package
+type LicenseInfo struct {
+	Package     string `json:"package"`
+	Version     string `json:"version"`
+	RepoURL     string `json:"repo_url"`
+	Homepage    string `json:"homepage,omitempty"`
+	Declared    string `json:"declared,omitempty"`     // From the manifest's license field
+	Detected    string `json:"detected,omitempty"`     // Recognised from the license file
+	LicenseFile string `json:"license_file,omitempty"` // License file in the cached repo
+}
+
+// License returns the best known license: the declared one, otherwise the
+// detected one, otherwise NOASSERTION
+func (l LicenseInfo) License() string {
+	if l.Declared != "" {
+		return l.Declared
+	}
+	if l.Detected != "" {
+		return l.Detected
+	}
+	return "NOASSERTION"
+}
+
+// detectLicense identifies the license text in a file
+func detectLicense(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	text := strings.Join(strings.Fields(string(data)), " ")
+
+	for _, pattern := range licensePatterns {
+		matched := true
+		for _, s := range pattern.contains {
+			if !strings.Contains(text, s) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return pattern.id
+		}
+	}
+	return ""
+}
+
+// findLicenseFile looks for a license file in each dir, first match wins
+func findLicenseFile(dirs ...string) string {
+	for _, dir := range dirs {
+		for _, name := range licenseFileNames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// Licenses collects license information for every installed package from
+// the manifest and the license files in the cached repos
+func (i *Installer) Licenses() ([]LicenseInfo, error) {
+	installedData, err := i.State.Load()
+	if err != nil {
+		return nil, err
+	}
+	m, _ := i.LoadManifest()
+
+	var infos []LicenseInfo
+	for _, pkg := range installedData.Installed {
+		info := LicenseInfo{
+			Package: pkg.Name,
+			Version: pkg.Version,
+			RepoURL: pkg.RepoURL,
+		}
+
+		sourceDir := pkg.BuildDir
+		if m != nil && !pkg.Unmanaged {
+			if mp, err := m.Find(pkg.Name); err == nil {
+				info.RepoURL = mp.RepoURL
+				info.Homepage = mp.Homepage
+				info.Declared = mp.License
+				sourceDir = mp.SourceDir
+			}
+		}
+
+		// A package in a subdirectory may carry its own license
+		dirs := []string{pkg.RepoPath}
+		if sourceDir != "" {
+			dirs = []string{filepath.Join(pkg.RepoPath, sourceDir), pkg.RepoPath}
+		}
+		if path := findLicenseFile(dirs...); path != "" {
+			info.LicenseFile = path
+			info.Detected = detectLicense(path)
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// spdxIDChars are the characters not allowed in an SPDX identifier
+var spdxIDChars = regexp.MustCompile(`[^A-Za-z0-9.-]`)
+
+// WriteSPDX writes license information as an SPDX 2.3 JSON document.
+// tool names the generator, e.g. "binrex-0.1.6".
+func WriteSPDX(w io.Writer, infos []LicenseInfo, tool string) error {
+	type spdxPackage struct {
+		Name             string `json:"name"`
+		SPDXID           string `json:"SPDXID"`
+		VersionInfo      string `json:"versionInfo,omitempty"`
+		DownloadLocation string `json:"downloadLocation"`
+		Homepage         string `json:"homepage,omitempty"`
+		FilesAnalyzed    bool   `json:"filesAnalyzed"`
+		LicenseConcluded string `json:"licenseConcluded"`
+		LicenseDeclared  string `json:"licenseDeclared"`
+	}
+
+	now := time.Now().UTC()
+	doc := struct {
+		SPDXVersion       string `json:"spdxVersion"`
+		DataLicense       string `json:"dataLicense"`
+		SPDXID            string `json:"SPDXID"`
+		Name              string `json:"name"`
+		DocumentNamespace string `json:"documentNamespace"`
+		CreationInfo      struct {
+			Created  string   `json:"created"`
+			Creators []string `json:"creators"`
+		} `json:"creationInfo"`
+		Packages []spdxPackage `json:"packages"`
+	}{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              "binrex-installed-packages",
+		DocumentNamespace: fmt.Sprintf("https://spdx.org/spdxdocs/binrex-%d", now.UnixNano()),
+		Packages:          []spdxPackage{},
+	}
+	doc.CreationInfo.Created = now.Format(time.RFC3339)
+	doc.CreationInfo.Creators = []string{"Tool: " + tool}
+
+	for _, info := range infos {
+		download := "NOASSERTION"
+		if info.RepoURL != "" {
+			download = "git+" + info.RepoURL
+		}
+		declared := info.Declared
+		if declared == "" {
+			declared = "NOASSERTION"
+		}
+
+		doc.Packages = append(doc.Packages, spdxPackage{
+			Name:             info.Package,
+			SPDXID:           "SPDXRef-Package-" + spdxIDChars.ReplaceAllString(info.Package, "-"),
+			VersionInfo:      info.Version,
+			DownloadLocation: download,
+			Homepage:         info.Homepage,
+			LicenseConcluded: info.License(),
+			LicenseDeclared:  declared,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
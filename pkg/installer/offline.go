@@ -0,0 +1,113 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/nurysso/binrex/pkg/manifest"
+)
+
+// isolateNetwork runs a command in a network namespace of its own, with
+// only a loopback device. Mapping the user to root lets it work without
+// privileges.
+var isolateNetwork = []string{"unshare", "--user", "--map-root-user", "--net"}
+
+// dependencyFetches are the commands downloading a build system's
+// dependencies ahead of the build, by the file marking the build system,
+// with the environment that makes its build use only what they fetched
+var dependencyFetches = []struct {
+	file    string
+	command string
+	env     []string
+}{
+	{"Cargo.toml", "cargo fetch", []string{"CARGO_NET_OFFLINE=true"}},
+	{"go.mod", "go mod download", []string{"GOPROXY=off"}},
+}
+
+// noNetworkBuild reports whether local builds run without network, as
+// --no-network-build or the config's no_network_builds ask
+func (i *Installer) noNetworkBuild() bool {
+	return i.NoNetworkBuild || i.Config.NoNetworkBuilds
+}
+
+// dependencyFetchesFor returns the dependency fetch commands for the build
+// systems in buildPath and the environment of the build that follows
+func dependencyFetchesFor(buildPath string) ([]string, []string) {
+	var commands, env []string
+	for _, fetch := range dependencyFetches {
+		if _, err := os.Stat(filepath.Join(buildPath, fetch.file)); err == nil {
+			commands = append(commands, fetch.command)
+			env = append(env, fetch.env...)
+		}
+	}
+	return commands, env
+}
+
+// checkNetworkIsolation makes sure builds can be cut off from the network
+// here, which needs unshare and unprivileged user namespaces
+func checkNetworkIsolation(ctx context.Context) error {
+	if !CheckToolExists("unshare") {
+		return fmt.Errorf("builds without network need unshare (util-linux)")
+	}
+	args := append(append([]string{}, isolateNetwork...), "true")
+	if out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("can't build without network, unshare failed: %v %s", err, out)
+	}
+	return nil
+}
+
+// runLocalBuild runs a package's build commands on this machine, under a
+// sandbox tool when there is one. For builds without network the
+// dependencies are fetched first, then the build runs with no network, so
+// a build downloading anything else fails instead of running unreviewed
+// code.
+func (i *Installer) runLocalBuild(ctx context.Context, sandbox string, pkg *manifest.Package, repoPath string, out io.Writer) error {
+	buildPath := buildPathFor(pkg, repoPath)
+	if sandbox != "" {
+		if err := os.MkdirAll(i.sandboxCacheDir(), 0755); err != nil {
+			return fmt.Errorf("error creating %s: %w", i.sandboxCacheDir(), err)
+		}
+		i.printf("Building in a %s sandbox...\n", sandbox)
+	}
+	if !i.noNetworkBuild() {
+		return i.runLocalCommand(ctx, sandbox, repoPath, buildPath, pkg.BuildCommands, true, nil, out)
+	}
+
+	fetches, env := dependencyFetchesFor(buildPath)
+	for _, fetch := range fetches {
+		i.printf("Fetching dependencies: %s\n", fetch)
+		if err := i.runLocalCommand(ctx, sandbox, repoPath, buildPath, fetch, true, nil, out); err != nil {
+			return fmt.Errorf("%s failed: %w", fetch, err)
+		}
+	}
+	i.println("Building without network...")
+	return i.runLocalCommand(ctx, sandbox, repoPath, buildPath, pkg.BuildCommands, false, env, out)
+}
+
+// runLocalCommand runs a command in buildPath with the build environment
+// plus env, under the sandbox tool when there is one and in a network
+// namespace of its own unless network is set
+func (i *Installer) runLocalCommand(ctx context.Context, sandbox, repoPath, buildPath, cmd string, network bool, env []string, out io.Writer) error {
+	args := []string{"sh", "-c", cmd}
+	environ := i.buildEnv()
+	if sandbox != "" {
+		var err error
+		if args, err = i.sandboxArgs(sandbox, repoPath, buildPath, cmd, network); err != nil {
+			return err
+		}
+		environ = i.sandboxEnv()
+	} else if !network {
+		args = append(append([]string{}, isolateNetwork...), args...)
+	}
+
+	command := exec.CommandContext(ctx, args[0], args[1:]...)
+	command.Dir = buildPath
+	command.Env = append(environ, env...)
+	command.Stdout = out
+	command.Stderr = out
+	return command.Run()
+}
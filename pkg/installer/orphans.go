@@ -0,0 +1,105 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Orphan is an executable in the bin dir that no installed package owns
+type Orphan struct {
+	Path string `json:"path"`
+	// Target is where a symlink points, Broken when that is gone, as
+	// happens to links into the store of a package removed by hand
+	Target string `json:"target,omitempty"`
+	Broken bool   `json:"broken,omitempty"`
+}
+
+// Orphans lists the executables and symlinks in the bin dir that are not
+// owned by any installed package, leaving out binrex itself
+func (i *Installer) Orphans() ([]Orphan, error) {
+	entries, err := os.ReadDir(i.Paths.BinDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	self, _ := os.Executable()
+	self, _ = filepath.EvalSymlinks(self)
+
+	owned := make(map[string]bool)
+	installedData, err := i.State.Load()
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range installedData.Installed {
+		for _, bp := range pkg.BinaryPaths {
+			owned[filepath.Clean(bp)] = true
+		}
+	}
+
+	var orphans []Orphan
+	for _, entry := range entries {
+		path := filepath.Join(i.Paths.BinDir, entry.Name())
+		if owned[path] || entry.IsDir() {
+			continue
+		}
+
+		orphan := Orphan{Path: path}
+		if entry.Type()&os.ModeSymlink != 0 {
+			orphan.Target, _ = os.Readlink(path)
+		}
+		info, err := os.Stat(path)
+		switch {
+		case err != nil:
+			if orphan.Target == "" {
+				continue
+			}
+			orphan.Broken = true
+		case info.IsDir() || info.Mode().Perm()&0111 == 0:
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(path); err == nil && resolved == self {
+			continue
+		}
+		orphans = append(orphans, orphan)
+	}
+
+	sort.Slice(orphans, func(a, b int) bool { return orphans[a].Path < orphans[b].Path })
+	return orphans, nil
+}
+
+// CleanOrphans deletes orphaned bin dir entries after confirmation
+func (i *Installer) CleanOrphans(orphans []Orphan) error {
+	if len(orphans) == 0 {
+		return nil
+	}
+	if i.DryRun {
+		i.println("[dry-run] Planned actions:")
+		for _, orphan := range orphans {
+			i.printf("  Would delete: %s\n", orphan.Path)
+		}
+		return nil
+	}
+	if !i.confirm(fmt.Sprintf("\nDelete %d orphaned file(s)?", len(orphans)), false) {
+		i.println("Clean aborted.")
+		return ErrAborted
+	}
+
+	var failed int
+	for _, orphan := range orphans {
+		if err := os.Remove(orphan.Path); err != nil {
+			i.eprintf("✗ Failed to delete %s: %v\n", orphan.Path, err)
+			failed++
+			continue
+		}
+		i.printf("  ✓ Deleted: %s\n", orphan.Path)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d orphaned file(s)", failed)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package installer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+	"github.com/nurysso/binrex/pkg/manifest"
+)
+
+// Overrides are local replacements for manifest fields, package name ->
+// field -> JSON value. They survive syncs, so a broken build command can
+// be fixed without waiting for upstream.
+type Overrides map[string]map[string]json.RawMessage
+
+// overridesPath is where SetOverride keeps the overrides
+func (i *Installer) overridesPath() string {
+	return filepath.Join(i.Paths.ConfigDir, "overrides.json")
+}
+
+// LoadOverrides reads the local field overrides
+func (i *Installer) LoadOverrides() (Overrides, error) {
+	overrides := make(Overrides)
+	data, err := os.ReadFile(i.overridesPath())
+	if os.IsNotExist(err) {
+		return overrides, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("%s: %w", i.overridesPath(), err)
+	}
+	for _, fields := range overrides {
+		for field, value := range fields {
+			fields[field] = compactJSON(value)
+		}
+	}
+	return overrides, nil
+}
+
+// saveOverrides writes the overrides, deleting the file once none are left
+func (i *Installer) saveOverrides(overrides Overrides) error {
+	if len(overrides) == 0 {
+		if err := os.Remove(i.overridesPath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(overrides, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(i.Paths.ConfigDir, 0755); err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(i.overridesPath(), append(data, '\n'), 0644)
+}
+
+// compactJSON drops the indentation saveOverrides adds to a value
+func compactJSON(value json.RawMessage) json.RawMessage {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, value); err != nil {
+		return value
+	}
+	return compact.Bytes()
+}
+
+// applyOverride sets one field of pkg from its JSON value
+func applyOverride(pkg *manifest.Package, field string, value json.RawMessage) error {
+	fields, err := packageFields(pkg)
+	if err != nil {
+		return err
+	}
+	if _, ok := fields[field]; !ok {
+		return fmt.Errorf("unknown manifest field %q", field)
+	}
+	fields[field] = value
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	var updated manifest.Package
+	if err := json.Unmarshal(data, &updated); err != nil {
+		return fmt.Errorf("invalid value for %s: %w", field, err)
+	}
+	if updated.Name != pkg.Name {
+		return fmt.Errorf("the name of a package can't be overridden")
+	}
+	*pkg = updated
+	return nil
+}
+
+// packageFields returns a package as its manifest JSON fields
+func packageFields(pkg *manifest.Package) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(pkg)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
+
+// applyOverrides applies the local overrides to the manifest's packages.
+// An override that no longer fits the manifest is reported and skipped.
+func (i *Installer) applyOverrides(m *manifest.Manifest) error {
+	overrides, err := i.LoadOverrides()
+	if err != nil {
+		return err
+	}
+
+	for n := range m.Packages {
+		pkg := &m.Packages[n]
+		for _, field := range sortedFields(overrides[pkg.Name]) {
+			if err := applyOverride(pkg, field, overrides[pkg.Name][field]); err != nil {
+				i.eprintf("Warning: override of %s: %v\n", pkg.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// sortedFields returns the overridden field names in order
+func sortedFields(fields map[string]json.RawMessage) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetOverride overrides a manifest field of a package. The value is taken
+// as JSON when the field accepts it, such as a list or true, and as a
+// string otherwise.
+func (i *Installer) SetOverride(name, field, value string) error {
+	pkg, err := i.FindPackage(name)
+	if err != nil {
+		return err
+	}
+
+	raw := json.RawMessage(value)
+	if !json.Valid(raw) || applyOverride(pkg, field, raw) != nil {
+		raw, _ = json.Marshal(value)
+		if err := applyOverride(pkg, field, raw); err != nil {
+			return err
+		}
+	}
+
+	raw = compactJSON(raw)
+
+	overrides, err := i.LoadOverrides()
+	if err != nil {
+		return err
+	}
+	if overrides[name] == nil {
+		overrides[name] = make(map[string]json.RawMessage)
+	}
+	overrides[name][field] = raw
+
+	if i.DryRun {
+		i.printf("  Would set %s %s to %s\n", name, field, raw)
+		return nil
+	}
+	return i.saveOverrides(overrides)
+}
+
+// UnsetOverride drops an override of a package, or all of them when field
+// is empty, going back to the manifest's values
+func (i *Installer) UnsetOverride(name, field string) error {
+	overrides, err := i.LoadOverrides()
+	if err != nil {
+		return err
+	}
+	if _, ok := overrides[name]; !ok {
+		return fmt.Errorf("%s has no overrides", name)
+	}
+
+	if field == "" {
+		delete(overrides, name)
+	} else {
+		if _, ok := overrides[name][field]; !ok {
+			return fmt.Errorf("%s has no override of %s", name, field)
+		}
+		delete(overrides[name], field)
+		if len(overrides[name]) == 0 {
+			delete(overrides, name)
+		}
+	}
+
+	if i.DryRun {
+		i.printf("  Would remove the override of %s %s\n", name, field)
+		return nil
+	}
+	return i.saveOverrides(overrides)
+}
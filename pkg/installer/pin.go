@@ -0,0 +1,135 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+)
+
+// Pins returns the pinned refs by package name
+func (i *Installer) Pins() (map[string]string, error) {
+	data, err := i.State.Load()
+	if err != nil {
+		return nil, err
+	}
+	return data.Pins, nil
+}
+
+// pinnedRef returns the ref a package is pinned to, or ""
+func (i *Installer) pinnedRef(name string) string {
+	data, _ := i.State.Load()
+	return data.Pins[name]
+}
+
+// Pin freezes a package at a commit or tag: installs and updates build
+// exactly that ref until it is unpinned. The ref is checked against the
+// cached repository when there is one.
+func (i *Installer) Pin(ctx context.Context, name, ref string) error {
+	repoURL := ""
+	if installed := i.State.Get(name); installed != nil && installed.Unmanaged {
+		repoURL = installed.RepoURL
+		if dir, local := localPath(repoURL); local {
+			return fmt.Errorf("%s is built from %s as it is, there is nothing to pin", name, dir)
+		}
+	} else {
+		pkg, err := i.FindPackage(name)
+		if err != nil {
+			return err
+		}
+		if pkg.URL != "" {
+			return fmt.Errorf("%s is downloaded from a URL, there is no source to pin", name)
+		}
+		repoURL = pkg.RepoURL
+	}
+
+	if repoPath := i.RepoCachePath(repoURL); fsutil.FileExists(repoPath) {
+		if _, err := resolveRef(ctx, repoPath, ref); err != nil {
+			return err
+		}
+	}
+
+	if i.DryRun {
+		i.printf("  Would pin %s to %s in %s\n", name, ref, i.Paths.InstalledPath)
+		return nil
+	}
+	data, err := i.State.Load()
+	if err != nil {
+		return err
+	}
+	if data.Pins == nil {
+		data.Pins = make(map[string]string)
+	}
+	data.Pins[name] = ref
+	return i.State.Save(data)
+}
+
+// Unpin lets a package follow the manifest again
+func (i *Installer) Unpin(name string) error {
+	data, err := i.State.Load()
+	if err != nil {
+		return err
+	}
+	if _, ok := data.Pins[name]; !ok {
+		return fmt.Errorf("%s is not pinned", name)
+	}
+	if i.DryRun {
+		i.printf("  Would unpin %s in %s\n", name, i.Paths.InstalledPath)
+		return nil
+	}
+	delete(data.Pins, name)
+	return i.State.Save(data)
+}
+
+// resolveRef fetches a cached repository and returns the commit a ref
+// points at. Branch names resolve to the remote branch, so a pinned branch
+// builds what upstream has rather than a stale local copy.
+func resolveRef(ctx context.Context, repoPath, ref string) (string, error) {
+	exec.CommandContext(ctx, "git", "-C", repoPath, "fetch", "--quiet", "--tags").Run()
+
+	for _, candidate := range []string{"origin/" + ref, ref} {
+		out, err := exec.CommandContext(ctx, "git", "-C", repoPath, "rev-parse", "--verify", "--quiet", candidate+"^{commit}").Output()
+		if err == nil {
+			return strings.TrimSpace(string(out)), nil
+		}
+	}
+	return "", fmt.Errorf("no commit or tag %s in %s", ref, repoPath)
+}
+
+// refVersion returns the version a pinned build is recorded as: the tag's
+// version for tags, the short commit otherwise
+func refVersion(ctx context.Context, repoPath, ref, commit string) string {
+	if exec.CommandContext(ctx, "git", "-C", repoPath, "rev-parse", "--verify", "--quiet", "refs/tags/"+ref).Run() == nil {
+		return tagVersion(ref)
+	}
+	return ShortCommit(commit)
+}
+
+// checkoutRef checks out the commit a ref resolves to and returns it
+func (i *Installer) checkoutRef(ctx context.Context, repoPath, ref string) (string, error) {
+	commit, err := resolveRef(ctx, repoPath, ref)
+	if err != nil {
+		return "", err
+	}
+
+	if ref == commit {
+		ref = ShortCommit(commit)
+	}
+	i.printf("Checking out %s...\n", ref)
+	if err := runCommandSilent(ctx, fmt.Sprintf("cd %s && git checkout --quiet %s", repoPath, commit)); err != nil {
+		return "", fmt.Errorf("failed to check out %s: %w", ref, err)
+	}
+	return commit, nil
+}
+
+// checkoutPin checks out the ref a package is pinned to and returns the
+// version to record
+func (i *Installer) checkoutPin(ctx context.Context, repoPath, ref string) (string, error) {
+	commit, err := i.checkoutRef(ctx, repoPath, ref)
+	if err != nil {
+		return "", err
+	}
+	return refVersion(ctx, repoPath, ref, commit), nil
+}
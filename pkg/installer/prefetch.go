@@ -0,0 +1,158 @@
+package installer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nurysso/binrex/pkg/manifest"
+)
+
+// FetchResult is the outcome of fetching one repository for Fetch
+type FetchResult struct {
+	// Packages are the packages built from the repository
+	Packages []string
+	RepoPath string
+	Commit   string
+	Err      error
+}
+
+// fetchJob is a repository Fetch clones or updates, with the packages
+// that need it
+type fetchJob struct {
+	packages   []string
+	repoURL    string
+	mirrors    []string
+	submodules bool
+}
+
+// Fetch clones or updates the source repositories of packages without
+// building them, jobs at a time, so later installs and updates find them
+// cached. No names fetches every package the manifest has for this OS.
+// Packages sharing a repository fetch it once, packages without one are
+// skipped.
+func (i *Installer) Fetch(ctx context.Context, names []string, jobs int) ([]FetchResult, error) {
+	if err := i.requireManifest(); err != nil {
+		return nil, err
+	}
+	m, err := i.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []manifest.Package
+	if len(names) == 0 {
+		for _, pkg := range m.Packages {
+			if pkg.SupportsOS(GetOSName()) {
+				packages = append(packages, pkg)
+			}
+		}
+	} else {
+		for _, name := range names {
+			pkg, err := m.Find(name)
+			if err != nil {
+				return nil, err
+			}
+			packages = append(packages, *pkg)
+		}
+	}
+
+	var queue []*fetchJob
+	byPath := make(map[string]*fetchJob)
+	for _, pkg := range packages {
+		if pkg.RepoURL == "" {
+			if len(names) > 0 {
+				i.printf("Skipping %s (downloaded from its url, no repo)\n", pkg.Name)
+			}
+			continue
+		}
+		path := i.RepoCachePath(pkg.RepoURL)
+		job := byPath[path]
+		if job == nil {
+			job = &fetchJob{repoURL: pkg.RepoURL, mirrors: pkg.Mirrors}
+			byPath[path] = job
+			queue = append(queue, job)
+		}
+		job.packages = append(job.packages, pkg.Name)
+		job.submodules = job.submodules || pkg.Submodules
+	}
+
+	if i.DryRun {
+		i.println("[dry-run] Planned actions:")
+		for _, job := range queue {
+			i.printf("  Would fetch %s into %s (%s)\n", job.repoURL, i.RepoCachePath(job.repoURL), strings.Join(job.packages, ", "))
+		}
+		return nil, nil
+	}
+	if len(queue) == 0 {
+		i.println("No repositories to fetch.")
+		return nil, nil
+	}
+
+	// Warn about git rate limiting once, not from every job
+	i.gitCommand()
+	jobs = max(min(jobs, len(queue)), 1)
+	i.printf("Fetching %d repositories (%d at a time)...\n", len(queue), jobs)
+
+	results := make([]FetchResult, len(queue))
+	var printMu sync.Mutex
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range next {
+				results[n] = i.fetchRepo(ctx, queue[n], &printMu)
+			}
+		}()
+	}
+	for n := range queue {
+		next <- n
+	}
+	close(next)
+	wg.Wait()
+
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+	}
+	if len(errs) > 0 {
+		return results, &batchError{msg: fmt.Sprintf("%d of %d repositories failed to fetch", len(errs), len(results)), errs: errs}
+	}
+	return results, nil
+}
+
+// fetchRepo clones or updates one repository with its output kept in a
+// buffer, printed under printMu only when it fails
+func (i *Installer) fetchRepo(ctx context.Context, job *fetchJob, printMu *sync.Mutex) FetchResult {
+	var out bytes.Buffer
+	quiet := i.WithOutput(&out, &out)
+
+	result := FetchResult{Packages: job.packages}
+	result.RepoPath, result.Err = quiet.cloneOrUpdateRepo(ctx, job.repoURL, job.mirrors)
+	if result.Err == nil && job.submodules {
+		result.Err = quiet.updateSubmodules(ctx, result.RepoPath)
+	}
+	if result.Err == nil {
+		result.Commit = getRepoCommit(result.RepoPath)
+	}
+
+	printMu.Lock()
+	defer printMu.Unlock()
+	name := strings.Join(job.packages, ", ")
+	if result.Err != nil {
+		result.Err = fmt.Errorf("%s: %w", name, result.Err)
+		i.eprintf("✗ %s\n", name)
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			i.eprintf("    %s\n", line)
+		}
+		return result
+	}
+	i.printf("✓ %s at %s\n", name, ShortCommit(result.Commit))
+	return result
+}
@@ -0,0 +1,158 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+)
+
+// buildArtifactDirs are directory names treated as rebuildable output
+var buildArtifactDirs = []string{"target", "build"}
+
+// PruneResult describes what Prune removed
+type PruneResult struct {
+	Removed   []string
+	Reclaimed int64
+}
+
+// dirSize returns the total size of the files under path
+func dirSize(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && !d.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// isTracked reports whether git tracks anything under rel in repoPath, so
+// checked-in directories named build/ aren't mistaken for artifacts
+func isTracked(ctx context.Context, repoPath, rel string) bool {
+	out, err := exec.CommandContext(ctx, "git", "-C", repoPath, "ls-files", "--", rel).Output()
+	return err != nil || len(strings.TrimSpace(string(out))) > 0
+}
+
+// findBuildArtifacts returns untracked build output directories in a repo
+func findBuildArtifacts(ctx context.Context, repoPath string) []string {
+	var found []string
+	filepath.WalkDir(repoPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if path != repoPath && contains(buildArtifactDirs, d.Name()) {
+			rel, _ := filepath.Rel(repoPath, path)
+			if !isTracked(ctx, repoPath, rel) {
+				found = append(found, path)
+			}
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return found
+}
+
+// Prune deletes cached repos of packages that are no longer installed and
+// build artifacts left in the remaining ones
+func (i *Installer) Prune(ctx context.Context) (*PruneResult, error) {
+	installedData, err := i.State.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	inUse := make(map[string]bool)
+	for _, pkg := range installedData.Installed {
+		inUse[filepath.Clean(pkg.RepoPath)] = true
+	}
+
+	entries, err := os.ReadDir(i.Paths.CacheDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", i.Paths.CacheDir, err)
+	}
+
+	var targets []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		repoPath := filepath.Join(i.Paths.CacheDir, entry.Name())
+		if inUse[repoPath] {
+			targets = append(targets, findBuildArtifacts(ctx, repoPath)...)
+		} else {
+			targets = append(targets, repoPath)
+		}
+	}
+
+	result := &PruneResult{}
+	if i.DryRun && len(targets) > 0 {
+		i.println("[dry-run] Planned actions:")
+	}
+	for _, path := range targets {
+		size := dirSize(path)
+		if i.DryRun {
+			i.printf("  Would delete: %s (%s)\n", path, fsutil.FormatBytes(size))
+		} else {
+			if err := os.RemoveAll(path); err != nil {
+				i.eprintf("Error removing %s: %v\n", path, err)
+				continue
+			}
+			i.printf("  ✓ Removed: %s (%s)\n", path, fsutil.FormatBytes(size))
+		}
+		result.Removed = append(result.Removed, path)
+		result.Reclaimed += size
+	}
+
+	if !i.DryRun {
+		i.markPruned()
+	}
+	return result, nil
+}
+
+// lastPrunePath is where the time of the last prune is kept
+func (i *Installer) lastPrunePath() string {
+	return filepath.Join(filepath.Dir(i.Paths.InstalledPath), "last-prune")
+}
+
+// markPruned records that a prune just ran
+func (i *Installer) markPruned() {
+	stamp := strconv.FormatInt(time.Now().Unix(), 10)
+	if err := fsutil.WriteFileAtomic(i.lastPrunePath(), []byte(stamp+"\n"), 0644); err != nil {
+		i.eprintf("Warning: Failed to record prune time: %v\n", err)
+	}
+}
+
+// PruneDue reports whether the configured auto_prune_days have passed
+// since the last prune
+func (i *Installer) PruneDue() bool {
+	if i.Config.AutoPruneDays <= 0 {
+		return false
+	}
+
+	data, err := os.ReadFile(i.lastPrunePath())
+	if err != nil {
+		// Never pruned, start counting from now
+		i.markPruned()
+		return false
+	}
+	last, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return true
+	}
+
+	return time.Since(time.Unix(last, 0)) > time.Duration(i.Config.AutoPruneDays)*24*time.Hour
+}
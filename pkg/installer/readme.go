@@ -0,0 +1,50 @@
+package installer
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+)
+
+// readmeNames are the README files looked for, in order
+var readmeNames = []string{"README.md", "README", "README.txt", "README.rst", "readme.md", "Readme.md"}
+
+// ReadmePath returns the README of a package from its cached repo,
+// preferring one in the package's source dir over the repo root
+func (i *Installer) ReadmePath(name string) (string, error) {
+	var repoPath, sourceDir string
+
+	if installed := i.State.Get(name); installed != nil {
+		repoPath = installed.RepoPath
+		if pkg, err := i.buildSpec(installed); err == nil {
+			sourceDir = pkg.SourceDir
+		}
+	} else {
+		pkg, err := i.FindPackage(name)
+		if err != nil {
+			return "", fmt.Errorf("package '%s' is not installed or in the manifest", name)
+		}
+		repoPath = i.RepoCachePath(pkg.RepoURL)
+		sourceDir = pkg.SourceDir
+	}
+
+	if !fsutil.FileExists(repoPath) {
+		return "", fmt.Errorf("%s has no cached repo, install it first", name)
+	}
+
+	dirs := []string{repoPath}
+	if sourceDir != "" {
+		dirs = []string{filepath.Join(repoPath, sourceDir), repoPath}
+	}
+	for _, dir := range dirs {
+		for _, readme := range readmeNames {
+			path := filepath.Join(dir, readme)
+			if fsutil.FileExists(path) {
+				return path, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no README found for %s", name)
+}
@@ -0,0 +1,476 @@
+package installer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/nurysso/binrex/internal/fetch"
+	"github.com/nurysso/binrex/internal/fsutil"
+	"github.com/nurysso/binrex/pkg/manifest"
+	"github.com/nurysso/binrex/pkg/state"
+)
+
+// releaseOS and releaseArch are the spellings release assets commonly use
+// for each GOOS and GOARCH, tried in order for {os} and {arch}
+var releaseOS = map[string][]string{
+	"linux":   {"linux", "unknown-linux-gnu", "unknown-linux-musl"},
+	"darwin":  {"darwin", "macos", "apple-darwin", "osx", "mac"},
+	"windows": {"windows", "pc-windows-msvc", "win64", "win"},
+	"freebsd": {"freebsd", "unknown-freebsd"},
+}
+
+var releaseArch = map[string][]string{
+	"amd64": {"amd64", "x86_64", "x64", "64bit"},
+	"arm64": {"arm64", "aarch64"},
+	"386":   {"386", "i386", "i686", "x86", "32bit"},
+	"arm":   {"arm", "armv7", "armhf"},
+}
+
+// githubRelease is the part of the GitHub releases API response binrex uses
+type githubRelease struct {
+	TagName string         `json:"tag_name"`
+	Assets  []releaseAsset `json:"assets"`
+}
+
+type releaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// artifact is a prebuilt download and what it can be verified against
+type artifact struct {
+	URL string
+	// SHA256 is the hash the manifest expects
+	SHA256 string
+	// SumsURL is a SHA256SUMS style file listing the download, SigURL
+	// an optional detached GPG signature of it
+	SumsURL string
+	SigURL  string
+}
+
+// expandRelease fills in the {name}, {version} and {tag} placeholders of a
+// release_tag or release_asset pattern
+func expandRelease(pattern string, pkg *manifest.Package, tag string) string {
+	return strings.NewReplacer("{name}", pkg.Name, "{version}", pkg.Version, "{tag}", tag).Replace(pattern)
+}
+
+// assetNames expands a release_asset pattern into the asset names it may
+// stand for on this host, one per spelling of {os} and {arch}
+func assetNames(pattern string) []string {
+	oses := releaseOS[runtime.GOOS]
+	if len(oses) == 0 {
+		oses = []string{runtime.GOOS}
+	}
+	arches := releaseArch[runtime.GOARCH]
+	if len(arches) == 0 {
+		arches = []string{runtime.GOARCH}
+	}
+
+	var names []string
+	for _, osName := range oses {
+		for _, arch := range arches {
+			name := strings.NewReplacer("{os}", osName, "{arch}", arch).Replace(pattern)
+			if !contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// githubRepo returns the owner/repo of a GitHub repository URL
+func githubRepo(repoURL string) (string, bool) {
+	path := strings.TrimSuffix(strings.TrimSuffix(repoURL, "/"), ".git")
+	for _, prefix := range []string{"https://github.com/", "http://github.com/", "git@github.com:", "ssh://git@github.com/"} {
+		if rest, ok := strings.CutPrefix(path, prefix); ok && strings.Count(rest, "/") == 1 {
+			return rest, true
+		}
+	}
+	return "", false
+}
+
+// findReleaseAsset looks up the release of a package's version and picks
+// the asset matching its release_asset pattern for this OS and arch
+func (i *Installer) findReleaseAsset(ctx context.Context, pkg *manifest.Package) (*releaseAsset, *githubRelease, error) {
+	repo, ok := githubRepo(pkg.RepoURL)
+	if !ok {
+		return nil, nil, fmt.Errorf("release assets are only supported for GitHub repositories")
+	}
+
+	tagPattern := pkg.ReleaseTag
+	if tagPattern == "" {
+		tagPattern = "v{version}"
+	}
+	tag := expandRelease(tagPattern, pkg, "")
+
+	data, err := fetch.Get(ctx, fmt.Sprintf("%s/repos/%s/releases/tags/%s", i.Config.GetGitHubAPIURL(), repo, tag))
+	if err != nil {
+		return nil, nil, err
+	}
+	release := &githubRelease{TagName: tag}
+	if err := json.Unmarshal(data, release); err != nil {
+		return nil, nil, fmt.Errorf("invalid release data for %s: %w", tag, err)
+	}
+
+	for _, name := range assetNames(expandRelease(pkg.ReleaseAsset, pkg, tag)) {
+		for n, asset := range release.Assets {
+			if strings.EqualFold(asset.Name, name) {
+				return &release.Assets[n], release, nil
+			}
+		}
+	}
+	return nil, nil, fmt.Errorf("no asset of release %s matches %s for %s/%s", tag, pkg.ReleaseAsset, runtime.GOOS, runtime.GOARCH)
+}
+
+// installRelease installs a package from the matching asset of its GitHub
+// release instead of building it
+func (i *Installer) installRelease(ctx context.Context, pkg *manifest.Package) error {
+	asset, release, err := i.findReleaseAsset(ctx, pkg)
+	if err != nil {
+		return err
+	}
+
+	i.printf("\nUsing %s from release %s\n", asset.Name, release.TagName)
+	sumsURL, sigURL := releaseChecksums(pkg, release, asset.Name)
+	return i.installArtifact(ctx, pkg, artifact{URL: asset.URL, SumsURL: sumsURL, SigURL: sigURL})
+}
+
+// installURL installs a package whose manifest entry is a direct url to
+// an archive or a binary
+func (i *Installer) installURL(ctx context.Context, pkg *manifest.Package) error {
+	expand := func(pattern string) string {
+		if pattern == "" {
+			return ""
+		}
+		return strings.NewReplacer("{os}", runtime.GOOS, "{arch}", runtime.GOARCH).Replace(expandRelease(pattern, pkg, ""))
+	}
+	return i.installArtifact(ctx, pkg, artifact{
+		URL:     expand(pkg.URL),
+		SHA256:  pkg.SHA256,
+		SumsURL: expand(pkg.Checksums),
+		SigURL:  expand(pkg.ChecksumsSig),
+	})
+}
+
+// downloadMirrored downloads url to dest, falling back to the source_mirrors
+// of its prefix when the host is unreachable or rate limits the download
+func (i *Installer) downloadMirrored(ctx context.Context, url, dest string) error {
+	var err error
+	for n, mirror := range i.Config.GetRepoURLs(url, nil) {
+		if n > 0 {
+			i.eprintf("Warning: %v\n", err)
+			i.printf("Trying mirror %s...\n", mirror)
+			// A partial download from another host may not be the same file
+			os.Remove(dest + ".part")
+		}
+		if err = fetch.DownloadFile(ctx, mirror, dest, i.Stdout); !failsOver(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// getMirrored fetches url like fetch.Get, falling back to the
+// source_mirrors of its prefix like downloadMirrored
+func (i *Installer) getMirrored(ctx context.Context, url string) ([]byte, error) {
+	var data []byte
+	var err error
+	for n, mirror := range i.Config.GetRepoURLs(url, nil) {
+		if n > 0 {
+			i.eprintf("Warning: %v\n", err)
+			i.printf("Trying mirror %s...\n", mirror)
+		}
+		if data, err = fetch.Get(ctx, mirror); !failsOver(err) {
+			return data, err
+		}
+	}
+	return data, err
+}
+
+// failsOver reports whether a download failed in a way a mirror may not:
+// the host was unreachable, failed or rate limited it
+func failsOver(err error) bool {
+	return errors.Is(err, fetch.ErrTransient) || errors.Is(err, fetch.ErrRateLimited)
+}
+
+// installArtifact downloads a prebuilt archive or binary, checks it against
+// the expected hash and checksums file when there are any, and installs the
+// binaries in it
+func (i *Installer) installArtifact(ctx context.Context, pkg *manifest.Package, a artifact) error {
+	url := a.URL
+	if i.DryRun {
+		versionDir := i.storeEntryDir(pkg.Name, pkg.Version, "")
+		i.println("[dry-run] Planned actions:")
+		i.printf("  Would download: %s\n", url)
+		for _, mirror := range i.Config.GetRepoURLs(url, nil)[1:] {
+			i.printf("  Would fall back to: %s\n", mirror)
+		}
+		if a.SHA256 != "" {
+			i.printf("  Would check its SHA256 is %s\n", a.SHA256)
+		}
+		if a.SumsURL != "" {
+			i.printf("  Would check it against %s\n", a.SumsURL)
+		}
+		if a.SigURL != "" {
+			i.printf("  Would verify %s with gpg\n", a.SigURL)
+		}
+		i.printf("  Would extract the binaries to %s\n", versionDir)
+		i.printf("  Would link them into %s\n", i.binDir(pkg))
+		i.printf("  Would record %s in %s\n", pkg.Name, i.Paths.InstalledPath)
+		return nil
+	}
+
+	tmpDir, err := os.MkdirTemp("", "binrex-artifact-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	fileName := path.Base(strings.SplitN(url, "?", 2)[0])
+	i.printf("\nDownloading %s...\n", url)
+	download := filepath.Join(tmpDir, fileName)
+	err = i.retry(ctx, "Downloading "+fileName, func() error {
+		return i.downloadMirrored(ctx, url, download)
+	})
+	if err != nil {
+		return err
+	}
+
+	sum, err := fsutil.SHA256File(download)
+	if err != nil {
+		return err
+	}
+	if err := i.verifyArtifact(ctx, a, fileName, sum, tmpDir); err != nil {
+		return err
+	}
+
+	extractDir := filepath.Join(tmpDir, "extracted")
+	if err := extractAsset(download, extractDir, pkg); err != nil {
+		return fmt.Errorf("failed to extract %s: %w", fileName, err)
+	}
+
+	binaries, err := findAssetBinaries(extractDir, pkg)
+	if err != nil {
+		return err
+	}
+	i.printf("\nFound %d binary file(s):\n", len(binaries))
+	for _, binary := range binaries {
+		i.printf("  - %s\n", binary.Name)
+	}
+	if binaries, err = applyAliases(binaries, pkg.BinaryAliases); err != nil {
+		return err
+	}
+
+	provenance := &state.Provenance{
+		OS:     runtime.GOOS,
+		Arch:   runtime.GOARCH,
+		SHA256: make(map[string]string),
+	}
+	installedBinaries, err := i.installBinaries(pkg, extractDir, binaries, provenance)
+	if err != nil {
+		return err
+	}
+
+	i.recordInstall(ctx, state.InstalledPackage{
+		Name:          pkg.Name,
+		Version:       pkg.Version,
+		BinaryPaths:   installedBinaries,
+		InstallDate:   getCurrentDate(),
+		TotalBinaries: len(installedBinaries),
+		Provenance:    provenance,
+		InstallDir:    pkg.InstallDir,
+		BinaryAliases: pkg.BinaryAliases,
+		Provides:      pkg.Provides,
+		Asset:         url,
+		AssetSHA256:   sum,
+	})
+	i.registerProvides(pkg.Name)
+
+	i.printInstallSummary(pkg, installedBinaries)
+	if pkg.PostInstall != "" {
+		i.printf("\n%s\n", strings.TrimRight(pkg.PostInstall, "\n"))
+	}
+	return nil
+}
+
+// extractAsset unpacks a .tar.gz, .tgz or .zip asset into dir. Any other
+// asset is taken to be the binary itself.
+func extractAsset(path, dir string, pkg *manifest.Package) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return extractTarGz(path, dir)
+	case strings.HasSuffix(name, ".zip"):
+		return extractZip(path, dir)
+	}
+
+	binary := pkg.Name
+	if len(pkg.BinaryNames) > 0 && !manifest.IsBinaryPattern(pkg.BinaryNames[0]) {
+		binary = pkg.BinaryNames[0]
+	}
+	if runtime.GOOS == "windows" {
+		binary += ".exe"
+	}
+	return copyAssetFile(path, filepath.Join(dir, binary), 0755)
+}
+
+// archivePath joins an archive entry name to dir, refusing entries that
+// would land outside it
+func archivePath(dir, name string) (string, error) {
+	path := filepath.Join(dir, name)
+	if path != filepath.Clean(dir) && !strings.HasPrefix(path, filepath.Clean(dir)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("archive entry %s points outside the archive", name)
+	}
+	return path, nil
+}
+
+func extractTarGz(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		dst, err := archivePath(dir, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(dst, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeAssetFile(tr, dst, fs.FileMode(header.Mode)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func extractZip(path, dir string) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, file := range zr.File {
+		dst, err := archivePath(dir, file.Name)
+		if err != nil {
+			return err
+		}
+		if file.FileInfo().IsDir() {
+			if err := os.MkdirAll(dst, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		r, err := file.Open()
+		if err != nil {
+			return err
+		}
+		err = writeAssetFile(r, dst, file.Mode())
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeAssetFile writes an extracted file, keeping its permission bits
+func writeAssetFile(r io.Reader, dst string, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func copyAssetFile(src, dst string, mode fs.FileMode) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return writeAssetFile(f, dst, mode)
+}
+
+// findAssetBinaries locates a package's binaries anywhere in an extracted
+// asset, by binary_names or the package name. When none of those exist,
+// every executable file is taken.
+func findAssetBinaries(dir string, pkg *manifest.Package) ([]Binary, error) {
+	names := pkg.BinaryNames
+	if len(names) == 0 {
+		names = []string{pkg.Name}
+	}
+
+	var named, executables []Binary
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		base := d.Name()
+		if matchesBinaryNames(names, strings.TrimSuffix(base, ".exe")) {
+			named = append(named, Binary{Name: base, Path: path})
+		} else if info, err := d.Info(); err == nil && info.Mode()&0111 != 0 {
+			executables = append(executables, Binary{Name: base, Path: path})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(named) > 0:
+		return named, nil
+	case len(executables) > 0 && len(pkg.BinaryNames) == 0:
+		return executables, nil
+	}
+	return nil, fmt.Errorf("no binaries named %s found in the release asset", strings.Join(names, ", "))
+}
@@ -0,0 +1,174 @@
+package installer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/nurysso/binrex/pkg/manifest"
+)
+
+// remoteBuildHost returns the SSH host builds are offloaded to, "" to
+// build here
+func (i *Installer) remoteBuildHost() string {
+	if i.RemoteBuildHost != "" {
+		return i.RemoteBuildHost
+	}
+	return i.Config.RemoteBuildHost
+}
+
+// buildsLocally reports whether build commands run with this machine's
+// own toolchains, rather than in a container or on a build host
+func (i *Installer) buildsLocally() bool {
+	return !i.containerBuilds() && i.remoteBuildHost() == ""
+}
+
+// shellQuote quotes a string for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// remotePlatform maps uname -s and -m output to GOOS and GOARCH names
+func remotePlatform(uname string) (string, string) {
+	fields := strings.Fields(uname)
+	if len(fields) != 2 {
+		return "", ""
+	}
+	arch := map[string]string{
+		"x86_64":  "amd64",
+		"amd64":   "amd64",
+		"aarch64": "arm64",
+		"arm64":   "arm64",
+		"armv7l":  "arm",
+		"armv6l":  "arm",
+		"i686":    "386",
+		"i386":    "386",
+		"riscv64": "riscv64",
+	}[fields[1]]
+	return strings.ToLower(fields[0]), arch
+}
+
+// checkRemotePlatform makes sure the build host produces binaries this
+// machine can run
+func (i *Installer) checkRemotePlatform(ctx context.Context, host string) error {
+	out, err := exec.CommandContext(ctx, "ssh", host, "uname -sm").Output()
+	if err != nil {
+		return fmt.Errorf("can't reach build host %s: %w", host, err)
+	}
+	goos, goarch := remotePlatform(string(out))
+	if goos != runtime.GOOS || goarch != runtime.GOARCH {
+		return fmt.Errorf("build host %s is %s, binaries for %s/%s are needed", host, strings.TrimSpace(string(out)), runtime.GOOS, runtime.GOARCH)
+	}
+	return nil
+}
+
+// remoteBuildScript returns the script that clones or updates a package's
+// repo on the build host, checks out commit and runs the build commands
+func (i *Installer) remoteBuildScript(pkg *manifest.Package, dir, commit string) string {
+	jobs := "$(nproc 2>/dev/null || echo 1)"
+	if i.BuildJobs > 0 || i.Config.BuildJobs > 0 {
+		jobs = strconv.Itoa(i.buildJobs())
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "set -e\ndir=%s\n", shellQuote(dir))
+	fmt.Fprintf(&b, "if [ -d \"$dir/.git\" ]; then git -C \"$dir\" fetch --quiet --tags origin; else mkdir -p \"$(dirname \"$dir\")\" && git clone --quiet %s \"$dir\"; fi\n", shellQuote(pkg.RepoURL))
+	fmt.Fprintf(&b, "git -C \"$dir\" checkout --quiet --force %s\n", shellQuote(commit))
+	if pkg.Submodules {
+		b.WriteString("git -C \"$dir\" submodule update --quiet --init --recursive\n")
+	}
+	fmt.Fprintf(&b, "jobs=%s\n", jobs)
+	b.WriteString("export MAKEFLAGS=\"-j$jobs\" CARGO_BUILD_JOBS=\"$jobs\" CMAKE_BUILD_PARALLEL_LEVEL=\"$jobs\" BINREX_BUILD_JOBS=\"$jobs\"\n")
+	fmt.Fprintf(&b, "cd \"$dir\"/%s\n", shellQuote(path.Join(".", filepath.ToSlash(pkg.SourceDir))))
+	b.WriteString(pkg.BuildCommands + "\n")
+	return b.String()
+}
+
+// remoteBinaryFinds returns the shell commands listing, relative to the
+// repo, the executables a remote build copies back: those findBuiltBinaries
+// would look at after a local build
+func remoteBinaryFinds(pkg *manifest.Package) []string {
+	var finds []string
+	if pkg.BinPath != "" {
+		d := shellQuote(path.Join(".", filepath.ToSlash(pkg.BinPath)))
+		finds = append(finds, fmt.Sprintf("[ -d %s ] && find %s -maxdepth 1 -type f -perm -u+x", d, d))
+	}
+	src := shellQuote(path.Join(".", filepath.ToSlash(pkg.SourceDir)))
+	// The globs are left unquoted for the shell to expand
+	for _, pattern := range pkg.BinaryPaths {
+		finds = append(finds, fmt.Sprintf("for f in %s/%s; do if [ -f \"$f\" ]; then echo \"$f\"; fi; done", src, pattern))
+	}
+
+	prune := []string{"-name '.*' ! -name ."}
+	for _, dir := range unsearchedDirs {
+		prune = append(prune, "-name "+shellQuote(dir))
+	}
+	for _, dir := range cargoInternalDirs {
+		prune = append(prune, "-path "+shellQuote("*/target/*/"+dir))
+	}
+	finds = append(finds, fmt.Sprintf("find %s -maxdepth %d -type d \\( %s \\) -prune -o -type f -perm -u+x -print",
+		src, maxBinaryDepth+1, strings.Join(prune, " -o ")))
+	return finds
+}
+
+// runRemoteBuild builds a package on the build host over SSH, from the
+// commit checked out in the local repo, then copies the executables of
+// the usual output directories and the lib_paths back into it, where the
+// binaries are picked up as after a local build
+func (i *Installer) runRemoteBuild(ctx context.Context, pkg *manifest.Package, repoPath string, out io.Writer) error {
+	host := i.remoteBuildHost()
+	if err := i.checkRemotePlatform(ctx, host); err != nil {
+		return err
+	}
+	commit := getRepoCommit(repoPath)
+	if commit == "" {
+		return fmt.Errorf("no commit checked out in %s", repoPath)
+	}
+
+	dir := ".cache/binrex-remote/" + pkg.Name
+	i.printf("Building on %s at %s...\n", host, ShortCommit(commit))
+	build := exec.CommandContext(ctx, "ssh", host, i.remoteBuildScript(pkg, dir, commit))
+	build.Stdout = out
+	build.Stderr = out
+	if err := build.Run(); err != nil {
+		return fmt.Errorf("remote build on %s failed: %w", host, err)
+	}
+
+	var find strings.Builder
+	fmt.Fprintf(&find, "set -e\ncd %s\n{\n", shellQuote(dir))
+	for _, line := range remoteBinaryFinds(pkg) {
+		fmt.Fprintf(&find, "%s\n", line)
+	}
+	for _, lib := range pkg.LibPaths {
+		d := path.Join(".", filepath.ToSlash(pkg.SourceDir), filepath.ToSlash(lib))
+		fmt.Fprintf(&find, "[ -e %s ] && find %s\n", shellQuote(d), shellQuote(d))
+	}
+	find.WriteString("true\n} | sort -u | tar -cf - --no-recursion -T -\n")
+
+	i.printf("Copying the binaries back from %s...\n", host)
+	var stderr bytes.Buffer
+	fetch := exec.CommandContext(ctx, "ssh", host, find.String())
+	unpack := exec.CommandContext(ctx, "tar", "-xf", "-", "-C", repoPath)
+	fetch.Stderr = &stderr
+	unpack.Stderr = &stderr
+	pipe, err := fetch.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	unpack.Stdin = pipe
+	if err := unpack.Start(); err != nil {
+		return err
+	}
+	fetchErr := fetch.Run()
+	if err := unpack.Wait(); err != nil || fetchErr != nil {
+		return fmt.Errorf("failed to copy the build output from %s: %s", host, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
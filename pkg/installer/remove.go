@@ -0,0 +1,302 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+	"github.com/nurysso/binrex/pkg/state"
+)
+
+// Remove removes an installed package and its binaries
+func (i *Installer) Remove(ctx context.Context, name string) error {
+	version := i.installedVersion(name)
+	err := i.remove(ctx, name, false)
+	i.recordHistory("remove", name, version, err)
+	return err
+}
+
+// remove removes an installed package. keepVersions leaves its builds in
+// the store, for updates that install a new version next to them.
+func (i *Installer) remove(ctx context.Context, name string, keepVersions bool) error {
+	installedData, err := i.State.Load()
+	if err != nil {
+		return err
+	}
+	if err := i.removeFrom(ctx, installedData, name, keepVersions); err != nil {
+		return err
+	}
+	if i.DryRun {
+		return nil
+	}
+	if err := i.State.Save(installedData); err != nil {
+		i.eprintln("Warning: Failed to update installed.json")
+	}
+	return nil
+}
+
+// removeFrom deletes an installed package's files and drops it from
+// installedData, leaving the caller to save it
+func (i *Installer) removeFrom(ctx context.Context, installedData *state.InstalledData, name string, keepVersions bool) error {
+	i.printf("Removing package: %s\n", name)
+
+	var pkgToRemove *state.InstalledPackage
+	var remainingPackages []state.InstalledPackage
+
+	for n, pkg := range installedData.Installed {
+		if pkg.Name == name {
+			pkgToRemove = &installedData.Installed[n]
+		} else {
+			remainingPackages = append(remainingPackages, pkg)
+		}
+	}
+
+	if pkgToRemove == nil {
+		i.eprintf("Package '%s' is not installed\n", name)
+		return ErrNotInstalled
+	}
+
+	if i.DryRun {
+		i.println("[dry-run] Planned actions:")
+		for _, binaryPath := range pkgToRemove.BinaryPaths {
+			i.printf("  Would delete: %s\n", binaryPath)
+		}
+		for _, path := range append(append(append(append([]string{}, pkgToRemove.Files...), pkgToRemove.DesktopFiles...), pkgToRemove.IconPaths...), pkgToRemove.ServiceUnits...) {
+			i.printf("  Would delete: %s\n", path)
+		}
+		if !keepVersions {
+			entries, _ := i.StoreEntries(name)
+			for _, entry := range entries {
+				i.printf("  Would delete: %s\n", entry.Path)
+			}
+		}
+		i.printf("  Would remove %s from %s\n", name, i.Paths.InstalledPath)
+		return nil
+	}
+
+	files := pkgToRemove.FileList
+	if files == nil {
+		files = fileList(pkgToRemove)
+	}
+
+	// Remove all binaries
+	removedCount := 0
+	for _, binaryPath := range pkgToRemove.BinaryPaths {
+		if fsutil.FileExists(binaryPath) {
+			if err := os.Remove(binaryPath); err != nil {
+				i.eprintf("Error removing binary %s: %v\n", binaryPath, err)
+			} else {
+				i.printf("  ✓ Removed binary: %s\n", binaryPath)
+				removedCount++
+			}
+		} else {
+			i.printf("  Binary not found: %s\n", binaryPath)
+		}
+	}
+
+	for _, path := range pkgToRemove.Files {
+		if err := os.RemoveAll(path); err != nil {
+			i.eprintf("Error removing %s: %v\n", path, err)
+		} else {
+			i.printf("  ✓ Removed: %s\n", path)
+		}
+	}
+
+	i.removeDesktopFiles(ctx, pkgToRemove.DesktopFiles, pkgToRemove.IconPaths)
+	i.removeServices(ctx, pkgToRemove.ServiceUnits)
+
+	if !keepVersions {
+		i.removeStoreEntries(name)
+	}
+	i.removeLeftovers(files, nil, ownedFiles(installedData, name))
+	i.logFileChanges("remove", name, files, nil)
+
+	binaryCount := len(pkgToRemove.BinaryPaths)
+	installedData.Installed = remainingPackages
+	if !keepVersions {
+		i.dropProvider(installedData, name)
+	}
+
+	i.printf("\n✓ Package '%s' removed successfully.\n", name)
+	i.printf("  Binaries removed: %d/%d\n", removedCount, binaryCount)
+
+	return nil
+}
+
+// RemovePackages removes or purges several installed packages, writing
+// installed.json once at the end. It returns the names that failed, with
+// their errors joined in the error.
+func (i *Installer) RemovePackages(ctx context.Context, names []string, purge bool) ([]string, error) {
+	installedData, err := i.State.Load()
+	if err != nil {
+		return names, err
+	}
+
+	action := "remove"
+	if purge {
+		action = "purge"
+	}
+
+	var failed []string
+	var errs []error
+	for n, name := range names {
+		if len(names) > 1 {
+			if n > 0 {
+				i.println()
+			}
+			i.printf("==> [%d/%d] %s\n", n+1, len(names), name)
+		}
+
+		version := ""
+		if pkg := installedData.Find(name); pkg != nil {
+			version = pkg.Version
+		}
+		var leftovers []string
+		if purge {
+			leftovers = i.purgePaths(installedData, name)
+		}
+
+		err := i.removeFrom(ctx, installedData, name, false)
+		if err == nil {
+			i.deleteLeftovers(leftovers)
+		}
+		i.recordHistory(action, name, version, err)
+		if err != nil {
+			failed = append(failed, name)
+			errs = append(errs, err)
+		}
+	}
+
+	if !i.DryRun && len(failed) < len(names) {
+		if err := i.State.Save(installedData); err != nil {
+			i.eprintf("Error: Failed to update installed.json: %v\n", err)
+			return names, err
+		}
+	}
+	if len(failed) > 0 {
+		return failed, &batchError{fmt.Sprintf("failed to %s %s", action, strings.Join(failed, ", ")), errs}
+	}
+	return nil, nil
+}
+
+// MatchInstalled expands glob patterns like 'rust-*' to the installed
+// packages they match. Plain names are kept as they are.
+func (i *Installer) MatchInstalled(patterns []string) ([]string, error) {
+	installedData, err := i.State.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, "*?[") {
+			if !seen[pattern] {
+				seen[pattern] = true
+				names = append(names, pattern)
+			}
+			continue
+		}
+
+		matched := false
+		for _, pkg := range installedData.Installed {
+			ok, err := path.Match(pattern, pkg.Name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+			if ok {
+				matched = true
+				if !seen[pkg.Name] {
+					seen[pkg.Name] = true
+					names = append(names, pkg.Name)
+				}
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no installed package matches %s", pattern)
+		}
+	}
+	return names, nil
+}
+
+// Purge removes an installed package like Remove, then deletes everything
+// else binrex kept for it: the cached repository and its build logs
+func (i *Installer) Purge(ctx context.Context, name string) error {
+	version := i.installedVersion(name)
+	err := i.purge(ctx, name)
+	i.recordHistory("purge", name, version, err)
+	return err
+}
+
+func (i *Installer) purge(ctx context.Context, name string) error {
+	leftovers := i.PurgePaths(name)
+	if err := i.remove(ctx, name, false); err != nil {
+		return err
+	}
+	i.deleteLeftovers(leftovers)
+	return nil
+}
+
+// deleteLeftovers deletes the extra files of a purged package
+func (i *Installer) deleteLeftovers(paths []string) {
+	for _, path := range paths {
+		if i.DryRun {
+			i.printf("  Would delete: %s\n", path)
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			i.eprintf("Error removing %s: %v\n", path, err)
+		} else {
+			i.printf("  ✓ Deleted: %s\n", path)
+		}
+	}
+}
+
+// PurgePaths returns the files Purge deletes on top of what Remove does.
+// The cached repository is left alone while other installed packages are
+// built from it.
+func (i *Installer) PurgePaths(name string) []string {
+	installedData, err := i.State.Load()
+	if err != nil {
+		return nil
+	}
+	return i.purgePaths(installedData, name)
+}
+
+func (i *Installer) purgePaths(installedData *state.InstalledData, name string) []string {
+	if installedData.Find(name) == nil {
+		return nil
+	}
+
+	var paths []string
+	if repoPath := i.unsharedRepoPath(installedData, name); repoPath != "" {
+		paths = append(paths, repoPath)
+	}
+	return append(paths, i.buildLogs(name)...)
+}
+
+// unsharedRepoPath returns the cached repository an installed package was
+// built from, or "" when it is missing or other installed packages are
+// built from it too
+func (i *Installer) unsharedRepoPath(installedData *state.InstalledData, name string) string {
+	pkg := installedData.Find(name)
+	if pkg == nil {
+		return ""
+	}
+
+	repoPath := filepath.Clean(pkg.RepoPath)
+	for _, other := range installedData.Installed {
+		if other.Name != name && filepath.Clean(other.RepoPath) == repoPath {
+			return ""
+		}
+	}
+	// Only ever hand out a single repository inside the cache
+	if filepath.Dir(repoPath) != filepath.Clean(i.Paths.CacheDir) || !fsutil.FileExists(repoPath) {
+		return ""
+	}
+	return repoPath
+}
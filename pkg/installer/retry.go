@@ -0,0 +1,106 @@
+package installer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/nurysso/binrex/internal/fetch"
+)
+
+// defaultNetworkRetries is how often a transient network failure is
+// retried when the config doesn't say
+const defaultNetworkRetries = 3
+
+// retryDelay is the wait before the first retry, doubled for each one
+// after it
+const retryDelay = 2 * time.Second
+
+// transientGitErrors are what git prints when a remote can't be reached
+// or a transfer breaks off, as opposed to missing repositories, refused
+// credentials or local conflicts, which fail the same way every time
+var transientGitErrors = []string{
+	"Could not resolve host",
+	"Temporary failure in name resolution",
+	"Connection refused",
+	"Couldn't connect to server",
+	"Connection reset",
+	"Connection timed out",
+	"Operation timed out",
+	"Network is unreachable",
+	"early EOF",
+	"The remote end hung up unexpectedly",
+	"RPC failed",
+	"gnutls_handshake",
+	"SSL_ERROR",
+	"returned error: 429",
+	"returned error: 5",
+}
+
+// networkRetries returns how often transient network failures are
+// retried, following the config's network_retries
+func (i *Installer) networkRetries() int {
+	switch {
+	case i.Config.NetworkRetries < 0:
+		return 0
+	case i.Config.NetworkRetries == 0:
+		return defaultNetworkRetries
+	}
+	return i.Config.NetworkRetries
+}
+
+// retry runs a clone, pull or download step, running it again while it
+// fails with a transient network error, waiting twice as long before each
+// retry. Other failures, like a build breaking or a 404, return at once.
+func (i *Installer) retry(ctx context.Context, step string, fn func() error) error {
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !errors.Is(err, fetch.ErrTransient) || attempt > i.networkRetries() || ctx.Err() != nil {
+			return err
+		}
+
+		i.eprintf("Warning: %s failed with a network error, retrying in %s (%d of %d)\n", step, delay, attempt, i.networkRetries())
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// runGit runs a git command like runCommand, marking its failure as
+// transient when git's output says the remote couldn't be reached
+func (i *Installer) runGit(ctx context.Context, cmd string) error {
+	var stderr bytes.Buffer
+	command := exec.CommandContext(ctx, "sh", "-c", cmd)
+	command.Stdout = i.Stdout
+	command.Stderr = io.MultiWriter(i.Stderr, &stderr)
+	err := command.Run()
+	if err == nil {
+		return nil
+	}
+	for _, msg := range transientGitErrors {
+		if strings.Contains(stderr.String(), msg) {
+			return fetch.TransientError(err)
+		}
+	}
+	return err
+}
+
+// failureKind classifies why a package of a batch failed: "network" when
+// a remote couldn't be reached, "build" when its build commands failed
+func failureKind(err error) string {
+	switch {
+	case errors.Is(err, ErrNetwork):
+		return "network"
+	case errors.Is(err, ErrBuildFailed):
+		return "build"
+	}
+	return ""
+}
@@ -0,0 +1,180 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+	"github.com/nurysso/binrex/pkg/state"
+)
+
+// runDir is where run keeps the packages it builds for one-off use, apart
+// from the installed ones
+func (i *Installer) runDir(name string) string {
+	return filepath.Join(filepath.Dir(i.Paths.CacheDir), "run", name)
+}
+
+// runInstaller returns an installer that installs into a package's run
+// dir
+func (i *Installer) runInstaller(name string) *Installer {
+	return i.scratchInstaller(i.runDir(name))
+}
+
+// scratchInstaller returns an installer that installs into dir. It shares
+// the repo cache but has its own bin dir, store and installed.json, so
+// nothing it installs shows up as installed.
+func (i *Installer) scratchInstaller(dir string) *Installer {
+	paths := i.Paths
+	paths.BinDir = filepath.Join(dir, "bin")
+	paths.StoreDir = filepath.Join(dir, "store")
+	paths.InstalledPath = filepath.Join(dir, "installed.json")
+	paths.HistoryPath = filepath.Join(dir, "history.jsonl")
+	paths.ApplicationsDir = filepath.Join(dir, "applications")
+	paths.IconsDir = filepath.Join(dir, "icons")
+	paths.SystemdUserDir = filepath.Join(dir, "systemd")
+
+	// Nothing may land outside the run dir
+	cfg := *i.Config
+	cfg.InstallDirs = nil
+	cfg.EnableServices = false
+
+	return &Installer{
+		Paths:           paths,
+		Config:          &cfg,
+		State:           state.NewStore(paths.InstalledPath, i.Stderr),
+		Stdout:          i.Stderr,
+		Stderr:          i.Stderr,
+		BuildJobs:       i.BuildJobs,
+		ContainerBuilds: i.ContainerBuilds,
+		RemoteBuildHost: i.RemoteBuildHost,
+		Sandbox:         i.Sandbox,
+		NoNetworkBuild:  i.NoNetworkBuild,
+		LimitRate:       i.LimitRate,
+		Confirm:         i.Confirm,
+		ephemeral:       true,
+	}
+}
+
+// PrepareRun builds or downloads a package for run and returns the path of
+// the binary to execute, "" for dry runs. binary picks one of several
+// binaries, by default the one named like the package.
+func (i *Installer) PrepareRun(ctx context.Context, name, binary string) (string, error) {
+	paths, err := i.prepareEphemeral(ctx, name)
+	if err != nil || i.DryRun {
+		return "", err
+	}
+	return pickBinary(name, binary, paths)
+}
+
+// PrepareShell makes the binaries of packages available for shell: it
+// prepares them like run and links them all into a new temporary
+// directory to put first on PATH. The caller removes the directory.
+func (i *Installer) PrepareShell(ctx context.Context, names []string) (string, error) {
+	var binaries []string
+	for _, name := range names {
+		paths, err := i.prepareEphemeral(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		binaries = append(binaries, paths...)
+	}
+	if i.DryRun {
+		return "", nil
+	}
+
+	dir, err := os.MkdirTemp("", "binrex-shell-*")
+	if err != nil {
+		return "", err
+	}
+	for _, binary := range binaries {
+		if err := linkBinary(binary, filepath.Join(dir, filepath.Base(binary))); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// prepareEphemeral returns the binaries of a package for run and shell.
+// Installed packages use their bin dir entries. Others are installed into
+// a cache outside the bin dir and installed.json, reused while the
+// manifest version stays the same.
+func (i *Installer) prepareEphemeral(ctx context.Context, name string) ([]string, error) {
+	if installed := i.State.Get(name); installed != nil {
+		return installed.BinaryPaths, nil
+	}
+
+	if err := i.requireManifest(); err != nil {
+		return nil, err
+	}
+	pkg, err := i.FindPackage(name)
+	if err != nil {
+		return nil, err
+	}
+
+	run := i.runInstaller(name)
+	if cached := run.State.Get(name); cached != nil && cached.Version == pkg.Version && binariesExist(cached.BinaryPaths) {
+		return cached.BinaryPaths, nil
+	}
+
+	if i.DryRun {
+		run.DryRun = true
+		return nil, run.install(ctx, name, InstallOptions{InstallDir: run.Paths.BinDir})
+	}
+
+	// Start over, the cached build is outdated or incomplete
+	if err := os.RemoveAll(i.runDir(name)); err != nil {
+		return nil, err
+	}
+	if err := run.Init(); err != nil {
+		return nil, err
+	}
+	i.eprintf("Preparing %s %s in %s...\n", name, pkg.Version, i.runDir(name))
+	if err := run.install(ctx, name, InstallOptions{InstallDir: run.Paths.BinDir}); err != nil {
+		return nil, err
+	}
+
+	cached := run.State.Get(name)
+	if cached == nil {
+		return nil, fmt.Errorf("%s was not installed", name)
+	}
+	return cached.BinaryPaths, nil
+}
+
+// binariesExist reports whether every path exists
+func binariesExist(paths []string) bool {
+	for _, path := range paths {
+		if !fsutil.FileExists(path) {
+			return false
+		}
+	}
+	return len(paths) > 0
+}
+
+// pickBinary chooses the binary to run among a package's binaries
+func pickBinary(name, binary string, paths []string) (string, error) {
+	var names []string
+	for _, path := range paths {
+		names = append(names, filepath.Base(path))
+	}
+
+	if binary == "" {
+		if len(paths) == 1 {
+			return paths[0], nil
+		}
+		binary = name
+	}
+	for _, path := range paths {
+		if filepath.Base(path) == binary {
+			return path, nil
+		}
+	}
+
+	if len(names) == 0 {
+		return "", fmt.Errorf("%s has no binaries", name)
+	}
+	return "", fmt.Errorf("%s has no binary %s, pick one of %s with --bin", name, binary, strings.Join(names, ", "))
+}
@@ -0,0 +1,140 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sandboxTool returns the sandbox local builds run under: the --sandbox
+// choice, then the config's sandbox. "" builds without one.
+func (i *Installer) sandboxTool() (string, error) {
+	tool := i.Sandbox
+	if tool == "" {
+		tool = i.Config.Sandbox
+	}
+
+	switch tool {
+	case "", "none":
+		return "", nil
+	case "auto":
+		for _, tool := range []string{"bwrap", "firejail"} {
+			if CheckToolExists(tool) {
+				return tool, nil
+			}
+		}
+		return "", fmt.Errorf("sandboxed builds need bubblewrap (bwrap) or firejail")
+	case "bwrap", "bubblewrap", "firejail":
+		if tool == "bubblewrap" {
+			tool = "bwrap"
+		}
+		if !CheckToolExists(tool) {
+			return "", fmt.Errorf("sandbox %s is not installed", tool)
+		}
+		return tool, nil
+	}
+	return "", fmt.Errorf("unknown sandbox %q, use bwrap, firejail or auto", tool)
+}
+
+// sandboxCacheDir keeps the download and compiler caches of sandboxed
+// builds, the one place besides the repo they write to for good
+func (i *Installer) sandboxCacheDir() string {
+	return filepath.Join(filepath.Dir(i.Paths.CacheDir), "sandbox")
+}
+
+// sandboxEnv points the build tools' caches into the sandbox cache dir,
+// as the usual ones in the home directory are hidden or read only
+func (i *Installer) sandboxEnv() []string {
+	dir := i.sandboxCacheDir()
+	return append(i.buildEnv(),
+		"CARGO_HOME="+filepath.Join(dir, "cargo"),
+		"GOPATH="+filepath.Join(dir, "go"),
+		"GOMODCACHE="+filepath.Join(dir, "go", "pkg", "mod"),
+		"GOCACHE="+filepath.Join(dir, "go-build"),
+		"SCCACHE_DIR="+filepath.Join(dir, "sccache"),
+		"CCACHE_DIR="+filepath.Join(dir, "ccache"),
+	)
+}
+
+// sandboxReadPaths returns what sandboxed builds may read in the home
+// directory: the directories on PATH, so toolchains installed there keep
+// working, rustup's toolchains, binrex's own and the config's
+// sandbox_paths
+func (i *Installer) sandboxReadPaths(home string) []string {
+	candidates := filepath.SplitList(os.Getenv("PATH"))
+	candidates = append(candidates, filepath.Join(home, ".rustup"), i.toolchainDir())
+	for _, path := range i.Config.SandboxPaths {
+		if resolved, err := i.Config.ResolveBinDir(path); err == nil {
+			candidates = append(candidates, resolved)
+		}
+	}
+
+	var paths []string
+	for _, path := range candidates {
+		path = filepath.Clean(path)
+		if !filepath.IsAbs(path) || path == home || !inDir(path, home) || contains(paths, path) {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// inDir reports whether path is dir or inside it
+func inDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// sandboxArgs returns the command line running a build command under a
+// sandbox tool. The build can write to the repo, the sandbox cache dir
+// and a private /tmp only. The home directory is replaced by an empty one
+// holding just the repo and the sandboxReadPaths, so SSH keys, tokens and
+// browser profiles stay out of reach. Unless network is set the build
+// gets no network either.
+func (i *Installer) sandboxArgs(tool, repoPath, buildPath, cmd string, network bool) ([]string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("could not determine HOME directory: %w", err)
+	}
+	readPaths := i.sandboxReadPaths(home)
+	writePaths := []string{repoPath, i.sandboxCacheDir()}
+
+	if tool == "firejail" {
+		args := []string{"firejail", "--quiet", "--noprofile", "--private-tmp", "--private-dev"}
+		if !network {
+			args = append(args, "--net=none")
+		}
+		for _, path := range writePaths {
+			if inDir(path, home) {
+				args = append(args, "--whitelist="+path)
+			}
+		}
+		for _, path := range readPaths {
+			args = append(args, "--whitelist="+path, "--read-only="+path)
+		}
+		return append(args, "sh", "-c", cmd), nil
+	}
+
+	args := []string{"bwrap", "--die-with-parent", "--unshare-user-try", "--unshare-ipc", "--unshare-pid", "--unshare-uts",
+		"--ro-bind", "/", "/",
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+		"--tmpfs", home,
+	}
+	if !network {
+		args = append(args, "--unshare-net")
+	}
+	for _, path := range readPaths {
+		args = append(args, "--ro-bind", path, path)
+	}
+	for _, path := range writePaths {
+		args = append(args, "--bind", path, path)
+	}
+	args = append(args, "--chdir", buildPath)
+	return append(args, "sh", "-c", cmd), nil
+}
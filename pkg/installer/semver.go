@@ -0,0 +1,375 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+	"github.com/nurysso/binrex/pkg/manifest"
+)
+
+// semver is a parsed semantic version. Missing minor or patch numbers are
+// recorded in parts, so "1.2" can mean "any 1.2.x" in a constraint.
+type semver struct {
+	major, minor, patch int
+	pre                 string
+	parts               int
+}
+
+// parseSemver parses a version or tag like "v1.2.3", "1.2" or "2.0.0-rc.1".
+// Build metadata after "+" is ignored.
+func parseSemver(s string) (semver, bool) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+	s, _, _ = strings.Cut(s, "+")
+
+	var v semver
+	core, pre, _ := strings.Cut(s, "-")
+	v.pre = pre
+
+	fields := strings.Split(core, ".")
+	if len(fields) > 3 {
+		return v, false
+	}
+	for n, field := range fields {
+		x, err := strconv.Atoi(field)
+		if err != nil || x < 0 {
+			return v, false
+		}
+		switch n {
+		case 0:
+			v.major = x
+		case 1:
+			v.minor = x
+		case 2:
+			v.patch = x
+		}
+	}
+	v.parts = len(fields)
+	return v, true
+}
+
+// compare returns -1, 0 or 1 as v is lower than, equal to or higher than o.
+// A pre-release sorts before its release.
+func (v semver) compare(o semver) int {
+	for _, d := range []int{v.major - o.major, v.minor - o.minor, v.patch - o.patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+
+	switch {
+	case v.pre == o.pre:
+		return 0
+	case v.pre == "":
+		return 1
+	case o.pre == "":
+		return -1
+	}
+
+	as, bs := strings.Split(v.pre, "."), strings.Split(o.pre, ".")
+	for n := 0; n < min(len(as), len(bs)); n++ {
+		x, xerr := strconv.Atoi(as[n])
+		y, yerr := strconv.Atoi(bs[n])
+		switch {
+		case xerr == nil && yerr == nil:
+			if x != y {
+				return sign(x - y)
+			}
+		case xerr == nil:
+			return -1
+		case yerr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[n], bs[n]); c != 0 {
+				return c
+			}
+		}
+	}
+	return sign(len(as) - len(bs))
+}
+
+func sign(x int) int {
+	switch {
+	case x < 0:
+		return -1
+	case x > 0:
+		return 1
+	}
+	return 0
+}
+
+// bound is one comparison of a version constraint
+type bound struct {
+	op      string
+	version semver
+}
+
+// versionConstraint is a set of bounds a version must all satisfy
+type versionConstraint struct {
+	bounds []bound
+	// pre allows pre-releases, only when the constraint names one
+	pre bool
+}
+
+// parseConstraint parses constraints like "^1.2", "~1.4.0", ">=1.0 <2",
+// "1.x" or an exact "1.2.3". Bounds are separated by commas or spaces.
+func parseConstraint(s string) (versionConstraint, error) {
+	var c versionConstraint
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(fields) == 0 {
+		return c, fmt.Errorf("empty version constraint")
+	}
+
+	for _, field := range fields {
+		op := ""
+		for _, prefix := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+			if strings.HasPrefix(field, prefix) {
+				op, field = prefix, field[len(prefix):]
+				break
+			}
+		}
+
+		// "1.x" and "1.2.*" mean the same as "1" and "1.2"
+		if trimmed := strings.TrimRight(field, ".xX*"); trimmed != field {
+			if trimmed == "" {
+				continue
+			}
+			field = trimmed
+		}
+
+		v, ok := parseSemver(field)
+		if !ok {
+			return c, fmt.Errorf("invalid version constraint %q", s)
+		}
+		if v.pre != "" {
+			c.pre = true
+		}
+		c.bounds = append(c.bounds, expandBound(op, v)...)
+	}
+	return c, nil
+}
+
+// expandBound turns a comparison into lower and upper bounds
+func expandBound(op string, v semver) []bound {
+	next := func(major, minor, patch int) semver {
+		return semver{major: major, minor: minor, patch: patch, parts: 3}
+	}
+
+	switch op {
+	case "^":
+		// Changes that don't modify the left-most non-zero number
+		upper := next(v.major+1, 0, 0)
+		switch {
+		case v.major == 0 && v.parts >= 3 && v.minor == 0:
+			upper = next(0, 0, v.patch+1)
+		case v.major == 0 && v.parts >= 2:
+			upper = next(0, v.minor+1, 0)
+		}
+		return []bound{{">=", v}, {"<", upper}}
+	case "~":
+		upper := next(v.major, v.minor+1, 0)
+		if v.parts == 1 {
+			upper = next(v.major+1, 0, 0)
+		}
+		return []bound{{">=", v}, {"<", upper}}
+	case "", "=":
+		// A partial version matches every release it covers
+		switch v.parts {
+		case 1:
+			return []bound{{">=", v}, {"<", next(v.major+1, 0, 0)}}
+		case 2:
+			return []bound{{">=", v}, {"<", next(v.major, v.minor+1, 0)}}
+		}
+		return []bound{{"=", v}}
+	case "<=":
+		switch v.parts {
+		case 1:
+			return []bound{{"<", next(v.major+1, 0, 0)}}
+		case 2:
+			return []bound{{"<", next(v.major, v.minor+1, 0)}}
+		}
+	case ">":
+		switch v.parts {
+		case 1:
+			return []bound{{">=", next(v.major+1, 0, 0)}}
+		case 2:
+			return []bound{{">=", next(v.major, v.minor+1, 0)}}
+		}
+	}
+	return []bound{{op, v}}
+}
+
+// matches reports whether version satisfies every bound
+func (c versionConstraint) matches(version string) bool {
+	v, ok := parseSemver(version)
+	if !ok || (v.pre != "" && !c.pre) {
+		return false
+	}
+
+	for _, b := range c.bounds {
+		r := v.compare(b.version)
+		var ok bool
+		switch b.op {
+		case ">=":
+			ok = r >= 0
+		case ">":
+			ok = r > 0
+		case "<=":
+			ok = r <= 0
+		case "<":
+			ok = r < 0
+		default:
+			ok = r == 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveTag returns the tag with the highest version satisfying the
+// constraint, or "" when none does
+func resolveTag(tags map[string]string, constraint string) (string, error) {
+	c, err := parseConstraint(constraint)
+	if err != nil {
+		return "", err
+	}
+
+	best := ""
+	var bestVersion semver
+	for tag := range tags {
+		if !c.matches(tag) {
+			continue
+		}
+		v, _ := parseSemver(tag)
+		if best == "" || v.compare(bestVersion) > 0 || (v.compare(bestVersion) == 0 && tag < best) {
+			best, bestVersion = tag, v
+		}
+	}
+	return best, nil
+}
+
+// repoTags returns the tags of a cached repository and the commits they
+// point at, after fetching new ones
+func repoTags(ctx context.Context, repoPath string) (map[string]string, error) {
+	exec.CommandContext(ctx, "git", "-C", repoPath, "fetch", "--quiet", "--tags").Run()
+
+	out, err := exec.CommandContext(ctx, "git", "-C", repoPath, "for-each-ref",
+		"--format=%(refname:strip=2) %(objectname) %(*objectname)", "refs/tags").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+
+	tags := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Fields(line)
+		switch len(fields) {
+		case 2:
+			tags[fields[0]] = fields[1]
+		case 3:
+			// Annotated tag, use the commit it points at
+			tags[fields[0]] = fields[2]
+		}
+	}
+	return tags, nil
+}
+
+// remoteTags lists a remote repository's tags without cloning it
+func remoteTags(ctx context.Context, repoURL string) (map[string]string, error) {
+	out, err := exec.CommandContext(ctx, "git", "ls-remote", "--tags", repoURL).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags of %s: %w", repoURL, err)
+	}
+
+	tags := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		commit, ref, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		tag := strings.TrimPrefix(ref, "refs/tags/")
+		if peeled, ok := strings.CutSuffix(tag, "^{}"); ok {
+			tags[peeled] = commit
+		} else if _, seen := tags[tag]; !seen {
+			tags[tag] = commit
+		}
+	}
+	return tags, nil
+}
+
+// resolveConstraint finds the newest tag of a package's repository that
+// satisfies a version constraint, from the cached repo when there is one
+func (i *Installer) resolveConstraint(ctx context.Context, repoPath, repoURL, constraint string) (string, string, error) {
+	var tags map[string]string
+	var err error
+	if fsutil.FileExists(repoPath) {
+		tags, err = repoTags(ctx, repoPath)
+	} else {
+		tags, err = remoteTags(ctx, repoURL)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	tag, err := resolveTag(tags, constraint)
+	if err != nil {
+		return "", "", err
+	}
+	if tag == "" {
+		return "", "", fmt.Errorf("no tag matches %s", constraint)
+	}
+	return tag, tags[tag], nil
+}
+
+// checkoutConstraint checks out the newest tag of a cloned repository that
+// satisfies a version constraint and returns it
+func (i *Installer) checkoutConstraint(ctx context.Context, repoPath, constraint string) (string, error) {
+	tag, _, err := i.resolveConstraint(ctx, repoPath, "", constraint)
+	if err != nil {
+		return "", err
+	}
+
+	i.printf("Checking out %s, the newest tag matching %s...\n", tag, constraint)
+	if err := runCommandSilent(ctx, fmt.Sprintf("cd %s && git checkout --quiet %s", repoPath, tag)); err != nil {
+		return "", fmt.Errorf("failed to check out %s: %w", tag, err)
+	}
+	return tag, nil
+}
+
+// planConstraint resolves a dry run's version constraint and sets the
+// tag's version on pkg for the install plan
+func (i *Installer) planConstraint(ctx context.Context, pkg *manifest.Package, constraint string) error {
+	if constraint == "" {
+		return nil
+	}
+
+	tag, _, err := i.resolveConstraint(ctx, i.RepoCachePath(pkg.RepoURL), pkg.RepoURL, constraint)
+	if err != nil {
+		i.eprintf("Error: %v\n", err)
+		return err
+	}
+	i.printf("[dry-run] %s resolves to tag %s\n", constraint, tag)
+	pkg.Version = tagVersion(tag)
+	return nil
+}
+
+// tagVersion returns the version a release tag names, "v1.2.0" -> "1.2.0"
+func tagVersion(tag string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(tag, "v"), "V")
+}
+
+// constraintAllows reports whether a newer manifest version is one a
+// package installed with a version constraint may move to
+func constraintAllows(constraint, installed, version string) bool {
+	c, err := parseConstraint(constraint)
+	if err != nil || !c.matches(version) {
+		return false
+	}
+	a, _ := parseSemver(version)
+	b, ok := parseSemver(installed)
+	return !ok || a.compare(b) > 0
+}
@@ -0,0 +1,104 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+	"github.com/nurysso/binrex/pkg/manifest"
+)
+
+// systemctl runs systemctl --user with args, output goes to the installer
+func (i *Installer) systemctl(ctx context.Context, args ...string) error {
+	command := exec.CommandContext(ctx, "systemctl", append([]string{"--user"}, args...)...)
+	command.Stdout = i.Stdout
+	command.Stderr = i.Stderr
+	return command.Run()
+}
+
+// installServices copies a package's systemd user units from its build
+// dir, reloads systemd and, when enable is set, enables and starts them
+func (i *Installer) installServices(ctx context.Context, pkg *manifest.Package, buildPath string, enable bool) []string {
+	if len(pkg.Services) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(i.Paths.SystemdUserDir, 0755); err != nil {
+		i.eprintf("Warning: Failed to create %s: %v\n", i.Paths.SystemdUserDir, err)
+		return nil
+	}
+
+	i.println("\nInstalling systemd user services...")
+	var units []string
+	for _, src := range pkg.Services {
+		dst := filepath.Join(i.Paths.SystemdUserDir, filepath.Base(src))
+		if err := fsutil.CopyFile(filepath.Join(buildPath, src), dst); err != nil {
+			i.eprintf("Warning: Failed to install %s: %v\n", src, err)
+			continue
+		}
+		if err := os.Chmod(dst, 0644); err != nil {
+			i.eprintf("Warning: Failed to set permissions on %s: %v\n", dst, err)
+		}
+		units = append(units, dst)
+		i.printf("  ✓ Installed: %s\n", dst)
+	}
+
+	if len(units) == 0 || !CheckToolExists("systemctl") {
+		return units
+	}
+
+	if err := i.systemctl(ctx, "daemon-reload"); err != nil {
+		i.eprintf("Warning: systemctl --user daemon-reload failed: %v\n", err)
+		return units
+	}
+	if !enable {
+		i.printf("  Enable with: systemctl --user enable --now %s\n", unitNames(units))
+		return units
+	}
+	for _, unit := range units {
+		if err := i.systemctl(ctx, "enable", "--now", filepath.Base(unit)); err != nil {
+			i.eprintf("Warning: Failed to enable %s: %v\n", filepath.Base(unit), err)
+			continue
+		}
+		i.printf("  ✓ Enabled: %s\n", filepath.Base(unit))
+	}
+
+	return units
+}
+
+// removeServices stops, disables and deletes installed systemd user units
+func (i *Installer) removeServices(ctx context.Context, units []string) {
+	if len(units) == 0 {
+		return
+	}
+
+	hasSystemctl := CheckToolExists("systemctl")
+	for _, unit := range units {
+		if hasSystemctl {
+			// Units that were never enabled make this fail, that's fine
+			runCommandSilent(ctx, fmt.Sprintf("systemctl --user disable --now %q", filepath.Base(unit)))
+		}
+		if err := os.Remove(unit); err != nil && !os.IsNotExist(err) {
+			i.eprintf("Error removing %s: %v\n", unit, err)
+			continue
+		}
+		i.printf("  ✓ Removed: %s\n", unit)
+	}
+
+	if hasSystemctl {
+		runCommandSilent(ctx, "systemctl --user daemon-reload")
+	}
+}
+
+// unitNames joins the base names of unit files for display
+func unitNames(units []string) string {
+	names := make([]string, len(units))
+	for n, unit := range units {
+		names[n] = filepath.Base(unit)
+	}
+	return strings.Join(names, " ")
+}
@@ -0,0 +1,197 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BinDirOnPath reports whether the bin dir is listed in $PATH
+func (i *Installer) BinDirOnPath() bool {
+	return onPath(i.Paths.BinDir)
+}
+
+// onPath reports whether a directory is listed in $PATH
+func onPath(binDir string) bool {
+	binDir = filepath.Clean(binDir)
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir != "" && filepath.Clean(dir) == binDir {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectShell returns the name of the user's login shell from $SHELL
+func DetectShell() string {
+	return filepath.Base(os.Getenv("SHELL"))
+}
+
+// ShellPathLine returns the line that adds the bin dir to PATH for a shell
+func (i *Installer) ShellPathLine(shell string) string {
+	if shell == "fish" {
+		return fmt.Sprintf("set -gx PATH %q $PATH", i.Paths.BinDir)
+	}
+	return fmt.Sprintf("export PATH=%q:\"$PATH\"", i.Paths.BinDir)
+}
+
+// EnvPaths returns the directories binrex installs into that shells
+// should search: the bin dir and install dirs for PATH, the man page dir
+// for MANPATH and the completion dirs of bash, zsh and fish
+func (i *Installer) EnvPaths() (path []string, manPath string, completions map[string]string) {
+	path = []string{filepath.Clean(i.Paths.BinDir)}
+	add := func(dir string) {
+		if dir != "" && !contains(path, filepath.Clean(dir)) {
+			path = append(path, filepath.Clean(dir))
+		}
+	}
+	if data, err := i.State.Load(); err == nil {
+		for _, pkg := range data.Installed {
+			add(pkg.InstallDir)
+		}
+	}
+	for _, dir := range i.Config.InstallDirs {
+		if resolved, err := i.Config.ResolveBinDir(dir); err == nil {
+			add(resolved)
+		}
+	}
+
+	dataHome := filepath.Dir(i.Paths.ApplicationsDir)
+	completions = map[string]string{
+		"bash": filepath.Join(dataHome, "bash-completion"),
+		"zsh":  filepath.Join(dataHome, "zsh", "site-functions"),
+		"fish": filepath.Join(dataHome, "fish", "vendor_completions.d"),
+	}
+	return path, filepath.Join(dataHome, "man"), completions
+}
+
+// ShellEnv returns the script that sets up a shell's environment for
+// binrex, for eval "$(binrex env)" in its startup file. Directories
+// already present are not added again, so it can run more than once.
+// Shells other than fish get POSIX sh.
+func (i *Installer) ShellEnv(shell string) string {
+	path, manPath, completions := i.EnvPaths()
+	var b strings.Builder
+
+	if shell == "fish" {
+		for n := len(path) - 1; n >= 0; n-- {
+			fmt.Fprintf(&b, "contains %q $PATH; or set -gx PATH %q $PATH\n", path[n], path[n])
+		}
+		// An empty entry keeps man's default path
+		b.WriteString("set -q MANPATH; or set -gx MANPATH \"\"\n")
+		fmt.Fprintf(&b, "contains %q $MANPATH; or set -gx MANPATH %q $MANPATH\n", manPath, manPath)
+		fmt.Fprintf(&b, "contains %q $fish_complete_path; or set -g fish_complete_path %q $fish_complete_path\n", completions["fish"], completions["fish"])
+		return b.String()
+	}
+
+	for n := len(path) - 1; n >= 0; n-- {
+		fmt.Fprintf(&b, "case \":$PATH:\" in *:%q:*) ;; *) export PATH=%q:\"$PATH\" ;; esac\n", path[n], path[n])
+	}
+	// The empty entry a trailing colon leaves keeps man's default path
+	fmt.Fprintf(&b, "case \":$MANPATH:\" in *:%q:*) ;; *) export MANPATH=%q:\"$MANPATH\" ;; esac\n", manPath, manPath)
+	switch shell {
+	case "bash":
+		fmt.Fprintf(&b, "export BASH_COMPLETION_USER_DIR=\"${BASH_COMPLETION_USER_DIR:-%s}\"\n", completions["bash"])
+	case "zsh":
+		fmt.Fprintf(&b, "fpath=(%q ${fpath:#%q})\n", completions["zsh"], completions["zsh"])
+	}
+	return b.String()
+}
+
+// ShellRCPath returns the rc file binrex appends to for a shell, or "" if
+// the shell isn't supported
+func ShellRCPath(shell string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not determine HOME directory: %w", err)
+	}
+
+	switch shell {
+	case "bash":
+		return filepath.Join(home, ".bashrc"), nil
+	case "zsh":
+		if zdotdir := os.Getenv("ZDOTDIR"); zdotdir != "" {
+			return filepath.Join(zdotdir, ".zshrc"), nil
+		}
+		return filepath.Join(home, ".zshrc"), nil
+	case "fish":
+		configHome := os.Getenv("XDG_CONFIG_HOME")
+		if !filepath.IsAbs(configHome) {
+			configHome = filepath.Join(home, ".config")
+		}
+		return filepath.Join(configHome, "fish", "conf.d", "binrex.fish"), nil
+	}
+	return "", nil
+}
+
+// InitShell appends the PATH line for shell to its rc file. Unsupported
+// shells get the line printed so the user can add it themselves.
+func (i *Installer) InitShell(shell string) error {
+	line := i.ShellPathLine(shell)
+
+	rcPath, err := ShellRCPath(shell)
+	if err != nil {
+		return err
+	}
+	if rcPath == "" {
+		i.printf("Don't know how to configure shell '%s'. Add this to its startup file:\n\n", shell)
+		i.printf("  %s\n", line)
+		return nil
+	}
+
+	existing, err := os.ReadFile(rcPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", rcPath, err)
+	}
+	if strings.Contains(string(existing), line) {
+		i.printf("✓ %s already adds %s to PATH\n", rcPath, i.Paths.BinDir)
+		return nil
+	}
+
+	if i.DryRun {
+		i.println("[dry-run] Planned actions:")
+		i.printf("  Would append to %s: %s\n", rcPath, line)
+		return nil
+	}
+
+	if !i.confirm(fmt.Sprintf("Add %s to PATH in %s?", i.Paths.BinDir, rcPath), true) {
+		return ErrAborted
+	}
+
+	if err := os.MkdirAll(filepath.Dir(rcPath), 0755); err != nil {
+		return fmt.Errorf("error creating %s: %w", filepath.Dir(rcPath), err)
+	}
+
+	f, err := os.OpenFile(rcPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", rcPath, err)
+	}
+	defer f.Close()
+
+	prefix := ""
+	if len(existing) > 0 {
+		prefix = "\n"
+		if !strings.HasSuffix(string(existing), "\n") {
+			prefix = "\n\n"
+		}
+	}
+	if _, err := fmt.Fprintf(f, "%s# Added by binrex\n%s\n", prefix, line); err != nil {
+		return fmt.Errorf("failed to write %s: %w", rcPath, err)
+	}
+
+	i.printf("✓ Added %s to PATH in %s\n", i.Paths.BinDir, rcPath)
+	i.println("  Open a new shell or source the file to pick it up.")
+	return nil
+}
+
+// warnIfNotOnPath tells the user how to reach freshly installed binaries
+func (i *Installer) warnIfNotOnPath(binDir string) {
+	if i.ephemeral || onPath(binDir) {
+		return
+	}
+	i.printf("\n⚠ %s is not on your PATH, so these binaries won't be found.\n", binDir)
+	if binDir == i.Paths.BinDir {
+		i.println("  Run 'binrex init-shell' to add it to your shell's rc file.")
+	}
+}
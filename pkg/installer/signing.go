@@ -0,0 +1,157 @@
+package installer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/nurysso/binrex/internal/fetch"
+	"github.com/nurysso/binrex/internal/fsutil"
+	"github.com/nurysso/binrex/pkg/manifest"
+)
+
+// verifySigned checks that the commit checked out in repoPath, or a tag
+// pointing at it, is signed by one of the package's signing_keys, and
+// returns the fingerprint of the key that signed it. Packages without
+// signing_keys are not checked.
+func (i *Installer) verifySigned(ctx context.Context, pkg *manifest.Package, repoPath string) (string, error) {
+	if len(pkg.SigningKeys) == 0 {
+		return "", nil
+	}
+	if !CheckToolExists("gpg") {
+		return "", fmt.Errorf("gpg is needed to verify the signature of %s", pkg.Name)
+	}
+
+	// A throwaway keyring holding only the package's keys
+	home, err := os.MkdirTemp("", "binrex-gpg-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(home)
+
+	var keys []string
+	for _, key := range pkg.SigningKeys {
+		fingerprint := manifest.NormalizeFingerprint(key)
+		keys = append(keys, fingerprint)
+		armored, err := i.signingKey(ctx, fingerprint)
+		if err == nil {
+			err = importKey(ctx, home, armored)
+		}
+		if err != nil {
+			i.eprintf("Warning: Can't get signing key %s: %v\n", fingerprint, err)
+		}
+	}
+
+	commit := getRepoCommit(repoPath)
+	var reasons []string
+	for _, tag := range tagsAt(ctx, repoPath) {
+		signer, reason := verifyRef(ctx, home, repoPath, "verify-tag", tag, keys)
+		if signer != "" {
+			i.printf("✓ Tag %s of %s is signed by %s\n", tag, pkg.Name, signer)
+			return signer, nil
+		}
+		reasons = append(reasons, fmt.Sprintf("tag %s %s", tag, reason))
+	}
+	signer, reason := verifyRef(ctx, home, repoPath, "verify-commit", "HEAD", keys)
+	if signer != "" {
+		i.printf("✓ Commit %s of %s is signed by %s\n", ShortCommit(commit), pkg.Name, signer)
+		return signer, nil
+	}
+	reasons = append(reasons, fmt.Sprintf("commit %s %s", ShortCommit(commit), reason))
+
+	return "", fmt.Errorf("%s is not signed by any of its signing_keys: %s", pkg.Name, strings.Join(reasons, ", "))
+}
+
+// verifyRef verifies the signature of a commit or tag with git and
+// returns the listed key that made it, or why there is none
+func verifyRef(ctx context.Context, home, repoPath, verify, ref string, keys []string) (string, string) {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "-c", "gpg.format=openpgp", "-c", "gpg.program=gpg", verify, "--raw", ref)
+	cmd.Env = append(os.Environ(), "GNUPGHOME="+home)
+	out, _ := cmd.CombinedOutput()
+
+	reason := "is not signed"
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(strings.TrimPrefix(line, "[GNUPG:] "))
+		if len(fields) < 2 || !strings.HasPrefix(line, "[GNUPG:] ") {
+			continue
+		}
+		switch fields[0] {
+		case "REVKEYSIG":
+			return "", "is signed by revoked key " + fields[1]
+		case "BADSIG":
+			return "", "has a bad signature"
+		case "ERRSIG", "NO_PUBKEY":
+			reason = "is signed by unknown key " + fields[1]
+		case "VALIDSIG":
+			// The signing (sub)key first, the primary key last
+			for _, fingerprint := range []string{fields[1], fields[len(fields)-1]} {
+				if slices.Contains(keys, fingerprint) {
+					return fingerprint, ""
+				}
+			}
+			reason = "is signed by unlisted key " + fields[1]
+		}
+	}
+	return "", reason
+}
+
+// tagsAt returns the tags pointing at the checked out commit
+func tagsAt(ctx context.Context, repoPath string) []string {
+	out, err := exec.CommandContext(ctx, "git", "-C", repoPath, "tag", "--points-at", "HEAD").Output()
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(out))
+}
+
+// signingKey returns the armored public key with a fingerprint, from the
+// key cache, the user's keyring or else the keyserver
+func (i *Installer) signingKey(ctx context.Context, fingerprint string) ([]byte, error) {
+	path := filepath.Join(filepath.Dir(i.Paths.CacheDir), "keys", fingerprint+".asc")
+	if data, err := os.ReadFile(path); err == nil {
+		return data, nil
+	}
+
+	if data, err := exec.CommandContext(ctx, "gpg", "--batch", "--no-tty", "--armor", "--export", fingerprint).Output(); err == nil && len(bytes.TrimSpace(data)) > 0 {
+		return data, nil
+	}
+
+	keyURL := i.Config.GetKeyserver() + "/pks/lookup?op=get&options=mr&search=0x" + url.QueryEscape(fingerprint)
+	data, err := fetch.Get(ctx, keyURL)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(data, []byte("BEGIN PGP PUBLIC KEY BLOCK")) {
+		return nil, fmt.Errorf("%s has no key %s", i.Config.GetKeyserver(), fingerprint)
+	}
+	// Whatever the keyserver returned only counts when it made a signature
+	// with the listed fingerprint, so caching it is safe
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+		fsutil.WriteFileAtomic(path, data, 0644)
+	}
+	return data, nil
+}
+
+// importKey imports an armored public key into the keyring at home
+func importKey(ctx context.Context, home string, armored []byte) error {
+	cmd := exec.CommandContext(ctx, "gpg", "--batch", "--no-tty", "--import")
+	cmd.Env = append(os.Environ(), "GNUPGHOME="+home)
+	cmd.Stdin = bytes.NewReader(armored)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// printSigningPlan prints the signature check of a package, for dry runs
+func (i *Installer) printSigningPlan(pkg *manifest.Package) {
+	if len(pkg.SigningKeys) > 0 {
+		i.printf("  Would verify the commit or its tag is signed by %s\n", strings.Join(pkg.SigningKeys, " or "))
+	}
+}
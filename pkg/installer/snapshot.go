@@ -0,0 +1,398 @@
+package installer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+	"github.com/nurysso/binrex/pkg/state"
+)
+
+// Snapshot is the installed set at one point in time, with the commit and
+// binary hashes of every package, so it can be restored later
+type Snapshot struct {
+	Name     string            `json:"name"`
+	Created  string            `json:"created"`
+	Packages []SnapshotPackage `json:"packages"`
+	Pins     map[string]string `json:"pins,omitempty"`
+}
+
+// SnapshotPackage is an installed.json entry along with the SHA256 of each
+// of its binaries, by bin dir entry name
+type SnapshotPackage struct {
+	state.InstalledPackage
+	SHA256 map[string]string `json:"sha256"`
+}
+
+// snapshotsDir keeps the snapshots next to installed.json
+func (i *Installer) snapshotsDir() string {
+	return filepath.Join(i.Paths.StateDir, "snapshots")
+}
+
+// snapshotPath returns the file of a named snapshot
+func (i *Installer) snapshotPath(name string) (string, error) {
+	if name == "" || !filepath.IsLocal(name) || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid snapshot name %q", name)
+	}
+	return filepath.Join(i.snapshotsDir(), name+".json"), nil
+}
+
+// binaryHashes returns the SHA256 of the binaries behind bin dir entries,
+// by entry name
+func binaryHashes(paths []string) map[string]string {
+	hashes := make(map[string]string)
+	for _, path := range paths {
+		if sum, err := fsutil.SHA256File(WrappedBinary(path)); err == nil {
+			hashes[filepath.Base(path)] = sum
+		}
+	}
+	return hashes
+}
+
+// CreateSnapshot records the installed packages under a name
+func (i *Installer) CreateSnapshot(name string) (*Snapshot, error) {
+	path, err := i.snapshotPath(name)
+	if err != nil {
+		return nil, err
+	}
+	if fsutil.FileExists(path) {
+		return nil, fmt.Errorf("snapshot %s already exists, delete it first", name)
+	}
+
+	data, err := i.State.Load()
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{
+		Name:    name,
+		Created: time.Now().Format(time.RFC3339),
+		Pins:    data.Pins,
+	}
+	for _, pkg := range data.Installed {
+		snapshot.Packages = append(snapshot.Packages, SnapshotPackage{
+			InstalledPackage: pkg,
+			SHA256:           binaryHashes(pkg.BinaryPaths),
+		})
+	}
+
+	if i.DryRun {
+		i.printf("  Would record %d package(s) in %s\n", len(snapshot.Packages), path)
+		return snapshot, nil
+	}
+	jsonData, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(i.snapshotsDir(), 0755); err != nil {
+		return nil, fmt.Errorf("error creating %s: %w", i.snapshotsDir(), err)
+	}
+	if err := fsutil.WriteFileAtomic(path, jsonData, 0644); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// LoadSnapshot reads a named snapshot
+func (i *Installer) LoadSnapshot(name string) (*Snapshot, error) {
+	path, err := i.snapshotPath(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no snapshot named %s", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &snapshot, nil
+}
+
+// Snapshots lists the snapshots, oldest first
+func (i *Installer) Snapshots() ([]Snapshot, error) {
+	paths, err := filepath.Glob(filepath.Join(i.snapshotsDir(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []Snapshot
+	for _, path := range paths {
+		snapshot, err := i.LoadSnapshot(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			i.eprintf("Warning: %v\n", err)
+			continue
+		}
+		snapshots = append(snapshots, *snapshot)
+	}
+	sort.SliceStable(snapshots, func(a, b int) bool { return snapshots[a].Created < snapshots[b].Created })
+	return snapshots, nil
+}
+
+// DeleteSnapshot deletes a named snapshot
+func (i *Installer) DeleteSnapshot(name string) error {
+	path, err := i.snapshotPath(name)
+	if err != nil {
+		return err
+	}
+	if !fsutil.FileExists(path) {
+		return fmt.Errorf("no snapshot named %s", name)
+	}
+	if i.DryRun {
+		i.printf("  Would delete: %s\n", path)
+		return nil
+	}
+	return os.Remove(path)
+}
+
+// Ways RestoreSnapshot brings back a package
+const (
+	restoreUnchanged = iota
+	restoreRelink
+	restoreBuild
+)
+
+// restoreAction decides how a snapshot's package comes back: it is already
+// installed as recorded, its version is still in the store, or it has to
+// be built again
+func (i *Installer) restoreAction(current *state.InstalledPackage, pkg SnapshotPackage) int {
+	if current != nil && current.Version == pkg.Version && current.Commit == pkg.Commit &&
+		hashesMatch(binaryHashes(current.BinaryPaths), pkg.SHA256) {
+		return restoreUnchanged
+	}
+
+	if i.storeEntryWith(pkg.Name, pkg.Version, pkg.SHA256) != "" {
+		return restoreRelink
+	}
+	return restoreBuild
+}
+
+// hashesMatch reports whether two sets of binary hashes are the same
+func hashesMatch(got, want map[string]string) bool {
+	if len(got) != len(want) || len(want) == 0 {
+		return false
+	}
+	for binary, sum := range want {
+		if got[binary] != sum {
+			return false
+		}
+	}
+	return true
+}
+
+// RestoreSnapshot returns the installed set to a snapshot: packages not in
+// it are removed, versions still in the store are linked back in and the
+// rest are rebuilt from their recorded commits.
+func (i *Installer) RestoreSnapshot(ctx context.Context, name string) error {
+	snapshot, err := i.LoadSnapshot(name)
+	if err != nil {
+		return err
+	}
+	data, err := i.State.Load()
+	if err != nil {
+		return err
+	}
+
+	var extra, relink, build []string
+	wanted := make(map[string]bool)
+	for _, pkg := range snapshot.Packages {
+		wanted[pkg.Name] = true
+		switch i.restoreAction(data.Find(pkg.Name), pkg) {
+		case restoreRelink:
+			relink = append(relink, pkg.Name)
+		case restoreBuild:
+			build = append(build, pkg.Name)
+		}
+	}
+	for _, pkg := range data.Installed {
+		if !wanted[pkg.Name] {
+			extra = append(extra, pkg.Name)
+		}
+	}
+
+	if len(extra)+len(relink)+len(build) == 0 {
+		i.printf("✓ Already matches snapshot %s\n", name)
+		return i.restorePins(snapshot)
+	}
+
+	i.printf("Restoring snapshot %s from %s:\n", name, snapshot.Created)
+	for _, pkg := range snapshot.Packages {
+		switch {
+		case contains(relink, pkg.Name):
+			i.printf("  ~ %s %s (from the store)\n", pkg.Name, pkg.Version)
+		case contains(build, pkg.Name):
+			i.printf("  + %s %s (build %s)\n", pkg.Name, pkg.Version, ShortCommit(pkg.Commit))
+		}
+	}
+	for _, pkg := range extra {
+		i.printf("  - %s\n", pkg)
+	}
+	if i.DryRun {
+		return nil
+	}
+	if !i.confirm("\nRestore this snapshot?", false) {
+		i.println("Restore aborted.")
+		return ErrAborted
+	}
+
+	var failed []string
+	var errs []error
+	for _, pkg := range extra {
+		i.println()
+		err := i.remove(ctx, pkg, true)
+		i.recordHistory("remove", pkg, "", err)
+		if err != nil {
+			failed = append(failed, pkg)
+			errs = append(errs, err)
+		}
+	}
+	for _, pkg := range snapshot.Packages {
+		if !contains(relink, pkg.Name) && !contains(build, pkg.Name) {
+			continue
+		}
+		i.println()
+		var err error
+		if contains(relink, pkg.Name) {
+			err = i.relinkSnapshot(pkg)
+		} else {
+			err = i.rebuildSnapshot(ctx, pkg)
+		}
+		i.recordHistory("restore", pkg.Name, i.installedVersion(pkg.Name), err)
+		if err != nil {
+			i.eprintf("✗ Failed to restore %s: %v\n", pkg.Name, err)
+			failed = append(failed, pkg.Name)
+			errs = append(errs, err)
+			continue
+		}
+		if current := i.State.Get(pkg.Name); current != nil && !hashesMatch(binaryHashes(current.BinaryPaths), pkg.SHA256) {
+			i.eprintf("Warning: %s was rebuilt but its binaries differ from the snapshot\n", pkg.Name)
+		}
+	}
+
+	if err := i.restorePins(snapshot); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return &batchError{fmt.Sprintf("failed to restore %s", strings.Join(failed, ", ")), errs}
+	}
+	i.printf("\n✓ Restored snapshot %s\n", name)
+	return nil
+}
+
+// restorePins brings back the pins a snapshot was taken with
+func (i *Installer) restorePins(snapshot *Snapshot) error {
+	if i.DryRun {
+		return nil
+	}
+	data, err := i.State.Load()
+	if err != nil {
+		return err
+	}
+	data.Pins = snapshot.Pins
+	return i.State.Save(data)
+}
+
+// relinkSnapshot points a package's bin dir entries back at its snapshot
+// version in the store and records its snapshot entry. Like use, it keeps
+// the desktop entries and services of an installed version.
+func (i *Installer) relinkSnapshot(pkg SnapshotPackage) error {
+	i.printf("Linking %s %s from the store...\n", pkg.Name, pkg.Version)
+	data, err := i.State.Load()
+	if err != nil {
+		return err
+	}
+
+	entry := pkg.InstalledPackage
+	entry.DesktopFiles, entry.IconPaths, entry.ServiceUnits = nil, nil, nil
+	current := data.Find(pkg.Name)
+	if current != nil {
+		for _, binaryPath := range current.BinaryPaths {
+			if err := os.Remove(binaryPath); err != nil && !os.IsNotExist(err) {
+				i.eprintf("Error removing binary %s: %v\n", binaryPath, err)
+			}
+		}
+		entry.DesktopFiles, entry.IconPaths, entry.ServiceUnits = current.DesktopFiles, current.IconPaths, current.ServiceUnits
+	}
+
+	binDir := i.Paths.BinDir
+	if entry.InstallDir != "" {
+		binDir = entry.InstallDir
+	}
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		return fmt.Errorf("error creating %s: %w", binDir, err)
+	}
+
+	binaries := make([]string, 0, len(pkg.SHA256))
+	for binary := range pkg.SHA256 {
+		binaries = append(binaries, binary)
+	}
+	sort.Strings(binaries)
+
+	dir := i.storeEntryWith(pkg.Name, pkg.Version, pkg.SHA256)
+	if dir == "" {
+		return fmt.Errorf("%s %s is no longer in the store", pkg.Name, pkg.Version)
+	}
+	entry.BinaryPaths = nil
+	entry.StorePath = dir
+	for _, binary := range binaries {
+		link := filepath.Join(binDir, binary)
+		if err := linkEntry(dir, binary, link); err != nil {
+			return fmt.Errorf("failed to link %s: %w", link, err)
+		}
+		entry.BinaryPaths = append(entry.BinaryPaths, link)
+		i.printf("  ✓ Linked: %s\n", link)
+	}
+	entry.TotalBinaries = len(entry.BinaryPaths)
+
+	if current != nil {
+		*current = entry
+	} else {
+		data.Installed = append(data.Installed, entry)
+	}
+	if err := i.State.Save(data); err != nil {
+		return fmt.Errorf("failed to update installed.json: %w", err)
+	}
+	i.registerProvides(pkg.Name)
+	return nil
+}
+
+// rebuildSnapshot builds a package again from the commit its snapshot
+// entry records, or downloads it again when it was not built
+func (i *Installer) rebuildSnapshot(ctx context.Context, pkg SnapshotPackage) error {
+	if i.State.IsInstalled(pkg.Name) {
+		if err := i.remove(ctx, pkg.Name, true); err != nil {
+			return err
+		}
+	}
+
+	opts := InstallOptions{
+		InstallDir: pkg.InstallDir,
+		Aliases:    pkg.BinaryAliases,
+		Constraint: pkg.Constraint,
+		Commit:     pkg.Commit,
+		Version:    pkg.Version,
+		FromSource: pkg.Commit != "",
+	}
+	if pkg.Unmanaged {
+		opts.BuildCommand = pkg.BuildCommands
+		opts.BuildDir = pkg.BuildDir
+		return i.installGit(ctx, pkg.RepoURL, opts)
+	}
+
+	err := i.install(ctx, pkg.Name, opts)
+	if err == nil && !i.State.IsInstalled(pkg.Name) {
+		err = errors.New("it was not installed")
+	}
+	return err
+}
@@ -0,0 +1,196 @@
+package installer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/nurysso/binrex/internal/fetch"
+	"github.com/nurysso/binrex/internal/fsutil"
+)
+
+// Key types a manifest source can be signed with
+const (
+	KeyGPG      = "gpg"
+	KeyMinisign = "minisign"
+)
+
+// Source is a configured manifest URL and the key its signature is
+// checked with, if any
+type Source struct {
+	URL     string `json:"url"`
+	KeyType string `json:"key_type,omitempty"`
+	KeyPath string `json:"key_path,omitempty"`
+}
+
+// keysDir holds the keys added with TrustSource
+func (i *Installer) keysDir() string {
+	return filepath.Join(i.Paths.ConfigDir, "keys")
+}
+
+// trustedKeyPath returns where TrustSource keeps the key of a manifest URL
+func (i *Installer) trustedKeyPath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(i.keysDir(), hex.EncodeToString(sum[:8])+".key")
+}
+
+// sourceKey returns the key file a manifest URL is signed with, from the
+// config's source_keys or the trusted keys, or "" for unsigned sources
+func (i *Installer) sourceKey(url string) string {
+	if path := i.Config.SourceKeys[url]; path != "" {
+		if rest, ok := strings.CutPrefix(path, "~/"); ok {
+			if home, err := os.UserHomeDir(); err == nil {
+				path = filepath.Join(home, rest)
+			}
+		}
+		return path
+	}
+	if path := i.trustedKeyPath(url); fsutil.FileExists(path) {
+		return path
+	}
+	return ""
+}
+
+// keyType tells minisign public keys from GPG ones
+func keyType(key []byte) string {
+	for _, line := range strings.Split(string(key), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.Contains(line, "minisign public key") || (len(line) == 56 && strings.HasPrefix(line, "RW")) {
+			return KeyMinisign
+		}
+	}
+	return KeyGPG
+}
+
+// Sources lists the configured manifest URLs with their keys
+func (i *Installer) Sources() []Source {
+	var sources []Source
+	for _, url := range i.Config.GetManifestURLs() {
+		source := Source{URL: url}
+		if path := i.sourceKey(url); path != "" {
+			source.KeyPath = path
+			if key, err := os.ReadFile(path); err == nil {
+				source.KeyType = keyType(key)
+			}
+		}
+		sources = append(sources, source)
+	}
+	return sources
+}
+
+// TrustSource stores the public key a manifest URL's signature must verify
+// with. From then on sync rejects the URL's manifest without a valid
+// signature.
+func (i *Installer) TrustSource(url, keyFile string) (*Source, error) {
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	if len(bytes.TrimSpace(key)) == 0 {
+		return nil, fmt.Errorf("%s is empty", keyFile)
+	}
+
+	path := i.trustedKeyPath(url)
+	if i.DryRun {
+		i.printf("  Would store %s key for %s in %s\n", keyType(key), url, path)
+		return &Source{URL: url, KeyType: keyType(key), KeyPath: path}, nil
+	}
+	if err := os.MkdirAll(i.keysDir(), 0755); err != nil {
+		return nil, fmt.Errorf("error creating %s: %w", i.keysDir(), err)
+	}
+	if err := fsutil.WriteFileAtomic(path, key, 0644); err != nil {
+		return nil, fmt.Errorf("failed to store key: %w", err)
+	}
+	return &Source{URL: url, KeyType: keyType(key), KeyPath: path}, nil
+}
+
+// UntrustSource removes the stored key of a manifest URL
+func (i *Installer) UntrustSource(url string) error {
+	path := i.trustedKeyPath(url)
+	if !fsutil.FileExists(path) {
+		if i.Config.SourceKeys[url] != "" {
+			return fmt.Errorf("the key of %s is set in config.json's source_keys", url)
+		}
+		return fmt.Errorf("no key stored for %s", url)
+	}
+	if i.DryRun {
+		i.printf("  Would delete: %s\n", path)
+		return nil
+	}
+	return os.Remove(path)
+}
+
+// verifySource checks a manifest file downloaded from url against the
+// signature published next to it, url.asc for GPG keys and url.minisig for
+// minisign, using the key of the manifest source it belongs to. Sources
+// without a key pass unchecked.
+func (i *Installer) verifySource(ctx context.Context, source, url string, data []byte, quiet bool) error {
+	keyPath := i.sourceKey(source)
+	if keyPath == "" {
+		return nil
+	}
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read the key of %s: %w", url, err)
+	}
+
+	kind := keyType(key)
+	sigURL := url + ".asc"
+	if kind == KeyMinisign {
+		sigURL = url + ".minisig"
+	}
+	sig, err := fetch.Get(ctx, sigURL)
+	if err != nil {
+		return fmt.Errorf("%s is signed but its signature is unavailable: %w", url, err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "binrex-verify-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dataPath := filepath.Join(tmpDir, "manifest.json")
+	sigPath := filepath.Join(tmpDir, "manifest.json.sig")
+	if err := os.WriteFile(dataPath, data, 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(sigPath, sig, 0644); err != nil {
+		return err
+	}
+
+	var out []byte
+	if kind == KeyMinisign {
+		if !CheckToolExists("minisign") {
+			return fmt.Errorf("minisign is needed to verify %s", url)
+		}
+		out, err = exec.CommandContext(ctx, "minisign", "-V", "-q", "-p", keyPath, "-m", dataPath, "-x", sigPath).CombinedOutput()
+	} else {
+		if !CheckToolExists("gpg") {
+			return fmt.Errorf("gpg is needed to verify %s", url)
+		}
+		// A throwaway keyring holding only this source's key
+		gpg := func(args ...string) ([]byte, error) {
+			cmd := exec.CommandContext(ctx, "gpg", append([]string{"--batch", "--no-tty"}, args...)...)
+			cmd.Env = append(os.Environ(), "GNUPGHOME="+tmpDir)
+			return cmd.CombinedOutput()
+		}
+		if out, err = gpg("--import", keyPath); err == nil {
+			out, err = gpg("--verify", sigPath, dataPath)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("signature of %s does not verify with %s:\n%s", url, keyPath, strings.TrimSpace(string(out)))
+	}
+
+	if !quiet {
+		i.printf("✓ Signature of %s verified (%s)\n", url, kind)
+	}
+	return nil
+}
@@ -0,0 +1,675 @@
+package installer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+	"github.com/nurysso/binrex/pkg/manifest"
+)
+
+// storeEntryFile names the description every store entry keeps of itself
+const storeEntryFile = ".binrex-entry.json"
+
+// stagingPrefix starts the names of store entries still being written
+const stagingPrefix = ".staging-"
+
+// StoreEntry is one built version of a package kept in the store. Its
+// directory is named <name>-<version>-<hash>, the hash covering its
+// binaries, libraries and runtime environment, so identical builds share
+// an entry and an entry never changes once written.
+type StoreEntry struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Hash    string `json:"hash"`
+	// LastUsed is when the entry was last installed or switched to
+	LastUsed time.Time `json:"last_used"`
+	Path     string    `json:"-"`
+}
+
+// storeVersionName turns a version into a store directory name
+func storeVersionName(version string) string {
+	if version == "" {
+		return "unversioned"
+	}
+	return strings.NewReplacer("/", "_", "\\", "_").Replace(version)
+}
+
+// storeEntryDir returns where the store keeps a version with a hash. An
+// empty hash gives the placeholder dry runs print.
+func (i *Installer) storeEntryDir(name, version, hash string) string {
+	if hash == "" {
+		hash = "<hash>"
+	} else if len(hash) > 12 {
+		hash = hash[:12]
+	}
+	return filepath.Join(i.Paths.StoreDir, fmt.Sprintf("%s-%s-%s", name, storeVersionName(version), hash))
+}
+
+// readStoreEntry reads the description of the store entry at dir
+func readStoreEntry(dir string) (*StoreEntry, error) {
+	data, err := os.ReadFile(filepath.Join(dir, storeEntryFile))
+	if err != nil {
+		return nil, err
+	}
+	var entry StoreEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", filepath.Join(dir, storeEntryFile), err)
+	}
+	entry.Path = dir
+	return &entry, nil
+}
+
+// writeStoreEntry writes the description of a store entry into it
+func writeStoreEntry(entry *StoreEntry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(filepath.Join(entry.Path, storeEntryFile), append(data, '\n'), 0644)
+}
+
+// StoreEntries lists the entries in the store, only those of one package
+// unless name is "", by name and then least recently used first
+func (i *Installer) StoreEntries(name string) ([]StoreEntry, error) {
+	dirs, err := os.ReadDir(i.Paths.StoreDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var entries []StoreEntry
+	for _, dir := range dirs {
+		if !dir.IsDir() || strings.HasPrefix(dir.Name(), stagingPrefix) {
+			continue
+		}
+		entry, err := readStoreEntry(filepath.Join(i.Paths.StoreDir, dir.Name()))
+		if err != nil || (name != "" && entry.Name != name) {
+			continue
+		}
+		entries = append(entries, *entry)
+	}
+	sort.SliceStable(entries, func(a, b int) bool {
+		if entries[a].Name != entries[b].Name {
+			return entries[a].Name < entries[b].Name
+		}
+		return entries[a].LastUsed.Before(entries[b].LastUsed)
+	})
+	return entries, nil
+}
+
+// storeEntry returns the most recently used store entry holding a version
+// of a package, nil when there is none
+func (i *Installer) storeEntry(name, version string) *StoreEntry {
+	entries, _ := i.StoreEntries(name)
+	for n := len(entries) - 1; n >= 0; n-- {
+		if entries[n].Version == version {
+			return &entries[n]
+		}
+	}
+	return nil
+}
+
+// storeEntryWith returns the store entry of a version whose binaries have
+// the given hashes, "" when there is none
+func (i *Installer) storeEntryWith(name, version string, sums map[string]string) string {
+	entries, _ := i.StoreEntries(name)
+	for n := len(entries) - 1; n >= 0; n-- {
+		if entries[n].Version != version {
+			continue
+		}
+		stored := make(map[string]string)
+		for binary := range sums {
+			if sum, err := fsutil.SHA256File(filepath.Join(entries[n].Path, binary)); err == nil {
+				stored[binary] = sum
+			}
+		}
+		if hashesMatch(stored, sums) {
+			return entries[n].Path
+		}
+	}
+	return ""
+}
+
+// storeEntryOf returns the store entry the bin dir entries of a package
+// point into, "" when they point elsewhere
+func (i *Installer) storeEntryOf(binaryPaths []string) string {
+	for _, path := range binaryPaths {
+		target := WrappedBinary(path)
+		if target == path {
+			if link, err := os.Readlink(path); err == nil {
+				target = link
+			}
+		}
+		dir := filepath.Dir(target)
+		if filepath.Dir(dir) == filepath.Clean(i.Paths.StoreDir) {
+			return dir
+		}
+	}
+	return ""
+}
+
+// InstalledVersions lists the versions of a package kept in the store
+func (i *Installer) InstalledVersions(name string) ([]string, error) {
+	entries, err := i.StoreEntries(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, entry := range entries {
+		if !contains(versions, entry.Version) {
+			versions = append(versions, entry.Version)
+		}
+	}
+	sort.Strings(versions)
+	return versions, nil
+}
+
+// contentHash hashes a store entry's files, leaving out its description
+// and wrapper scripts as they name the entry's own path, and the runtime
+// environment the wrappers set up
+func contentHash(dir string, env map[string]string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		if rel == storeEntryFile || rel == filepath.Base(wrappersDir(dir)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		switch {
+		case d.IsDir():
+			fmt.Fprintf(h, "dir %s\n", rel)
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "link %s %s\n", rel, target)
+		default:
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			sum, err := fsutil.SHA256File(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "file %s %t %s\n", rel, info.Mode()&0111 != 0, sum)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "env %s=%s\n", name, env[name])
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// stageStoreEntry creates an empty directory in the store to stage a new
+// entry in. commitStoreEntry moves it into place.
+func (i *Installer) stageStoreEntry() (string, error) {
+	if err := os.MkdirAll(i.Paths.StoreDir, 0755); err != nil {
+		return "", fmt.Errorf("error creating %s: %w", i.Paths.StoreDir, err)
+	}
+	dir, err := os.MkdirTemp(i.Paths.StoreDir, stagingPrefix)
+	if err != nil {
+		return "", err
+	}
+	return dir, os.Chmod(dir, 0755)
+}
+
+// commitStoreEntry moves a staged entry to its content-addressed place
+// and returns that. When the store already has an identical entry the
+// staged one is dropped and the existing one used instead.
+func (i *Installer) commitStoreEntry(staging string, pkg *manifest.Package) (string, error) {
+	hash, err := contentHash(staging, pkg.Env)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", staging, err)
+	}
+	entry := &StoreEntry{
+		Name:     pkg.Name,
+		Version:  pkg.Version,
+		Hash:     hash,
+		LastUsed: time.Now(),
+		Path:     i.storeEntryDir(pkg.Name, pkg.Version, hash),
+	}
+
+	if fsutil.FileExists(entry.Path) {
+		os.RemoveAll(staging)
+		i.printf("Reusing identical store entry %s\n", entry.Path)
+	} else if err := os.Rename(staging, entry.Path); err != nil {
+		return "", err
+	}
+	if err := writeStoreEntry(entry); err != nil {
+		return "", err
+	}
+	return entry.Path, nil
+}
+
+// stageBinary copies a built binary into a staged store entry
+func (i *Installer) stageBinary(src, staging, name string) error {
+	stored := filepath.Join(staging, name)
+	if err := fsutil.CopyFile(src, stored); err != nil {
+		return err
+	}
+	if err := os.Chmod(stored, 0755); err != nil {
+		i.eprintf("Warning: Failed to make %s executable: %v\n", name, err)
+	}
+	i.prepareForGatekeeper(stored, i.Config.Codesign)
+	if problem := checkExecutable(stored); problem != "" {
+		i.eprintf("Warning: %s %s, the build output may be wrong\n", name, problem)
+	}
+	return nil
+}
+
+// linkStored points the entry in binDir at a binary of a store entry, or
+// at its wrapper script, returning the entry's path
+func linkStored(entryDir, binDir, name string) (string, error) {
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		return "", fmt.Errorf("error creating %s: %w", binDir, err)
+	}
+	dst := filepath.Join(binDir, name)
+	if err := linkEntry(entryDir, name, dst); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// linkBinary replaces link with a symlink to target, falling back to a
+// copy where symlinks aren't available
+func linkBinary(target, link string) error {
+	return replaceEntry(link, func(tmp string) error {
+		if err := os.Symlink(target, tmp); err != nil {
+			return copyExecutable(target, tmp)
+		}
+		return nil
+	})
+}
+
+// replaceEntry creates a bin dir entry next to link and renames it over
+// link, so the command never goes missing while an update swaps it
+func replaceEntry(link string, create func(tmp string) error) error {
+	tmp := link + ".binrex-new"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := create(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// copyExecutable copies src to dst and makes it executable
+func copyExecutable(src, dst string) error {
+	if err := fsutil.CopyFile(src, dst); err != nil {
+		return err
+	}
+	return os.Chmod(dst, 0755)
+}
+
+// Use switches an installed package's bin dir entries to another version
+// kept in the store
+func (i *Installer) Use(ctx context.Context, name, version string) error {
+	err := i.use(name, version)
+	i.recordHistory("use", name, version, err)
+	return err
+}
+
+func (i *Installer) use(name, version string) error {
+	if !i.State.IsInstalled(name) {
+		i.eprintf("Package '%s' is not installed\n", name)
+		return ErrNotInstalled
+	}
+
+	entry := i.storeEntry(name, version)
+	if entry == nil {
+		versions, _ := i.InstalledVersions(name)
+		i.eprintf("Error: Version '%s' of %s is not in the store\n", version, name)
+		if len(versions) > 0 {
+			i.eprintf("Available versions: %s\n", strings.Join(versions, ", "))
+		}
+		return fmt.Errorf("version not installed")
+	}
+	return i.useEntry(entry)
+}
+
+// Rollback switches an installed package back to the store entry it used
+// before the current one
+func (i *Installer) Rollback(ctx context.Context, name string) error {
+	err := i.rollback(name)
+	i.recordHistory("rollback", name, i.installedVersion(name), err)
+	return err
+}
+
+func (i *Installer) rollback(name string) error {
+	pkg := i.State.Get(name)
+	if pkg == nil {
+		i.eprintf("Package '%s' is not installed\n", name)
+		return ErrNotInstalled
+	}
+	current := pkg.StorePath
+	if current == "" {
+		current = i.storeEntryOf(pkg.BinaryPaths)
+	}
+
+	entries, err := i.StoreEntries(name)
+	if err != nil {
+		return err
+	}
+	for n := len(entries) - 1; n >= 0; n-- {
+		if entries[n].Path != current {
+			return i.useEntry(&entries[n])
+		}
+	}
+	return fmt.Errorf("the store has no other version of %s to roll back to", name)
+}
+
+// useEntry points an installed package's bin dir entries at a store entry
+func (i *Installer) useEntry(entry *StoreEntry) error {
+	installedData, err := i.State.Load()
+	if err != nil {
+		return err
+	}
+	pkg := installedData.Find(entry.Name)
+	if pkg == nil {
+		i.eprintf("Package '%s' is not installed\n", entry.Name)
+		return ErrNotInstalled
+	}
+
+	current := pkg.StorePath
+	if current == "" {
+		current = i.storeEntryOf(pkg.BinaryPaths)
+	}
+	if current == entry.Path && pkg.DevPath == "" {
+		i.printf("Already using %s %s\n", entry.Name, entry.Version)
+		return nil
+	}
+
+	files, err := os.ReadDir(entry.Path)
+	if err != nil {
+		return err
+	}
+	var binaries []string
+	for _, file := range files {
+		if !file.IsDir() && file.Name() != storeEntryFile {
+			binaries = append(binaries, file.Name())
+		}
+	}
+
+	binDir := i.Paths.BinDir
+	if pkg.InstallDir != "" {
+		binDir = pkg.InstallDir
+	}
+
+	if i.DryRun {
+		i.println("[dry-run] Planned actions:")
+		for _, binaryPath := range pkg.BinaryPaths {
+			if !contains(binaries, filepath.Base(binaryPath)) {
+				i.printf("  Would delete: %s\n", binaryPath)
+			}
+		}
+		for _, binary := range binaries {
+			i.printf("  Would link: %s -> %s\n", filepath.Join(binDir, binary), filepath.Join(entry.Path, binary))
+		}
+		i.printf("  Would record %s %s in %s\n", entry.Name, entry.Version, i.Paths.InstalledPath)
+		return nil
+	}
+
+	// Drop entries the new version doesn't ship
+	for _, binaryPath := range pkg.BinaryPaths {
+		if contains(binaries, filepath.Base(binaryPath)) {
+			continue
+		}
+		if err := os.Remove(binaryPath); err != nil && !os.IsNotExist(err) {
+			i.eprintf("Error removing binary %s: %v\n", binaryPath, err)
+		}
+	}
+
+	var binaryPaths []string
+	for _, binary := range binaries {
+		link := filepath.Join(binDir, binary)
+		if err := linkEntry(entry.Path, binary, link); err != nil {
+			i.eprintf("Error: Failed to link %s: %v\n", link, err)
+			return err
+		}
+		binaryPaths = append(binaryPaths, link)
+		i.printf("  ✓ Linked: %s\n", link)
+	}
+
+	pkg.Version = entry.Version
+	pkg.BinaryPaths = binaryPaths
+	pkg.TotalBinaries = len(binaryPaths)
+	pkg.StorePath = entry.Path
+	pkg.DevPath = ""
+	i.trackFiles("use", pkg)
+	if err := i.State.Save(installedData); err != nil {
+		return fmt.Errorf("failed to update installed.json: %w", err)
+	}
+	entry.LastUsed = time.Now()
+	if err := writeStoreEntry(entry); err != nil {
+		i.eprintf("Warning: Failed to update %s: %v\n", entry.Path, err)
+	}
+
+	i.printf("\n✓ Now using %s %s from %s\n", entry.Name, entry.Version, entry.Path)
+	return nil
+}
+
+// storeRoots returns the store entries that must stay: those of the
+// installed packages and those snapshots would link back in
+func (i *Installer) storeRoots() (map[string]bool, error) {
+	installedData, err := i.State.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	roots := make(map[string]bool)
+	for _, pkg := range installedData.Installed {
+		if pkg.StorePath != "" {
+			roots[filepath.Clean(pkg.StorePath)] = true
+		}
+		if dir := i.storeEntryOf(pkg.BinaryPaths); dir != "" {
+			roots[dir] = true
+		}
+	}
+
+	snapshots, err := i.Snapshots()
+	if err != nil {
+		return nil, err
+	}
+	for _, snapshot := range snapshots {
+		for _, pkg := range snapshot.Packages {
+			if dir := i.storeEntryWith(pkg.Name, pkg.Version, pkg.SHA256); dir != "" {
+				roots[dir] = true
+			}
+		}
+	}
+	return roots, nil
+}
+
+// GC deletes the store entries no installed package or snapshot uses, and
+// entries left half-written by interrupted installs
+func (i *Installer) GC(ctx context.Context) (*PruneResult, error) {
+	roots, err := i.storeRoots()
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := os.ReadDir(i.Paths.StoreDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", i.Paths.StoreDir, err)
+	}
+
+	var targets []string
+	for _, dir := range dirs {
+		path := filepath.Join(i.Paths.StoreDir, dir.Name())
+		if !dir.IsDir() || roots[path] {
+			continue
+		}
+		if strings.HasPrefix(dir.Name(), stagingPrefix) || fsutil.FileExists(filepath.Join(path, storeEntryFile)) {
+			targets = append(targets, path)
+		}
+	}
+
+	result := &PruneResult{}
+	if i.DryRun && len(targets) > 0 {
+		i.println("[dry-run] Planned actions:")
+	}
+	for _, path := range targets {
+		size := dirSize(path)
+		if i.DryRun {
+			i.printf("  Would delete: %s (%s)\n", path, fsutil.FormatBytes(size))
+		} else {
+			if err := os.RemoveAll(path); err != nil {
+				i.eprintf("Error removing %s: %v\n", path, err)
+				continue
+			}
+			i.printf("  ✓ Removed: %s (%s)\n", path, fsutil.FormatBytes(size))
+		}
+		result.Removed = append(result.Removed, path)
+		result.Reclaimed += size
+	}
+	return result, nil
+}
+
+// removeStoreEntries deletes every store entry of a package
+func (i *Installer) removeStoreEntries(name string) {
+	entries, _ := i.StoreEntries(name)
+	for _, entry := range entries {
+		if err := os.RemoveAll(entry.Path); err != nil {
+			i.eprintf("Error removing %s: %v\n", entry.Path, err)
+		}
+	}
+}
+
+// migrateStore moves the versions of the store layout before content
+// addressing, <name>/<version>/, to entries of their own and points the
+// installed packages' bin dir entries at them
+func (i *Installer) migrateStore() error {
+	dirs, err := os.ReadDir(i.Paths.StoreDir)
+	if err != nil {
+		return nil
+	}
+	installedData, err := i.State.Load()
+	if err != nil {
+		return err
+	}
+
+	moved := false
+	for _, dir := range dirs {
+		pkgDir := filepath.Join(i.Paths.StoreDir, dir.Name())
+		if !dir.IsDir() || strings.HasPrefix(dir.Name(), stagingPrefix) || fsutil.FileExists(filepath.Join(pkgDir, storeEntryFile)) {
+			continue
+		}
+		versions, err := os.ReadDir(pkgDir)
+		if err != nil {
+			continue
+		}
+
+		pkg := installedData.Find(dir.Name())
+		for _, version := range versions {
+			if !version.IsDir() {
+				continue
+			}
+			from := filepath.Join(pkgDir, version.Name())
+			entry := &StoreEntry{Name: dir.Name(), Version: version.Name(), LastUsed: time.Now()}
+			if pkg != nil && storeVersionName(pkg.Version) == version.Name() {
+				entry.Version = pkg.Version
+			}
+			if entry.Hash, err = contentHash(from, nil); err != nil {
+				return err
+			}
+			entry.Path = i.storeEntryDir(entry.Name, entry.Version, entry.Hash)
+			if err := os.Rename(from, entry.Path); err != nil {
+				return fmt.Errorf("failed to move %s to %s: %w", from, entry.Path, err)
+			}
+			if err := writeStoreEntry(entry); err != nil {
+				return err
+			}
+			i.eprintf("Moved %s to %s\n", from, entry.Path)
+			moved = true
+
+			if err := relinkMoved(wrapperPaths(entry.Path), from, entry.Path); err != nil {
+				return err
+			}
+			if pkg != nil && i.storeEntryOf(pkg.BinaryPaths) == "" {
+				if err := relinkMoved(pkg.BinaryPaths, from, entry.Path); err != nil {
+					return err
+				}
+				if i.storeEntryOf(pkg.BinaryPaths) == entry.Path {
+					pkg.StorePath = entry.Path
+				}
+			}
+		}
+		os.Remove(pkgDir)
+	}
+
+	if !moved {
+		return nil
+	}
+	return i.State.Save(installedData)
+}
+
+// wrapperPaths returns the wrapper scripts kept in a store entry
+func wrapperPaths(dir string) []string {
+	paths, _ := filepath.Glob(filepath.Join(wrappersDir(dir), "*"))
+	return paths
+}
+
+// relinkMoved points symlinks and wrapper scripts into a moved store
+// directory at its new location
+func relinkMoved(paths []string, from, to string) error {
+	for _, path := range paths {
+		if target, err := os.Readlink(path); err == nil {
+			if strings.HasPrefix(target, from+string(filepath.Separator)) {
+				if err := linkBinary(to+strings.TrimPrefix(target, from), path); err != nil {
+					return fmt.Errorf("failed to relink %s: %w", path, err)
+				}
+			}
+			continue
+		}
+		if WrappedBinary(path) == path {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		script := strings.ReplaceAll(string(data), from+string(filepath.Separator), to+string(filepath.Separator))
+		script = strings.ReplaceAll(script, `"`+from+`"`, `"`+to+`"`)
+		if err := fsutil.WriteFileAtomic(path, []byte(script), 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
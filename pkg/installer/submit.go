@@ -0,0 +1,234 @@
+package installer
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/nurysso/binrex/internal/fetch"
+	"github.com/nurysso/binrex/pkg/manifest"
+)
+
+// submitManifestPath is the manifest file inside the repository submit
+// proposes packages to
+const submitManifestPath = "manifest.json"
+
+// SubmitOptions control Submit
+type SubmitOptions struct {
+	// SkipBuild opens the pull request without test-building first
+	SkipBuild bool
+}
+
+// LocalEntry returns a package as defined in the user's manifest.d files,
+// without overrides, and the file defining it
+func (i *Installer) LocalEntry(name string) (*manifest.Package, string, error) {
+	files, _ := filepath.Glob(filepath.Join(i.localManifestDir(), "*.json"))
+	var found *manifest.Package
+	var foundIn string
+	for _, path := range files {
+		m, err := manifest.Load(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", path, err)
+		}
+		// Later files win, as in LoadManifest
+		if pkg, err := m.Find(name); err == nil {
+			found, foundIn = pkg, path
+		}
+	}
+	if found == nil {
+		return nil, "", fmt.Errorf("%s is not defined in %s", name, i.localManifestDir())
+	}
+	return found, foundIn, nil
+}
+
+// testBuild installs a package into a temporary directory, away from the
+// installed packages, to check that it builds and produces binaries
+func (i *Installer) testBuild(ctx context.Context, name string) error {
+	dir, err := os.MkdirTemp("", "binrex-submit-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	scratch := i.scratchInstaller(dir)
+	if err := scratch.Init(); err != nil {
+		return err
+	}
+	if err := scratch.install(ctx, name, InstallOptions{InstallDir: scratch.Paths.BinDir}); err != nil {
+		return fmt.Errorf("test build of %s failed: %w", name, err)
+	}
+	installed := scratch.State.Get(name)
+	if installed == nil || (len(installed.BinaryPaths) == 0 && len(installed.Files) == 0) {
+		return fmt.Errorf("test build of %s installed nothing", name)
+	}
+	return nil
+}
+
+// githubAPI calls the GitHub API with the configured token, decoding the
+// JSON response into out when it isn't nil
+func (i *Installer) githubAPI(ctx context.Context, method, path string, in, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	data, err := fetch.API(ctx, method, i.Config.GetGitHubAPIURL()+path, i.Config.GetGitHubToken(), body)
+	if err != nil || out == nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// Submit proposes a package from the user's manifest.d to the upstream
+// manifest: it validates the entry, test-builds it and opens a pull
+// request adding it, from a fork unless the user can push upstream.
+// It returns the URL of the pull request.
+func (i *Installer) Submit(ctx context.Context, name string, opts SubmitOptions) (string, error) {
+	pkg, path, err := i.LocalEntry(name)
+	if err != nil {
+		return "", err
+	}
+	if err := pkg.Validate(); err != nil {
+		return "", err
+	}
+	i.printf("✓ %s from %s is valid\n", name, path)
+
+	upstream := i.Config.GetSubmitRepo()
+	if i.DryRun {
+		i.println("[dry-run] Planned actions:")
+		if !opts.SkipBuild {
+			i.printf("  Would test-build %s in a temporary directory\n", name)
+		}
+		i.printf("  Would open a pull request against %s adding %s to %s\n", upstream, name, submitManifestPath)
+		return "", nil
+	}
+	if i.Config.GetGitHubToken() == "" {
+		return "", fmt.Errorf("a GitHub token is needed to open a pull request, set github_token in the config or GITHUB_TOKEN")
+	}
+
+	// Read the upstream manifest first, so a package it already has fails
+	// before the build
+	var repo struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := i.githubAPI(ctx, http.MethodGet, "/repos/"+upstream, nil, &repo); err != nil {
+		return "", err
+	}
+	var ref struct {
+		Object struct {
+			SHA string `json:"sha"`
+		} `json:"object"`
+	}
+	if err := i.githubAPI(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/git/ref/heads/%s", upstream, repo.DefaultBranch), nil, &ref); err != nil {
+		return "", err
+	}
+	var file struct {
+		SHA     string `json:"sha"`
+		Content string `json:"content"`
+	}
+	if err := i.githubAPI(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/contents/%s?ref=%s", upstream, submitManifestPath, ref.Object.SHA), nil, &file); err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(file.Content, "\n", ""))
+	if err != nil {
+		return "", fmt.Errorf("invalid %s content: %w", submitManifestPath, err)
+	}
+	if data, err = manifest.AppendPackage(data, pkg); err != nil {
+		return "", err
+	}
+
+	if !opts.SkipBuild {
+		i.printf("Test-building %s...\n", name)
+		if err := i.testBuild(ctx, name); err != nil {
+			return "", err
+		}
+		i.printf("✓ %s builds\n", name)
+	}
+
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := i.githubAPI(ctx, http.MethodGet, "/user", nil, &user); err != nil {
+		return "", err
+	}
+
+	// The branch goes into the user's fork unless the repo is theirs
+	head := upstream
+	if owner, _, _ := strings.Cut(upstream, "/"); !strings.EqualFold(owner, user.Login) {
+		if head, err = i.fork(ctx, upstream); err != nil {
+			return "", err
+		}
+	}
+
+	branch := fmt.Sprintf("add-%s-%d", strings.ToLower(name), time.Now().Unix())
+	newRef := map[string]string{"ref": "refs/heads/" + branch, "sha": ref.Object.SHA}
+	if err := i.githubAPI(ctx, http.MethodPost, "/repos/"+head+"/git/refs", newRef, nil); err != nil {
+		return "", err
+	}
+
+	title := fmt.Sprintf("Add %s %s", pkg.Name, pkg.Version)
+	update := map[string]string{
+		"message": title,
+		"content": base64.StdEncoding.EncodeToString(data),
+		"sha":     file.SHA,
+		"branch":  branch,
+	}
+	if err := i.githubAPI(ctx, http.MethodPut, fmt.Sprintf("/repos/%s/contents/%s", head, submitManifestPath), update, nil); err != nil {
+		return "", err
+	}
+
+	body := fmt.Sprintf("Adds %s %s from %s.", pkg.Name, pkg.Version, pkg.RepoURL)
+	if pkg.Description != "" {
+		body += "\n\n" + pkg.Description
+	}
+	if !opts.SkipBuild {
+		body += fmt.Sprintf("\n\nTest-built with binrex on %s/%s.", runtime.GOOS, runtime.GOARCH)
+	}
+	headOwner, _, _ := strings.Cut(head, "/")
+	pull := map[string]string{
+		"title": title,
+		"head":  headOwner + ":" + branch,
+		"base":  repo.DefaultBranch,
+		"body":  body,
+	}
+	var pr struct {
+		URL string `json:"html_url"`
+	}
+	if err := i.githubAPI(ctx, http.MethodPost, "/repos/"+upstream+"/pulls", pull, &pr); err != nil {
+		return "", err
+	}
+	return pr.URL, nil
+}
+
+// fork forks a repository into the user's account, or finds the existing
+// fork, and waits for it to become available. It returns its owner/repo.
+func (i *Installer) fork(ctx context.Context, upstream string) (string, error) {
+	var fork struct {
+		FullName string `json:"full_name"`
+	}
+	if err := i.githubAPI(ctx, http.MethodPost, "/repos/"+upstream+"/forks", map[string]any{}, &fork); err != nil {
+		return "", err
+	}
+
+	// Forks are created in the background
+	for attempt := 0; attempt < 10; attempt++ {
+		if err := i.githubAPI(ctx, http.MethodGet, "/repos/"+fork.FullName, nil, nil); err == nil {
+			return fork.FullName, nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(3 * time.Second):
+		}
+	}
+	return "", fmt.Errorf("fork %s did not become available", fork.FullName)
+}
@@ -0,0 +1,151 @@
+package installer
+
+import (
+	"encoding/json"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+)
+
+// Batch result statuses
+const (
+	StatusInstalled = "installed"
+	StatusUpgraded  = "upgraded"
+	StatusFailed    = "failed"
+)
+
+// BatchResult is the outcome of one package of install -a or upgrade
+type BatchResult struct {
+	Name       string   `json:"name"`
+	OldVersion string   `json:"old_version,omitempty"`
+	NewVersion string   `json:"new_version"`
+	Seconds    float64  `json:"seconds"`
+	Binaries   []string `json:"binaries,omitempty"`
+	Status     string   `json:"status"`
+	Error      string   `json:"error,omitempty"`
+	// Failure is "network" or "build" for packages that failed for either
+	Failure string `json:"failure,omitempty"`
+}
+
+// BatchSummary is written to the summary file after install -a or
+// upgrade, for scripts checking what a batch did
+type BatchSummary struct {
+	Operation string        `json:"operation"`
+	Started   string        `json:"started"`
+	Seconds   float64       `json:"seconds"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []BatchResult `json:"results"`
+}
+
+// batchSummaryPath returns the summary file of the last batch of an
+// operation, next to installed.json
+func (i *Installer) batchSummaryPath(operation string) string {
+	return filepath.Join(filepath.Dir(i.Paths.InstalledPath), "last-"+operation+".json")
+}
+
+// batchResult returns the result of one package of a batch that took
+// since start and failed with err, or else installed its new version
+func (i *Installer) batchResult(name, oldVersion, newVersion string, start time.Time, err error) BatchResult {
+	result := BatchResult{
+		Name:       name,
+		OldVersion: oldVersion,
+		NewVersion: newVersion,
+		Seconds:    math.Round(time.Since(start).Seconds()*10) / 10,
+		Status:     StatusInstalled,
+	}
+	if oldVersion != "" {
+		result.Status = StatusUpgraded
+	}
+	if err != nil {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+		result.Failure = failureKind(err)
+		return result
+	}
+	if installed := i.State.Get(name); installed != nil {
+		result.NewVersion = installed.Version
+		for _, path := range installed.BinaryPaths {
+			result.Binaries = append(result.Binaries, filepath.Base(path))
+		}
+	}
+	return result
+}
+
+// printBatchSummary prints a table of a batch's results with the counts
+// below it and writes them to the operation's summary file. Dry runs
+// have nothing to summarize.
+func (i *Installer) printBatchSummary(title, operation string, start time.Time, results []BatchResult) {
+	if i.DryRun {
+		return
+	}
+	summary := BatchSummary{
+		Operation: operation,
+		Started:   start.Format(time.RFC3339),
+		Seconds:   math.Round(time.Since(start).Seconds()*10) / 10,
+		Results:   results,
+	}
+
+	rows := [][]string{{"Package", "Version", "Time", "Binaries", "Status"}}
+	for _, result := range results {
+		version := result.NewVersion
+		if result.OldVersion != "" {
+			version = result.OldVersion + " → " + result.NewVersion
+		}
+		status := "✓ " + result.Status
+		if result.Status == StatusFailed {
+			status = "✗ " + result.Status
+			if result.Failure != "" {
+				status += " (" + result.Failure + ")"
+			}
+			summary.Failed++
+		} else {
+			summary.Succeeded++
+		}
+		rows = append(rows, []string{
+			result.Name,
+			version,
+			strconv.FormatFloat(result.Seconds, 'f', 1, 64) + "s",
+			strconv.Itoa(len(result.Binaries)),
+			status,
+		})
+	}
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for n, cell := range row {
+			widths[n] = max(widths[n], utf8.RuneCountInString(cell))
+		}
+	}
+
+	i.println("\n" + strings.Repeat("=", 60))
+	i.printf("%s:\n", title)
+	for _, row := range rows {
+		line := ""
+		for n, cell := range row[:len(row)-1] {
+			line += cell + strings.Repeat(" ", widths[n]-utf8.RuneCountInString(cell)+2)
+		}
+		i.printf("  %s%s\n", line, row[len(row)-1])
+	}
+	i.println()
+	i.printf("  ✓ Succeeded: %d\n", summary.Succeeded)
+	if summary.Failed > 0 {
+		i.printf("  ✗ Failed: %d\n", summary.Failed)
+	}
+
+	path := i.batchSummaryPath(operation)
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err == nil {
+		err = fsutil.WriteFileAtomic(path, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		i.eprintf("Warning: failed to write %s: %v\n", path, err)
+		return
+	}
+	i.printf("  Summary written to %s\n", path)
+}
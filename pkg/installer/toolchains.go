@@ -0,0 +1,197 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/nurysso/binrex/internal/fetch"
+)
+
+// DefaultToolInstallers are the toolchain installers allowed when the
+// config doesn't list any. Both install into the user's home without sudo.
+var DefaultToolInstallers = []string{"rustup", "go"}
+
+// toolInstallers maps a missing tool to the toolchain installer providing it
+var toolInstallers = map[string]string{
+	"cargo":  "rustup",
+	"rustc":  "rustup",
+	"rustup": "rustup",
+	"go":     "go",
+	"gofmt":  "go",
+	"gcc":    "build-essential",
+	"g++":    "build-essential",
+	"cc":     "build-essential",
+	"make":   "build-essential",
+}
+
+// allowedToolInstallers returns the toolchain installers the config allows
+func (i *Installer) allowedToolInstallers() []string {
+	if len(i.Config.AllowedToolInstallers) > 0 {
+		return i.Config.AllowedToolInstallers
+	}
+	return DefaultToolInstallers
+}
+
+// ensureRequiredTools checks the required tools and, with install set,
+// bootstraps the missing ones it knows how to before checking again
+func (i *Installer) ensureRequiredTools(ctx context.Context, tools string, install bool) bool {
+	missing := i.missingTools(tools)
+	if len(missing) == 0 {
+		return true
+	}
+	if !install {
+		return false
+	}
+
+	var needed []string
+	for _, tool := range missing {
+		name, ok := toolInstallers[tool]
+		if !ok {
+			i.eprintf("Don't know how to install %s\n", tool)
+			continue
+		}
+		if !contains(i.allowedToolInstallers(), name) {
+			i.eprintf("Installing %s needs %s, which is not in allowed_tool_installers\n", tool, name)
+			continue
+		}
+		if !contains(needed, name) {
+			needed = append(needed, name)
+		}
+	}
+
+	for _, name := range needed {
+		if err := i.installToolchain(ctx, name); err != nil {
+			i.eprintf("Error: Failed to install %s: %v\n", name, err)
+		}
+	}
+
+	return len(i.missingTools(tools)) == 0
+}
+
+// toolchainDir is where binrex keeps toolchains it downloaded itself
+func (i *Installer) toolchainDir() string {
+	return filepath.Join(filepath.Dir(i.Paths.StoreDir), "toolchains")
+}
+
+// prependPath puts dir first on this process's PATH so the rest of the
+// install finds the new tools
+func prependPath(dir string) {
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// installToolchain runs one of the known toolchain installers
+func (i *Installer) installToolchain(ctx context.Context, name string) error {
+	if i.DryRun {
+		i.printf("  Would install toolchain: %s\n", name)
+		return nil
+	}
+	if !i.confirm(fmt.Sprintf("Install the %s toolchain?", name), true) {
+		return ErrAborted
+	}
+
+	switch name {
+	case "rustup":
+		return i.installRustup(ctx)
+	case "go":
+		return i.installGo(ctx)
+	case "build-essential":
+		return i.installBuildEssential(ctx)
+	}
+	return fmt.Errorf("unknown toolchain installer %s", name)
+}
+
+// installRustup installs the Rust toolchain into ~/.cargo via rustup
+func (i *Installer) installRustup(ctx context.Context) error {
+	i.println("\nInstalling Rust via rustup...")
+	cmd := "curl --proto '=https' --tlsv1.2 -sSf https://sh.rustup.rs | sh -s -- -y --no-modify-path"
+	if err := i.runCommand(ctx, cmd); err != nil {
+		return err
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	cargoBin := filepath.Join(home, ".cargo", "bin")
+	prependPath(cargoBin)
+	i.printf("✓ Installed Rust, add %s to your PATH to use it outside binrex\n", cargoBin)
+	return nil
+}
+
+// installGo downloads the latest Go release into the toolchain dir and
+// links go and gofmt into the bin dir
+func (i *Installer) installGo(ctx context.Context) error {
+	i.println("\nInstalling Go...")
+	data, err := fetch.Get(ctx, "https://go.dev/VERSION?m=text")
+	if err != nil {
+		return err
+	}
+	version, _, _ := strings.Cut(strings.TrimSpace(string(data)), "\n")
+
+	url := fmt.Sprintf("https://go.dev/dl/%s.%s-%s.tar.gz", version, runtime.GOOS, runtime.GOARCH)
+	dir := i.toolchainDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating %s: %w", dir, err)
+	}
+
+	archive := filepath.Join(dir, version+".tar.gz")
+	err = i.retry(ctx, "Downloading "+version, func() error {
+		return fetch.DownloadFile(ctx, url, archive, i.Stdout)
+	})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archive)
+
+	goRoot := filepath.Join(dir, "go")
+	if err := os.RemoveAll(goRoot); err != nil {
+		return err
+	}
+	if err := i.runCommand(ctx, fmt.Sprintf("tar -C %s -xzf %s", dir, archive)); err != nil {
+		return fmt.Errorf("failed to extract %s: %w", archive, err)
+	}
+
+	for _, tool := range []string{"go", "gofmt"} {
+		i.prepareForGatekeeper(filepath.Join(goRoot, "bin", tool), false)
+		if err := linkBinary(filepath.Join(goRoot, "bin", tool), filepath.Join(i.Paths.BinDir, tool)); err != nil {
+			return err
+		}
+	}
+	prependPath(filepath.Join(goRoot, "bin"))
+	i.printf("✓ Installed %s, linked into %s\n", version, i.Paths.BinDir)
+	return nil
+}
+
+// installBuildEssential installs a C toolchain and make with the system
+// package manager, which prompts for the sudo password
+func (i *Installer) installBuildEssential(ctx context.Context) error {
+	managers := []struct {
+		tool    string
+		command string
+	}{
+		{"apt-get", "sudo apt-get install -y build-essential"},
+		{"dnf", "sudo dnf group install -y development-tools"},
+		{"pacman", "sudo pacman -S --needed --noconfirm base-devel"},
+		{"zypper", "sudo zypper install -y -t pattern devel_basis"},
+		{"apk", "sudo apk add build-base"},
+		{"xcode-select", "xcode-select --install"},
+	}
+
+	for _, m := range managers {
+		if CheckToolExists(m.tool) {
+			i.printf("\nRunning: %s\n", m.command)
+			command := exec.CommandContext(ctx, "sh", "-c", m.command)
+			// sudo needs the terminal to ask for the password
+			command.Stdin = os.Stdin
+			command.Stdout = i.Stdout
+			command.Stderr = i.Stderr
+			return command.Run()
+		}
+	}
+	return fmt.Errorf("no supported system package manager found")
+}
@@ -0,0 +1,102 @@
+package installer
+
+import (
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// toolRequirement is one entry of required_tools, e.g. "go>=1.21"
+type toolRequirement struct {
+	Name    string
+	Op      string // One of >=, >, <=, <, =, or "" for any version
+	Version string
+}
+
+// constraintOps are the supported comparison operators, longest first
+var constraintOps = []string{">=", "<=", "==", ">", "<", "="}
+
+// parseToolRequirement parses a required_tools entry
+func parseToolRequirement(s string) toolRequirement {
+	s = strings.TrimSpace(s)
+	for n, c := range s {
+		if !strings.ContainsRune("<>=", c) {
+			continue
+		}
+		for _, op := range constraintOps {
+			if strings.HasPrefix(s[n:], op) {
+				return toolRequirement{
+					Name:    strings.TrimSpace(s[:n]),
+					Op:      op,
+					Version: strings.TrimSpace(s[n+len(op):]),
+				}
+			}
+		}
+	}
+	return toolRequirement{Name: s}
+}
+
+// String formats the requirement the way it's written in the manifest
+func (r toolRequirement) String() string {
+	return r.Name + r.Op + r.Version
+}
+
+// versionPattern matches the first dotted version number in tool output
+var versionPattern = regexp.MustCompile(`\d+(\.\d+)+`)
+
+// toolVersion runs a tool's version command and extracts its version
+func toolVersion(name string) string {
+	args := []string{"--version"}
+	switch name {
+	case "go":
+		args = []string{"version"}
+	case "java":
+		args = []string{"-version"}
+	}
+
+	out, _ := exec.Command(name, args...).CombinedOutput()
+	return versionPattern.FindString(string(out))
+}
+
+// compareVersions compares dotted numeric versions, returning -1, 0 or 1.
+// Missing components count as zero, so 1.21 == 1.21.0.
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+
+	for n := 0; n < max(len(as), len(bs)); n++ {
+		var x, y int
+		if n < len(as) {
+			x, _ = strconv.Atoi(as[n])
+		}
+		if n < len(bs) {
+			y, _ = strconv.Atoi(bs[n])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// satisfiedBy reports whether version meets the requirement's constraint
+func (r toolRequirement) satisfiedBy(version string) bool {
+	c := compareVersions(version, r.Version)
+	switch r.Op {
+	case ">=":
+		return c >= 0
+	case ">":
+		return c > 0
+	case "<=":
+		return c <= 0
+	case "<":
+		return c < 0
+	case "=", "==":
+		return c == 0
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+package installer
+
+import "sort"
+
+// DepNode is a package in a dependency tree
+type DepNode struct {
+	Name      string
+	Installed bool
+	// Orphan is set for packages the manifest doesn't have, either named
+	// in depends or installed and since dropped from the manifest
+	Orphan bool
+	// Cycle is set when the package already is on the path from the root,
+	// its dependencies are not listed again
+	Cycle bool
+	Deps  []*DepNode
+}
+
+// DependencyTree returns the dependency trees of the named packages from
+// the manifest's depends fields. Without names it returns the trees of
+// the installed packages no other installed package depends on, and of
+// any installed package left out because it only appears in a cycle.
+func (i *Installer) DependencyTree(names []string) ([]*DepNode, error) {
+	m, err := i.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+	installedData, err := i.State.Load()
+	if err != nil {
+		return nil, err
+	}
+	installed := make(map[string]bool, len(installedData.Installed))
+	for _, pkg := range installedData.Installed {
+		installed[pkg.Name] = true
+	}
+
+	depends := func(name string) ([]string, bool) {
+		pkg, err := m.Find(name)
+		if err != nil {
+			return nil, false
+		}
+		return pkg.Depends, true
+	}
+
+	seen := make(map[string]bool)
+	var build func(name string, path map[string]bool) *DepNode
+	build = func(name string, path map[string]bool) *DepNode {
+		seen[name] = true
+		node := &DepNode{Name: name, Installed: installed[name]}
+		if path[name] {
+			node.Cycle = true
+			return node
+		}
+		deps, ok := depends(name)
+		node.Orphan = !ok
+		path[name] = true
+		for _, dep := range deps {
+			node.Deps = append(node.Deps, build(dep, path))
+		}
+		delete(path, name)
+		return node
+	}
+
+	if len(names) == 0 {
+		dependedOn := make(map[string]bool)
+		for name := range installed {
+			deps, _ := depends(name)
+			for _, dep := range deps {
+				if installed[dep] && dep != name {
+					dependedOn[dep] = true
+				}
+			}
+		}
+		for name := range installed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var roots, rest []string
+		for _, name := range names {
+			if dependedOn[name] {
+				rest = append(rest, name)
+			} else {
+				roots = append(roots, name)
+			}
+		}
+		var trees []*DepNode
+		for _, name := range roots {
+			trees = append(trees, build(name, make(map[string]bool)))
+		}
+		for _, name := range rest {
+			if !seen[name] {
+				trees = append(trees, build(name, make(map[string]bool)))
+			}
+		}
+		return trees, nil
+	}
+
+	var trees []*DepNode
+	for _, name := range names {
+		if _, err := m.Find(name); err != nil && !installed[name] {
+			return nil, err
+		}
+		trees = append(trees, build(name, make(map[string]bool)))
+	}
+	return trees, nil
+}
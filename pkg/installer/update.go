@@ -0,0 +1,408 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+	"github.com/nurysso/binrex/pkg/manifest"
+	"github.com/nurysso/binrex/pkg/state"
+)
+
+// Update rebuilds an installed package from the latest upstream source.
+// Packages that are not installed yet are installed.
+func (i *Installer) Update(ctx context.Context, name string, opts InstallOptions) error {
+	err := i.update(ctx, name, opts)
+	i.recordHistory("update", name, i.installedVersion(name), err)
+	return err
+}
+
+// update updates an installed package. The new version is built while the
+// installed one stays in place, and only swapped in once it built and its
+// binaries are stored, so a failed update leaves the package as it was.
+func (i *Installer) update(ctx context.Context, name string, opts InstallOptions) error {
+	i.printf("Updating package: %s\n", name)
+
+	installed := i.State.Get(name)
+	if installed == nil {
+		i.eprintf("Package '%s' is not installed. Installing new...\n", name)
+		return i.install(ctx, name, opts)
+	}
+
+	// Keep the binaries where and as what they were installed unless told
+	// otherwise
+	if opts.InstallDir == "" {
+		opts.InstallDir = installed.InstallDir
+	}
+	if len(opts.Aliases) == 0 {
+		opts.Aliases = installed.BinaryAliases
+	}
+
+	// Unmanaged packages have no manifest entry, rebuild from their own repo
+	// with the recorded build settings unless overridden
+	if installed.Unmanaged {
+		if installed.RepoURL == "" {
+			i.eprintf("Error: %s was adopted without a source repo, there is nothing to update it from\n", name)
+			return fmt.Errorf("no source repo for %s", name)
+		}
+		gitOpts := InstallOptions{
+			BuildCommand: installed.BuildCommands,
+			BuildDir:     installed.BuildDir,
+			InstallDir:   opts.InstallDir,
+			Aliases:      opts.Aliases,
+			NoKeepSource: opts.NoKeepSource,
+		}
+		if opts.BuildCommand != "" {
+			gitOpts.BuildCommand = opts.BuildCommand
+		}
+		if opts.BuildDir != "" {
+			gitOpts.BuildDir = opts.BuildDir
+		}
+
+		if i.DryRun {
+			i.printf("[dry-run] %s %s stays installed until the new version is built\n", name, installed.Version)
+			pkg, err := i.withInstallDir(gitOpts.apply(&manifest.Package{Name: name, RepoURL: installed.RepoURL}), gitOpts.InstallDir)
+			if err != nil {
+				return err
+			}
+			i.printInstallPlan(pkg)
+			return nil
+		}
+
+		// A local directory is rebuilt as it is, there's no upstream to
+		// compare it with
+		if _, local := localPath(installed.RepoURL); !local {
+			if i.upToDatePin(ctx, installed, opts.forcesRebuild()) || i.upToDate(ctx, installed, installed.RepoURL, installed.Version, opts.forcesRebuild()) {
+				return nil
+			}
+
+			if !i.confirmUpstreamChanges(ctx, installed, opts.confirmed) {
+				i.println("Update aborted.")
+				return nil
+			}
+		}
+
+		i.println("\nInstalling updated version...")
+		return i.replace(installed, func() error {
+			return i.installGit(ctx, installed.RepoURL, gitOpts)
+		})
+	}
+
+	// Get package info from manifest
+	manifestPkg, err := i.FindPackage(name)
+	if err != nil {
+		i.eprintf("Error: Package '%s' not found in manifest\n", name)
+		return err
+	}
+
+	// Packages installed with a version constraint stay within it, and
+	// packages built from source or pinned to a ref keep being built
+	if opts.Constraint == "" {
+		opts.Constraint = installed.Constraint
+	}
+	if installed.Asset == "" && manifestPkg.URL == "" {
+		opts.FromSource = true
+	}
+	pin := i.pinnedRef(name)
+	if pin != "" {
+		opts.FromSource = true
+	}
+
+	if i.DryRun {
+		i.printf("[dry-run] %s %s stays installed until the new version is built\n", name, installed.Version)
+		pkg, err := i.withInstallDir(opts.apply(manifestPkg), opts.InstallDir)
+		if err != nil {
+			return err
+		}
+		if pkg.URL != "" {
+			return i.installURL(ctx, pkg)
+		}
+		if pkg.ReleaseAsset != "" && !opts.FromSource {
+			return i.installRelease(ctx, pkg)
+		}
+		if pin != "" {
+			i.printf("[dry-run] %s is pinned to %s\n", name, pin)
+		} else if err := i.planConstraint(ctx, pkg, opts.Constraint); err != nil {
+			return err
+		}
+		i.printInstallPlan(pkg)
+		return nil
+	}
+
+	if manifestPkg.URL != "" || (installed.Asset != "" && manifestPkg.ReleaseAsset != "" && !opts.FromSource) {
+		if !opts.forcesRebuild() && manifestPkg.Version == installed.Version {
+			i.printf("✓ %s %s is already installed from its download.\n", name, installed.Version)
+			i.println("  Use --force to reinstall anyway.")
+			return nil
+		}
+	} else if pin != "" {
+		if i.upToDatePin(ctx, installed, opts.forcesRebuild()) {
+			return nil
+		}
+	} else if opts.Constraint != "" {
+		tag, commit, err := i.resolveConstraint(ctx, installed.RepoPath, manifestPkg.RepoURL, opts.Constraint)
+		if err != nil {
+			i.eprintf("Error: %v\n", err)
+			return err
+		}
+		if !opts.forcesRebuild() && commit == installed.Commit {
+			i.printf("✓ %s is already built from %s, the newest tag matching %s.\n", name, tag, opts.Constraint)
+			i.println("  Use --force to rebuild anyway.")
+			return nil
+		}
+	} else if i.upToDate(ctx, installed, manifestPkg.RepoURL, manifestPkg.Version, opts.forcesRebuild()) {
+		return nil
+	}
+
+	if !i.confirmUpstreamChanges(ctx, installed, opts.confirmed) {
+		i.println("Update aborted.")
+		return nil
+	}
+
+	// Update repository
+	repoPath := i.RepoCachePath(manifestPkg.RepoURL)
+	if manifestPkg.RepoURL != "" && fsutil.FileExists(repoPath) && opts.Constraint == "" && pin == "" {
+		cmd := fmt.Sprintf("cd %s && %s pull", repoPath, i.gitCommand())
+		i.println("\nPulling latest changes...")
+		i.runCommand(ctx, cmd)
+	}
+
+	// Install new version
+	i.println("\nInstalling updated version...")
+	return i.replace(installed, func() error {
+		return i.install(ctx, name, opts)
+	})
+}
+
+// replace runs the install of a package's new version, letting it install
+// over the installed one. The installed version's entries are only
+// replaced once the new version is recorded.
+func (i *Installer) replace(installed *state.InstalledPackage, install func() error) error {
+	i.replacing = installed
+	defer func() { i.replacing = nil }()
+
+	err := install()
+	if err != nil && i.State.IsInstalled(installed.Name) {
+		i.eprintf("%s %s is still installed.\n", installed.Name, installed.Version)
+	}
+	return err
+}
+
+// replaces reports whether the install running replaces the installed
+// version of a package
+func (i *Installer) replaces(name string) bool {
+	return i.replacing != nil && i.replacing.Name == name
+}
+
+// retire deletes what the replaced version of a package installed and its
+// new version entry doesn't have: bin dir entries, files, desktop files
+// and services. Its builds stay in the store.
+func (i *Installer) retire(ctx context.Context, old, entry *state.InstalledPackage) {
+	for _, path := range old.BinaryPaths {
+		if contains(entry.BinaryPaths, path) {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			i.eprintf("Error removing binary %s: %v\n", path, err)
+			continue
+		}
+		i.printf("  ✓ Removed binary: %s\n", path)
+	}
+	for _, path := range old.Files {
+		if contains(entry.Files, path) {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			i.eprintf("Error removing %s: %v\n", path, err)
+			continue
+		}
+		i.printf("  ✓ Removed: %s\n", path)
+	}
+	i.removeDesktopFiles(ctx, without(old.DesktopFiles, entry.DesktopFiles), without(old.IconPaths, entry.IconPaths))
+	i.removeServices(ctx, without(old.ServiceUnits, entry.ServiceUnits))
+}
+
+// without returns the paths that aren't in keep
+func without(paths, keep []string) []string {
+	var out []string
+	for _, path := range paths {
+		if !contains(keep, path) {
+			out = append(out, path)
+		}
+	}
+	return out
+}
+
+// upToDate fetches an installed package's repo and reports, with a message,
+// when there is nothing to rebuild: upstream HEAD is the commit it was
+// built from and the version hasn't changed. force skips the check. When
+// the cached repo was deleted, upstream HEAD is asked from repoURL.
+func (i *Installer) upToDate(ctx context.Context, installed *state.InstalledPackage, repoURL, version string, force bool) bool {
+	upstream := i.fetchUpstream(ctx, installed.RepoPath)
+	if upstream == "" && !force && !fsutil.FileExists(installed.RepoPath) {
+		upstream = remoteHead(ctx, repoURL)
+	}
+	if force || upstream == "" || upstream != installed.Commit || version != installed.Version {
+		return false
+	}
+
+	i.printf("✓ %s is already built from upstream %s, nothing to rebuild.\n", installed.Name, ShortCommit(upstream))
+	i.println("  Use --force to rebuild anyway.")
+	return true
+}
+
+// upToDatePin reports, with a message, when a pinned package is already
+// built from the commit its pin resolves to. Unpinned packages are never
+// up to date here.
+func (i *Installer) upToDatePin(ctx context.Context, installed *state.InstalledPackage, force bool) bool {
+	pin := i.pinnedRef(installed.Name)
+	if pin == "" || force || !fsutil.FileExists(installed.RepoPath) {
+		return false
+	}
+	commit, err := resolveRef(ctx, installed.RepoPath, pin)
+	if err != nil || commit != installed.Commit {
+		return false
+	}
+
+	i.printf("✓ %s is already built from %s, the pinned ref.\n", installed.Name, pin)
+	i.println("  Use 'binrex unpin' to follow the manifest again.")
+	return true
+}
+
+// confirmUpstreamChanges shows what changed upstream since the installed
+// build and asks whether to continue with the update, unless it was
+// confirmed already
+func (i *Installer) confirmUpstreamChanges(ctx context.Context, installed *state.InstalledPackage, confirmed bool) bool {
+	if !fsutil.FileExists(installed.RepoPath) {
+		return true
+	}
+
+	i.showUpstreamChanges(ctx, installed.RepoPath, installed.Commit)
+	return confirmed || i.confirm("\nContinue with update?", true)
+}
+
+// OutdatedPackage describes an installed package with a newer manifest version
+type OutdatedPackage struct {
+	Name             string `json:"name"`
+	InstalledVersion string `json:"installed_version"`
+	LatestVersion    string `json:"latest_version"`
+}
+
+// Outdated compares installed packages against the manifest
+func (i *Installer) Outdated() ([]OutdatedPackage, error) {
+	m, err := i.LoadManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make(map[string]string)
+	for _, pkg := range m.Packages {
+		latest[pkg.Name] = pkg.Version
+	}
+
+	var outdated []OutdatedPackage
+	installedData, err := i.State.Load()
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range installedData.Installed {
+		if pkg.Unmanaged || installedData.Pins[pkg.Name] != "" {
+			continue
+		}
+
+		version, ok := latest[pkg.Name]
+		if !ok || version == "" || version == pkg.Version {
+			continue
+		}
+		if pkg.Constraint != "" && !constraintAllows(pkg.Constraint, pkg.Version, version) {
+			continue
+		}
+
+		outdated = append(outdated, OutdatedPackage{
+			Name:             pkg.Name,
+			InstalledVersion: pkg.Version,
+			LatestVersion:    version,
+		})
+	}
+
+	return outdated, nil
+}
+
+// Upgrade updates the given installed packages, or every outdated package
+// when names is empty. Names that aren't installed are reported and fail
+// the upgrade after the others are done.
+func (i *Installer) Upgrade(ctx context.Context, names []string) error {
+	if err := i.requireManifest(); err != nil {
+		return err
+	}
+
+	outdated, err := i.Outdated()
+	if err != nil {
+		i.eprintf("Error: Failed to load manifest: %v\n", err)
+		return err
+	}
+
+	var toUpgrade []OutdatedPackage
+	for _, pkg := range outdated {
+		if len(names) == 0 || contains(names, pkg.Name) {
+			toUpgrade = append(toUpgrade, pkg)
+		}
+	}
+
+	var errs []error
+	for _, name := range names {
+		switch {
+		case !i.State.IsInstalled(name):
+			i.eprintf("Package '%s' is not installed\n", name)
+			errs = append(errs, fmt.Errorf("%s: %w", name, ErrNotInstalled))
+		case !slices.ContainsFunc(toUpgrade, func(pkg OutdatedPackage) bool { return pkg.Name == name }):
+			i.printf("%s is up to date.\n", name)
+		}
+	}
+
+	if len(toUpgrade) == 0 {
+		if len(errs) > 0 {
+			return &batchError{"some packages failed to upgrade", errs}
+		}
+		i.println("All packages are up to date.")
+		return nil
+	}
+
+	i.printf("Found %d package(s) to upgrade:\n", len(toUpgrade))
+	for _, pkg := range toUpgrade {
+		i.printf("  - %s (%s → %s)\n", pkg.Name, pkg.InstalledVersion, pkg.LatestVersion)
+	}
+
+	if !i.confirm("\nUpgrade these packages?", false) {
+		i.println("Upgrade aborted.")
+		return ErrAborted
+	}
+
+	start := time.Now()
+	var results []BatchResult
+	for n, pkg := range toUpgrade {
+		i.printf("\n[%d/%d] Upgrading %s...\n", n+1, len(toUpgrade), pkg.Name)
+		i.println(strings.Repeat("=", 60))
+
+		pkgStart := time.Now()
+		// The batch prompt covered every package
+		err := i.update(ctx, pkg.Name, InstallOptions{confirmed: true})
+		i.recordHistory("update", pkg.Name, i.installedVersion(pkg.Name), err)
+		if err != nil {
+			i.eprintf("✗ Failed to upgrade %s: %v\n", pkg.Name, err)
+			errs = append(errs, err)
+		}
+		results = append(results, i.batchResult(pkg.Name, pkg.InstalledVersion, pkg.LatestVersion, pkgStart, err))
+	}
+
+	i.printBatchSummary("Upgrade Summary", "upgrade", start, results)
+	if len(errs) > 0 {
+		return &batchError{"some packages failed to upgrade", errs}
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+)
+
+// Vendor archives the cached source tree of an installed package at the
+// commit it was built from into outDir, returning the tarball's path
+func (i *Installer) Vendor(ctx context.Context, name, outDir string) (string, error) {
+	installed := i.State.Get(name)
+	if installed == nil {
+		return "", fmt.Errorf("package '%s' is not installed", name)
+	}
+	if installed.Commit == "" {
+		return "", fmt.Errorf("no build commit recorded for %s, reinstall it first", name)
+	}
+	if !fsutil.FileExists(installed.RepoPath) {
+		return "", fmt.Errorf("cached repo %s is missing", installed.RepoPath)
+	}
+
+	base := fmt.Sprintf("%s-%s-%s", name, storeVersionName(installed.Version), ShortCommit(installed.Commit))
+	archive := filepath.Join(outDir, base+".tar.gz")
+
+	if i.DryRun {
+		i.printf("  Would archive: %s at %s -> %s\n", installed.RepoPath, ShortCommit(installed.Commit), archive)
+		return archive, nil
+	}
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return "", fmt.Errorf("error creating %s: %w", outDir, err)
+	}
+
+	command := exec.CommandContext(ctx, "git", "-C", installed.RepoPath, "archive",
+		"--format=tar.gz", "--prefix="+base+"/", "-o", archive, installed.Commit)
+	command.Stderr = i.Stderr
+	if err := command.Run(); err != nil {
+		os.Remove(archive)
+		return "", fmt.Errorf("failed to archive %s: %w", name, err)
+	}
+
+	return archive, nil
+}
@@ -0,0 +1,123 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+	"github.com/nurysso/binrex/pkg/manifest"
+	"github.com/nurysso/binrex/pkg/state"
+)
+
+// BinaryCheck compares an installed binary against a fresh build
+type BinaryCheck struct {
+	Name            string
+	InstalledSHA256 string
+	RebuiltSHA256   string // Empty when the rebuild didn't produce it
+}
+
+// Match reports whether the rebuilt binary is identical
+func (c BinaryCheck) Match() bool {
+	return c.RebuiltSHA256 != "" && c.RebuiltSHA256 == c.InstalledSHA256
+}
+
+// buildSpec returns the package definition an installed package is built
+// from: its manifest entry, or the recorded settings for unmanaged ones
+func (i *Installer) buildSpec(installed *state.InstalledPackage) (*manifest.Package, error) {
+	if installed.Unmanaged {
+		return &manifest.Package{
+			Name:          installed.Name,
+			RepoURL:       installed.RepoURL,
+			SourceDir:     installed.BuildDir,
+			Version:       installed.Version,
+			BuildCommands: installed.BuildCommands,
+		}, nil
+	}
+	return i.FindPackage(installed.Name)
+}
+
+// VerifyRebuild rebuilds a package from its recorded commit in a clean
+// checkout and compares the resulting binaries with the installed ones
+func (i *Installer) VerifyRebuild(ctx context.Context, name string) ([]BinaryCheck, error) {
+	installed := i.State.Get(name)
+	if installed == nil {
+		return nil, fmt.Errorf("package '%s' is not installed", name)
+	}
+	if installed.Type != "" {
+		return nil, fmt.Errorf("%s is a %s package, there is no build to verify", name, installed.Type)
+	}
+	if installed.Commit == "" {
+		return nil, fmt.Errorf("no build commit recorded for %s, reinstall it first", name)
+	}
+	if !fsutil.FileExists(installed.RepoPath) {
+		return nil, fmt.Errorf("cached repo %s is missing", installed.RepoPath)
+	}
+
+	pkg, err := i.buildSpec(installed)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "binrex-verify-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	checkout := filepath.Join(tmpDir, name)
+	i.printf("Checking out %s at %s...\n", name, ShortCommit(installed.Commit))
+	cmd := fmt.Sprintf("git clone --quiet %s %s && cd %s && git checkout --quiet %s",
+		installed.RepoPath, checkout, checkout, installed.Commit)
+	if err := i.runCommand(ctx, cmd); err != nil {
+		return nil, fmt.Errorf("failed to check out %s: %w", ShortCommit(installed.Commit), err)
+	}
+	if pkg.Submodules || (installed.Unmanaged && hasSubmodules(checkout)) {
+		if err := i.updateSubmodules(ctx, checkout); err != nil {
+			return nil, err
+		}
+	}
+
+	i.println("Rebuilding...")
+	if err := i.build(ctx, pkg, checkout); err != nil {
+		return nil, fmt.Errorf("rebuild failed: %w", err)
+	}
+
+	rebuilt, err := i.findBuiltBinaries(checkout, pkg)
+	if err != nil {
+		return nil, err
+	}
+	if rebuilt, err = applyAliases(rebuilt, installed.BinaryAliases); err != nil {
+		return nil, err
+	}
+	rebuiltPaths := make(map[string]string)
+	for _, binary := range rebuilt {
+		rebuiltPaths[binary.Name] = binary.Path
+	}
+
+	var checks []BinaryCheck
+	for _, binaryPath := range installed.BinaryPaths {
+		check := BinaryCheck{Name: filepath.Base(binaryPath)}
+
+		// Prefer the checksum taken at install time, the file on disk may
+		// have been replaced since
+		if installed.Provenance != nil {
+			check.InstalledSHA256 = installed.Provenance.SHA256[check.Name]
+		}
+		if check.InstalledSHA256 == "" {
+			if check.InstalledSHA256, err = fsutil.SHA256File(WrappedBinary(binaryPath)); err != nil {
+				return nil, fmt.Errorf("failed to hash %s: %w", binaryPath, err)
+			}
+		}
+		if path, ok := rebuiltPaths[check.Name]; ok {
+			if check.RebuiltSHA256, err = fsutil.SHA256File(path); err != nil {
+				return nil, fmt.Errorf("failed to hash %s: %w", path, err)
+			}
+		}
+
+		checks = append(checks, check)
+	}
+
+	return checks, nil
+}
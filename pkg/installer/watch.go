@@ -0,0 +1,132 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// watchInterval is how often watch-build looks for changed files
+const watchInterval = 500 * time.Millisecond
+
+// unwatchedDirs hold version control data, dependencies and build
+// outputs, which change without the sources changing
+var unwatchedDirs = []string{".git", ".hg", "node_modules", "target", "zig-cache", "zig-out", "__pycache__"}
+
+// fileStamp is what watch-build compares to tell a file changed
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// sourceStamps records the files of a source tree, leaving out the dirs
+// builds and tools write to
+func sourceStamps(dir string) map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			if path != dir && (contains(unwatchedDirs, entry.Name()) || strings.HasPrefix(entry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			stamps[path] = fileStamp{info.ModTime(), info.Size()}
+		}
+		return nil
+	})
+	return stamps
+}
+
+// WatchBuild rebuilds a package whenever its sources change, until ctx is
+// cancelled. Packages installed with install --path are rebuilt and
+// reinstalled from their directory, packages linked with dev link are
+// rebuilt in the working copy their commands already run from.
+func (i *Installer) WatchBuild(ctx context.Context, name string) error {
+	installed := i.State.Get(name)
+	if installed == nil {
+		i.eprintf("Package '%s' is not installed\n", name)
+		return ErrNotInstalled
+	}
+	dir := installed.DevPath
+	if dir == "" {
+		var local bool
+		if dir, local = localPath(installed.RepoURL); !local {
+			i.eprintf("Error: %s has no working copy to watch, install it with 'binrex install --path <dir>' or run 'binrex dev link %s <dir>'\n", name, name)
+			return fmt.Errorf("%s is neither local nor linked", name)
+		}
+	}
+
+	i.streamBuild = true
+	defer func() { i.streamBuild = false }()
+
+	i.printf("Watching %s for changes to rebuild %s, press Ctrl-C to stop\n", dir, name)
+	stamps := sourceStamps(dir)
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if maps.Equal(stamps, sourceStamps(dir)) {
+			continue
+		}
+
+		// Editors and checkouts write several files, wait for them to
+		// settle before building
+		for {
+			stamps = sourceStamps(dir)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(watchInterval):
+			}
+			if maps.Equal(stamps, sourceStamps(dir)) {
+				break
+			}
+		}
+
+		i.printf("\n[%s] Sources changed, rebuilding %s...\n", time.Now().Format("15:04:05"), name)
+		start := time.Now()
+		if err := i.watchRebuild(ctx, name); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			i.eprintf("✗ Rebuilding %s failed: %v\n", name, err)
+		} else {
+			i.printf("✓ Rebuilt %s in %s\n", name, time.Since(start).Round(100*time.Millisecond))
+		}
+		i.println("Waiting for changes...")
+		// The build wrote outputs into the tree, which aren't changes
+		stamps = sourceStamps(dir)
+	}
+}
+
+// watchRebuild runs one rebuild of WatchBuild, holding the lock while it
+// changes the install
+func (i *Installer) watchRebuild(ctx context.Context, name string) error {
+	unlock, err := i.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	installed := i.State.Get(name)
+	if installed == nil {
+		return ErrNotInstalled
+	}
+	if installed.DevPath == "" {
+		return i.Update(ctx, name, InstallOptions{})
+	}
+	// The commands link into the working copy, building is all it takes
+	return i.build(ctx, i.buildRecipe(installed), installed.DevPath)
+}
@@ -0,0 +1,157 @@
+package installer
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+	"github.com/nurysso/binrex/pkg/manifest"
+)
+
+// wrapperMarker starts the second line of every generated wrapper
+const wrapperMarker = "# binrex wrapper"
+
+// wrappersDir keeps the wrapper scripts of one stored version, so use can
+// put them back into the bin dir
+func wrappersDir(versionDir string) string {
+	return filepath.Join(versionDir, ".wrappers")
+}
+
+// needsWrapper reports whether a package's binaries have to run through a
+// wrapper script setting up their environment
+func needsWrapper(pkg *manifest.Package) bool {
+	return (len(pkg.Env) > 0 || len(pkg.LibPaths) > 0) && runtime.GOOS != "windows"
+}
+
+// libraryPathVar is the variable the dynamic linker searches
+func libraryPathVar() string {
+	if runtime.GOOS == "darwin" {
+		return "DYLD_LIBRARY_PATH"
+	}
+	return "LD_LIBRARY_PATH"
+}
+
+// storeLibs copies a package's lib_paths from srcDir into the store
+func storeLibs(pkg *manifest.Package, srcDir, versionDir string) error {
+	for _, lib := range pkg.LibPaths {
+		if !filepath.IsLocal(lib) {
+			return fmt.Errorf("lib path %s is outside the package", lib)
+		}
+		if err := copyTree(filepath.Join(srcDir, lib), filepath.Join(versionDir, "lib", lib)); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", lib, err)
+		}
+	}
+	return nil
+}
+
+// copyTree copies a directory, keeping symlinks such as libfoo.so ->
+// libfoo.so.1 as they are
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0755)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			return fsutil.CopyFile(path, target)
+		}
+	})
+}
+
+// wrapperScript returns a script exporting a package's runtime environment
+// before running its stored binary. "{dir}" in env values is the store
+// directory of the version.
+func wrapperScript(pkg *manifest.Package, versionDir, binary string) string {
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`")
+
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&b, "%s for %s %s\n", wrapperMarker, pkg.Name, pkg.Version)
+
+	names := make([]string, 0, len(pkg.Env))
+	for name := range pkg.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := strings.ReplaceAll(pkg.Env[name], "{dir}", versionDir)
+		fmt.Fprintf(&b, "export %s=\"%s\"\n", name, quote.Replace(value))
+	}
+
+	if len(pkg.LibPaths) > 0 {
+		var dirs []string
+		for _, lib := range pkg.LibPaths {
+			dirs = append(dirs, filepath.Join(versionDir, "lib", lib))
+		}
+		v := libraryPathVar()
+		fmt.Fprintf(&b, "export %s=\"%s${%s:+:$%s}\"\n", v, quote.Replace(strings.Join(dirs, ":")), v, v)
+	}
+
+	fmt.Fprintf(&b, "exec \"%s\" \"$@\"\n", quote.Replace(filepath.Join(versionDir, binary)))
+	return b.String()
+}
+
+// writeWrapper stores the wrapper script of one binary next to it
+func writeWrapper(pkg *manifest.Package, versionDir, binary string) error {
+	if err := os.MkdirAll(wrappersDir(versionDir), 0755); err != nil {
+		return err
+	}
+	script := wrapperScript(pkg, versionDir, binary)
+	return os.WriteFile(filepath.Join(wrappersDir(versionDir), binary), []byte(script), 0755)
+}
+
+// linkEntry points a bin dir entry at a stored binary, copying in its
+// wrapper script instead when the version has one
+func linkEntry(versionDir, binary, link string) error {
+	wrapper := filepath.Join(wrappersDir(versionDir), binary)
+	if !fsutil.FileExists(wrapper) {
+		return linkBinary(filepath.Join(versionDir, binary), link)
+	}
+	return replaceEntry(link, func(tmp string) error {
+		return copyExecutable(wrapper, tmp)
+	})
+}
+
+// WrappedBinary returns the binary a bin dir entry runs: the stored binary
+// for a binrex wrapper script, the entry itself otherwise
+func WrappedBinary(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return path
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 0; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if n == 1 && !strings.HasPrefix(line, wrapperMarker) {
+			return path
+		}
+		if rest, ok := strings.CutPrefix(line, "exec \""); ok && n > 1 {
+			if binary, _, ok := strings.Cut(rest, "\" \"$@\""); ok {
+				return strings.NewReplacer(`\\`, `\`, `\"`, `"`, "\\`", "`").Replace(binary)
+			}
+		}
+	}
+	return path
+}
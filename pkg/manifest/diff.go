@@ -0,0 +1,57 @@
+package manifest
+
+import "sort"
+
+// VersionChange is a package whose version differs between two manifests
+type VersionChange struct {
+	Name string
+	From string
+	To   string
+}
+
+// Diff lists the differences between two manifests
+type Diff struct {
+	Added   []Package
+	Removed []Package
+	Changed []VersionChange
+}
+
+// Empty reports whether the manifests list the same packages and versions
+func (d *Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Compare returns what changed going from old to new. A nil old manifest
+// means every package is new.
+func Compare(old, new *Manifest) *Diff {
+	diff := &Diff{}
+
+	oldPackages := make(map[string]Package)
+	if old != nil {
+		for _, pkg := range old.Packages {
+			oldPackages[pkg.Name] = pkg
+		}
+	}
+	newPackages := make(map[string]Package)
+	for _, pkg := range new.Packages {
+		newPackages[pkg.Name] = pkg
+
+		prev, ok := oldPackages[pkg.Name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, pkg)
+		case prev.Version != pkg.Version:
+			diff.Changed = append(diff.Changed, VersionChange{Name: pkg.Name, From: prev.Version, To: pkg.Version})
+		}
+	}
+	for name, pkg := range oldPackages {
+		if _, ok := newPackages[name]; !ok {
+			diff.Removed = append(diff.Removed, pkg)
+		}
+	}
+
+	sort.Slice(diff.Added, func(a, b int) bool { return diff.Added[a].Name < diff.Added[b].Name })
+	sort.Slice(diff.Removed, func(a, b int) bool { return diff.Removed[a].Name < diff.Removed[b].Name })
+	sort.Slice(diff.Changed, func(a, b int) bool { return diff.Changed[a].Name < diff.Changed[b].Name })
+	return diff
+}
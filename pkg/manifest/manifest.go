@@ -0,0 +1,352 @@
+// Package manifest loads, searches and downloads the binrex package manifest.
+package manifest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/nurysso/binrex/internal/fetch"
+)
+
+// ErrNotFound is returned by Find for packages the manifest doesn't have
+var ErrNotFound = errors.New("not found")
+
+// Package types that copy files instead of building binaries
+const (
+	TypeScript = "script"
+	TypeAssets = "assets"
+)
+
+// Package represents a package in the manifest
+type Package struct {
+	Name          string            `json:"name"`
+	RepoURL       string            `json:"repo_url"`
+	SourceDir     string            `json:"source_dir"`   // Where to run build commands (where Cargo.toml/Makefile is)
+	BinPath       string            `json:"bin_path"`     // Optional: explicit path to binaries after build
+	BinaryNames   []string          `json:"binary_names"` // Binaries to install, also globs like "tool-*" or regexps like "/^tool-v[0-9.]+$/"
+	BinaryPaths   []string          `json:"binary_paths"` // Optional: globs relative to source_dir matching the built binaries, e.g. "out/*/tool"
+	Version       string            `json:"version"`
+	Description   string            `json:"description"`
+	Keywords      []string          `json:"keywords"`
+	OSSupported   string            `json:"os_supported"`
+	RequiredTools string            `json:"required_tools"`
+	BuildCommands string            `json:"build_commands"`
+	InstallSize   string            `json:"install_size"`
+	Mirrors       []string          `json:"mirrors"`             // Alternative clone URLs tried when repo_url fails
+	Submodules    bool              `json:"submodules"`          // Check out git submodules before building
+	ReleaseAsset  string            `json:"release_asset"`       // Install this GitHub release asset instead of building, e.g. "tool-{version}-{os}-{arch}.tar.gz"
+	ReleaseTag    string            `json:"release_tag"`         // Tag of the release to use (default: v{version})
+	URL           string            `json:"url"`                 // Direct archive or binary download instead of a repo, {version}, {os} and {arch} are filled in
+	SHA256        string            `json:"sha256"`              // Expected SHA256 of the url download
+	Checksums     string            `json:"checksums"`           // SHA256SUMS file listing the download, a URL or a release asset name
+	ChecksumsSig  string            `json:"checksums_signature"` // Detached GPG signature of the checksums file, a URL or a release asset name
+	SigningKeys   []string          `json:"signing_keys"`        // Fingerprints of the GPG keys the built commit, or a tag on it, must be signed by
+	License       string            `json:"license"`
+	Homepage      string            `json:"homepage"`
+	Maintainer    string            `json:"maintainer"`
+	DesktopFiles  []string          `json:"desktop_files"`        // .desktop files to install, relative to source_dir
+	Icons         []string          `json:"icons"`                // Icon files relative to source_dir, "path:name" installs under another name
+	BuildImage    string            `json:"build_image"`          // Container image for container builds
+	Services      []string          `json:"services"`             // systemd user units, relative to source_dir
+	PostInstall   string            `json:"post_install_message"` // Printed after a successful install
+	InstallDir    string            `json:"install_dir"`          // Link binaries here instead of the bin dir
+	BinaryAliases map[string]string `json:"binary_aliases"`       // Install a binary under another name, binary -> alias
+	Provides      []string          `json:"provides"`             // Shared command names, "name" or "name:binary"
+	Env           map[string]string `json:"env"`                  // Runtime environment set by a wrapper script, {dir} is the version's store dir
+	LibPaths      []string          `json:"lib_paths"`            // Library dirs relative to source_dir, kept in the store and added to the library path
+	Type          string            `json:"type"`                 // "script" or "assets" copies files instead of building, empty for binaries
+	Files         map[string]string `json:"files"`                // Files or globs relative to source_dir -> target dir, scripts default to the bin dir
+	Depends       []string          `json:"depends"`              // Names of the packages this one needs, shown by tree
+}
+
+// Manifest represents the manifest.json structure
+type Manifest struct {
+	// Version of the manifest itself, informational
+	Version  string    `json:"version,omitempty"`
+	Packages []Package `json:"packages"`
+	// Include lists more manifest files, relative to this one, such as
+	// "manifest.d/rust.json". They are merged in order after Packages.
+	Include []string `json:"include,omitempty"`
+}
+
+// Load loads a manifest.json file and merges the files it includes
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, include := range m.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		data, err := os.ReadFile(include)
+		if err != nil {
+			return nil, err
+		}
+		part, err := Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", include, err)
+		}
+		m.Merge(part)
+	}
+	m.Include = nil
+	return m, nil
+}
+
+// Parse parses manifest JSON
+func Parse(data []byte) (*Manifest, error) {
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+
+	return &manifest, nil
+}
+
+// Merge adds the packages of other to m. A package other defines under a
+// name m already has replaces m's definition in place, so the last file
+// merged wins.
+func (m *Manifest) Merge(other *Manifest) {
+	index := make(map[string]int, len(m.Packages))
+	for n, pkg := range m.Packages {
+		index[pkg.Name] = n
+	}
+
+	for _, pkg := range other.Packages {
+		if n, ok := index[pkg.Name]; ok {
+			m.Packages[n] = pkg
+			continue
+		}
+		index[pkg.Name] = len(m.Packages)
+		m.Packages = append(m.Packages, pkg)
+	}
+}
+
+// ResolveURL resolves an include relative to the URL of the manifest
+// naming it
+func ResolveURL(base, include string) string {
+	if strings.Contains(include, "://") {
+		return include
+	}
+	if n := strings.LastIndex(base, "/"); n >= 0 {
+		return base[:n+1] + include
+	}
+	return include
+}
+
+// Find finds a package in the manifest by name
+func (m *Manifest) Find(name string) (*Package, error) {
+	for _, pkg := range m.Packages {
+		if pkg.Name == name {
+			return &pkg, nil
+		}
+	}
+
+	return nil, fmt.Errorf("package '%s' %w", name, ErrNotFound)
+}
+
+// binaryRegexp returns the regular expression of a binary_names entry
+// written between slashes, like "/^tool-v[0-9.]+$/"
+func binaryRegexp(entry string) (*regexp.Regexp, bool, error) {
+	if len(entry) < 3 || !strings.HasPrefix(entry, "/") || !strings.HasSuffix(entry, "/") {
+		return nil, false, nil
+	}
+	re, err := regexp.Compile(entry[1 : len(entry)-1])
+	return re, true, err
+}
+
+// IsBinaryPattern reports whether a binary_names entry is a glob like
+// "tool-*" or a regular expression between slashes rather than a name
+func IsBinaryPattern(entry string) bool {
+	_, isRegexp, _ := binaryRegexp(entry)
+	return isRegexp || strings.ContainsAny(entry, "*?[")
+}
+
+// MatchBinaryName reports whether a file name matches a binary_names
+// entry: the name itself, a glob or a regular expression
+func MatchBinaryName(entry, name string) bool {
+	if re, isRegexp, err := binaryRegexp(entry); isRegexp {
+		return err == nil && re.MatchString(name)
+	}
+	if ok, err := filepath.Match(entry, name); err == nil && ok {
+		return true
+	}
+	return entry == name
+}
+
+// NormalizeFingerprint returns a GPG fingerprint in upper case without
+// spaces or a 0x prefix, as gpg prints them
+func NormalizeFingerprint(fingerprint string) string {
+	fingerprint = strings.Join(strings.Fields(fingerprint), "")
+	fingerprint = strings.TrimPrefix(strings.TrimPrefix(fingerprint, "0x"), "0X")
+	return strings.ToUpper(fingerprint)
+}
+
+// SupportsOS reports whether the package can be installed on the given OS
+func (p *Package) SupportsOS(osName string) bool {
+	return p.OSSupported == "all" || strings.Contains(p.OSSupported, osName)
+}
+
+// SearchOptions filter the results of Search
+type SearchOptions struct {
+	// Query is matched against name, description, keywords and license.
+	// An empty query matches everything.
+	Query string
+	// License restricts results to a single license (case-insensitive)
+	License string
+	// Keyword restricts results to packages with this keyword
+	Keyword string
+	// OS restricts results to packages supporting this OS
+	OS string
+	// RequiredTool restricts results to packages needing this tool
+	RequiredTool string
+}
+
+// HasKeyword reports whether the package has a keyword, ignoring case
+func (p *Package) HasKeyword(keyword string) bool {
+	for _, k := range p.Keywords {
+		if strings.EqualFold(strings.TrimSpace(k), keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiresTool reports whether required_tools lists a tool, ignoring any
+// version constraint
+func (p *Package) RequiresTool(tool string) bool {
+	for _, entry := range strings.Split(p.RequiredTools, ",") {
+		if n := strings.IndexAny(entry, "<>="); n >= 0 {
+			entry = entry[:n]
+		}
+		if strings.TrimSpace(entry) == tool {
+			return true
+		}
+	}
+	return false
+}
+
+// Search returns the packages matching opts
+func (m *Manifest) Search(opts SearchOptions) []Package {
+	query := strings.ToLower(opts.Query)
+
+	var results []Package
+	for _, pkg := range m.Packages {
+		if opts.License != "" && !strings.EqualFold(pkg.License, opts.License) {
+			continue
+		}
+		if opts.Keyword != "" && !pkg.HasKeyword(opts.Keyword) {
+			continue
+		}
+		if opts.OS != "" && !pkg.SupportsOS(strings.ToLower(opts.OS)) {
+			continue
+		}
+		if opts.RequiredTool != "" && !pkg.RequiresTool(opts.RequiredTool) {
+			continue
+		}
+
+		searchText := strings.ToLower(fmt.Sprintf("%s %s %s %s",
+			pkg.Name, pkg.Description, strings.Join(pkg.Keywords, " "), pkg.License))
+
+		if strings.Contains(searchText, query) {
+			results = append(results, pkg)
+		}
+	}
+
+	return results
+}
+
+// Categories groups packages by keyword. Keywords are compared case
+// insensitively and keyed in lower case.
+func (m *Manifest) Categories() map[string][]Package {
+	categories := make(map[string][]Package)
+	for _, pkg := range m.Packages {
+		seen := make(map[string]bool)
+		for _, keyword := range pkg.Keywords {
+			key := strings.ToLower(strings.TrimSpace(keyword))
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			categories[key] = append(categories[key], pkg)
+		}
+	}
+	return categories
+}
+
+// Download fetches the manifest, trying each URL in turn until one
+// succeeds. Failed attempts are reported to warn.
+func Download(ctx context.Context, urls []string, warn io.Writer) ([]byte, error) {
+	return DownloadVerified(ctx, urls, warn, nil)
+}
+
+// DownloadVerified is Download with a check of each downloaded manifest,
+// such as its signature. A URL whose check fails is skipped like an
+// unreachable one.
+func DownloadVerified(ctx context.Context, urls []string, warn io.Writer, verify func(url string, data []byte) error) ([]byte, error) {
+	var lastErr error
+
+	for _, url := range urls {
+		data, err := fetch.Get(ctx, url)
+		if err == nil && verify != nil {
+			err = verify(url, data)
+		}
+		if err == nil {
+			return data, nil
+		}
+
+		fmt.Fprintf(warn, "Warning: %v\n", err)
+		lastErr = err
+	}
+
+	return nil, fmt.Errorf("failed to download manifest from any mirror: %w", lastErr)
+}
+
+// PrintInfo writes the package details in the "Key: value" form used by
+// install and info
+func (p *Package) PrintInfo(w io.Writer) {
+	fmt.Fprintf(w, "Package: %s\n", p.Name)
+	fmt.Fprintf(w, "Version: %s\n", p.Version)
+	fmt.Fprintf(w, "Description: %s\n", p.Description)
+	fmt.Fprintf(w, "Repository: %s\n", p.RepoURL)
+	if p.Homepage != "" {
+		fmt.Fprintf(w, "Homepage: %s\n", p.Homepage)
+	}
+	if p.License != "" {
+		fmt.Fprintf(w, "License: %s\n", p.License)
+	}
+	if p.Maintainer != "" {
+		fmt.Fprintf(w, "Maintainer: %s\n", p.Maintainer)
+	}
+	fmt.Fprintf(w, "OS: %s\n", p.OSSupported)
+	if p.RequiredTools != "" {
+		fmt.Fprintf(w, "Required tools: %s\n", p.RequiredTools)
+	}
+	if len(p.Depends) > 0 {
+		fmt.Fprintf(w, "Depends on: %s\n", strings.Join(p.Depends, ", "))
+	}
+	if p.Type != "" {
+		fmt.Fprintf(w, "Type: %s\n", p.Type)
+	}
+	if len(p.BinaryNames) > 0 {
+		fmt.Fprintf(w, "Binaries: %s\n", strings.Join(p.BinaryNames, ", "))
+	}
+	if len(p.SigningKeys) > 0 {
+		fmt.Fprintf(w, "Signed by: %s\n", strings.Join(p.SigningKeys, ", "))
+	}
+	if len(p.Keywords) > 0 {
+		fmt.Fprintf(w, "Keywords: %s\n", strings.Join(p.Keywords, ", "))
+	}
+}
@@ -0,0 +1,292 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// namePattern matches the package names binrex accepts
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+
+// fingerprintPattern matches full v4 and v5 GPG fingerprints
+var fingerprintPattern = regexp.MustCompile(`^([0-9A-F]{40}|[0-9A-F]{64})$`)
+
+// Validate checks that a package has what installing it needs and that
+// its fields make sense together, reporting every problem at once
+func (p *Package) Validate() error {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if !namePattern.MatchString(p.Name) {
+		add("name %q must be letters, digits, '.', '_', '+' or '-'", p.Name)
+	}
+	if p.Version == "" {
+		add("version is required")
+	}
+	if p.OSSupported == "" {
+		add("os_supported is required, e.g. \"linux,mac\" or \"all\"")
+	}
+
+	switch {
+	case p.RepoURL == "" && p.URL == "":
+		add("repo_url or url is required")
+	case p.RepoURL != "" && p.URL != "":
+		add("repo_url and url can't both be set")
+	}
+
+	switch p.Type {
+	case "":
+		if p.RepoURL != "" && p.BuildCommands == "" {
+			add("build_commands is required to build from repo_url")
+		}
+	case TypeScript, TypeAssets:
+		if len(p.Files) == 0 {
+			add("%s packages need files", p.Type)
+		}
+		if p.RepoURL == "" {
+			add("%s packages need a repo_url", p.Type)
+		}
+	default:
+		add("unknown type %q", p.Type)
+	}
+
+	if p.SHA256 != "" && p.URL == "" {
+		add("sha256 only applies to url packages")
+	}
+	if p.ReleaseAsset != "" && p.RepoURL == "" {
+		add("release_asset needs a GitHub repo_url")
+	}
+	if len(p.SigningKeys) > 0 && p.RepoURL == "" {
+		add("signing_keys only apply to packages built from a repo_url")
+	}
+	for _, key := range p.SigningKeys {
+		if !fingerprintPattern.MatchString(NormalizeFingerprint(key)) {
+			add("signing key %q must be a full GPG fingerprint", key)
+		}
+	}
+
+	for _, dep := range p.Depends {
+		if !namePattern.MatchString(dep) || dep == p.Name {
+			add("depends %q must name another package", dep)
+		}
+	}
+
+	for field, paths := range map[string][]string{"source_dir": {p.SourceDir}, "bin_path": {p.BinPath}, "binary_paths": p.BinaryPaths, "lib_paths": p.LibPaths} {
+		for _, path := range paths {
+			if path != "" && !filepath.IsLocal(path) {
+				add("%s %q must be a relative path inside the repo", field, path)
+			}
+		}
+	}
+	for _, pattern := range p.BinaryPaths {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			add("binary_paths %q is not a valid glob", pattern)
+		}
+	}
+	for _, name := range p.BinaryNames {
+		if _, isRegexp, err := binaryRegexp(name); isRegexp {
+			if err != nil {
+				add("binary name %q is not a valid regular expression: %v", name, err)
+			}
+			continue
+		}
+		if name == "" || strings.ContainsAny(name, `/\`) {
+			add("binary name %q must be a plain file name, a glob or a /regexp/", name)
+		} else if _, err := filepath.Match(name, ""); err != nil {
+			add("binary name %q is not a valid glob", name)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("package %s: %s", p.Name, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// legacyFields are package fields of older manifests that binrex
+// ignores without warning
+var legacyFields = map[string]bool{
+	"binary_name":         true,
+	"binary_version":      true,
+	"Install_size":        true,
+	"total_bin_installed": true,
+}
+
+// ValidateSchema strictly checks a manifest file before it replaces the
+// local copy. It must be one complete JSON object whose fields have the
+// right types, with a packages list whose packages are named once, or
+// else it is rejected: a truncated download fails here instead of
+// breaking every command that reads the manifest later. Problems that
+// only affect single packages, such as a missing version or an unknown
+// field like "build_command", are returned as warnings, so manifests
+// written for newer binrex versions still sync.
+func ValidateSchema(data []byte) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var m Manifest
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("invalid manifest: unexpected data after the manifest object")
+	}
+	if m.Packages == nil && len(m.Include) == 0 {
+		return nil, errors.New("invalid manifest: no packages list")
+	}
+
+	var raw struct {
+		Packages []map[string]json.RawMessage `json:"packages"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	known, err := (&Package{}).fields()
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	seen := make(map[string]bool, len(m.Packages))
+	for n := range m.Packages {
+		pkg := &m.Packages[n]
+		if pkg.Name == "" {
+			return nil, fmt.Errorf("invalid manifest: package %d has no name", n+1)
+		}
+		if seen[pkg.Name] {
+			return nil, fmt.Errorf("invalid manifest: package %s is defined twice", pkg.Name)
+		}
+		seen[pkg.Name] = true
+
+		var unknown []string
+		for field := range raw.Packages[n] {
+			if _, ok := known[field]; !ok && !legacyFields[field] {
+				unknown = append(unknown, field)
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			warnings = append(warnings, fmt.Sprintf("package %s: unknown field(s) %s", pkg.Name, strings.Join(unknown, ", ")))
+		}
+		if err := pkg.Validate(); err != nil {
+			warnings = append(warnings, err.Error())
+		}
+	}
+	return warnings, nil
+}
+
+// fields returns the JSON fields of a package by name
+func (p *Package) fields() (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
+
+// CompactJSON returns the JSON of a package without its empty fields,
+// the others in manifest order
+func (p *Package) CompactJSON() (json.RawMessage, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.WriteByte('{')
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.Token()
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		switch string(value) {
+		case `""`, "null", "[]", "{}", "false":
+			continue
+		}
+		if out.Len() > 1 {
+			out.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		out.Write(name)
+		out.WriteByte(':')
+		out.Write(value)
+	}
+	out.WriteByte('}')
+	return out.Bytes(), nil
+}
+
+// AppendPackage adds the JSON of a package at the end of the packages list
+// of a manifest file, leaving the rest of its formatting as it is. It
+// refuses packages the manifest already has.
+func AppendPackage(data []byte, pkg *Package) ([]byte, error) {
+	compact, err := pkg.CompactJSON()
+	if err != nil {
+		return nil, err
+	}
+	var entry bytes.Buffer
+	if err := json.Indent(&entry, compact, "    ", "  "); err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, errors.New("manifest is not a JSON object")
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if key != "packages" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			return nil, errors.New("manifest packages is not a list")
+		}
+		first := true
+		for dec.More() {
+			var existing Package
+			if err := dec.Decode(&existing); err != nil {
+				return nil, err
+			}
+			if existing.Name == pkg.Name {
+				return nil, fmt.Errorf("the manifest already has a package %s", pkg.Name)
+			}
+			first = false
+		}
+
+		// The offset is past the whitespace before the closing bracket
+		at := dec.InputOffset()
+		for at > 0 && strings.ContainsRune(" \t\r\n", rune(data[at-1])) {
+			at--
+		}
+		insert := ",\n    " + entry.String()
+		if first {
+			insert = "\n    " + entry.String()
+		}
+		out := append([]byte{}, data[:at]...)
+		out = append(out, insert...)
+		return append(out, data[at:]...), nil
+	}
+	return nil, errors.New("manifest has no packages list")
+}
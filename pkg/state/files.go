@@ -0,0 +1,119 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+)
+
+// FileRecord is one file in the file list of an installed package, as
+// binrex left it
+type FileRecord struct {
+	Path   string `json:"path"`
+	Kind   string `json:"kind"`             // binary, store, file, desktop, icon or service
+	SHA256 string `json:"sha256,omitempty"` // Content of regular files
+	Link   string `json:"link,omitempty"`   // Target of symlinks
+}
+
+// Same reports whether two records describe the same content
+func (r FileRecord) Same(other FileRecord) bool {
+	return r.SHA256 == other.SHA256 && r.Link == other.Link
+}
+
+// FileChange is one line of the append-only file log
+type FileChange struct {
+	Time    string `json:"time"`
+	Action  string `json:"action"` // Operation that made the change, e.g. install or remove
+	Package string `json:"package"`
+	Change  string `json:"change"` // created, modified or deleted
+	Path    string `json:"path"`
+	Kind    string `json:"kind"`
+}
+
+// DiffFiles returns how the file list of a package went from before to
+// after. Files dropped from the list only count as deleted when exists
+// says they are gone, store entries stay behind for rollbacks.
+func DiffFiles(before, after []FileRecord, exists func(path string) bool) []FileChange {
+	old := make(map[string]FileRecord, len(before))
+	for _, record := range before {
+		old[record.Path] = record
+	}
+
+	var changes []FileChange
+	for _, record := range after {
+		prev, ok := old[record.Path]
+		delete(old, record.Path)
+		switch {
+		case !ok:
+			changes = append(changes, FileChange{Change: "created", Path: record.Path, Kind: record.Kind})
+		case !prev.Same(record):
+			changes = append(changes, FileChange{Change: "modified", Path: record.Path, Kind: record.Kind})
+		}
+	}
+	for _, record := range before {
+		if _, dropped := old[record.Path]; dropped && !exists(record.Path) {
+			changes = append(changes, FileChange{Change: "deleted", Path: record.Path, Kind: record.Kind})
+		}
+	}
+	return changes
+}
+
+// AppendFileChanges appends the changes one operation made to a package's
+// files to the file log
+func AppendFileChanges(path, action, pkg string, changes []FileChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	var lines []byte
+	now := time.Now().Format(time.RFC3339)
+	for _, change := range changes {
+		change.Time, change.Action, change.Package = now, action, pkg
+		data, err := json.Marshal(change)
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, data...), '\n')
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(lines)
+	return err
+}
+
+// ReadFileChanges reads the file log, optionally only for one package. A
+// missing log yields no entries.
+func ReadFileChanges(path, pkgName string) ([]FileChange, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var changes []FileChange
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		var change FileChange
+		if err := json.Unmarshal([]byte(line), &change); err != nil {
+			continue
+		}
+		if pkgName != "" && change.Package != pkgName {
+			continue
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,78 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+)
+
+// HistoryEntry is one line of the append-only history log
+type HistoryEntry struct {
+	Time    string `json:"time"`
+	Action  string `json:"action"`
+	Package string `json:"package,omitempty"`
+	Version string `json:"version,omitempty"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+// AppendHistory appends an operation and its outcome to the history log
+func AppendHistory(path, action, pkg, version string, opErr error) error {
+	entry := HistoryEntry{
+		Time:    time.Now().Format(time.RFC3339),
+		Action:  action,
+		Package: pkg,
+		Version: version,
+		Status:  "ok",
+	}
+	if opErr != nil {
+		entry.Status = "failed"
+		entry.Error = opErr.Error()
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// ReadHistory reads the history log, optionally only for one package. A
+// missing log yields no entries.
+func ReadHistory(path, pkgName string) ([]HistoryEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var entries []HistoryEntry
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		var entry HistoryEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			continue
+		}
+		if pkgName != "" && entry.Package != pkgName {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
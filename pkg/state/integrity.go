@@ -0,0 +1,86 @@
+package state
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+)
+
+// ErrModified is returned by CheckSeal for files that changed since binrex
+// last wrote them
+var ErrModified = errors.New("modified outside binrex")
+
+// SealPath returns the file recording the checksum of the file at path
+func SealPath(path string) string {
+	return path + ".sum"
+}
+
+// seal returns the checksum of data: an HMAC-SHA256 with key when there is
+// one, which can't be forged without the key, else a plain SHA-256
+func seal(data, key []byte) string {
+	if len(key) > 0 {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(data)
+		return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Seal records the checksum of data, just written to path by binrex
+func Seal(path string, data, key []byte) error {
+	return fsutil.WriteFileAtomic(SealPath(path), []byte(seal(data, key)+"\n"), 0644)
+}
+
+// CheckSeal reports whether data, read from path, is what binrex last
+// wrote there. Files without a seal yet pass. With a key the seal must be
+// an HMAC made with it, so a file and plain checksum written together
+// don't pass either.
+func CheckSeal(path string, data, key []byte) error {
+	recorded, err := os.ReadFile(SealPath(path))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	want := strings.TrimSpace(string(recorded))
+	switch kind, _, _ := strings.Cut(want, ":"); {
+	case kind == "hmac-sha256" && len(key) == 0:
+		return fmt.Errorf("%s is sealed with an integrity key, but none is configured", path)
+	case kind != "hmac-sha256" && len(key) > 0:
+		return fmt.Errorf("%s may have been %w, its checksum isn't sealed with the integrity key", path, ErrModified)
+	}
+	if !hmac.Equal([]byte(want), []byte(seal(data, key))) {
+		return fmt.Errorf("%s was %w, its checksum doesn't match", path, ErrModified)
+	}
+	return nil
+}
+
+// ReadKey reads an integrity key file, which must not be readable by
+// other users
+func ReadKey(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the integrity key: %w", err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("integrity key %s must only be readable by you (chmod 600)", path)
+	}
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the integrity key: %w", err)
+	}
+	key = []byte(strings.TrimSpace(string(key)))
+	if len(key) < 16 {
+		return nil, fmt.Errorf("integrity key %s is too short, use at least 16 characters", path)
+	}
+	return key, nil
+}
@@ -0,0 +1,49 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// errLocked is returned by openLocked when another process holds the lock
+var errLocked = errors.New("locked")
+
+// AcquireLock takes the binrex lock file so that only one process mutates
+// installed.json and the repo cache at a time. The lock is an advisory
+// lock held on the open file for as long as the command runs, so the
+// system drops it when a crashed run exits. The returned function
+// releases the lock.
+func AcquireLock(lockPath string) (func(), error) {
+	f, err := openLocked(lockPath)
+	if err != nil {
+		if !errors.Is(err, errLocked) {
+			return nil, fmt.Errorf("could not lock %s: %w", lockPath, err)
+		}
+		if pid := readLockPid(lockPath); pid > 0 {
+			return nil, fmt.Errorf("another binrex process (pid %d) is running", pid)
+		}
+		return nil, errors.New("another binrex process is running")
+	}
+
+	// The pid only tells other processes who holds the lock
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return func() { f.Close() }, nil
+}
+
+// readLockPid returns the pid recorded in the lock file, or 0
+func readLockPid(lockPath string) int {
+	data, err := os.ReadFile(lockPath)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
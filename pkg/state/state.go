@@ -0,0 +1,265 @@
+// Package state manages installed.json, the record of installed packages,
+// along with the lock file and history log that sit next to it.
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/nurysso/binrex/internal/fsutil"
+)
+
+// Backups is the number of rotated installed.json backups to keep
+const Backups = 5
+
+// InstalledPackage represents an installed package
+type InstalledPackage struct {
+	Name          string            `json:"name"`
+	Version       string            `json:"version"`
+	BinaryPaths   []string          `json:"binary_paths"`
+	RepoPath      string            `json:"repo_path"`
+	InstallDate   string            `json:"install_date"`
+	TotalBinaries int               `json:"total_binaries"`
+	Unmanaged     bool              `json:"unmanaged,omitempty"`      // Installed straight from a git URL, not from the manifest
+	RepoURL       string            `json:"repo_url,omitempty"`       // Source repository for unmanaged packages
+	BuildCommands string            `json:"build_commands,omitempty"` // Detected build command for unmanaged packages
+	BuildDir      string            `json:"build_dir,omitempty"`      // Build directory inside the repo for unmanaged packages
+	Commit        string            `json:"commit,omitempty"`         // Source commit the binaries were built from
+	DesktopFiles  []string          `json:"desktop_files,omitempty"`  // Installed .desktop entries
+	IconPaths     []string          `json:"icon_paths,omitempty"`     // Installed icons
+	ServiceUnits  []string          `json:"service_units,omitempty"`  // Installed systemd user units
+	Provenance    *Provenance       `json:"provenance,omitempty"`     // How the binaries were built
+	InstallDir    string            `json:"install_dir,omitempty"`    // Where the binaries are linked, when not the bin dir
+	BinaryAliases map[string]string `json:"binary_aliases,omitempty"` // Binaries installed under another name, binary -> alias
+	Provides      []string          `json:"provides,omitempty"`       // Shared command names the package can provide
+	Constraint    string            `json:"constraint,omitempty"`     // Version constraint the installed tag was resolved from, e.g. ^1.2
+	Asset         string            `json:"asset,omitempty"`          // Release asset URL the binaries came from, instead of a build
+	AssetSHA256   string            `json:"asset_sha256,omitempty"`   // SHA256 of the downloaded asset
+	Type          string            `json:"type,omitempty"`           // Package type, for script and assets packages
+	Files         []string          `json:"files,omitempty"`          // Files and dirs copied outside the bin dir
+	StorePath     string            `json:"store_path,omitempty"`     // Store entry the bin dir entries point into
+	DevPath       string            `json:"dev_path,omitempty"`       // Working copy the bin dir entries are linked into by dev link
+	FileList      []FileRecord      `json:"file_list,omitempty"`      // Every file binrex wrote for the package, as it wrote it
+}
+
+// Provenance records how an installed package was built
+type Provenance struct {
+	BuildCommand string            `json:"build_command"`         // Build command that was run
+	BuildImage   string            `json:"build_image,omitempty"` // Container image, for container builds
+	BuildHost    string            `json:"build_host,omitempty"`  // SSH host, for remote builds
+	Sandbox      string            `json:"sandbox,omitempty"`     // Sandbox tool, for sandboxed builds
+	NoNetwork    bool              `json:"no_network,omitempty"`  // Built without network after fetching dependencies
+	SignedBy     string            `json:"signed_by,omitempty"`   // Fingerprint of the key the built commit or tag was signed by
+	BuildSeconds float64           `json:"build_seconds"`         // Wall-clock build duration
+	OS           string            `json:"os"`                    // Builder OS
+	Arch         string            `json:"arch"`                  // Builder architecture
+	SHA256       map[string]string `json:"sha256"`                // SHA256 of each binary, by name
+}
+
+// InstalledData represents installed.json structure
+type InstalledData struct {
+	Installed []InstalledPackage `json:"installed"`
+	// Alternatives maps a provided command name to the package whose
+	// binary it currently links to
+	Alternatives map[string]string `json:"alternatives,omitempty"`
+	// Pins maps a package name to the commit or tag its installs and
+	// updates build, until it is unpinned
+	Pins map[string]string `json:"pins,omitempty"`
+}
+
+// Find returns the entry for a package, or nil
+func (d *InstalledData) Find(name string) *InstalledPackage {
+	for i, pkg := range d.Installed {
+		if pkg.Name == name {
+			return &d.Installed[i]
+		}
+	}
+	return nil
+}
+
+// Store reads and writes an installed.json file
+type Store struct {
+	Path string
+	// Warn receives the corrupted and modified state warnings, printed
+	// once
+	Warn io.Writer
+	// Key seals installed.json with an HMAC instead of a plain checksum
+	Key []byte
+
+	warned       bool
+	warnedSealed bool
+}
+
+// NewStore returns a Store for the installed.json at path
+func NewStore(path string, warn io.Writer) *Store {
+	return &Store{Path: path, Warn: warn}
+}
+
+// Load loads the installed.json file. A missing file is treated as an
+// empty install list, an unreadable or corrupted one is reported as an
+// error. A file changed outside binrex is loaded as it is, after a
+// warning.
+func (s *Store) Load() (*InstalledData, error) {
+	data, err := os.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return &InstalledData{Installed: []InstalledPackage{}}, nil
+	}
+	if err != nil {
+		return &InstalledData{Installed: []InstalledPackage{}}, fmt.Errorf("failed to read the state file: %w", err)
+	}
+	if err := CheckSeal(s.Path, data, s.Key); err != nil && !s.warnedSealed && s.Warn != nil {
+		fmt.Fprintf(s.Warn, "⚠ Warning: %v\n", err)
+		fmt.Fprintln(s.Warn, "  Check it, then run 'binrex verify-state --accept' to trust it or 'binrex restore-state' to go back to a backup.")
+		s.warnedSealed = true
+	}
+
+	var installed InstalledData
+	if err := json.Unmarshal(data, &installed); err != nil {
+		if !s.warned && s.Warn != nil {
+			fmt.Fprintf(s.Warn, "⚠ Warning: %s is corrupted: %v\n", s.Path, err)
+			fmt.Fprintln(s.Warn, "  binrex won't change it until it's fixed. Run 'binrex restore-state' to recover from a backup.")
+			s.warned = true
+		}
+		return &InstalledData{Installed: []InstalledPackage{}}, fmt.Errorf("corrupted state file: %w", err)
+	}
+
+	return &installed, nil
+}
+
+// Save saves the installed.json file, rotating backups first
+func (s *Store) Save(data *InstalledData) error {
+	jsonData, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.rotateBackups()
+	if err := fsutil.WriteFileAtomic(s.Path, jsonData, 0644); err != nil {
+		return err
+	}
+	return Seal(s.Path, jsonData, s.Key)
+}
+
+// Init creates an empty installed.json if it doesn't exist
+func (s *Store) Init() error {
+	if fsutil.FileExists(s.Path) {
+		return nil
+	}
+
+	data, _ := json.MarshalIndent(InstalledData{Installed: []InstalledPackage{}}, "", "  ")
+	if err := fsutil.WriteFileAtomic(s.Path, data, 0644); err != nil {
+		return err
+	}
+	return Seal(s.Path, data, s.Key)
+}
+
+// Accept seals installed.json as it is now, after a change outside binrex
+// was checked
+func (s *Store) Accept() error {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return err
+	}
+	return Seal(s.Path, data, s.Key)
+}
+
+// Get returns the entry for an installed package, or nil
+func (s *Store) Get(name string) *InstalledPackage {
+	data, _ := s.Load()
+	return data.Find(name)
+}
+
+// IsInstalled checks if a package is already installed
+func (s *Store) IsInstalled(name string) bool {
+	return s.Get(name) != nil
+}
+
+// Add records an entry in installed.json. An entry of the same name is
+// replaced in place, so an updated package swaps in with a single save.
+func (s *Store) Add(entry InstalledPackage) error {
+	data, err := s.Load()
+	if err != nil {
+		return err
+	}
+
+	if existing := data.Find(entry.Name); existing != nil {
+		*existing = entry
+		return s.Save(data)
+	}
+	data.Installed = append(data.Installed, entry)
+	return s.Save(data)
+}
+
+// BackupPath returns the path of the n-th installed.json backup
+func (s *Store) BackupPath(n int) string {
+	return fmt.Sprintf("%s.%d", s.Path, n)
+}
+
+// rotateBackups shifts installed.json.1..N and copies the current state
+// into installed.json.1. A corrupted state file is kept aside as
+// installed.json.corrupt instead so it never pushes out a good backup.
+func (s *Store) rotateBackups() {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return
+	}
+
+	if !json.Valid(data) {
+		fsutil.WriteFileAtomic(s.Path+".corrupt", data, 0644)
+		return
+	}
+
+	for i := Backups - 1; i >= 1; i-- {
+		if fsutil.FileExists(s.BackupPath(i)) {
+			os.Rename(s.BackupPath(i), s.BackupPath(i+1))
+		}
+	}
+
+	fsutil.WriteFileAtomic(s.BackupPath(1), data, 0644)
+}
+
+// Restore replaces installed.json with a backup. With n == 0 the newest
+// backup that parses correctly is used. It returns the backup used and the
+// restored data.
+func (s *Store) Restore(n int) (string, *InstalledData, error) {
+	candidates := []int{n}
+	if n == 0 {
+		candidates = nil
+		for i := 1; i <= Backups; i++ {
+			candidates = append(candidates, i)
+		}
+	}
+
+	for _, i := range candidates {
+		data, err := os.ReadFile(s.BackupPath(i))
+		if err != nil {
+			continue
+		}
+
+		var installed InstalledData
+		if err := json.Unmarshal(data, &installed); err != nil {
+			if s.Warn != nil {
+				fmt.Fprintf(s.Warn, "Skipping corrupted backup: %s\n", s.BackupPath(i))
+			}
+			continue
+		}
+
+		// Keep whatever is there now, just in case
+		if current, err := os.ReadFile(s.Path); err == nil {
+			fsutil.WriteFileAtomic(s.Path+".pre-restore", current, 0644)
+		}
+
+		if err := fsutil.WriteFileAtomic(s.Path, data, 0644); err != nil {
+			return "", nil, fmt.Errorf("failed to restore state: %w", err)
+		}
+		if err := Seal(s.Path, data, s.Key); err != nil {
+			return "", nil, fmt.Errorf("failed to restore state: %w", err)
+		}
+
+		return s.BackupPath(i), &installed, nil
+	}
+
+	return "", nil, fmt.Errorf("no usable backup found")
+}